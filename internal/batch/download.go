@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"ya-music/utils"
 	"ya-music/ya"
 	"ya-music/ya/model"
 )
@@ -21,14 +23,22 @@ const (
 	StatusDone        Status = "done"
 	StatusSkipped     Status = "skipped"
 	StatusError       Status = "error"
+	// StatusProgress events report the bytes of a track being downloaded.
+	// They are sent only when Config.Progress is set.
+	StatusProgress Status = "progress"
 )
 
+// ProgressInterval is the minimum time between two progress events of a
+// track.
+const ProgressInterval = 250 * time.Millisecond
+
 type Container string
 
 const (
 	ContainerMP3  Container = "mp3"
 	ContainerFLAC Container = "flac"
 	ContainerM4A  Container = "m4a"
+	ContainerOpus Container = "opus"
 )
 
 const (
@@ -42,11 +52,26 @@ type Event struct {
 	Track  model.Track
 	Status Status
 	Format Container
+	Path   string
 	Reason string
+	// Stage names the download stage that failed for error events, if known.
+	Stage string
+	// Err is the failure of error events. ya.Classify tells its class, such
+	// as ya.ErrAuthExpired.
+	Err error
+	// Bytes and TotalBytes are set on progress events. TotalBytes is -1 when
+	// the size is unknown.
+	Bytes      int64
+	TotalBytes int64
+}
+
+// Terminal reports whether e is the final event of its track.
+func (e Event) Terminal() bool {
+	return e.Status != StatusDownloading && e.Status != StatusProgress
 }
 
 type trackDownloader interface {
-	DownloadTrackWithOptions(model.Track, string, ya.DownloadOptions) (string, error)
+	DownloadTrackWithOptionsContext(context.Context, model.Track, string, ya.DownloadOptions) (string, error)
 }
 
 type Config struct {
@@ -55,7 +80,14 @@ type Config struct {
 	OutputDir   string
 	Options     ya.DownloadOptions
 	Concurrency int
-	Context     context.Context
+	// Context stops scheduling tracks when done; started tracks finish.
+	Context context.Context
+	// DownloadContext cancels the downloads in flight when done. Nil means
+	// they always finish.
+	DownloadContext context.Context
+	// Progress enables StatusProgress events between the downloading and the
+	// final event of each track.
+	Progress bool
 }
 
 // Run downloads all eligible tracks and reports immutable lifecycle events.
@@ -65,6 +97,10 @@ func Run(config Config) <-chan Event {
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	downloadCtx := config.DownloadContext
+	if downloadCtx == nil {
+		downloadCtx = context.Background()
+	}
 	concurrency := config.Concurrency
 	if concurrency <= 0 {
 		concurrency = DefaultConcurrency
@@ -75,6 +111,10 @@ func Run(config Config) <-chan Event {
 
 		seenIDs := make(map[string]struct{}, len(config.Tracks))
 		suffixes := filenameSuffixes(config.Tracks)
+		var albumLoudness map[string]model.R128
+		if config.Options.ReplayGain {
+			albumLoudness = ya.AlbumLoudness(config.Tracks)
+		}
 		sem := make(chan struct{}, concurrency)
 		var workers sync.WaitGroup
 
@@ -114,6 +154,9 @@ func Run(config Config) <-chan Event {
 
 			options := config.Options
 			options.FilenameSuffix = suffixes[position]
+			if albumLoudness != nil {
+				options.AlbumLoudness = ya.AlbumLoudnessFor(albumLoudness, track)
+			}
 
 			workers.Add(1)
 			go func(event Event, options ya.DownloadOptions) {
@@ -123,6 +166,7 @@ func Run(config Config) <-chan Event {
 					if recovered := recover(); recovered != nil {
 						event.Status = StatusError
 						event.Reason = fmt.Sprintf("panic: %v", recovered)
+						event.Err = errors.New(event.Reason)
 						events <- event
 					}
 				}()
@@ -133,18 +177,25 @@ func Run(config Config) <-chan Event {
 
 				event.Status = StatusDownloading
 				events <- event
+				if config.Progress {
+					options.Progress = progressReporter(event, events)
+				}
 
-				filename, err := config.Client.DownloadTrackWithOptions(event.Track, config.OutputDir, options)
+				filename, err := config.Client.DownloadTrackWithOptionsContext(downloadCtx, event.Track, config.OutputDir, options)
 				if errors.Is(err, ya.ErrTrackAlreadyExists) {
 					event.Status = StatusSkipped
 					event.Reason = SkipAlreadyExists
 					event.Format = formatFromFilename(filename)
+					event.Path = filename
 				} else if err != nil {
 					event.Status = StatusError
 					event.Reason = err.Error()
+					event.Stage = ya.FailureStage(err)
+					event.Err = err
 				} else {
 					event.Status = StatusDone
 					event.Format = formatFromFilename(filename)
+					event.Path = filename
 				}
 				events <- event
 			}(event, options)
@@ -156,6 +207,24 @@ func Run(config Config) <-chan Event {
 	return events
 }
 
+// progressReporter sends progress events for event, at most one per
+// ProgressInterval apart from the last one of each download.
+func progressReporter(event Event, events chan<- Event) utils.ProgressFunc {
+	var last time.Time
+	return func(written, total int64) {
+		now := time.Now()
+		if written != total && now.Sub(last) < ProgressInterval {
+			return
+		}
+		last = now
+		progress := event
+		progress.Status = StatusProgress
+		progress.Bytes = written
+		progress.TotalBytes = total
+		events <- progress
+	}
+}
+
 func filenameSuffixes(tracks []model.Track) []string {
 	idsByFilenameKey := make(map[string]map[string]struct{}, len(tracks))
 	for _, track := range tracks {
@@ -182,7 +251,12 @@ func formatFromFilename(filename string) Container {
 		return ContainerFLAC
 	case ".m4a", ".mp4":
 		return ContainerM4A
-	default:
+	case ".opus":
+		return ContainerOpus
+	case "", ".mp3":
 		return ContainerMP3
+	default:
+		// Transcode profiles may produce other containers.
+		return Container(strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), "."))
 	}
 }
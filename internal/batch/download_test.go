@@ -23,7 +23,7 @@ type fakeResult struct {
 	err      error
 }
 
-func (c fakeClient) DownloadTrackWithOptions(track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
+func (c fakeClient) DownloadTrackWithOptionsContext(_ context.Context, track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
 	result := c.results[track.ID.String()]
 	return result.filename, result.err
 }
@@ -32,7 +32,7 @@ func TestRunReportsTrackLifecycleAndContinuesAfterErrors(t *testing.T) {
 	events := collect(Run(Config{
 		Client: fakeClient{results: map[string]fakeResult{
 			"1": {filename: "first.mp3"},
-			"2": {err: errors.New("access denied")},
+			"2": {err: &ya.StageError{Stage: "download_link", Kind: ya.ErrRegionBlocked, Err: errors.New("access denied")}},
 		}},
 		Tracks: []model.Track{
 			{ID: "1", Title: "First", Available: true},
@@ -45,9 +45,12 @@ func TestRunReportsTrackLifecycleAndContinuesAfterErrors(t *testing.T) {
 	assert.Equal(t, StatusDownloading, findEvent(t, events, 1, StatusDownloading).Status)
 	done := findEvent(t, events, 1, StatusDone)
 	assert.Equal(t, ContainerMP3, done.Format)
+	assert.Equal(t, "first.mp3", done.Path)
 	assert.Equal(t, StatusDownloading, findEvent(t, events, 2, StatusDownloading).Status)
 	failed := findEvent(t, events, 2, StatusError)
 	assert.Equal(t, "access denied", failed.Reason)
+	assert.Equal(t, "download_link", failed.Stage)
+	assert.ErrorIs(t, failed.Err, ya.ErrRegionBlocked)
 }
 
 func TestRunSkipsUnavailableDuplicatesAndExistingFiles(t *testing.T) {
@@ -80,7 +83,7 @@ type recordingClient struct {
 	downloads []recordedDownload
 }
 
-func (c *recordingClient) DownloadTrackWithOptions(track model.Track, _ string, options ya.DownloadOptions) (string, error) {
+func (c *recordingClient) DownloadTrackWithOptionsContext(_ context.Context, track model.Track, _ string, options ya.DownloadOptions) (string, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.downloads = append(c.downloads, recordedDownload{id: track.ID.String(), options: options})
@@ -148,6 +151,41 @@ func TestRunDeduplicatesOnlyIDsAndSuffixesFilenameCollisions(t *testing.T) {
 	assert.Equal(t, SkipDuplicate, findEvent(t, events, 3, StatusSkipped).Reason)
 }
 
+func TestRunPassesAlbumLoudnessOnlyForCompleteAlbums(t *testing.T) {
+	albumTrack := func(id, albumID string, trackCount int) model.Track {
+		return model.Track{
+			ID:         model.FlexibleID(id),
+			Available:  true,
+			DurationMs: 1000,
+			R128:       &model.R128{Integrated: -10, TruePeak: -1},
+			Albums:     []model.Album{{ID: model.FlexibleID(albumID), TrackCount: trackCount}},
+		}
+	}
+	tracks := []model.Track{
+		albumTrack("1", "complete", 2),
+		albumTrack("2", "complete", 2),
+		albumTrack("3", "partial", 5),
+	}
+
+	client := &recordingClient{}
+	collect(Run(Config{
+		Client:      client,
+		Tracks:      tracks,
+		Options:     ya.DownloadOptions{ReplayGain: true},
+		Concurrency: 1,
+	}))
+
+	downloads := client.downloadsByID()
+	require.NotNil(t, downloads["1"].options.AlbumLoudness)
+	assert.InDelta(t, -10.0, downloads["1"].options.AlbumLoudness.Integrated, 1e-9)
+	require.NotNil(t, downloads["2"].options.AlbumLoudness)
+	assert.Nil(t, downloads["3"].options.AlbumLoudness)
+
+	client = &recordingClient{}
+	collect(Run(Config{Client: client, Tracks: tracks, Concurrency: 1}))
+	assert.Nil(t, client.downloadsByID()["1"].options.AlbumLoudness)
+}
+
 type blockingClient struct {
 	started chan string
 	release chan struct{}
@@ -155,7 +193,7 @@ type blockingClient struct {
 	called  []string
 }
 
-func (c *blockingClient) DownloadTrackWithOptions(track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
+func (c *blockingClient) DownloadTrackWithOptionsContext(_ context.Context, track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
 	c.mu.Lock()
 	c.called = append(c.called, track.ID.String())
 	c.mu.Unlock()
@@ -202,11 +240,42 @@ func TestRunStopsSchedulingTracksWhenContextIsCancelled(t *testing.T) {
 	assert.Equal(t, []string{"1"}, client.calls())
 }
 
+type contextClient struct {
+	started chan struct{}
+}
+
+func (c contextClient) DownloadTrackWithOptionsContext(ctx context.Context, _ model.Track, _ string, _ ya.DownloadOptions) (string, error) {
+	close(c.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestRunCancelsInFlightDownloadsThroughDownloadContext(t *testing.T) {
+	downloadCtx, cancelDownloads := context.WithCancel(context.Background())
+	defer cancelDownloads()
+	client := contextClient{started: make(chan struct{})}
+
+	events := Run(Config{
+		Client:          client,
+		Tracks:          []model.Track{{ID: "1", Title: "First", Available: true}},
+		DownloadContext: downloadCtx,
+	})
+
+	assert.Equal(t, StatusDownloading, (<-events).Status)
+	<-client.started
+	cancelDownloads()
+
+	remaining := collect(events)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, StatusError, remaining[0].Status)
+	assert.ErrorIs(t, remaining[0].Err, context.Canceled)
+}
+
 type panicClient struct {
 	results map[string]fakeResult
 }
 
-func (c panicClient) DownloadTrackWithOptions(track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
+func (c panicClient) DownloadTrackWithOptionsContext(_ context.Context, track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
 	if track.ID.String() == "1" {
 		panic("boom")
 	}
@@ -233,6 +302,42 @@ func TestRunRecoversWorkerPanicAndContinues(t *testing.T) {
 	assert.Equal(t, ContainerMP3, done.Format)
 }
 
+type progressClient struct{}
+
+func (progressClient) DownloadTrackWithOptionsContext(_ context.Context, track model.Track, _ string, options ya.DownloadOptions) (string, error) {
+	if options.Progress != nil {
+		options.Progress(0, 100)
+		options.Progress(40, 100)
+		options.Progress(100, 100)
+	}
+	return track.ID.String() + ".mp3", nil
+}
+
+func TestRunReportsThrottledProgressOnlyWhenEnabled(t *testing.T) {
+	tracks := []model.Track{{ID: "1", Title: "First", Available: true}}
+
+	events := collect(Run(Config{Client: progressClient{}, Tracks: tracks, Progress: true}))
+
+	require.Len(t, events, 4)
+	assert.Equal(t, []Status{StatusDownloading, StatusProgress, StatusProgress, StatusDone}, statuses(events))
+	assert.Equal(t, int64(0), events[1].Bytes)
+	assert.Equal(t, int64(100), events[2].Bytes)
+	assert.Equal(t, int64(100), events[2].TotalBytes)
+	assert.False(t, events[2].Terminal())
+	assert.True(t, events[3].Terminal())
+
+	events = collect(Run(Config{Client: progressClient{}, Tracks: tracks}))
+	assert.Equal(t, []Status{StatusDownloading, StatusDone}, statuses(events))
+}
+
+func statuses(events []Event) []Status {
+	result := make([]Status, 0, len(events))
+	for _, event := range events {
+		result = append(result, event.Status)
+	}
+	return result
+}
+
 func collect(events <-chan Event) []Event {
 	var result []Event
 	for event := range events {
@@ -11,6 +11,8 @@ func TestFormatFromFilename(t *testing.T) {
 		{filename: "track.flac", want: ContainerFLAC},
 		{filename: "track.m4a", want: ContainerM4A},
 		{filename: "track.mp4", want: ContainerM4A},
+		{filename: "track.opus", want: ContainerOpus},
+		{filename: "track.OGG", want: Container("ogg")},
 		{filename: "track", want: ContainerMP3},
 		{filename: "", want: ContainerMP3},
 	}
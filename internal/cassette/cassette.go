@@ -0,0 +1,142 @@
+// Package cassette records HTTP traffic to a directory and serves it back,
+// so a failing run can be reproduced offline.
+//
+// Each request is saved as one JSON file named after its sequence number.
+// Tokens, cookies and URL signatures are redacted before anything is
+// written, and binary bodies such as audio and covers are cut to
+// MaxBinaryBody bytes. Replay pads a cut body with zeros back to its
+// recorded size, so sizes and progress match while the audio itself is
+// not playable.
+package cassette
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MaxBinaryBody is how much of a non-text response body is kept.
+	MaxBinaryBody = 64 << 10
+
+	redacted  = "REDACTED"
+	extension = ".json"
+)
+
+// Interaction is one recorded request and its outcome.
+type Interaction struct {
+	Seq      int       `json:"seq"`
+	Request  Request   `json:"request"`
+	Response *Response `json:"response,omitempty"`
+	// Error is the transport error returned instead of a response.
+	Error string `json:"error,omitempty"`
+}
+
+// Request is a redacted request.
+type Request struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// Response is a redacted response. Text bodies are kept in Body, binary ones
+// in BodyBase64.
+type Response struct {
+	Status     int         `json:"status"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 []byte      `json:"body_base64,omitempty"`
+	// Size is the full body length, which exceeds the kept bytes when
+	// Truncated is set.
+	Size      int64 `json:"size"`
+	Truncated bool  `json:"truncated,omitempty"`
+	// ReadError is the error that interrupted reading the body.
+	ReadError string `json:"read_error,omitempty"`
+}
+
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// sensitiveParams are query parameters that carry credentials or request
+// signatures.
+var sensitiveParams = []string{"sign", "ts", "token", "access_token", "oauth_token"}
+
+var sensitiveParamPattern = regexp.MustCompile(`([?&]|\\u0026)(` + strings.Join(sensitiveParams, "|") + `)=[^&"'<\s\\]*`)
+
+// redactURL removes credentials and signatures from u. It is applied to both
+// recorded and replayed requests, so it also serves as the match key.
+func redactURL(u *url.URL) string {
+	redactedURL := *u
+	redactedURL.User = nil
+
+	if query := redactedURL.Query(); len(query) > 0 {
+		changed := false
+		for _, param := range sensitiveParams {
+			if query.Has(param) {
+				query.Set(param, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			redactedURL.RawQuery = query.Encode()
+		}
+	}
+
+	// MP3 links are /get-mp3/<sign>/<ts>/<path>.
+	segments := strings.Split(redactedURL.Path, "/")
+	if len(segments) > 3 && segments[1] == "get-mp3" {
+		segments[2], segments[3] = redacted, redacted
+		redactedURL.Path = strings.Join(segments, "/")
+		redactedURL.RawPath = ""
+	}
+
+	return redactedURL.String()
+}
+
+// redactText removes signed URL parameters from a text body, such as links
+// the API hands out for later requests.
+func redactText(body string) string {
+	return sensitiveParamPattern.ReplaceAllString(body, "$1$2="+redacted)
+}
+
+func redactRequestHeaders(headers http.Header) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	redactedHeaders := make(map[string]string, len(headers))
+	for key, values := range headers {
+		redactedHeaders[key] = strings.Join(values, ", ")
+	}
+	for _, key := range sensitiveHeaders {
+		if headers.Get(key) != "" {
+			redactedHeaders[http.CanonicalHeaderKey(key)] = redacted
+		}
+	}
+	return redactedHeaders
+}
+
+func redactResponseHeaders(headers http.Header) http.Header {
+	redactedHeaders := headers.Clone()
+	for _, key := range sensitiveHeaders {
+		if redactedHeaders.Get(key) != "" {
+			redactedHeaders.Set(key, redacted)
+		}
+	}
+	// The replayed length is set from Size.
+	redactedHeaders.Del("Content-Length")
+	return redactedHeaders
+}
+
+// isText reports whether a body of contentType is kept whole and redacted.
+func isText(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") ||
+		strings.Contains(contentType, "x-www-form-urlencoded")
+}
+
+func matchKey(method, redactedURL, body string) string {
+	return method + " " + redactedURL + "\n" + body
+}
@@ -0,0 +1,129 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Player is a transport that answers requests from a recorded cassette
+// without touching the network. Requests match on method, redacted URL and
+// body; repeated requests get the recorded answers in their original order.
+type Player struct {
+	mu      sync.Mutex
+	pending map[string][]Interaction
+}
+
+// NewPlayer loads the cassette recorded in dir.
+func NewPlayer(dir string) (*Player, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+extension))
+	if err != nil {
+		return nil, fmt.Errorf("read cassette directory: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no cassette found in %s", dir)
+	}
+
+	interactions := make([]Interaction, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read cassette: %w", err)
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(data, &interaction); err != nil {
+			return nil, fmt.Errorf("parse cassette %s: %w", filepath.Base(path), err)
+		}
+		interactions = append(interactions, interaction)
+	}
+	slices.SortFunc(interactions, func(a, b Interaction) int { return a.Seq - b.Seq })
+
+	pending := make(map[string][]Interaction)
+	for _, interaction := range interactions {
+		key := matchKey(interaction.Request.Method, interaction.Request.URL, interaction.Request.Body)
+		pending[key] = append(pending[key], interaction)
+	}
+	return &Player{pending: pending}, nil
+}
+
+func (p *Player) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := redactText(requestBody(req))
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	redactedURL := redactURL(req.URL)
+	key := matchKey(req.Method, redactedURL, body)
+	p.mu.Lock()
+	queue := p.pending[key]
+	if len(queue) == 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("cassette has no recorded response for %s %s", req.Method, redactedURL)
+	}
+	interaction := queue[0]
+	p.pending[key] = queue[1:]
+	p.mu.Unlock()
+
+	if interaction.Error != "" {
+		return nil, errors.New(interaction.Error)
+	}
+	if interaction.Response == nil {
+		return nil, fmt.Errorf("cassette entry %d has no response", interaction.Seq)
+	}
+	return interaction.Response.httpResponse(req), nil
+}
+
+func (r *Response) httpResponse(req *http.Request) *http.Response {
+	kept := []byte(r.Body)
+	if r.BodyBase64 != nil {
+		kept = r.BodyBase64
+	}
+	var body io.Reader = bytes.NewReader(kept)
+	if padding := r.Size - int64(len(kept)); padding > 0 {
+		body = io.MultiReader(body, io.LimitReader(zeroReader{}, padding))
+	}
+	if r.ReadError != "" {
+		body = io.MultiReader(body, errorReader{errors.New(r.ReadError)})
+	}
+
+	headers := r.Headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("Content-Length", strconv.FormatInt(r.Size, 10))
+	return &http.Response{
+		Status:        strconv.Itoa(r.Status) + " " + http.StatusText(r.Status),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          io.NopCloser(body),
+		ContentLength: r.Size,
+		Request:       req,
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+type errorReader struct{ err error }
+
+func (r errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,174 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// Recorder is a transport that saves every exchange of next to a directory.
+// Response bodies are streamed through unchanged; an exchange is written once
+// its body is read to the end or closed.
+type Recorder struct {
+	dir  string
+	next http.RoundTripper
+	seq  atomic.Int64
+	// OnSaveError, when set, is called for every exchange that could not be
+	// saved. The request itself is not affected.
+	OnSaveError func(error)
+
+	mu      sync.Mutex
+	saveErr error
+}
+
+// NewRecorder records the traffic of next into dir, which is created when
+// missing. A directory that already holds a cassette is refused so two runs
+// are never mixed.
+func NewRecorder(dir string, next http.RoundTripper) (*Recorder, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cassette directory: %w", err)
+	}
+	existing, err := filepath.Glob(filepath.Join(dir, "*"+extension))
+	if err != nil {
+		return nil, fmt.Errorf("read cassette directory: %w", err)
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("cassette directory %s is not empty", dir)
+	}
+	return &Recorder{dir: dir, next: next}, nil
+}
+
+// Err returns the first error met while saving an exchange.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.saveErr
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	interaction := Interaction{
+		Seq: int(r.seq.Add(1)),
+		Request: Request{
+			Method:  req.Method,
+			URL:     redactURL(req.URL),
+			Headers: redactRequestHeaders(req.Header),
+			Body:    redactText(requestBody(req)),
+		},
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		interaction.Error = err.Error()
+		r.save(interaction)
+		return nil, err
+	}
+
+	interaction.Response = &Response{
+		Status:  resp.StatusCode,
+		Headers: redactResponseHeaders(resp.Header),
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		text:       isText(resp.Header.Get("Content-Type")),
+		finish: func(body *recordingBody) {
+			interaction.Response.Size = body.size
+			interaction.Response.Truncated = body.size > int64(body.kept.Len())
+			if body.readErr != nil {
+				interaction.Response.ReadError = body.readErr.Error()
+			}
+			if body.text {
+				interaction.Response.Body = redactText(body.kept.String())
+				interaction.Response.Size = int64(len(interaction.Response.Body))
+			} else {
+				interaction.Response.BodyBase64 = body.kept.Bytes()
+			}
+			r.save(interaction)
+		},
+	}
+	return resp, nil
+}
+
+func (r *Recorder) save(interaction Interaction) {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err == nil {
+		path := filepath.Join(r.dir, fmt.Sprintf("%05d%s", interaction.Seq, extension))
+		err = os.WriteFile(path, append(data, '\n'), 0o644)
+	}
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("save cassette: %w", err)
+	r.mu.Lock()
+	if r.saveErr == nil {
+		r.saveErr = err
+	}
+	r.mu.Unlock()
+	if r.OnSaveError != nil {
+		r.OnSaveError(err)
+	}
+}
+
+// requestBody reads the body of req without consuming it. Requests without
+// GetBody are recorded without a body.
+func requestBody(req *http.Request) string {
+	if req.Body == nil || req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// recordingBody keeps a copy of what is read through it and calls finish
+// once, at the end of the body or when it is closed.
+type recordingBody struct {
+	io.ReadCloser
+	text    bool
+	kept    bytes.Buffer
+	size    int64
+	readErr error
+	once    sync.Once
+	finish  func(*recordingBody)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.size += int64(n)
+		keep := n
+		if !b.text {
+			keep = min(n, max(0, MaxBinaryBody-b.kept.Len()))
+		}
+		b.kept.Write(p[:keep])
+	}
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			b.readErr = err
+		}
+		b.once.Do(func() { b.finish(b) })
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.finish(b) })
+	return err
+}
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"ya-music/utils"
+)
+
+// accountFlags select a named account from the accounts file instead of
+// passing --token.
+type accountFlags struct {
+	account string
+}
+
+func registerAccountFlags(fs *flag.FlagSet, dest *accountFlags) {
+	fs.StringVar(&dest.account, "account", "", "use the token and default output directory of a named account from "+utils.AccountsFileName+" (see 'yamdl accounts')")
+}
+
+// applyAccount fills token from --account when --token is not given. When
+// output is not nil and --output was not set, the account's output directory
+// replaces the default.
+func applyAccount(f accountFlags, fs *flag.FlagSet, token, output *string) error {
+	*token = strings.TrimSpace(*token)
+	name := strings.TrimSpace(f.account)
+	if name == "" {
+		if *token == "" {
+			return errors.New("--token is required")
+		}
+		return nil
+	}
+	if *token != "" {
+		return errors.New("--token cannot be combined with --account")
+	}
+	account, err := loadAccount(name)
+	if err != nil {
+		return err
+	}
+	*token = account.Token
+	if output != nil && account.OutputDir != "" && !isFlagSet(fs, "output") {
+		*output = account.OutputDir
+	}
+	return nil
+}
+
+func loadAccount(name string) (utils.StoredAccount, error) {
+	store, err := utils.LoadTokenStore(utils.AccountsFileName)
+	if err != nil {
+		return utils.StoredAccount{}, err
+	}
+	account, ok := store.Account(name)
+	if !ok {
+		return utils.StoredAccount{}, fmt.Errorf("account %q not found; add it with 'yamdl accounts add %s --token TOKEN'", name, name)
+	}
+	return account, nil
+}
+
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+type accountsAddOptions struct {
+	name   string
+	token  string
+	output string
+	sharedFlags
+}
+
+func runAccounts(args []string, stdout, stderr io.Writer) int {
+	command := "list"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "list":
+		if len(args) != 0 {
+			fmt.Fprintln(stderr, "accounts list does not accept arguments")
+			return 2
+		}
+		return listAccounts(stdout, stderr)
+	case "add":
+		parsed := parseAccountsAddOptions(args, stderr)
+		if !parsed.proceed {
+			return parsed.exitCode
+		}
+		return addAccount(parsed.options, stdout, stderr)
+	case "remove":
+		if len(args) != 1 {
+			fmt.Fprintln(stderr, "Usage: yamdl accounts remove NAME")
+			return 2
+		}
+		return removeAccount(strings.TrimSpace(args[0]), stdout, stderr)
+	default:
+		fmt.Fprintln(stderr, "Usage: yamdl accounts [list | add NAME --token TOKEN [--output DIR] | remove NAME]")
+		return 2
+	}
+}
+
+func parseAccountsAddOptions(args []string, stderr io.Writer) parseOutcome[accountsAddOptions] {
+	options := accountsAddOptions{}
+	// The name may come before or after the flags.
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		options.name, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("yamdl accounts add", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&options.token, "token", "", "Yandex Music authentication token of the account (required)")
+	flags.StringVar(&options.output, "output", "", "default download directory when the account is used")
+	registerSharedFlags(flags, &options.sharedFlags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: yamdl accounts add NAME --token TOKEN [options]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return parseOutcome[accountsAddOptions]{exitCode: 0}
+		}
+		return parseOutcome[accountsAddOptions]{exitCode: 2}
+	}
+	if options.name == "" && flags.NArg() == 1 {
+		options.name = flags.Arg(0)
+	} else if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "accounts add expects exactly one account name")
+		return parseOutcome[accountsAddOptions]{exitCode: 2}
+	}
+	options.name = strings.TrimSpace(options.name)
+	if options.name == "" {
+		fmt.Fprintln(stderr, "account name is required")
+		return parseOutcome[accountsAddOptions]{exitCode: 2}
+	}
+	options.token = strings.TrimSpace(options.token)
+	if options.token == "" {
+		fmt.Fprintln(stderr, "--token is required")
+		return parseOutcome[accountsAddOptions]{exitCode: 2}
+	}
+	if err := validateSharedFlags(options.sharedFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[accountsAddOptions]{exitCode: 2}
+	}
+	options.output = strings.TrimSpace(options.output)
+	return parseOutcome[accountsAddOptions]{options: options, proceed: true}
+}
+
+func addAccount(options accountsAddOptions, stdout, stderr io.Writer) int {
+	store, err := utils.LoadTokenStore(utils.AccountsFileName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	downloadLogger, client, err := newLoggedClient(options.sharedFlags, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer downloadLogger.Close()
+	client.SetToken(options.token)
+	status, err := client.Status()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to check token: %v\n", err)
+		return errorExitCode(err)
+	}
+	if status.Account.Uid == 0 {
+		fmt.Fprintln(stderr, "token is not valid")
+		return 1
+	}
+
+	account := utils.StoredAccount{
+		Name:        options.name,
+		Token:       options.token,
+		OutputDir:   options.output,
+		DisplayName: status.Account.DisplayName,
+		HasPlus:     status.Plus.HasPlus,
+	}
+	if account.DisplayName == "" {
+		account.DisplayName = status.Account.Login
+	}
+	store.Put(account)
+	if err := store.Save(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Saved account %s (%s, %s)\n", account.Name, account.DisplayName, subscriptionLabel(account))
+	return 0
+}
+
+func listAccounts(stdout, stderr io.Writer) int {
+	store, err := utils.LoadTokenStore(utils.AccountsFileName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if len(store.Accounts) == 0 {
+		fmt.Fprintln(stdout, "No accounts; add one with 'yamdl accounts add NAME --token TOKEN'")
+		return 0
+	}
+	table := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tDISPLAY NAME\tSUBSCRIPTION\tOUTPUT")
+	for _, account := range store.Accounts {
+		output := account.OutputDir
+		if output == "" {
+			output = defaultOutputDir
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", account.Name, account.DisplayName, subscriptionLabel(account), output)
+	}
+	if err := table.Flush(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func removeAccount(name string, stdout, stderr io.Writer) int {
+	store, err := utils.LoadTokenStore(utils.AccountsFileName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if !store.Remove(name) {
+		fmt.Fprintf(stderr, "account %q not found\n", name)
+		return 1
+	}
+	if err := store.Save(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Removed account %s\n", name)
+	return 0
+}
+
+func subscriptionLabel(account utils.StoredAccount) string {
+	if account.HasPlus {
+		return "Plus"
+	}
+	return "no subscription"
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"ya-music/utils"
+)
+
+func saveTestAccounts(t *testing.T, accounts ...utils.StoredAccount) {
+	t.Helper()
+	store, err := utils.LoadTokenStore(utils.AccountsFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, account := range accounts {
+		store.Put(account)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDownloadOptionsUsesAccountTokenAndOutput(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saveTestAccounts(t, utils.StoredAccount{Name: "anna", Token: "anna-token", OutputDir: "music/anna"})
+
+	var stderr bytes.Buffer
+	parsed := parseDownloadOptions([]string{"--account", "anna", "--link", "https://music.yandex.ru/album/1"}, &stderr)
+	if !parsed.proceed {
+		t.Fatalf("expected proceed, exit code = %d, stderr: %s", parsed.exitCode, stderr.String())
+	}
+	if parsed.options.token != "anna-token" || parsed.options.output != "music/anna" {
+		t.Fatalf("token = %q, output = %q", parsed.options.token, parsed.options.output)
+	}
+
+	parsed = parseDownloadOptions([]string{"--account", "anna", "--link", "https://music.yandex.ru/album/1", "--output", "elsewhere"}, &stderr)
+	if !parsed.proceed || parsed.options.output != "elsewhere" {
+		t.Fatalf("explicit --output was not kept: %#v, stderr: %s", parsed.options, stderr.String())
+	}
+}
+
+func TestParseOptionsRejectInvalidAccountUse(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saveTestAccounts(t, utils.StoredAccount{Name: "anna", Token: "anna-token"})
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--account", "anna", "--token", "t", "--link", "https://music.yandex.ru/album/1"}, "--token cannot be combined with --account"},
+		{[]string{"--account", "boris", "--link", "https://music.yandex.ru/album/1"}, `account "boris" not found`},
+		{[]string{"--link", "https://music.yandex.ru/album/1"}, "--token is required"},
+	} {
+		var stderr bytes.Buffer
+		parsed := parseDownloadOptions(tc.args, &stderr)
+		if parsed.proceed || parsed.exitCode != 2 || !strings.Contains(stderr.String(), tc.want) {
+			t.Fatalf("%v: proceed = %v, exit code = %d, stderr = %q", tc.args, parsed.proceed, parsed.exitCode, stderr.String())
+		}
+	}
+}
+
+func TestParseRetagOptionsUsesAccountToken(t *testing.T) {
+	t.Chdir(t.TempDir())
+	saveTestAccounts(t, utils.StoredAccount{Name: "anna", Token: "anna-token"})
+
+	var stderr bytes.Buffer
+	parsed := parseRetagOptions([]string{"--account", "anna", "music"}, &stderr)
+
+	if !parsed.proceed || parsed.options.token != "anna-token" {
+		t.Fatalf("proceed = %v, token = %q, stderr: %s", parsed.proceed, parsed.options.token, stderr.String())
+	}
+}
+
+func TestRunAccountsAddListAndRemove(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	server.SetPlus(true)
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runAccounts([]string{
+		"add", "anna",
+		"--token", "token",
+		"--output", "music/anna",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}, &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("add exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+	if got := stdout.String(); got != "Saved account anna (fake, Plus)\n" {
+		t.Fatalf("add stdout = %q", got)
+	}
+
+	stdout.Reset()
+	if exitCode := runAccounts(nil, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("list exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+	for _, want := range []string{"NAME", "anna", "fake", "Plus", "music/anna"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("list stdout = %q, want %q", stdout.String(), want)
+		}
+	}
+	if strings.Contains(stdout.String(), "token") {
+		t.Fatalf("list printed the token: %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if exitCode := runAccounts([]string{"remove", "anna"}, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("remove exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+	store, err := utils.LoadTokenStore(utils.AccountsFileName)
+	if err != nil || len(store.Accounts) != 0 {
+		t.Fatalf("accounts = %#v, err = %v", store, err)
+	}
+}
+
+func TestRunAccountsAddRejectsInvalidToken(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runAccounts([]string{
+		"add", "anna",
+		"--token", "wrong",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}, &stdout, &stderr)
+
+	if exitCode != exitAuthError {
+		t.Fatalf("exit code = %d, want %d, stderr: %s", exitCode, exitAuthError, stderr.String())
+	}
+	if store, err := utils.LoadTokenStore(utils.AccountsFileName); err != nil || len(store.Accounts) != 0 {
+		t.Fatalf("invalid token was saved: %#v, err = %v", store, err)
+	}
+}
@@ -2,20 +2,24 @@ package cli
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 	"ya-music/internal/batch"
+	"ya-music/internal/cassette"
+	"ya-music/internal/history"
+	"ya-music/internal/hook"
+	"ya-music/internal/retry"
 	"ya-music/source"
 	"ya-music/utils"
 	"ya-music/ya"
 	"ya-music/ya/model"
 )
 
-func newLoggedClient(timeoutSeconds int, stderr io.Writer) (*utils.DownloadLogger, *ya.Client) {
+func newLoggedClient(options sharedFlags, stderr io.Writer) (*utils.DownloadLogger, *ya.Client, error) {
 	downloadLogger, err := utils.NewDownloadLogger(utils.DefaultDownloadLogPath)
 	if err != nil {
 		fmt.Fprintf(stderr, "failed to initialize download logger: %v\n", err)
@@ -24,9 +28,43 @@ func newLoggedClient(timeoutSeconds int, stderr io.Writer) (*utils.DownloadLogge
 	if err := downloadLogger.Reset(); err != nil {
 		fmt.Fprintf(stderr, "failed to reset download log file: %v\n", err)
 	}
+	transport, err := newTransport(options, downloadLogger)
+	if err != nil {
+		downloadLogger.Close()
+		return nil, nil, err
+	}
 	httpClient := utils.NewHttpClientWithLogger(downloadLogger)
-	httpClient.SetDownloadTimeout(time.Duration(timeoutSeconds) * time.Second)
-	return downloadLogger, ya.NewClient(httpClient)
+	httpClient.SetTransport(transport)
+	httpClient.SetDownloadTimeout(time.Duration(options.timeoutSeconds) * time.Second)
+	client := ya.NewClient(httpClient)
+	if baseURL := strings.TrimSpace(options.apiBaseURL); baseURL != "" {
+		client.SetBaseURL(baseURL)
+	}
+	return downloadLogger, client, nil
+}
+
+// newTransport builds the network transport, or a cassette player that
+// replaces it under --replay.
+func newTransport(options sharedFlags, logger *utils.DownloadLogger) (http.RoundTripper, error) {
+	if replayDir := strings.TrimSpace(options.replayDir); replayDir != "" {
+		return cassette.NewPlayer(replayDir)
+	}
+	transport, err := utils.NewTransport(options.transportOptions())
+	if err != nil {
+		return nil, err
+	}
+	recordDir := strings.TrimSpace(options.recordDir)
+	if recordDir == "" {
+		return transport, nil
+	}
+	recorder, err := cassette.NewRecorder(recordDir, transport)
+	if err != nil {
+		return nil, err
+	}
+	recorder.OnSaveError = func(err error) {
+		logger.Error("cassette save failed", "stage", "record", "error", err)
+	}
+	return recorder, nil
 }
 
 func runDownload(args []string, stdout, stderr io.Writer) int {
@@ -36,44 +74,130 @@ func runDownload(args []string, stdout, stderr io.Writer) int {
 	}
 	options := parsed.options
 
-	downloadLogger, client := newLoggedClient(options.timeoutSeconds, stderr)
+	link := options.link
+	timer := summaryTimer{started: time.Now()}
+	report := newDownloadSummary(link, options.output, batchSummary{}, 0, false)
+	finish := func(exitCode int) int {
+		if options.summaryFile == "" {
+			return exitCode
+		}
+		if err := writeSummaryFile(options.summaryFile, timer.finish(report, exitCode, time.Now())); err != nil {
+			fmt.Fprintf(stderr, "failed to write summary file: %v\n", err)
+		}
+		return exitCode
+	}
+
+	retryPath := retry.DefaultPath(options.output)
+	var retryList retry.List
+	if options.retryFailed != "" {
+		list, err := retry.Load(options.retryFailed)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			report.Error = err.Error()
+			return finish(1)
+		}
+		if len(list.Entries) == 0 {
+			fmt.Fprintln(stdout, "No failed tracks to retry")
+			return finish(0)
+		}
+		if err := applyRetryOptions(&options, list.Options); err != nil {
+			fmt.Fprintln(stderr, err)
+			report.Error = err.Error()
+			return finish(2)
+		}
+		retryList = list
+		retryPath = options.retryFailed
+		link = list.Source()
+		report.Source = utils.SanitizeURL(link)
+		report.Output = options.output
+	}
+
+	if err := checkFFmpeg(options.transcodeFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		report.Error = err.Error()
+		return finish(1)
+	}
+
+	downloadLogger, client, err := newLoggedClient(options.sharedFlags, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		report.Error = err.Error()
+		return finish(1)
+	}
 	defer downloadLogger.Close()
 	client.SetToken(options.token)
 
 	interrupts := newInterruptSignals()
 	defer interrupts.stop()
 
+	var preflightResults <-chan downloadPreflightResult
+	if options.retryFailed != "" {
+		preflightResults = startPreflight(func() downloadPreflightResult {
+			return runRetryPreflight(client, retryList.TrackIDs())
+		})
+	} else {
+		preflightResults = startDownloadPreflight(client, link)
+	}
 	preflight, interrupted := awaitDownloadPreflight(
 		stdout,
-		startDownloadPreflight(client, options.link),
+		preflightResults,
 		interrupts.first,
 		client.Cancel,
 	)
+	timer.preflight = time.Since(timer.started)
 	if interrupted {
-		return 130
+		report.Interrupted = true
+		return finish(exitInterrupted)
+	}
+	if preflight.warning != "" {
+		fmt.Fprintf(stderr, "Warning: %s\n", preflight.warning)
+		downloadLogger.Info("account limited", "stage", "preflight", "reason", preflight.warning)
+	}
+	for _, missing := range preflight.missing {
+		fmt.Fprintf(stderr, "[retry] %s\n", missing)
 	}
 	if preflight.err != nil {
-		fmt.Fprintln(stderr, preflight.err)
-		return 1
+		fmt.Fprintln(stderr, describeError(preflight.err))
+		report.Error = preflight.err.Error()
+		return finish(errorExitCode(preflight.err))
 	}
 	tracks := preflight.tracks
+	historyStore := options.historyStore()
+	defer closeHistory(historyStore, stderr, downloadLogger)
+	if options.newEpisodes {
+		tracks, err = newEpisodes(historyStore, tracks)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			report.Error = err.Error()
+			return finish(1)
+		}
+		fmt.Fprintf(stdout, "New: %d of %d tracks have not been downloaded before\n", len(tracks), len(preflight.tracks))
+		if len(tracks) == 0 {
+			return finish(0)
+		}
+	}
+	report.Total = len(tracks)
 
 	if err := utils.CreateDirIfNotExists(options.output); err != nil {
 		fmt.Fprintf(stderr, "failed to create output directory: %v\n", err)
-		return 1
+		report.Error = err.Error()
+		return finish(1)
 	}
 	outputInfo, err := os.Stat(options.output)
 	if err != nil {
 		fmt.Fprintf(stderr, "failed to inspect output directory: %v\n", err)
-		return 1
+		report.Error = err.Error()
+		return finish(1)
 	}
 	if !outputInfo.IsDir() {
 		fmt.Fprintln(stderr, "--output must be a directory")
-		return 2
+		report.Error = "--output must be a directory"
+		return finish(2)
 	}
 
 	downloadLogger.Info("batch download started",
-		"source", utils.SanitizeURL(options.link),
+		"source", utils.SanitizeURL(link),
+		"retry_list", options.retryFailed,
 		"total_tracks", len(tracks),
 		"format", options.format,
 		"output", options.output,
@@ -81,24 +205,39 @@ func runDownload(args []string, stdout, stderr io.Writer) int {
 
 	batchContext, cancelBatch := context.WithCancel(context.Background())
 	defer cancelBatch()
+	downloadContext, cancelDownloads := context.WithCancel(context.Background())
+	defer cancelDownloads()
 
+	timer.batch = time.Now()
+	hooks := newBatchHooks(options.hookFlags, stderr, downloadLogger)
+	var recorded []batch.Event
+	live := newTerminalProgress(stdout, len(tracks))
 	summary, interrupted := consumeDownloadEventsWithFlush(
 		stdout,
-		batch.Run(batch.Config{
-			Client:    client,
-			Tracks:    tracks,
-			OutputDir: options.output,
-			Context:   batchContext,
+		hooks.wrap(recordHistory(recordEvents(batch.Run(batch.Config{
+			Client:          client,
+			Tracks:          tracks,
+			OutputDir:       options.output,
+			Context:         batchContext,
+			DownloadContext: downloadContext,
+			Progress:        live != nil,
 			Options: ya.DownloadOptions{
-				SkipCover:   options.skipCover,
-				AudioFormat: options.format,
+				SkipCover:         options.skipCover,
+				AudioFormat:       options.format,
+				ReplayGain:        options.replayGain,
+				Upgrade:           options.upgrade,
+				UpgradeArchiveDir: options.upgradeArchive,
+				LosslessContainer: options.container(),
+				Transcode:         options.profile,
+				FFmpegPath:        options.ffmpeg,
 			},
-		}),
+		}), &recorded), history.NewRecorder(historyStore, link), stderr, downloadLogger), len(tracks)),
 		interrupts.first,
 		interrupts.force,
 		cancelBatch,
-		client.Cancel,
+		cancelDownloads,
 		interrupts.flush,
+		live,
 	)
 
 	fmt.Fprintf(stdout, "\nFinished: %d downloaded, %d skipped, %d failed\nOutput: %s\n",
@@ -107,71 +246,132 @@ func runDownload(args []string, stdout, stderr io.Writer) int {
 		summary.failed,
 		options.output,
 	)
+	updateRetryList(stdout, stderr, retryPath, link, options, recorded)
+	exitCode := batchExitCode(summary, len(tracks), options.failOn, interrupted)
+	if !writeDownloadFeed(stdout, stderr, options, downloadLogger) && exitCode == 0 {
+		exitCode = 1
+	}
 	downloadLogger.Info("batch download finished",
 		"downloaded", summary.downloaded,
 		"skipped", summary.skipped,
 		"failed", summary.failed,
+		"bytes", summary.bytes,
 		"interrupted", interrupted,
+		"exit_code", exitCode,
 	)
-	if interrupted {
-		return 130
-	}
-	return 0
+	hooks.finish(summary.hookPayload(link, options.output, len(tracks), interrupted))
+	report = newDownloadSummary(link, options.output, summary, len(tracks), interrupted)
+	return finish(exitCode)
 }
 
 type batchSummary struct {
 	downloaded int
 	skipped    int
 	failed     int
+	// authFailed counts failures caused by a rejected token.
+	authFailed int
+	// bytes is the size of the downloaded files.
+	bytes int64
 }
 
 func (s *batchSummary) add(event batch.Event) {
 	switch event.Status {
 	case batch.StatusDone:
 		s.downloaded++
+		if info, err := os.Stat(event.Path); err == nil {
+			s.bytes += info.Size()
+		}
 	case batch.StatusSkipped:
 		s.skipped++
 	case batch.StatusError:
 		s.failed++
+		if ya.Classify(event.Err) == ya.ErrAuthExpired {
+			s.authFailed++
+		}
+	}
+}
+
+// describeError appends what the user can do about err, when known.
+func describeError(err error) string {
+	if hint := ya.ErrorHint(err); hint != "" {
+		return fmt.Sprintf("%v (%s)", err, hint)
+	}
+	return err.Error()
+}
+
+func (s batchSummary) hookPayload(link, output string, total int, interrupted bool) hook.BatchPayload {
+	return hook.BatchPayload{
+		Source:      utils.SanitizeURL(link),
+		Output:      output,
+		Total:       total,
+		Downloaded:  s.downloaded,
+		Skipped:     s.skipped,
+		Failed:      s.failed,
+		Interrupted: interrupted,
 	}
 }
 
 type downloadPreflightClient interface {
 	source.Client
-	AccountStatus() (*model.Account, error)
+	accountClient
+}
+
+type accountClient interface {
+	Status() (*model.Status, error)
 }
 
 type downloadPreflightResult struct {
 	tracks []model.Track
-	err    error
+	// missing lists retry tracks that could not be looked up again.
+	missing []string
+	// warning describes what the account cannot download.
+	warning string
+	err     error
 }
 
 func startDownloadPreflight(client downloadPreflightClient, link string) <-chan downloadPreflightResult {
+	return startPreflight(func() downloadPreflightResult {
+		return runDownloadPreflight(client, link)
+	})
+}
+
+func startPreflight(run func() downloadPreflightResult) <-chan downloadPreflightResult {
 	results := make(chan downloadPreflightResult, 1)
 	go func() {
 		defer close(results)
-		results <- runDownloadPreflight(client, link)
+		results <- run()
 	}()
 	return results
 }
 
 func runDownloadPreflight(client downloadPreflightClient, link string) downloadPreflightResult {
-	account, err := client.AccountStatus()
-	if err != nil || account == nil || account.Uid == 0 {
-		if err == nil {
-			err = errors.New("account has no user ID")
-		}
-		return downloadPreflightResult{err: fmt.Errorf("failed to validate token: %w", err)}
+	capabilities, err := validateAccount(client)
+	if err != nil {
+		return downloadPreflightResult{err: err}
 	}
+	warning := capabilities.Warning()
 
 	tracks, err := source.Resolve(client, link)
 	if err != nil {
-		return downloadPreflightResult{err: fmt.Errorf("failed to resolve source: %w", err)}
+		return downloadPreflightResult{warning: warning, err: fmt.Errorf("%w: %w", errResolveSource, err)}
 	}
 	if len(tracks) == 0 {
-		return downloadPreflightResult{err: errors.New("failed to resolve source: no tracks found")}
+		return downloadPreflightResult{warning: warning, err: fmt.Errorf("%w: no tracks found", errResolveSource)}
+	}
+	return downloadPreflightResult{tracks: tracks, warning: warning}
+}
+
+// validateAccount checks the token and reports what its account can
+// download.
+func validateAccount(client accountClient) (ya.Capabilities, error) {
+	status, err := client.Status()
+	if err != nil || status == nil || status.Account.Uid == 0 {
+		if err == nil {
+			err = fmt.Errorf("%w: account has no user ID", ya.ErrAuthExpired)
+		}
+		return ya.Capabilities{}, fmt.Errorf("failed to validate token: %w", err)
 	}
-	return downloadPreflightResult{tracks: tracks}
+	return ya.CapabilitiesOf(status), nil
 }
 
 func awaitDownloadPreflight(
@@ -228,6 +428,7 @@ func consumeDownloadEvents(
 		stopScheduling,
 		cancelInFlight,
 		nil,
+		nil,
 	)
 }
 
@@ -239,6 +440,7 @@ func consumeDownloadEventsWithFlush(
 	stopScheduling func(),
 	cancelInFlight func(),
 	flushInterrupts func(),
+	live *liveProgress,
 ) (summary batchSummary, interrupted bool) {
 	activeForceInterrupt := (<-chan struct{})(nil)
 	if firstInterrupt == nil {
@@ -246,7 +448,17 @@ func consumeDownloadEventsWithFlush(
 	}
 
 	emit := func(event batch.Event) {
-		fmt.Fprintln(stdout, formatBatchEvent(event))
+		if event.Status == batch.StatusProgress {
+			if live != nil {
+				live.update(event)
+			}
+			return
+		}
+		if live != nil {
+			live.line(event, formatBatchEvent(event))
+		} else {
+			fmt.Fprintln(stdout, formatBatchEvent(event))
+		}
 		summary.add(event)
 	}
 	handleFirstInterrupt := func() {
@@ -280,6 +492,9 @@ func consumeDownloadEventsWithFlush(
 			emit(event)
 		}
 	}
+	if live != nil {
+		live.clear()
+	}
 	if flushInterrupts != nil {
 		flushInterrupts()
 	}
@@ -312,5 +527,11 @@ func formatBatchEvent(event batch.Event) string {
 			status = reason
 		}
 	}
-	return fmt.Sprintf("[%s] %s", status, event.Track.DisplayLabel())
+	line := fmt.Sprintf("[%s] %s", status, event.Track.DisplayLabel())
+	if event.Status == batch.StatusError {
+		if hint := ya.ErrorHint(event.Err); hint != "" {
+			line += " (" + hint + ")"
+		}
+	}
+	return line
 }
@@ -3,8 +3,12 @@ package cli
 import (
 	"bytes"
 	"context"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -12,6 +16,8 @@ import (
 	"testing"
 	"time"
 	"ya-music/internal/batch"
+	"ya-music/internal/fakeapi"
+	"ya-music/ya"
 	"ya-music/ya/model"
 )
 
@@ -60,6 +66,10 @@ func TestFormatBatchEventAndSummary(t *testing.T) {
 		{event: batch.Event{Track: track, Status: batch.StatusSkipped, Reason: "unavailable"}, want: "[unavailable] Artist — Track"},
 		{event: batch.Event{Track: track, Status: batch.StatusSkipped, Reason: "duplicate"}, want: "[duplicate] Artist — Track"},
 		{event: batch.Event{Track: track, Status: batch.StatusError, Reason: "access denied"}, want: "[error] Artist — Track"},
+		{
+			event: batch.Event{Track: track, Status: batch.StatusError, Err: &ya.StageError{Kind: ya.ErrRateLimited, Err: errors.New("429")}},
+			want:  "[error] Artist — Track (Yandex Music is limiting requests; wait a few minutes and retry)",
+		},
 	}
 	for _, tt := range tests {
 		if got := formatBatchEvent(tt.event); got != tt.want {
@@ -74,6 +84,26 @@ func TestFormatBatchEventAndSummary(t *testing.T) {
 	if summary != (batchSummary{downloaded: 1, skipped: 1, failed: 1}) {
 		t.Fatalf("unexpected summary: %#v", summary)
 	}
+	summary.add(batch.Event{Status: batch.StatusError, Err: &ya.StageError{Kind: ya.ErrAuthExpired, Err: errors.New("expired")}})
+	if summary.failed != 2 || summary.authFailed != 1 {
+		t.Fatalf("unexpected summary: %#v", summary)
+	}
+}
+
+func TestErrorExitCodeReportsRejectedToken(t *testing.T) {
+	var expired model.ErrorResponse
+	expired.APIError.Name = "session-expired"
+	err := fmt.Errorf("failed to validate token: %w", &expired)
+
+	if got := errorExitCode(err); got != exitAuthError {
+		t.Fatalf("errorExitCode(%v) = %d, want %d", err, got, exitAuthError)
+	}
+	if got := errorExitCode(errors.New("failed to resolve source: boom")); got != 1 {
+		t.Fatalf("errorExitCode() = %d, want 1", got)
+	}
+	if got := describeError(err); !strings.Contains(got, "get a new token") {
+		t.Fatalf("describeError() = %q", got)
+	}
 }
 
 func TestConsumeDownloadEventsWritesEventsAsTheyArrive(t *testing.T) {
@@ -352,6 +382,7 @@ func TestConsumeDownloadEventsFlushesReceivedRouterSignalsBeforeReturning(t *tes
 				close(flushStarted)
 				interrupts.flush()
 			},
+			nil,
 		)
 		resultCh <- consumeResult{summary: summary, interrupted: interrupted}
 	}()
@@ -407,7 +438,7 @@ type blockingPreflightClient struct {
 	returned  chan struct{}
 }
 
-func (c *blockingPreflightClient) AccountStatus() (*model.Account, error) {
+func (c *blockingPreflightClient) Status() (*model.Status, error) {
 	close(c.started)
 	<-c.cancelled
 	close(c.returned)
@@ -440,8 +471,8 @@ type blockingSourcePreflightClient struct {
 	returned  chan struct{}
 }
 
-func (*blockingSourcePreflightClient) AccountStatus() (*model.Account, error) {
-	return &model.Account{Uid: 1}, nil
+func (*blockingSourcePreflightClient) Status() (*model.Status, error) {
+	return &model.Status{Account: model.Account{Uid: 1}, Plus: model.Plus{HasPlus: true}}, nil
 }
 
 func (c *blockingSourcePreflightClient) TrackInfo(string) (*model.Track, error) {
@@ -486,3 +517,262 @@ func assertConsumeResultPending(t *testing.T, results <-chan consumeResult) {
 	default:
 	}
 }
+
+// newFakeAPIDownload serves album 10 with one track and returns the server
+// and a CA bundle that trusts it.
+func newFakeAPIDownload(t *testing.T) (*fakeapi.Server, string) {
+	t.Helper()
+	server := fakeapi.New()
+	t.Cleanup(server.Close)
+	server.RequireToken("token")
+	server.AddTrack(fakeapi.Track{
+		Track: model.Track{
+			ID:        "1",
+			Title:     "Song",
+			Available: true,
+			Artists:   []model.Artist{{Name: "Artist"}},
+			Albums:    []model.Album{{ID: "10", Title: "Album"}},
+		},
+		Cover: fakeapi.CoverFixture(),
+	})
+	server.AddAlbum("10", "Album", "1")
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return server, bundle
+}
+
+func TestRunDownloadSendsAllRequestsToAPIBaseURL(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	output := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/10",
+		"--output", output,
+		"--no-history",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}, &stdout, &stderr)
+
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, stdout: %s, stderr: %s", exitCode, stdout.String(), stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(output, "Artist - Song.mp3")); err != nil {
+		t.Fatalf("downloaded track missing: %v", err)
+	}
+	if !slices.ContainsFunc(server.Requests(), func(request string) bool {
+		return strings.HasPrefix(request, "GET /covers/1/")
+	}) {
+		t.Fatalf("cover was not fetched from the base URL host, requests: %v", server.Requests())
+	}
+}
+
+func TestRunDownloadReplaysRecordedCassetteOffline(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	cassetteDir := filepath.Join(t.TempDir(), "cassette")
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/10",
+		"--output", t.TempDir(),
+		"--no-history",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+		"--record", cassetteDir,
+	}, &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("record exit code = %d, stdout: %s, stderr: %s", exitCode, stdout.String(), stderr.String())
+	}
+	server.Close()
+
+	output := t.TempDir()
+	stdout.Reset()
+	stderr.Reset()
+	exitCode = runDownload([]string{
+		"--token", "any",
+		"--link", "https://music.yandex.ru/album/10",
+		"--output", output,
+		"--no-history",
+		"--api-base-url", server.URL,
+		"--replay", cassetteDir,
+	}, &stdout, &stderr)
+
+	if exitCode != 0 {
+		t.Fatalf("replay exit code = %d, stdout: %s, stderr: %s", exitCode, stdout.String(), stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(output, "Artist - Song.mp3")); err != nil {
+		t.Fatalf("replayed track missing: %v", err)
+	}
+}
+
+func TestRunDownloadRejectsMissingCABundle(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/10",
+		"--no-history",
+		"--ca-bundle", filepath.Join(t.TempDir(), "missing.pem"),
+	}, &stdout, &stderr)
+
+	if exitCode != 1 || !strings.Contains(stderr.String(), "failed to read CA bundle") {
+		t.Fatalf("exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+}
+
+func TestRunDownloadWarnsWithoutSubscriptionAndRefusesPreviews(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	server.AddTrack(fakeapi.Track{
+		Track: model.Track{
+			ID:        "2",
+			Title:     "Preview",
+			Available: true,
+			Artists:   []model.Artist{{Name: "Artist"}},
+			Albums:    []model.Album{{ID: "11", Title: "Previews"}},
+		},
+		Preview: true,
+	})
+	server.AddAlbum("11", "Previews", "2")
+	output := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/11",
+		"--output", output,
+		"--no-history",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}, &stdout, &stderr)
+
+	if exitCode == 0 {
+		t.Fatalf("preview download succeeded, stdout: %s", stdout.String())
+	}
+	if !strings.HasPrefix(stderr.String(), "Warning: no active subscription: lossless unavailable, previews only\n") {
+		t.Fatalf("stderr = %q", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "needs an active Yandex Music Plus subscription") {
+		t.Fatalf("preview refusal not reported, stdout: %s, stderr: %s", stdout.String(), stderr.String())
+	}
+	if _, err := os.Stat(filepath.Join(output, "Artist - Preview.mp3")); !os.IsNotExist(err) {
+		t.Fatalf("preview was saved as a full track: %v", err)
+	}
+}
+
+func TestRunDownloadDoesNotWarnWithSubscription(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	server.SetPlus(true)
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/10",
+		"--output", t.TempDir(),
+		"--no-history",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}, &stdout, &stderr)
+
+	if exitCode != 0 || strings.Contains(stderr.String(), "Warning:") {
+		t.Fatalf("exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+}
+
+func TestRunDownloadWarnsWithoutHighQualityPermission(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	server.SetPlus(true)
+	server.SetPermissions(model.Permissions{Values: []string{"landing-play"}})
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/10",
+		"--output", t.TempDir(),
+		"--no-history",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}, &stdout, &stderr)
+
+	if exitCode != 0 || !strings.Contains(stderr.String(), "Warning: subscription has no high-quality permission: lossless unavailable\n") {
+		t.Fatalf("exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+}
+
+func TestRunDownloadNewEpisodesSkipsEpisodesInHistory(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	server.SetPlus(true)
+	addEpisode := func(id, title, pubDate string) {
+		server.AddTrack(fakeapi.Track{Track: model.Track{
+			ID:        model.FlexibleID(id),
+			Title:     title,
+			Available: true,
+			Type:      "podcast-episode",
+			PubDate:   pubDate,
+			Artists:   []model.Artist{{Name: "Host"}},
+			Albums:    []model.Album{{ID: "20", Title: "Show"}},
+		}})
+	}
+	addEpisode("22", "Second", "2024-02-01T06:00:00+03:00")
+	addEpisode("21", "First", "2024-01-01T06:00:00+03:00")
+	server.AddPodcast("20", "Show", "22", "21")
+	output := t.TempDir()
+	args := []string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/20",
+		"--output", output,
+		"--new-episodes",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}
+
+	var stdout, stderr bytes.Buffer
+	if exitCode := runDownload(args, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, stdout: %s, stderr: %s", exitCode, stdout.String(), stderr.String())
+	}
+	for _, name := range []string{"Show - 2024-01-01 - First.mp3", "Show - 2024-02-01 - Second.mp3"} {
+		if err := os.Remove(filepath.Join(output, name)); err != nil {
+			t.Fatalf("episode file: %v", err)
+		}
+	}
+
+	addEpisode("23", "Third", "2024-03-01T06:00:00+03:00")
+	server.AddPodcast("20", "Show", "23", "22", "21")
+	stdout.Reset()
+	if exitCode := runDownload(args, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("exit code = %d, stdout: %s, stderr: %s", exitCode, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "New: 1 of 3 tracks") {
+		t.Fatalf("stdout = %s", stdout.String())
+	}
+	entries, err := os.ReadDir(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, []string{"Show - 2024-03-01 - Third.mp3"}) {
+		t.Fatalf("output files = %v", names)
+	}
+}
+
+func TestParseDownloadOptionsRejectsNewEpisodesWithoutHistory(t *testing.T) {
+	var stderr bytes.Buffer
+	parsed := parseDownloadOptions([]string{"--token", "t", "--link", "https://music.yandex.ru/album/1", "--new-episodes", "--no-history"}, &stderr)
+
+	if parsed.proceed || parsed.exitCode != 2 || !strings.Contains(stderr.String(), "--no-history") {
+		t.Fatalf("proceed = %v, exit code = %d, stderr = %q", parsed.proceed, parsed.exitCode, stderr.String())
+	}
+}
@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"ya-music/internal/feed"
+	"ya-music/utils"
+)
+
+type feedOptions struct {
+	dir string
+	feed.Options
+}
+
+func runFeed(args []string, stdout, stderr io.Writer) int {
+	parsed := parseFeedOptions(args, stderr)
+	if !parsed.proceed {
+		return parsed.exitCode
+	}
+	options := parsed.options
+	result, err := feed.WriteFile(options.dir, options.Options)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	reportSkippedEpisodes(stderr, nil, result.Skipped)
+	fmt.Fprintf(stdout, "Wrote %s with %d episodes\n", filepath.Join(options.dir, feed.FileName), result.Episodes)
+	return 0
+}
+
+func parseFeedOptions(args []string, stderr io.Writer) parseOutcome[feedOptions] {
+	options := feedOptions{}
+	// The directory may come before or after the flags.
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		options.dir, args = args[0], args[1:]
+	}
+	flags := flag.NewFlagSet("yamdl feed", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&options.BaseURL, "base-url", "", "URL the directory is served at, used for episode links (required)")
+	flags.StringVar(&options.Title, "title", "", "feed title (default: the show of the episodes)")
+	flags.StringVar(&options.Description, "description", "", "feed description")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: yamdl feed DIR --base-url URL [options]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return parseOutcome[feedOptions]{exitCode: 0}
+		}
+		return parseOutcome[feedOptions]{exitCode: 2}
+	}
+	if options.dir == "" && flags.NArg() == 1 {
+		options.dir = flags.Arg(0)
+	} else if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "feed expects exactly one directory")
+		return parseOutcome[feedOptions]{exitCode: 2}
+	}
+	options.dir = strings.TrimSpace(options.dir)
+	if options.dir == "" {
+		fmt.Fprintln(stderr, "directory is required")
+		return parseOutcome[feedOptions]{exitCode: 2}
+	}
+	if strings.TrimSpace(options.BaseURL) == "" {
+		fmt.Fprintln(stderr, "--base-url is required")
+		return parseOutcome[feedOptions]{exitCode: 2}
+	}
+	if err := feed.ValidateBaseURL(options.BaseURL); err != nil {
+		fmt.Fprintf(stderr, "--base-url: %v\n", err)
+		return parseOutcome[feedOptions]{exitCode: 2}
+	}
+	options.Title = strings.TrimSpace(options.Title)
+	options.Description = strings.TrimSpace(options.Description)
+	return parseOutcome[feedOptions]{options: options, proceed: true}
+}
+
+// writeDownloadFeed refreshes the podcast feed of the output directory after
+// a download with --feed-base-url.
+func writeDownloadFeed(stdout, stderr io.Writer, options downloadOptions, logger *utils.DownloadLogger) bool {
+	if options.feedBaseURL == "" {
+		return true
+	}
+	result, err := feed.WriteFile(options.output, feed.Options{BaseURL: options.feedBaseURL})
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to write feed: %v\n", err)
+		logger.Error("feed write failed", "stage", "feed", "error", err)
+		return false
+	}
+	reportSkippedEpisodes(stderr, logger, result.Skipped)
+	fmt.Fprintf(stdout, "Feed: %s (%d episodes)\n", filepath.Join(options.output, feed.FileName), result.Episodes)
+	return true
+}
+
+// reportSkippedEpisodes warns about files left out of a feed; they do not
+// fail the command.
+func reportSkippedEpisodes(stderr io.Writer, logger *utils.DownloadLogger, skipped []feed.Skipped) {
+	for _, file := range skipped {
+		fmt.Fprintf(stderr, "Warning: skipped %s in feed: %v\n", file.Path, file.Err)
+		logger.Info("feed skipped file", "stage", "feed", "path", file.Path, "error", file.Err)
+	}
+}
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"ya-music/internal/fakeapi"
+	"ya-music/ya/model"
+)
+
+func TestRunDownloadWritesPodcastFeedAndRunFeedRefreshesIt(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server, bundle := newFakeAPIDownload(t)
+	server.SetPlus(true)
+	server.AddTrack(fakeapi.Track{Track: model.Track{
+		ID:         "31",
+		Title:      "Pilot",
+		Available:  true,
+		DurationMs: 61000,
+		PubDate:    "2024-01-01T06:00:00+03:00",
+		Artists:    []model.Artist{{Name: "Host"}},
+		Albums:     []model.Album{{ID: "30", Title: "Show"}},
+	}})
+	server.AddPodcast("30", "Show", "31")
+	output := t.TempDir()
+	// A file with a broken ID3 tag is left out of the feed without failing
+	// the download.
+	broken := []byte("ID3\x04\x00\x00\x00\x00\x00\x20TIT2\x00\x00\x7f\x7f\x00\x00\x03abc")
+	if err := os.WriteFile(filepath.Join(output, "Broken.mp3"), broken, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--link", "https://music.yandex.ru/album/30",
+		"--output", output,
+		"--no-history",
+		"--feed-base-url", "http://nas.local:8080/files/",
+		"--api-base-url", server.URL,
+		"--ca-bundle", bundle,
+	}, &stdout, &stderr)
+	if exitCode != 0 {
+		t.Fatalf("exit code = %d, stdout: %s, stderr: %s", exitCode, stdout.String(), stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "(1 episodes)") {
+		t.Fatalf("stdout = %s", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "Warning: skipped "+filepath.Join(output, "Broken.mp3")) {
+		t.Fatalf("stderr = %s", stderr.String())
+	}
+	data, err := os.ReadFile(filepath.Join(output, "feed.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<enclosure url="http://nas.local:8080/files/Show%20-%202024-01-01%20-%20Pilot.mp3"`,
+		"<itunes:duration>00:01:01</itunes:duration>",
+		"<title>Show</title>",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("feed is missing %q:\n%s", want, data)
+		}
+	}
+
+	stdout.Reset()
+	if exitCode := runFeed([]string{output, "--base-url", "https://example.com/podcasts", "--title", "Mine"}, &stdout, &stderr); exitCode != 0 {
+		t.Fatalf("feed exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+	data, err = os.ReadFile(filepath.Join(output, "feed.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "<title>Mine</title>") || !strings.Contains(string(data), "https://example.com/podcasts/Show%20-") {
+		t.Fatalf("feed was not refreshed:\n%s", data)
+	}
+}
+
+func TestParseFeedOptionsRequiresDirAndBaseURL(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--base-url", "http://nas.local/"}, "directory is required"},
+		{[]string{"music"}, "--base-url is required"},
+		{[]string{"music", "--base-url", "nas.local"}, "--base-url: feed base URL must be an http or https URL"},
+	} {
+		var stderr bytes.Buffer
+		parsed := parseFeedOptions(tc.args, &stderr)
+		if parsed.proceed || parsed.exitCode != 2 || !strings.Contains(stderr.String(), tc.want) {
+			t.Fatalf("%v: proceed = %v, exit code = %d, stderr = %q", tc.args, parsed.proceed, parsed.exitCode, stderr.String())
+		}
+	}
+}
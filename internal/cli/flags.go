@@ -5,7 +5,10 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"net/url"
 	"strings"
+	"ya-music/internal/feed"
+	"ya-music/utils"
 	"ya-music/ya"
 )
 
@@ -14,6 +17,15 @@ const defaultOutputDir = "./downloads"
 type sharedFlags struct {
 	timeoutSeconds int
 	skipCover      bool
+	replayGain     bool
+	// apiBaseURL replaces the API endpoint, e.g. a mirror or a local stub.
+	apiBaseURL string
+	proxy      string
+	caBundle   string
+	// recordDir and replayDir save HTTP traffic to a cassette or answer
+	// requests from one.
+	recordDir string
+	replayDir string
 }
 
 type parseOutcome[T any] struct {
@@ -22,15 +34,43 @@ type parseOutcome[T any] struct {
 	proceed  bool
 }
 
+// losslessFlags choose how flac-mp4 downloads are saved.
+type losslessFlags struct {
+	losslessContainer string
+}
+
 type tuiOptions struct {
+	accountFlags
+	losslessFlags
+	historyFlags
 	sharedFlags
 }
 
 type downloadOptions struct {
-	token  string
-	link   string
-	format ya.AudioFormat
-	output string
+	token          string
+	link           string
+	format         ya.AudioFormat
+	output         string
+	upgrade        bool
+	upgradeArchive string
+	// retryFailed is a retry list whose tracks replace --link.
+	retryFailed string
+	// setFlags holds the flags given on the command line, which override the
+	// options saved in a retry list.
+	setFlags map[string]bool
+	// failOn selects which track outcomes make the exit code non-zero.
+	failOn      string
+	summaryFile string
+	// newEpisodes skips tracks the history already has a download of.
+	newEpisodes bool
+	// feedBaseURL, when set, refreshes the podcast feed of the output
+	// directory after the downloads.
+	feedBaseURL string
+	accountFlags
+	losslessFlags
+	transcodeFlags
+	hookFlags
+	historyFlags
 	sharedFlags
 }
 
@@ -38,18 +78,62 @@ func validateSharedFlags(options sharedFlags) error {
 	if options.timeoutSeconds < 0 {
 		return errors.New("timeout must be >= 0 seconds")
 	}
+	if apiBaseURL := strings.TrimSpace(options.apiBaseURL); apiBaseURL != "" {
+		baseURL, err := url.Parse(apiBaseURL)
+		if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+			return errors.New("--api-base-url must be an http or https URL")
+		}
+	}
+	if strings.TrimSpace(options.proxy) != "" {
+		if _, err := utils.ParseProxyURL(options.proxy); err != nil {
+			return fmt.Errorf("--proxy: %w", err)
+		}
+	}
+	if strings.TrimSpace(options.recordDir) != "" && strings.TrimSpace(options.replayDir) != "" {
+		return errors.New("--record cannot be combined with --replay")
+	}
 	return nil
 }
 
+func (f sharedFlags) transportOptions() utils.TransportOptions {
+	return utils.TransportOptions{Proxy: f.proxy, CABundle: f.caBundle}
+}
+
 func registerSharedFlags(fs *flag.FlagSet, dest *sharedFlags) {
 	fs.IntVar(&dest.timeoutSeconds, "timeout", 0, "download timeout in seconds (0 disables timeout)")
 	fs.BoolVar(&dest.skipCover, "skip-cover", false, "skip downloading and embedding track cover images")
+	fs.BoolVar(&dest.replayGain, "replaygain", false, "write ReplayGain tags from API loudness or FLAC analysis")
+	fs.StringVar(&dest.apiBaseURL, "api-base-url", "", "API endpoint to use instead of "+ya.DefaultBaseURL)
+	fs.StringVar(&dest.proxy, "proxy", "", "proxy for all requests: http://, https:// or socks5://[user:password@]host:port (default from HTTPS_PROXY)")
+	fs.StringVar(&dest.caBundle, "ca-bundle", "", "PEM file of extra CA certificates to trust")
+	fs.StringVar(&dest.recordDir, "record", "", "save redacted HTTP requests and responses to this directory for bug reports")
+	fs.StringVar(&dest.replayDir, "replay", "", "answer HTTP requests from a directory written by --record instead of the network")
+}
+
+func registerLosslessFlags(fs *flag.FlagSet, dest *losslessFlags) {
+	fs.StringVar(&dest.losslessContainer, "lossless-container", string(ya.LosslessContainerMP4), "container for FLAC delivered in MP4: mp4 keeps .m4a, flac remuxes to .flac")
+}
+
+func validateLosslessFlags(options *losslessFlags) error {
+	container := ya.LosslessContainer(strings.ToLower(strings.TrimSpace(options.losslessContainer)))
+	if container != ya.LosslessContainerMP4 && container != ya.LosslessContainerFLAC {
+		return errors.New("--lossless-container must be flac or mp4")
+	}
+	options.losslessContainer = string(container)
+	return nil
+}
+
+func (f losslessFlags) container() ya.LosslessContainer {
+	return ya.LosslessContainer(f.losslessContainer)
 }
 
 func parseTUIOptions(args []string, stderr io.Writer) parseOutcome[tuiOptions] {
 	options := tuiOptions{}
 	flags := flag.NewFlagSet("yamdl", flag.ContinueOnError)
 	flags.SetOutput(stderr)
+	registerAccountFlags(flags, &options.accountFlags)
+	registerLosslessFlags(flags, &options.losslessFlags)
+	registerHistoryFlags(flags, &options.historyFlags)
 	registerSharedFlags(flags, &options.sharedFlags)
 	if err := flags.Parse(args); err != nil {
 		if errors.Is(err, flag.ErrHelp) {
@@ -65,6 +149,10 @@ func parseTUIOptions(args []string, stderr io.Writer) parseOutcome[tuiOptions] {
 		fmt.Fprintln(stderr, err)
 		return parseOutcome[tuiOptions]{exitCode: 2}
 	}
+	if err := validateLosslessFlags(&options.losslessFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[tuiOptions]{exitCode: 2}
+	}
 	return parseOutcome[tuiOptions]{options: options, proceed: true}
 }
 
@@ -72,11 +160,23 @@ func parseDownloadOptions(args []string, stderr io.Writer) parseOutcome[download
 	options := downloadOptions{format: ya.AudioFormatMP3, output: defaultOutputDir}
 	flags := flag.NewFlagSet("yamdl download", flag.ContinueOnError)
 	flags.SetOutput(stderr)
-	flags.StringVar(&options.token, "token", "", "Yandex Music authentication token (required)")
+	flags.StringVar(&options.token, "token", "", "Yandex Music authentication token (required unless --account is given)")
 	flags.StringVar(&options.link, "link", "", "Yandex Music track, album, playlist, or chart URL (required)")
 	format := string(options.format)
 	flags.StringVar(&format, "format", format, "audio format: mp3 or flac")
 	flags.StringVar(&options.output, "output", options.output, "directory for downloaded tracks")
+	flags.BoolVar(&options.upgrade, "upgrade", false, "replace existing MP3 files of the same tracks with lossless downloads (implies --format flac)")
+	flags.StringVar(&options.upgradeArchive, "upgrade-archive", "", "move replaced MP3 files to this directory instead of deleting them")
+	flags.StringVar(&options.retryFailed, "retry-failed", "", "download again only the tracks listed in a retry file from an earlier run, instead of --link")
+	flags.StringVar(&options.failOn, "fail-on", failOnError, "track outcomes that fail the command: error, skipped (errors and skips), or none")
+	flags.StringVar(&options.summaryFile, "summary-file", "", "write a JSON summary of the run to this file")
+	flags.StringVar(&options.feedBaseURL, "feed-base-url", "", "write "+feed.FileName+" for the podcast episodes in --output, linking them under this URL")
+	flags.BoolVar(&options.newEpisodes, "new-episodes", false, "download only tracks with no earlier download in the history, even if their files were deleted (for podcasts)")
+	registerAccountFlags(flags, &options.accountFlags)
+	registerLosslessFlags(flags, &options.losslessFlags)
+	registerTranscodeFlags(flags, &options.transcodeFlags)
+	registerHookFlags(flags, &options.hookFlags)
+	registerHistoryFlags(flags, &options.historyFlags)
 	registerSharedFlags(flags, &options.sharedFlags)
 	flags.Usage = func() {
 		fmt.Fprintln(stderr, "Usage: yamdl download --token TOKEN --link URL [options]")
@@ -92,23 +192,79 @@ func parseDownloadOptions(args []string, stderr io.Writer) parseOutcome[download
 		fmt.Fprintln(stderr, "download does not accept positional arguments")
 		return parseOutcome[downloadOptions]{exitCode: 2}
 	}
-	if strings.TrimSpace(options.token) == "" {
-		fmt.Fprintln(stderr, "--token is required")
+	if err := applyAccount(options.accountFlags, flags, &options.token, &options.output); err != nil {
+		fmt.Fprintln(stderr, err)
 		return parseOutcome[downloadOptions]{exitCode: 2}
 	}
-	if strings.TrimSpace(options.link) == "" {
+	options.retryFailed = strings.TrimSpace(options.retryFailed)
+	if strings.TrimSpace(options.link) == "" && options.retryFailed == "" {
 		fmt.Fprintln(stderr, "--link is required")
 		return parseOutcome[downloadOptions]{exitCode: 2}
 	}
+	if strings.TrimSpace(options.link) != "" && options.retryFailed != "" {
+		fmt.Fprintln(stderr, "--retry-failed cannot be combined with --link")
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
+	options.setFlags = make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		options.setFlags[f.Name] = true
+	})
 	if err := validateSharedFlags(options.sharedFlags); err != nil {
 		fmt.Fprintln(stderr, err)
 		return parseOutcome[downloadOptions]{exitCode: 2}
 	}
+	if err := validateHookFlags(&options.hookFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
+	options.failOn = strings.ToLower(strings.TrimSpace(options.failOn))
+	switch options.failOn {
+	case failOnError, failOnSkipped, failOnNone:
+	default:
+		fmt.Fprintln(stderr, "--fail-on must be error, skipped, or none")
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
+	options.summaryFile = strings.TrimSpace(options.summaryFile)
+	options.feedBaseURL = strings.TrimSpace(options.feedBaseURL)
+	if options.feedBaseURL != "" {
+		if err := feed.ValidateBaseURL(options.feedBaseURL); err != nil {
+			fmt.Fprintf(stderr, "--feed-base-url: %v\n", err)
+			return parseOutcome[downloadOptions]{exitCode: 2}
+		}
+	}
+	if options.newEpisodes && options.noHistory {
+		fmt.Fprintln(stderr, "--new-episodes reads the history and cannot be combined with --no-history")
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
 	options.format = ya.AudioFormat(strings.ToLower(strings.TrimSpace(format)))
 	if options.format != ya.AudioFormatMP3 && options.format != ya.AudioFormatFLAC {
 		fmt.Fprintln(stderr, "--format must be mp3 or flac")
 		return parseOutcome[downloadOptions]{exitCode: 2}
 	}
+	options.upgradeArchive = strings.TrimSpace(options.upgradeArchive)
+	if options.upgradeArchive != "" && !options.upgrade {
+		fmt.Fprintln(stderr, "--upgrade-archive requires --upgrade")
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
+	if options.upgrade {
+		if options.setFlags["format"] && options.format != ya.AudioFormatFLAC {
+			fmt.Fprintln(stderr, "--upgrade requires --format flac")
+			return parseOutcome[downloadOptions]{exitCode: 2}
+		}
+		options.format = ya.AudioFormatFLAC
+	}
+	if err := validateLosslessFlags(&options.losslessFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
+	if err := resolveTranscodeFlags(&options.transcodeFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
+	if options.upgrade && options.profile != nil {
+		fmt.Fprintln(stderr, "--upgrade cannot be combined with --transcode")
+		return parseOutcome[downloadOptions]{exitCode: 2}
+	}
 	options.output = strings.TrimSpace(options.output)
 	if options.output == "" {
 		fmt.Fprintln(stderr, "--output must not be empty")
@@ -0,0 +1,256 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/history"
+	"ya-music/utils"
+	"ya-music/ya/model"
+)
+
+type historyFlags struct {
+	historyFile string
+	noHistory   bool
+}
+
+func registerHistoryFlags(fs *flag.FlagSet, dest *historyFlags) {
+	fs.StringVar(&dest.historyFile, "history-file", history.DefaultPath, "database that records every download for 'yamdl history'")
+	fs.BoolVar(&dest.noHistory, "no-history", false, "do not record downloads in the history")
+}
+
+// historyStore returns nil when recording is disabled.
+func (f historyFlags) historyStore() *history.Store {
+	if f.noHistory {
+		return nil
+	}
+	return history.Open(strings.TrimSpace(f.historyFile))
+}
+
+// newEpisodes drops tracks with a successful download in the history, so
+// podcasts can be pulled incrementally after old episodes were deleted.
+func newEpisodes(store *history.Store, tracks []model.Track) ([]model.Track, error) {
+	ids := make([]string, len(tracks))
+	for i, track := range tracks {
+		ids[i] = track.ID.String()
+	}
+	downloaded, err := store.Downloaded(ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	var fresh []model.Track
+	for _, track := range tracks {
+		if _, ok := downloaded[track.ID.String()]; !ok {
+			fresh = append(fresh, track)
+		}
+	}
+	return fresh, nil
+}
+
+// closeHistory releases the history database at the end of a run.
+func closeHistory(store *history.Store, stderr io.Writer, logger *utils.DownloadLogger) {
+	if err := store.Close(); err != nil {
+		fmt.Fprintf(stderr, "[history] %v\n", err)
+		logger.Error("history close failed", "stage", "history", "error", err)
+	}
+}
+
+// recordHistory forwards events unchanged and records terminal ones. Only the
+// first write failure is reported; downloads continue without history.
+func recordHistory(
+	events <-chan batch.Event,
+	recorder *history.Recorder,
+	stderr io.Writer,
+	logger *utils.DownloadLogger,
+) <-chan batch.Event {
+	forwarded := make(chan batch.Event)
+	go func() {
+		defer close(forwarded)
+		failed := false
+		for event := range events {
+			if !failed {
+				if err := recorder.Observe(event); err != nil {
+					failed = true
+					fmt.Fprintf(stderr, "[history] %v\n", err)
+					logger.Error("history write failed", "stage", "history", "error", err)
+				}
+			}
+			forwarded <- event
+		}
+	}()
+	return forwarded
+}
+
+type historyOptions struct {
+	file   string
+	filter history.Filter
+	export string
+	limit  int
+}
+
+func parseHistoryOptions(args []string, stderr io.Writer, now time.Time) parseOutcome[historyOptions] {
+	options := historyOptions{file: history.DefaultPath}
+	var since, until, status string
+	flags := flag.NewFlagSet("yamdl history", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&options.file, "file", options.file, "history database to read")
+	flags.StringVar(&since, "since", "", "only downloads at or after a date (2006-01-02), RFC 3339 time, or age such as 7d or 12h")
+	flags.StringVar(&until, "until", "", "only downloads before a time; a date includes the whole day")
+	flags.StringVar(&status, "status", "", "only records with status done, skipped, or error")
+	flags.StringVar(&options.filter.Artist, "artist", "", "only tracks whose artists contain this text")
+	flags.StringVar(&options.filter.Source, "source", "", "only downloads whose source URL contains this text")
+	flags.StringVar(&options.export, "export", "", "print records as csv or json instead of a table")
+	flags.IntVar(&options.limit, "limit", 0, "show only the latest N matching records (0 shows all)")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: yamdl history [options]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return parseOutcome[historyOptions]{exitCode: 0}
+		}
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "history does not accept positional arguments")
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+
+	var err error
+	if options.filter.Since, err = parseHistoryTime(since, now, false); err != nil {
+		fmt.Fprintf(stderr, "--since: %v\n", err)
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+	if options.filter.Until, err = parseHistoryTime(until, now, true); err != nil {
+		fmt.Fprintf(stderr, "--until: %v\n", err)
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+	options.filter.Status = history.Status(strings.ToLower(strings.TrimSpace(status)))
+	switch options.filter.Status {
+	case "", history.StatusDone, history.StatusSkipped, history.StatusError:
+	default:
+		fmt.Fprintln(stderr, "--status must be done, skipped, or error")
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+	options.export = strings.ToLower(strings.TrimSpace(options.export))
+	if options.export != "" && options.export != "csv" && options.export != "json" {
+		fmt.Fprintln(stderr, "--export must be csv or json")
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+	if options.limit < 0 {
+		fmt.Fprintln(stderr, "--limit must be >= 0")
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+	options.file = strings.TrimSpace(options.file)
+	if options.file == "" {
+		fmt.Fprintln(stderr, "--file must not be empty")
+		return parseOutcome[historyOptions]{exitCode: 2}
+	}
+	return parseOutcome[historyOptions]{options: options, proceed: true}
+}
+
+// parseHistoryTime accepts a local date, an RFC 3339 time, or an age relative
+// to now such as 7d or 12h. With endOfDay a date means the following midnight.
+func parseHistoryTime(value string, now time.Time, endOfDay bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		if endOfDay {
+			return date.AddDate(0, 0, 1), nil
+		}
+		return date, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if count, err := strconv.Atoi(days); err == nil && count >= 0 {
+			return now.AddDate(0, 0, -count), nil
+		}
+	}
+	if age, err := time.ParseDuration(value); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q; use 2006-01-02, an RFC 3339 time, or an age such as 7d", value)
+}
+
+func runHistory(args []string, stdout, stderr io.Writer) int {
+	parsed := parseHistoryOptions(args, stderr, time.Now())
+	if !parsed.proceed {
+		return parsed.exitCode
+	}
+	options := parsed.options
+
+	records, err := history.Open(options.file).Query(options.filter)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if options.limit > 0 && len(records) > options.limit {
+		records = records[len(records)-options.limit:]
+	}
+
+	switch options.export {
+	case "csv":
+		err = history.WriteCSV(stdout, records)
+	case "json":
+		err = history.WriteJSON(stdout, records)
+	default:
+		err = writeHistoryTable(stdout, records)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func writeHistoryTable(w io.Writer, records []history.Record) error {
+	if len(records) == 0 {
+		_, err := fmt.Fprintln(w, "No matching downloads")
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TIME\tSTATUS\tFORMAT\tSIZE\tTRACK\tDETAILS")
+	for _, record := range records {
+		track := record.Title
+		if record.Artists != "" {
+			track = record.Artists + " - " + record.Title
+		}
+		details := record.Path
+		switch {
+		case record.Error != "":
+			details = record.Error
+		case record.Reason != "":
+			details = record.Reason
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Time.Local().Format(time.DateTime),
+			record.Status,
+			record.Format,
+			formatFileSize(record.Size),
+			track,
+			details,
+		)
+	}
+	return table.Flush()
+}
+
+func formatFileSize(size int64) string {
+	switch {
+	case size <= 0:
+		return ""
+	case size < 1<<20:
+		return fmt.Sprintf("%.0f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	}
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/history"
+	"ya-music/utils"
+	"ya-music/ya/model"
+)
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2026, 10, 19, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"", false, time.Time{}},
+		{"2026-10-01", false, time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)},
+		{"2026-10-01", true, time.Date(2026, 10, 2, 0, 0, 0, 0, time.Local)},
+		{"2026-10-01T08:30:00Z", true, time.Date(2026, 10, 1, 8, 30, 0, 0, time.UTC)},
+		{"7d", false, now.AddDate(0, 0, -7)},
+		{"12h", false, now.Add(-12 * time.Hour)},
+	}
+	for _, test := range tests {
+		got, err := parseHistoryTime(test.value, now, test.endOfDay)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.value, err)
+		}
+		if !got.Equal(test.want) {
+			t.Fatalf("%q: got %v, want %v", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{"yesterday", "-3d", "2026-13-01"} {
+		if _, err := parseHistoryTime(value, now, false); err == nil {
+			t.Fatalf("%q: expected error", value)
+		}
+	}
+}
+
+func TestParseHistoryOptionsRejectsInvalidInput(t *testing.T) {
+	tests := map[string][]string{
+		"--status must be done, skipped, or error": {"--status", "ok"},
+		"--export must be csv or json":             {"--export", "xml"},
+		"--limit must be >= 0":                     {"--limit", "-1"},
+		"--since: invalid time":                    {"--since", "soon"},
+		"history does not accept positional":       {"extra"},
+	}
+	for want, args := range tests {
+		var stderr bytes.Buffer
+		parsed := parseHistoryOptions(args, &stderr, time.Now())
+		if parsed.proceed || parsed.exitCode != 2 {
+			t.Fatalf("args %q: proceed = %v, exit code = %d", args, parsed.proceed, parsed.exitCode)
+		}
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("args %q: stderr = %q, want %q", args, stderr.String(), want)
+		}
+	}
+}
+
+func TestRunHistoryFiltersAndExports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store := history.Open(path)
+	if err := store.Append(
+		history.Record{Time: time.Now().Add(-48 * time.Hour), TrackID: "1", Title: "Old", Artists: "Alpha", Status: history.StatusDone},
+		history.Record{Time: time.Now(), TrackID: "2", Title: "New", Artists: "Alpha", Status: history.StatusDone, Size: 3 << 20, Path: "downloads/New.mp3"},
+		history.Record{Time: time.Now(), TrackID: "3", Title: "Broken", Artists: "Beta", Status: history.StatusError, Error: "boom"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"history", "--file", path, "--since", "1d", "--artist", "alpha"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "TIME") {
+		t.Fatalf("stdout = %q", stdout.String())
+	}
+	if !strings.Contains(lines[1], "Alpha - New") || !strings.Contains(lines[1], "3.0 MB") || !strings.Contains(lines[1], "downloads/New.mp3") {
+		t.Fatalf("row = %q", lines[1])
+	}
+
+	stdout.Reset()
+	code = Run([]string{"history", "--file", path, "--status", "error", "--export", "csv"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d, stderr: %s", code, stderr.String())
+	}
+	lines = strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], ",3,Broken,Beta,") || !strings.Contains(lines[1], "boom") {
+		t.Fatalf("csv = %q", stdout.String())
+	}
+}
+
+func TestRecordHistoryForwardsEventsAndRecords(t *testing.T) {
+	store := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	events := make(chan batch.Event, 2)
+	events <- batch.Event{Index: 1, Track: model.Track{ID: model.FlexibleID("1")}, Status: batch.StatusDownloading}
+	events <- batch.Event{Index: 1, Track: model.Track{ID: model.FlexibleID("1")}, Status: batch.StatusSkipped, Reason: batch.SkipAlreadyExists}
+	close(events)
+
+	var stderr bytes.Buffer
+	forwarded := 0
+	for range recordHistory(events, history.NewRecorder(store, "link"), &stderr, utils.NewDiscardDownloadLogger()) {
+		forwarded++
+	}
+
+	records, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forwarded != 2 || len(records) != 1 || records[0].Reason != batch.SkipAlreadyExists || stderr.Len() != 0 {
+		t.Fatalf("forwarded = %d, records = %#v, stderr = %q", forwarded, records, stderr.String())
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/hook"
+	"ya-music/utils"
+)
+
+type hookFlags struct {
+	onTrackDone string
+	onBatchDone string
+	hookTimeout time.Duration
+}
+
+func registerHookFlags(fs *flag.FlagSet, dest *hookFlags) {
+	fs.StringVar(&dest.onTrackDone, "on-track-done", "", "shell command run after each track with a JSON payload on stdin")
+	fs.StringVar(&dest.onBatchDone, "on-batch-done", "", "shell command run after the batch with a JSON summary on stdin")
+	fs.DurationVar(&dest.hookTimeout, "hook-timeout", hook.DefaultTimeout, "maximum run time of one hook command (0 disables)")
+}
+
+func validateHookFlags(options *hookFlags) error {
+	options.onTrackDone = strings.TrimSpace(options.onTrackDone)
+	options.onBatchDone = strings.TrimSpace(options.onBatchDone)
+	if options.hookTimeout < 0 {
+		return errors.New("--hook-timeout must be >= 0")
+	}
+	return nil
+}
+
+// batchHooks runs track hooks in the background while events keep flowing,
+// so a slow hook never stalls downloads, and runs the batch hook once every
+// track hook has finished. Hook failures are reported and otherwise ignored.
+type batchHooks struct {
+	options hookFlags
+	stderr  io.Writer
+	logger  *utils.DownloadLogger
+
+	queue  chan batch.Event
+	done   chan struct{}
+	tracks []hook.TrackPayload
+}
+
+func newBatchHooks(options hookFlags, stderr io.Writer, logger *utils.DownloadLogger) *batchHooks {
+	return &batchHooks{options: options, stderr: stderr, logger: logger}
+}
+
+// wrap forwards events unchanged and queues terminal ones for the track hook.
+// total bounds the number of terminal events, so queueing never blocks.
+func (h *batchHooks) wrap(events <-chan batch.Event, total int) <-chan batch.Event {
+	h.queue = make(chan batch.Event, total)
+	h.done = make(chan struct{})
+	go h.runTrackHooks()
+
+	forwarded := make(chan batch.Event)
+	go func() {
+		defer close(forwarded)
+		defer close(h.queue)
+		for event := range events {
+			forwarded <- event
+			if event.Terminal() {
+				h.queue <- event
+			}
+		}
+	}()
+	return forwarded
+}
+
+func (h *batchHooks) runTrackHooks() {
+	defer close(h.done)
+	for event := range h.queue {
+		payload := hook.NewTrackPayload(event)
+		h.tracks = append(h.tracks, payload)
+		if h.options.onTrackDone == "" {
+			continue
+		}
+		if err := hook.RunPayload(context.Background(), h.options.onTrackDone, h.options.hookTimeout, payload, h.stderr, h.stderr); err != nil {
+			h.report("on-track-done", err, "track_id", payload.Track.ID)
+		}
+	}
+}
+
+// finish waits for queued track hooks and then runs the batch hook.
+func (h *batchHooks) finish(payload hook.BatchPayload) {
+	if h.done != nil {
+		<-h.done
+	}
+	if h.options.onBatchDone == "" {
+		return
+	}
+	payload.Event = hook.EventBatchDone
+	payload.Tracks = h.tracks
+	if payload.Tracks == nil {
+		payload.Tracks = []hook.TrackPayload{}
+	}
+	if err := hook.RunPayload(context.Background(), h.options.onBatchDone, h.options.hookTimeout, payload, h.stderr, h.stderr); err != nil {
+		h.report("on-batch-done", err)
+	}
+}
+
+func (h *batchHooks) report(name string, err error, attrs ...any) {
+	fmt.Fprintf(h.stderr, "[hook] %s: %v\n", name, err)
+	if h.logger != nil {
+		h.logger.Error("hook failed", append([]any{"hook", name, "error", err}, attrs...)...)
+	}
+}
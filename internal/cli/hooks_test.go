@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/hook"
+	"ya-music/ya/model"
+)
+
+func TestBatchHooksRunForTerminalEventsThenBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+	dir := t.TempDir()
+	trackLog := filepath.Join(dir, "tracks.txt")
+	batchLog := filepath.Join(dir, "batch.json")
+
+	var stderr bytes.Buffer
+	hooks := newBatchHooks(hookFlags{
+		onTrackDone: `echo "$YAMDL_INDEX $YAMDL_STATUS" >> "` + trackLog + `"; [ "$YAMDL_STATUS" != error ]`,
+		onBatchDone: `cat > "` + batchLog + `"`,
+		hookTimeout: time.Minute,
+	}, &stderr, nil)
+
+	source := make(chan batch.Event, 4)
+	source <- batch.Event{Index: 1, Track: model.Track{ID: "1"}, Status: batch.StatusDownloading}
+	source <- batch.Event{Index: 1, Track: model.Track{ID: "1"}, Status: batch.StatusDone, Path: "one.mp3"}
+	source <- batch.Event{Index: 2, Track: model.Track{ID: "2"}, Status: batch.StatusError, Reason: "boom"}
+	close(source)
+
+	var forwarded int
+	for range hooks.wrap(source, 2) {
+		forwarded++
+	}
+	hooks.finish(hook.BatchPayload{Total: 2, Downloaded: 1, Failed: 1})
+
+	if forwarded != 3 {
+		t.Fatalf("forwarded %d events, want 3", forwarded)
+	}
+	tracks, err := os.ReadFile(trackLog)
+	if err != nil || string(tracks) != "1 done\n2 error\n" {
+		t.Fatalf("track hook log = %q, err = %v", tracks, err)
+	}
+	if !strings.Contains(stderr.String(), "[hook] on-track-done:") {
+		t.Fatalf("failed hook was not reported: %q", stderr.String())
+	}
+
+	data, err := os.ReadFile(batchLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload hook.BatchPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != hook.EventBatchDone || payload.Failed != 1 || len(payload.Tracks) != 2 || payload.Tracks[0].Path != "one.mp3" {
+		t.Fatalf("unexpected batch payload: %#v", payload)
+	}
+}
+
+func TestParseDownloadOptionsRejectsNegativeHookTimeout(t *testing.T) {
+	var stderr bytes.Buffer
+	parsed := parseDownloadOptions([]string{"--token", "abc", "--link", "https://music.yandex.ru/track/1", "--hook-timeout", "-1s"}, &stderr)
+	if parsed.proceed || parsed.exitCode != 2 || !strings.Contains(stderr.String(), "--hook-timeout must be >= 0") {
+		t.Fatalf("proceed = %v, exit code = %d, stderr = %q", parsed.proceed, parsed.exitCode, stderr.String())
+	}
+}
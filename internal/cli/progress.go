@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"ya-music/internal/batch"
+
+	"github.com/charmbracelet/x/ansi"
+	"github.com/charmbracelet/x/term"
+)
+
+// progressRedrawInterval limits how often byte progress repaints the
+// terminal between lifecycle lines.
+const progressRedrawInterval = 100 * time.Millisecond
+
+// progressLabelWidth is the widest track label of a progress line.
+const progressLabelWidth = 40
+
+// liveProgress keeps per-track and total byte progress at the bottom of a
+// terminal while lifecycle lines scroll above it.
+type liveProgress struct {
+	out   io.Writer
+	total int
+	now   func() time.Time
+
+	started   time.Time
+	tracks    map[int]*trackBytes
+	order     []int
+	finished  int
+	completed int
+	doneBytes int64
+	lines     int
+	drawn     time.Time
+}
+
+type trackBytes struct {
+	label   string
+	written int64
+	size    int64
+	started time.Time
+}
+
+// newTerminalProgress returns a live progress display for a batch of total
+// tracks, or nil when stdout is not a terminal.
+func newTerminalProgress(stdout io.Writer, total int) *liveProgress {
+	file, ok := stdout.(*os.File)
+	if !ok || !term.IsTerminal(file.Fd()) {
+		return nil
+	}
+	return newLiveProgress(stdout, total, time.Now)
+}
+
+func newLiveProgress(out io.Writer, total int, now func() time.Time) *liveProgress {
+	return &liveProgress{
+		out:     out,
+		total:   total,
+		now:     now,
+		started: now(),
+		tracks:  make(map[int]*trackBytes),
+	}
+}
+
+// line prints the lifecycle line of event above the progress lines.
+func (p *liveProgress) line(event batch.Event, text string) {
+	p.clear()
+	fmt.Fprintln(p.out, text)
+
+	switch {
+	case event.Status == batch.StatusDownloading:
+		if _, ok := p.tracks[event.Index]; !ok {
+			p.order = append(p.order, event.Index)
+		}
+		p.tracks[event.Index] = &trackBytes{
+			label:   event.Track.DisplayLabel(),
+			size:    -1,
+			started: p.now(),
+		}
+	case event.Terminal():
+		p.finished++
+		if track, ok := p.tracks[event.Index]; ok {
+			if event.Status == batch.StatusDone {
+				p.completed++
+				p.doneBytes += track.written
+			}
+			delete(p.tracks, event.Index)
+			p.order = removeIndex(p.order, event.Index)
+		}
+	}
+	p.draw()
+}
+
+// update records the bytes of a progress event.
+func (p *liveProgress) update(event batch.Event) {
+	track, ok := p.tracks[event.Index]
+	if !ok {
+		return
+	}
+	track.written = event.Bytes
+	track.size = event.TotalBytes
+	if p.now().Sub(p.drawn) < progressRedrawInterval {
+		return
+	}
+	p.clear()
+	p.draw()
+}
+
+// clear erases the progress lines so regular output can follow.
+func (p *liveProgress) clear() {
+	if p.lines == 0 {
+		return
+	}
+	fmt.Fprintf(p.out, "\x1b[%dF\x1b[J", p.lines)
+	p.lines = 0
+}
+
+func (p *liveProgress) draw() {
+	now := p.now()
+	p.drawn = now
+	if len(p.order) == 0 {
+		return
+	}
+	for _, index := range p.order {
+		fmt.Fprintln(p.out, p.trackLine(p.tracks[index], now))
+		p.lines++
+	}
+	fmt.Fprintln(p.out, p.totalLine(now))
+	p.lines++
+}
+
+func (p *liveProgress) trackLine(track *trackBytes, now time.Time) string {
+	label := ansi.Truncate(track.label, progressLabelWidth, "…")
+	parts := []string{"  " + label, formatProgressBytes(track.written, track.size)}
+	speed := bytesPerSecond(track.written, now.Sub(track.started))
+	if speed > 0 {
+		parts = append(parts, formatSpeed(speed))
+		if track.size > track.written {
+			parts = append(parts, "ETA "+formatETA(float64(track.size-track.written)/speed))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+func (p *liveProgress) totalLine(now time.Time) string {
+	written := p.doneBytes
+	var remaining int64
+	sized := true
+	for _, track := range p.tracks {
+		written += track.written
+		if track.size < 0 {
+			sized = false
+			continue
+		}
+		remaining += track.size - track.written
+	}
+	pending := p.total - p.finished - len(p.tracks)
+	if pending > 0 {
+		if p.completed == 0 {
+			sized = false
+		} else {
+			remaining += int64(pending) * (p.doneBytes / int64(p.completed))
+		}
+	}
+
+	parts := []string{fmt.Sprintf("Total: %d/%d tracks", p.finished, p.total), formatProgressBytes(written, -1)}
+	speed := bytesPerSecond(written, now.Sub(p.started))
+	if speed > 0 {
+		parts = append(parts, formatSpeed(speed))
+		if sized && remaining > 0 {
+			parts = append(parts, "ETA "+formatETA(float64(remaining)/speed))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+func removeIndex(order []int, index int) []int {
+	for i, candidate := range order {
+		if candidate == index {
+			return append(order[:i], order[i+1:]...)
+		}
+	}
+	return order
+}
+
+func bytesPerSecond(written int64, elapsed time.Duration) float64 {
+	if written <= 0 || elapsed <= 0 {
+		return 0
+	}
+	return float64(written) / elapsed.Seconds()
+}
+
+func formatProgressBytes(written, size int64) string {
+	if size <= 0 {
+		return fmt.Sprintf("%.1f MB", float64(written)/(1<<20))
+	}
+	return fmt.Sprintf("%.1f/%.1f MB", float64(written)/(1<<20), float64(size)/(1<<20))
+}
+
+func formatSpeed(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.1f MB/s", bytesPerSecond/(1<<20))
+}
+
+func formatETA(seconds float64) string {
+	total := int(seconds + 0.5)
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/ya/model"
+)
+
+func TestConsumeDownloadEventsRendersLiveProgress(t *testing.T) {
+	track := model.Track{Title: "Song", Artists: []model.Artist{{Name: "Artist"}}}
+	events := make(chan batch.Event, 4)
+	events <- batch.Event{Index: 1, Track: track, Status: batch.StatusDownloading}
+	events <- batch.Event{Index: 1, Track: track, Status: batch.StatusProgress, Bytes: 1 << 20, TotalBytes: 4 << 20}
+	events <- batch.Event{Index: 1, Track: track, Status: batch.StatusDone}
+	close(events)
+
+	started := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := started
+	clock := func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	var stdout bytes.Buffer
+	live := newLiveProgress(&stdout, 2, clock)
+
+	summary, _ := consumeDownloadEventsWithFlush(&stdout, events, nil, nil, nil, nil, nil, live)
+
+	if summary.downloaded != 1 {
+		t.Fatalf("summary = %#v", summary)
+	}
+	output := stdout.String()
+	for _, want := range []string{
+		"[downloading] Artist — Song\n",
+		"  Artist — Song  1.0/4.0 MB  0.3 MB/s  ETA 0:09\n",
+		"Total: 0/2 tracks  1.0 MB",
+		"\x1b[2F\x1b[J[done] Artist — Song\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("output %q does not contain %q", output, want)
+		}
+	}
+	if strings.Contains(output, "[progress]") {
+		t.Fatalf("progress event printed as a line: %q", output)
+	}
+	if !strings.HasSuffix(output, "[done] Artist — Song\n") {
+		t.Fatalf("progress lines left after the last track: %q", output)
+	}
+}
+
+func TestConsumeDownloadEventsIgnoresProgressWithoutTerminal(t *testing.T) {
+	events := make(chan batch.Event, 2)
+	events <- batch.Event{Index: 1, Status: batch.StatusProgress, Bytes: 10, TotalBytes: 20}
+	events <- batch.Event{Index: 1, Status: batch.StatusDone}
+	close(events)
+
+	var stdout bytes.Buffer
+	summary, _ := consumeDownloadEvents(&stdout, events, nil, nil, nil, nil)
+
+	if summary.downloaded != 1 || strings.Count(stdout.String(), "\n") != 1 {
+		t.Fatalf("summary = %#v, stdout = %q", summary, stdout.String())
+	}
+}
+
+func TestLiveProgressTotalEstimatesPendingTracks(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	live := newLiveProgress(&bytes.Buffer{}, 3, func() time.Time { return now })
+	live.line(batch.Event{Index: 1, Status: batch.StatusDownloading}, "")
+	live.update(batch.Event{Index: 1, Status: batch.StatusProgress, Bytes: 2 << 20, TotalBytes: 2 << 20})
+	live.line(batch.Event{Index: 1, Status: batch.StatusDone}, "")
+
+	got := live.totalLine(now.Add(2 * time.Second))
+
+	if want := "Total: 1/3 tracks  2.0 MB  1.0 MB/s  ETA 0:04"; got != want {
+		t.Fatalf("total line = %q, want %q", got, want)
+	}
+}
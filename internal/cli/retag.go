@@ -0,0 +1,260 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+type retagOptions struct {
+	token string
+	dir   string
+	accountFlags
+	sharedFlags
+}
+
+type retagClient interface {
+	TrackInfoContext(ctx context.Context, id string) (*model.Track, error)
+	RetagFileContext(ctx context.Context, path string, track model.Track, options ya.DownloadOptions) error
+}
+
+type retagSummary struct {
+	retagged int
+	skipped  int
+	failed   int
+}
+
+type retagEntry struct {
+	path  string
+	track model.Track
+}
+
+func parseRetagOptions(args []string, stderr io.Writer) parseOutcome[retagOptions] {
+	options := retagOptions{}
+	flags := flag.NewFlagSet("yamdl retag", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&options.token, "token", "", "Yandex Music authentication token (required unless --account is given)")
+	registerAccountFlags(flags, &options.accountFlags)
+	registerSharedFlags(flags, &options.sharedFlags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: yamdl retag --token TOKEN [options] DIR")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return parseOutcome[retagOptions]{exitCode: 0}
+		}
+		return parseOutcome[retagOptions]{exitCode: 2}
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "retag expects exactly one directory argument")
+		return parseOutcome[retagOptions]{exitCode: 2}
+	}
+	if err := applyAccount(options.accountFlags, flags, &options.token, nil); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[retagOptions]{exitCode: 2}
+	}
+	if err := validateSharedFlags(options.sharedFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[retagOptions]{exitCode: 2}
+	}
+	options.dir = strings.TrimSpace(flags.Arg(0))
+	if options.dir == "" {
+		fmt.Fprintln(stderr, "retag directory must not be empty")
+		return parseOutcome[retagOptions]{exitCode: 2}
+	}
+	options.token = strings.TrimSpace(options.token)
+	return parseOutcome[retagOptions]{options: options, proceed: true}
+}
+
+func runRetag(args []string, stdout, stderr io.Writer) int {
+	parsed := parseRetagOptions(args, stderr)
+	if !parsed.proceed {
+		return parsed.exitCode
+	}
+	options := parsed.options
+
+	info, err := os.Stat(options.dir)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to inspect retag directory: %v\n", err)
+		return 1
+	}
+	if !info.IsDir() {
+		fmt.Fprintln(stderr, "retag path must be a directory")
+		return 2
+	}
+
+	downloadLogger, client, err := newLoggedClient(options.sharedFlags, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer downloadLogger.Close()
+	client.SetToken(options.token)
+
+	interrupts := newInterruptSignals()
+	defer interrupts.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-interrupts.force:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	downloadLogger.Info("retag started", "dir", options.dir)
+	summary, interrupted, err := retagDirectory(ctx, client, options.dir, ya.DownloadOptions{
+		SkipCover:  options.skipCover,
+		ReplayGain: options.replayGain,
+	}, stdout, interrupts.first)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to scan retag directory: %v\n", err)
+		return 1
+	}
+	if interrupted {
+		fmt.Fprintln(stdout, "Interrupted: remaining files were left unchanged")
+	}
+
+	fmt.Fprintf(stdout, "\nFinished: %d retagged, %d skipped, %d failed\n",
+		summary.retagged,
+		summary.skipped,
+		summary.failed,
+	)
+	downloadLogger.Info("retag finished",
+		"retagged", summary.retagged,
+		"skipped", summary.skipped,
+		"failed", summary.failed,
+		"interrupted", interrupted,
+	)
+	if interrupted {
+		return 130
+	}
+	return 0
+}
+
+// retagDirectory resolves every supported audio file under dir before
+// rewriting any tags, so album loudness can be computed across the library.
+func retagDirectory(
+	ctx context.Context,
+	client retagClient,
+	dir string,
+	options ya.DownloadOptions,
+	stdout io.Writer,
+	interrupt <-chan struct{},
+) (summary retagSummary, interrupted bool, err error) {
+	paths, err := discoverRetagFiles(dir)
+	if err != nil {
+		return summary, false, err
+	}
+
+	stopRequested := func() bool {
+		select {
+		case <-interrupt:
+			return true
+		default:
+			return false
+		}
+	}
+	display := func(path string) string {
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			return rel
+		}
+		return path
+	}
+
+	tracksByID := make(map[string]model.Track)
+	entries := make([]retagEntry, 0, len(paths))
+	for _, path := range paths {
+		if stopRequested() {
+			return summary, true, nil
+		}
+
+		trackID, err := ya.ReadSourceTrackID(path)
+		if errors.Is(err, ya.ErrNoSourceTrackID) {
+			fmt.Fprintf(stdout, "[skipped] %s: no Yandex track ID\n", display(path))
+			summary.skipped++
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "[failed] %s: %v\n", display(path), err)
+			summary.failed++
+			continue
+		}
+
+		track, ok := tracksByID[trackID]
+		if !ok {
+			info, err := client.TrackInfoContext(ctx, trackID)
+			if err != nil {
+				fmt.Fprintf(stdout, "[failed] %s: fetch track %s: %v\n", display(path), trackID, err)
+				summary.failed++
+				continue
+			}
+			track = *info
+			tracksByID[trackID] = track
+		}
+		entries = append(entries, retagEntry{path: path, track: track})
+	}
+
+	var albumLoudness map[string]model.R128
+	if options.ReplayGain {
+		tracks := make([]model.Track, 0, len(entries))
+		for _, entry := range entries {
+			tracks = append(tracks, entry.track)
+		}
+		albumLoudness = ya.AlbumLoudness(tracks)
+	}
+
+	for _, entry := range entries {
+		if stopRequested() {
+			return summary, true, nil
+		}
+
+		trackOptions := options
+		if albumLoudness != nil {
+			trackOptions.AlbumLoudness = ya.AlbumLoudnessFor(albumLoudness, entry.track)
+		}
+		if err := client.RetagFileContext(ctx, entry.path, entry.track, trackOptions); err != nil {
+			fmt.Fprintf(stdout, "[failed] %s: %v\n", display(entry.path), err)
+			summary.failed++
+			continue
+		}
+		fmt.Fprintf(stdout, "[retagged] %s\n", display(entry.path))
+		summary.retagged++
+	}
+	return summary, false, nil
+}
+
+// discoverRetagFiles lists supported audio files in lexical order, ignoring
+// hidden files such as in-progress artifact temp files.
+func discoverRetagFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if _, ok := ya.RetagFormat(path); ok {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, err
+}
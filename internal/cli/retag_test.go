@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+type fakeRetagClient struct {
+	tracks     map[string]model.Track
+	infoCalls  []string
+	retagged   []string
+	retagErr   map[string]error
+	lastOption ya.DownloadOptions
+}
+
+func (c *fakeRetagClient) TrackInfoContext(_ context.Context, id string) (*model.Track, error) {
+	c.infoCalls = append(c.infoCalls, id)
+	track, ok := c.tracks[id]
+	if !ok {
+		return nil, errors.New("track not found")
+	}
+	return &track, nil
+}
+
+func (c *fakeRetagClient) RetagFileContext(_ context.Context, path string, _ model.Track, options ya.DownloadOptions) error {
+	c.lastOption = options
+	if err := c.retagErr[filepath.Base(path)]; err != nil {
+		return err
+	}
+	c.retagged = append(c.retagged, filepath.Base(path))
+	return nil
+}
+
+func writeTaggedMP3(t *testing.T, path, trackID string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("audio payload"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if trackID == "" {
+		return
+	}
+	client := ya.NewClient(nil)
+	track := model.Track{ID: model.FlexibleID(trackID), Title: "Song"}
+	if err := client.RetagFile(path, track, ya.DownloadOptions{SkipCover: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetagDirectoryRetagsTaggedFilesAndReportsTheRest(t *testing.T) {
+	dir := t.TempDir()
+	writeTaggedMP3(t, filepath.Join(dir, "a.mp3"), "1")
+	writeTaggedMP3(t, filepath.Join(dir, "nested", "b.mp3"), "1")
+	writeTaggedMP3(t, filepath.Join(dir, "c.mp3"), "")
+	writeTaggedMP3(t, filepath.Join(dir, "d.mp3"), "404")
+	writeTaggedMP3(t, filepath.Join(dir, "e.mp3"), "2")
+	writeTaggedMP3(t, filepath.Join(dir, ".hidden.mp3.artifact-1"), "")
+	if err := os.WriteFile(filepath.Join(dir, "cover.jpg"), []byte("jpg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeRetagClient{
+		tracks: map[string]model.Track{
+			"1": {ID: "1", Title: "One"},
+			"2": {ID: "2", Title: "Two"},
+		},
+		retagErr: map[string]error{"e.mp3": errors.New("disk full")},
+	}
+	var stdout bytes.Buffer
+	summary, interrupted, err := retagDirectory(context.Background(), client, dir, ya.DownloadOptions{SkipCover: true}, &stdout, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interrupted {
+		t.Fatal("expected interrupted = false")
+	}
+	if summary != (retagSummary{retagged: 2, skipped: 1, failed: 2}) {
+		t.Fatalf("unexpected summary: %#v", summary)
+	}
+	if got := strings.Join(client.infoCalls, ","); got != "1,404,2" {
+		t.Fatalf("TrackInfo calls = %q", got)
+	}
+	if got := strings.Join(client.retagged, ","); got != "a.mp3,b.mp3" {
+		t.Fatalf("retagged = %q", got)
+	}
+	if !client.lastOption.SkipCover {
+		t.Fatalf("options were not passed through: %#v", client.lastOption)
+	}
+	if got, want := stdout.String(), strings.Join([]string{
+		"[skipped] c.mp3: no Yandex track ID",
+		"[failed] d.mp3: fetch track 404: track not found",
+		"[retagged] a.mp3",
+		"[failed] e.mp3: disk full",
+		"[retagged] " + filepath.Join("nested", "b.mp3"),
+		"",
+	}, "\n"); got != want {
+		t.Fatalf("stdout = %q, want %q", got, want)
+	}
+}
+
+func TestRetagDirectoryStopsOnInterrupt(t *testing.T) {
+	dir := t.TempDir()
+	writeTaggedMP3(t, filepath.Join(dir, "a.mp3"), "1")
+	interrupt := make(chan struct{})
+	close(interrupt)
+
+	client := &fakeRetagClient{}
+	var stdout bytes.Buffer
+	summary, interrupted, err := retagDirectory(context.Background(), client, dir, ya.DownloadOptions{}, &stdout, interrupt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !interrupted || summary != (retagSummary{}) || len(client.infoCalls) != 0 {
+		t.Fatalf("interrupted = %v, summary = %#v, calls = %v", interrupted, summary, client.infoCalls)
+	}
+}
+
+func TestParseRetagOptions(t *testing.T) {
+	var stderr bytes.Buffer
+	parsed := parseRetagOptions([]string{"--token", " abc ", "--skip-cover", "--replaygain", "./music"}, &stderr)
+	if !parsed.proceed {
+		t.Fatalf("expected proceed, exit code = %d, stderr: %s", parsed.exitCode, stderr.String())
+	}
+	options := parsed.options
+	if options.token != "abc" || options.dir != "./music" || !options.skipCover || !options.replayGain {
+		t.Fatalf("unexpected options: %#v", options)
+	}
+
+	for _, args := range [][]string{
+		{"./music"},
+		{"--token", "abc"},
+		{"--token", "abc", "one", "two"},
+		{"--token", "abc", "--timeout", "-1", "./music"},
+	} {
+		stderr.Reset()
+		parsed := parseRetagOptions(args, &stderr)
+		if parsed.proceed || parsed.exitCode != 2 {
+			t.Fatalf("args %q: proceed = %v, exit code = %d", args, parsed.proceed, parsed.exitCode)
+		}
+	}
+}
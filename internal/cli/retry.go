@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/retry"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+// retryOptions describes the options of a batch for its retry list.
+func retryOptions(options downloadOptions) retry.Options {
+	saved := retry.Options{
+		Format:            string(options.format),
+		LosslessContainer: options.losslessContainer,
+		SkipCover:         options.skipCover,
+		ReplayGain:        options.replayGain,
+		Upgrade:           options.upgrade,
+		UpgradeArchive:    options.upgradeArchive,
+	}
+	if options.profile != nil {
+		saved.Transcode = options.profile.Name
+	}
+	return saved
+}
+
+// applyRetryOptions restores the options saved with a retry list. Flags given
+// on the command line take precedence.
+func applyRetryOptions(options *downloadOptions, saved retry.Options) error {
+	set := options.setFlags
+	if !set["format"] && saved.Format != "" {
+		options.format = ya.AudioFormat(saved.Format)
+		if options.format != ya.AudioFormatMP3 && options.format != ya.AudioFormatFLAC {
+			return fmt.Errorf("retry list has unknown format %q", saved.Format)
+		}
+	}
+	if !set["lossless-container"] && saved.LosslessContainer != "" {
+		options.losslessContainer = saved.LosslessContainer
+		if err := validateLosslessFlags(&options.losslessFlags); err != nil {
+			return fmt.Errorf("retry list: %w", err)
+		}
+	}
+	if !set["skip-cover"] {
+		options.skipCover = saved.SkipCover
+	}
+	if !set["replaygain"] {
+		options.replayGain = saved.ReplayGain
+	}
+	if !set["transcode"] && saved.Transcode != "" {
+		options.transcode = saved.Transcode
+		if err := resolveTranscodeFlags(&options.transcodeFlags); err != nil {
+			return fmt.Errorf("retry list: %w", err)
+		}
+	}
+	// A saved --upgrade yields to an explicit format or transcode profile.
+	if !set["upgrade"] && saved.Upgrade && options.profile == nil &&
+		(!set["format"] || options.format == ya.AudioFormatFLAC) {
+		options.upgrade = true
+		options.format = ya.AudioFormatFLAC
+		if !set["upgrade-archive"] {
+			options.upgradeArchive = saved.UpgradeArchive
+		}
+	}
+	if !set["output"] {
+		options.output = filepath.Dir(options.retryFailed)
+	}
+	return nil
+}
+
+type retryPreflightClient interface {
+	accountClient
+	TracksByIDs(ids []string) ([]model.Track, error)
+}
+
+// runRetryPreflight looks the failed tracks up again in batches. Tracks that
+// can no longer be found are reported and stay in the retry list.
+func runRetryPreflight(client retryPreflightClient, ids []string) downloadPreflightResult {
+	capabilities, err := validateAccount(client)
+	if err != nil {
+		return downloadPreflightResult{err: err}
+	}
+
+	result := downloadPreflightResult{warning: capabilities.Warning()}
+	tracks, err := client.TracksByIDs(ids)
+	if err != nil {
+		result.err = fmt.Errorf("%w: %w", errResolveSource, err)
+		return result
+	}
+	found := make(map[string]bool, len(tracks))
+	for _, track := range tracks {
+		found[track.ID.String()] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			result.missing = append(result.missing, fmt.Sprintf("%s: track not found", id))
+		}
+	}
+	result.tracks = tracks
+	if len(result.tracks) == 0 {
+		result.err = fmt.Errorf("%w: no track from the retry list could be looked up", errResolveSource)
+	}
+	return result
+}
+
+// updateRetryList merges the outcome of a batch into the retry list at path
+// and tells the user how to retry what still failed.
+func updateRetryList(
+	stdout, stderr io.Writer,
+	path string,
+	source string,
+	options downloadOptions,
+	events []batch.Event,
+) {
+	list, err := retry.Load(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to update retry list: %v\n", err)
+		return
+	}
+	list.Apply(source, retryOptions(options), events, time.Now())
+	if err := retry.Save(path, list); err != nil {
+		fmt.Fprintf(stderr, "failed to update retry list: %v\n", err)
+		return
+	}
+	if failed := countFailed(events); failed > 0 {
+		fmt.Fprintf(stdout, "Failed tracks saved to %s\nRetry them with: yamdl download --token TOKEN --retry-failed %s\n", path, path)
+	}
+}
+
+func countFailed(events []batch.Event) int {
+	failed := 0
+	for _, event := range events {
+		if event.Status == batch.StatusError {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"ya-music/internal/batch"
+	"ya-music/internal/retry"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+type fakeRetryClient struct {
+	fakeWatchClient
+	tracks  map[string]model.Track
+	batches int
+}
+
+func (*fakeRetryClient) Status() (*model.Status, error) {
+	return &model.Status{Account: model.Account{Uid: 1}, Plus: model.Plus{HasPlus: true}}, nil
+}
+
+func (c *fakeRetryClient) TracksByIDs(ids []string) ([]model.Track, error) {
+	c.batches++
+	var tracks []model.Track
+	for _, id := range ids {
+		if track, ok := c.tracks[id]; ok {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks, nil
+}
+
+func TestApplyRetryOptionsKeepsExplicitFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "music", retry.DefaultFilename)
+	parsed := parseDownloadOptions([]string{"--token", "t", "--retry-failed", path, "--format", "mp3"}, &bytes.Buffer{})
+	if !parsed.proceed {
+		t.Fatalf("parse failed: exit code %d", parsed.exitCode)
+	}
+	options := parsed.options
+
+	err := applyRetryOptions(&options, retry.Options{
+		Format:            "flac",
+		LosslessContainer: "flac",
+		SkipCover:         true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if options.format != ya.AudioFormatMP3 {
+		t.Fatalf("format = %q, want explicit mp3", options.format)
+	}
+	if options.container() != ya.LosslessContainerFLAC || !options.skipCover {
+		t.Fatalf("saved options not restored: %+v", options)
+	}
+	if options.output != filepath.Dir(path) {
+		t.Fatalf("output = %q, want retry list directory", options.output)
+	}
+}
+
+func TestRetryOptionsRoundTripUpgrade(t *testing.T) {
+	path := filepath.Join(t.TempDir(), retry.DefaultFilename)
+	saved := retryOptions(downloadOptions{upgrade: true, upgradeArchive: "old-mp3"})
+	if !saved.Upgrade || saved.UpgradeArchive != "old-mp3" {
+		t.Fatalf("saved = %+v", saved)
+	}
+
+	parsed := parseDownloadOptions([]string{"--token", "t", "--retry-failed", path}, &bytes.Buffer{})
+	if !parsed.proceed {
+		t.Fatalf("parse failed: exit code %d", parsed.exitCode)
+	}
+	options := parsed.options
+	if err := applyRetryOptions(&options, saved); err != nil {
+		t.Fatal(err)
+	}
+	if !options.upgrade || options.upgradeArchive != "old-mp3" || options.format != ya.AudioFormatFLAC {
+		t.Fatalf("upgrade not restored: %+v", options)
+	}
+
+	parsed = parseDownloadOptions([]string{"--token", "t", "--retry-failed", path, "--format", "mp3"}, &bytes.Buffer{})
+	options = parsed.options
+	if err := applyRetryOptions(&options, saved); err != nil {
+		t.Fatal(err)
+	}
+	if options.upgrade || options.format != ya.AudioFormatMP3 {
+		t.Fatalf("explicit --format mp3 lost to saved upgrade: %+v", options)
+	}
+}
+
+func TestApplyRetryOptionsRejectsUnknownFormat(t *testing.T) {
+	options := downloadOptions{retryFailed: retry.DefaultFilename}
+
+	err := applyRetryOptions(&options, retry.Options{Format: "ogg"})
+
+	if err == nil || !strings.Contains(err.Error(), `unknown format "ogg"`) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestRunRetryPreflightReportsMissingTracks(t *testing.T) {
+	client := &fakeRetryClient{tracks: map[string]model.Track{"1": {ID: model.FlexibleID("1")}}}
+
+	result := runRetryPreflight(client, []string{"1", "2"})
+
+	if result.err != nil || len(result.tracks) != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	if len(result.missing) != 1 || !strings.HasPrefix(result.missing[0], "2: track not found") {
+		t.Fatalf("missing = %q", result.missing)
+	}
+	if client.batches != 1 {
+		t.Fatalf("batches = %d, want one TracksByIDs call", client.batches)
+	}
+
+	result = runRetryPreflight(client, []string{"3"})
+	if result.err == nil {
+		t.Fatal("expected an error when no track can be looked up")
+	}
+}
+
+func TestUpdateRetryListWritesAndRemovesFailures(t *testing.T) {
+	path := retry.DefaultPath(t.TempDir())
+	track := model.Track{ID: model.FlexibleID("7"), Title: "Song"}
+	options := downloadOptions{}
+	options.format = ya.AudioFormatFLAC
+
+	var stdout, stderr bytes.Buffer
+	updateRetryList(&stdout, &stderr, path, "https://music.yandex.ru/album/1", options, []batch.Event{
+		{Track: track, Status: batch.StatusError, Reason: "boom", Stage: "download_link"},
+	})
+	list, err := retry.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 1 || list.Entries[0].Stage != "download_link" || list.Options.Format != "flac" {
+		t.Fatalf("list = %+v", list)
+	}
+	if !strings.Contains(stdout.String(), "--retry-failed "+path) {
+		t.Fatalf("stdout = %q", stdout.String())
+	}
+
+	stdout.Reset()
+	updateRetryList(&stdout, &stderr, path, "", options, []batch.Event{{Track: track, Status: batch.StatusDone}})
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("retry list still exists: %v", err)
+	}
+	if stdout.Len() != 0 || stderr.Len() != 0 {
+		t.Fatalf("stdout = %q, stderr = %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestRunDownloadWithEmptyRetryListDoesNothing(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	path := filepath.Join(t.TempDir(), retry.DefaultFilename)
+
+	code := Run([]string{"download", "--token", "t", "--retry-failed", path}, &stdout, &stderr)
+
+	if code != 0 || !strings.Contains(stdout.String(), "No failed tracks to retry") {
+		t.Fatalf("exit code = %d, stdout = %q, stderr = %q", code, stdout.String(), stderr.String())
+	}
+}
@@ -3,8 +3,23 @@ package cli
 import "io"
 
 func Run(args []string, stdout, stderr io.Writer) int {
-	if len(args) > 0 && args[0] == "download" {
-		return runDownload(args[1:], stdout, stderr)
+	if len(args) > 0 {
+		switch args[0] {
+		case "accounts":
+			return runAccounts(args[1:], stdout, stderr)
+		case "download":
+			return runDownload(args[1:], stdout, stderr)
+		case "feed":
+			return runFeed(args[1:], stdout, stderr)
+		case "history":
+			return runHistory(args[1:], stdout, stderr)
+		case "retag":
+			return runRetag(args[1:], stdout, stderr)
+		case "serve":
+			return runServe(args[1:], stdout, stderr)
+		case "watch":
+			return runWatch(args[1:], stdout, stderr)
+		}
 	}
 	return runTUI(args, stderr)
 }
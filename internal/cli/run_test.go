@@ -14,6 +14,10 @@ func TestRunDispatchesHelpToTheSelectedCommand(t *testing.T) {
 	}{
 		{name: "tui", args: []string{"--help"}, want: "Usage of yamdl:"},
 		{name: "download", args: []string{"download", "--help"}, want: "Usage: yamdl download --token TOKEN --link URL [options]"},
+		{name: "feed", args: []string{"feed", "--help"}, want: "Usage: yamdl feed DIR --base-url URL [options]"},
+		{name: "retag", args: []string{"retag", "--help"}, want: "Usage: yamdl retag --token TOKEN [options] DIR"},
+		{name: "serve", args: []string{"serve", "--help"}, want: "Usage: yamdl serve --token TOKEN --api-key KEY [options]"},
+		{name: "watch", args: []string{"watch", "--help"}, want: "Usage: yamdl watch --token TOKEN --link URL [options]"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/server"
+	"ya-music/utils"
+	"ya-music/ya"
+)
+
+const (
+	defaultServeListen = "127.0.0.1:8765"
+	defaultServeState  = "./yamdl-jobs.json"
+	serveAPIKeyEnv     = "YAMDL_API_KEY"
+	serveShutdownLimit = 10 * time.Second
+)
+
+type serveOptions struct {
+	token  string
+	apiKey string
+	listen string
+	state  string
+	format ya.AudioFormat
+	output string
+	// serveFiles exposes output at server.FilesPrefix for podcast feeds.
+	serveFiles bool
+	accountFlags
+	losslessFlags
+	historyFlags
+	sharedFlags
+}
+
+func parseServeOptions(args []string, stderr io.Writer, getenv func(string) string) parseOutcome[serveOptions] {
+	options := serveOptions{
+		listen: defaultServeListen,
+		state:  defaultServeState,
+		format: ya.AudioFormatMP3,
+		output: defaultOutputDir,
+	}
+	flags := flag.NewFlagSet("yamdl serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&options.token, "token", "", "Yandex Music authentication token (required unless --account is given)")
+	flags.StringVar(&options.apiKey, "api-key", "", "static key clients must send to the API (required; or set "+serveAPIKeyEnv+")")
+	flags.StringVar(&options.listen, "listen", options.listen, "address for the HTTP API")
+	flags.StringVar(&options.state, "state", options.state, "file that stores the job queue between restarts")
+	format := string(options.format)
+	flags.StringVar(&format, "format", format, "audio format: mp3 or flac")
+	flags.StringVar(&options.output, "output", options.output, "directory for downloaded tracks")
+	flags.BoolVar(&options.serveFiles, "serve-files", false, "serve --output at "+server.FilesPrefix+" without the API key, for podcast feeds written by 'yamdl feed'")
+	registerAccountFlags(flags, &options.accountFlags)
+	registerLosslessFlags(flags, &options.losslessFlags)
+	registerHistoryFlags(flags, &options.historyFlags)
+	registerSharedFlags(flags, &options.sharedFlags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: yamdl serve --token TOKEN --api-key KEY [options]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return parseOutcome[serveOptions]{exitCode: 0}
+		}
+		return parseOutcome[serveOptions]{exitCode: 2}
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "serve does not accept positional arguments")
+		return parseOutcome[serveOptions]{exitCode: 2}
+	}
+	if err := applyAccount(options.accountFlags, flags, &options.token, &options.output); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[serveOptions]{exitCode: 2}
+	}
+	options.apiKey = strings.TrimSpace(options.apiKey)
+	if options.apiKey == "" {
+		options.apiKey = strings.TrimSpace(getenv(serveAPIKeyEnv))
+	}
+	if options.apiKey == "" {
+		fmt.Fprintf(stderr, "--api-key or %s is required\n", serveAPIKeyEnv)
+		return parseOutcome[serveOptions]{exitCode: 2}
+	}
+	if err := validateSharedFlags(options.sharedFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[serveOptions]{exitCode: 2}
+	}
+	options.format = ya.AudioFormat(strings.ToLower(strings.TrimSpace(format)))
+	if options.format != ya.AudioFormatMP3 && options.format != ya.AudioFormatFLAC {
+		fmt.Fprintln(stderr, "--format must be mp3 or flac")
+		return parseOutcome[serveOptions]{exitCode: 2}
+	}
+	if err := validateLosslessFlags(&options.losslessFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[serveOptions]{exitCode: 2}
+	}
+	for _, field := range []struct {
+		name  string
+		value *string
+	}{
+		{"--listen", &options.listen},
+		{"--state", &options.state},
+		{"--output", &options.output},
+	} {
+		*field.value = strings.TrimSpace(*field.value)
+		if *field.value == "" {
+			fmt.Fprintf(stderr, "%s must not be empty\n", field.name)
+			return parseOutcome[serveOptions]{exitCode: 2}
+		}
+	}
+	return parseOutcome[serveOptions]{options: options, proceed: true}
+}
+
+func runServe(args []string, stdout, stderr io.Writer) int {
+	parsed := parseServeOptions(args, stderr, os.Getenv)
+	if !parsed.proceed {
+		return parsed.exitCode
+	}
+	options := parsed.options
+
+	if err := utils.CreateDirIfNotExists(options.output); err != nil {
+		fmt.Fprintf(stderr, "failed to create output directory: %v\n", err)
+		return 1
+	}
+	store, jobs, err := server.OpenStore(options.state)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	downloadLogger, client, err := newLoggedClient(options.sharedFlags, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer downloadLogger.Close()
+	client.SetToken(options.token)
+
+	manager := server.NewManager(server.Config{
+		Client:    client,
+		Store:     store,
+		OutputDir: options.output,
+		Options: ya.DownloadOptions{
+			SkipCover:         options.skipCover,
+			AudioFormat:       options.format,
+			ReplayGain:        options.replayGain,
+			LosslessContainer: options.container(),
+		},
+		Concurrency: batch.DefaultConcurrency,
+		Logger:      downloadLogger,
+		History:     options.historyStore(),
+	}, jobs)
+
+	listener, err := net.Listen("tcp", options.listen)
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to listen on %s: %v\n", options.listen, err)
+		return 1
+	}
+	// Cancelling the base context ends open event streams, which Shutdown
+	// would otherwise wait on until the timeout.
+	requestContext, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	handler := server.NewHandler(manager, options.apiKey)
+	if options.serveFiles {
+		handler = server.WithFiles(handler, options.output)
+	}
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return requestContext
+		},
+	}
+
+	interrupts := newInterruptSignals()
+	defer interrupts.stop()
+
+	managerContext, stopManager := context.WithCancel(context.Background())
+	defer stopManager()
+	managerDone := make(chan struct{})
+	go func() {
+		defer close(managerDone)
+		manager.Run(managerContext)
+	}()
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	fmt.Fprintf(stdout, "Serving API on http://%s (queue: %s, output: %s)\n", listener.Addr(), options.state, options.output)
+	if options.serveFiles {
+		fmt.Fprintf(stdout, "Serving files of %s on http://%s%s\n", options.output, listener.Addr(), server.FilesPrefix)
+	}
+	downloadLogger.Info("server started", "listen", listener.Addr().String(), "state", options.state)
+
+	exitCode := 0
+	select {
+	case <-interrupts.first:
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			fmt.Fprintf(stderr, "server failed: %v\n", err)
+			exitCode = 1
+		}
+	}
+
+	fmt.Fprintln(stdout, "Shutting down: active downloads finish, then unfinished jobs stay queued")
+	shutdownContext, cancelShutdown := context.WithTimeout(context.Background(), serveShutdownLimit)
+	defer cancelShutdown()
+	cancelRequests()
+	_ = httpServer.Shutdown(shutdownContext)
+	stopManager()
+
+	select {
+	case <-managerDone:
+	case <-interrupts.force:
+		manager.AbortDownloads()
+		<-managerDone
+	}
+	downloadLogger.Info("server stopped")
+	return exitCode
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"ya-music/ya"
+)
+
+func TestParseServeOptionsUsesDefaultsAndEnvironmentKey(t *testing.T) {
+	var stderr bytes.Buffer
+	getenv := func(name string) string {
+		if name == serveAPIKeyEnv {
+			return " env-key "
+		}
+		return ""
+	}
+	parsed := parseServeOptions([]string{"--token", "abc", "--format", "FLAC"}, &stderr, getenv)
+	if !parsed.proceed {
+		t.Fatalf("expected proceed, exit code = %d, stderr: %s", parsed.exitCode, stderr.String())
+	}
+	options := parsed.options
+	if options.apiKey != "env-key" || options.listen != defaultServeListen || options.state != defaultServeState {
+		t.Fatalf("unexpected options: %#v", options)
+	}
+	if options.format != ya.AudioFormatFLAC || options.output != defaultOutputDir {
+		t.Fatalf("unexpected download options: %#v", options)
+	}
+}
+
+func TestParseServeOptionsRejectsInvalidInput(t *testing.T) {
+	tests := map[string][]string{
+		"--token is required":                    {"--api-key", "k"},
+		"--api-key or YAMDL_API_KEY is required": {"--token", "abc"},
+		"--format must be mp3 or flac":           {"--token", "abc", "--api-key", "k", "--format", "aac"},
+		"--listen must not be empty":             {"--token", "abc", "--api-key", "k", "--listen", " "},
+		"serve does not accept positional":       {"--token", "abc", "--api-key", "k", "extra"},
+	}
+
+	for want, args := range tests {
+		var stderr bytes.Buffer
+		parsed := parseServeOptions(args, &stderr, func(string) string { return "" })
+		if parsed.proceed || parsed.exitCode != 2 {
+			t.Fatalf("args %q: proceed = %v, exit code = %d", args, parsed.proceed, parsed.exitCode)
+		}
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("args %q: stderr = %q, want %q", args, stderr.String(), want)
+		}
+	}
+}
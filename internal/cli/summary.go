@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"ya-music/utils"
+	"ya-music/ya"
+)
+
+// Exit codes of yamdl download. 1 is an unexpected error, 2 a usage error,
+// and 130 an interrupted run.
+const (
+	exitOK             = 0
+	exitAuthError      = 3
+	exitPartialFailure = 4
+	exitAllFailed      = 5
+	exitSourceError    = 6
+	exitInterrupted    = 130
+)
+
+// Values of --fail-on.
+const (
+	failOnError   = "error"
+	failOnSkipped = "skipped"
+	failOnNone    = "none"
+)
+
+// errResolveSource marks preflight failures to find the tracks to download.
+var errResolveSource = errors.New("failed to resolve source")
+
+func errorExitCode(err error) int {
+	switch {
+	case ya.Classify(err) == ya.ErrAuthExpired:
+		return exitAuthError
+	case errors.Is(err, errResolveSource):
+		return exitSourceError
+	default:
+		return 1
+	}
+}
+
+// batchExitCode reports the outcome of a finished batch of total tracks.
+// Tracks count as failed according to failOn.
+func batchExitCode(summary batchSummary, total int, failOn string, interrupted bool) int {
+	if interrupted {
+		return exitInterrupted
+	}
+	if summary.authFailed > 0 {
+		return exitAuthError
+	}
+
+	failed := 0
+	switch failOn {
+	case failOnError:
+		failed = summary.failed
+	case failOnSkipped:
+		failed = summary.failed + summary.skipped
+	}
+	switch {
+	case failed == 0:
+		return exitOK
+	case failed >= total:
+		return exitAllFailed
+	default:
+		return exitPartialFailure
+	}
+}
+
+// downloadSummary is the --summary-file report of one yamdl download run.
+type downloadSummary struct {
+	Source      string    `json:"source"`
+	Output      string    `json:"output"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	DurationMs  int64     `json:"duration_ms"`
+	PreflightMs int64     `json:"preflight_ms"`
+	DownloadMs  int64     `json:"download_ms"`
+	Total       int       `json:"total"`
+	Downloaded  int       `json:"downloaded"`
+	Skipped     int       `json:"skipped"`
+	Failed      int       `json:"failed"`
+	Bytes       int64     `json:"bytes"`
+	Interrupted bool      `json:"interrupted"`
+	ExitCode    int       `json:"exit_code"`
+	// Error is set when the run stopped before the batch started.
+	Error string `json:"error,omitempty"`
+}
+
+// summaryTimer collects the durations of a run for its summary.
+type summaryTimer struct {
+	started   time.Time
+	preflight time.Duration
+	batch     time.Time
+}
+
+func newDownloadSummary(link, output string, summary batchSummary, total int, interrupted bool) downloadSummary {
+	return downloadSummary{
+		Source:      utils.SanitizeURL(link),
+		Output:      output,
+		Total:       total,
+		Downloaded:  summary.downloaded,
+		Skipped:     summary.skipped,
+		Failed:      summary.failed,
+		Bytes:       summary.bytes,
+		Interrupted: interrupted,
+	}
+}
+
+// finish fills the timing fields and exit code of report.
+func (t summaryTimer) finish(report downloadSummary, exitCode int, now time.Time) downloadSummary {
+	report.StartedAt = t.started
+	report.FinishedAt = now
+	report.DurationMs = now.Sub(t.started).Milliseconds()
+	report.PreflightMs = t.preflight.Milliseconds()
+	if !t.batch.IsZero() {
+		report.DownloadMs = now.Sub(t.batch).Milliseconds()
+	}
+	report.ExitCode = exitCode
+	return report
+}
+
+// writeSummaryFile atomically writes report as JSON to path.
+func writeSummaryFile(path string, report downloadSummary) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode summary: %w", err)
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create summary temp file: %w", err)
+	}
+	tempName := temp.Name()
+	defer func() {
+		_ = os.Remove(tempName)
+	}()
+	if _, err := temp.Write(append(data, '\n')); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("write summary: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("close summary: %w", err)
+	}
+	if err := os.Rename(tempName, path); err != nil {
+		return fmt.Errorf("publish summary: %w", err)
+	}
+	return nil
+}
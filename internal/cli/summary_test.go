@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+)
+
+func TestBatchExitCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		summary     batchSummary
+		failOn      string
+		interrupted bool
+		want        int
+	}{
+		{"all ok", batchSummary{downloaded: 2, skipped: 1}, failOnError, false, exitOK},
+		{"partial failure", batchSummary{downloaded: 2, failed: 1}, failOnError, false, exitPartialFailure},
+		{"all failed", batchSummary{failed: 3}, failOnError, false, exitAllFailed},
+		{"skipped fails", batchSummary{downloaded: 2, skipped: 1}, failOnSkipped, false, exitPartialFailure},
+		{"skipped and failed", batchSummary{skipped: 1, failed: 2}, failOnSkipped, false, exitAllFailed},
+		{"none", batchSummary{failed: 3}, failOnNone, false, exitOK},
+		{"auth", batchSummary{downloaded: 1, failed: 2, authFailed: 2}, failOnNone, false, exitAuthError},
+		{"interrupted", batchSummary{failed: 3, authFailed: 3}, failOnError, true, exitInterrupted},
+	}
+	for _, test := range tests {
+		if got := batchExitCode(test.summary, 3, test.failOn, test.interrupted); got != test.want {
+			t.Fatalf("%s: exit code = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestErrorExitCodeReportsSourceErrors(t *testing.T) {
+	err := fmt.Errorf("%w: %w", errResolveSource, errors.New("playlist is private"))
+
+	if got := errorExitCode(err); got != exitSourceError {
+		t.Fatalf("errorExitCode() = %d, want %d", got, exitSourceError)
+	}
+	if err.Error() != "failed to resolve source: playlist is private" {
+		t.Fatalf("message = %q", err.Error())
+	}
+}
+
+func TestBatchSummaryCountsDownloadedBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.mp3")
+	if err := os.WriteFile(path, make([]byte, 1500), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var summary batchSummary
+	summary.add(batch.Event{Status: batch.StatusDone, Path: path})
+	summary.add(batch.Event{Status: batch.StatusDone, Path: filepath.Join(t.TempDir(), "missing.mp3")})
+
+	if summary.downloaded != 2 || summary.bytes != 1500 {
+		t.Fatalf("summary = %#v", summary)
+	}
+}
+
+func TestWriteSummaryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summary.json")
+	started := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	timer := summaryTimer{started: started, preflight: 2 * time.Second, batch: started.Add(2 * time.Second)}
+	report := newDownloadSummary("https://music.yandex.ru/album/1", "downloads", batchSummary{downloaded: 2, failed: 1, bytes: 4096}, 3, false)
+
+	if err := writeSummaryFile(path, timer.finish(report, exitPartialFailure, started.Add(10*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"total":        3.0,
+		"downloaded":   2.0,
+		"failed":       1.0,
+		"bytes":        4096.0,
+		"duration_ms":  10000.0,
+		"preflight_ms": 2000.0,
+		"download_ms":  8000.0,
+		"exit_code":    4.0,
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Fatalf("%s = %v, want %v (summary %s)", key, got[key], value, data)
+		}
+	}
+	if _, ok := got["error"]; ok {
+		t.Fatalf("unexpected error field: %s", data)
+	}
+}
+
+func TestRunDownloadWritesSummaryWhenRetryListFails(t *testing.T) {
+	dir := t.TempDir()
+	retryFile := filepath.Join(dir, "failed.json")
+	if err := os.WriteFile(retryFile, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	summaryPath := filepath.Join(dir, "summary.json")
+
+	var stdout, stderr strings.Builder
+	exitCode := runDownload([]string{
+		"--token", "token",
+		"--retry-failed", retryFile,
+		"--summary-file", summaryPath,
+	}, &stdout, &stderr)
+
+	if exitCode != 1 {
+		t.Fatalf("exit code = %d, stderr: %s", exitCode, stderr.String())
+	}
+	data, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got downloadSummary
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ExitCode != 1 || got.Error == "" {
+		t.Fatalf("summary = %s", data)
+	}
+}
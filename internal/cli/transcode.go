@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"ya-music/ya"
+)
+
+type transcodeFlags struct {
+	transcode             string
+	transcodeProfiles     string
+	transcodeKeepOriginal bool
+	ffmpeg                string
+	// profile is resolved from the flags above by resolveTranscodeFlags.
+	profile *ya.TranscodeProfile
+}
+
+func registerTranscodeFlags(fs *flag.FlagSet, dest *transcodeFlags) {
+	fs.StringVar(&dest.transcode, "transcode", "", "convert downloads with ffmpeg using a profile: "+strings.Join(builtinTranscodeProfileNames(), ", ")+", or one from --transcode-profiles")
+	fs.StringVar(&dest.transcodeProfiles, "transcode-profiles", "", "JSON file with additional transcode profiles")
+	fs.BoolVar(&dest.transcodeKeepOriginal, "transcode-keep-original", false, "keep the downloaded file next to the converted one")
+	fs.StringVar(&dest.ffmpeg, "ffmpeg", ya.DefaultFFmpegPath, "ffmpeg executable used by --transcode")
+}
+
+func builtinTranscodeProfileNames() []string {
+	var names []string
+	for _, profile := range ya.BuiltinTranscodeProfiles() {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// resolveTranscodeFlags selects the requested profile. Profiles from the
+// file replace built-in profiles of the same name.
+func resolveTranscodeFlags(options *transcodeFlags) error {
+	options.transcode = strings.TrimSpace(options.transcode)
+	options.transcodeProfiles = strings.TrimSpace(options.transcodeProfiles)
+	options.ffmpeg = strings.TrimSpace(options.ffmpeg)
+	if options.transcode == "" {
+		if options.transcodeProfiles != "" || options.transcodeKeepOriginal {
+			return errors.New("--transcode-profiles and --transcode-keep-original require --transcode")
+		}
+		return nil
+	}
+	if options.ffmpeg == "" {
+		return errors.New("--ffmpeg must not be empty")
+	}
+
+	profiles := make(map[string]ya.TranscodeProfile)
+	for _, profile := range ya.BuiltinTranscodeProfiles() {
+		profiles[profile.Name] = profile
+	}
+	if options.transcodeProfiles != "" {
+		custom, err := loadTranscodeProfiles(options.transcodeProfiles)
+		if err != nil {
+			return err
+		}
+		for _, profile := range custom {
+			profiles[profile.Name] = profile
+		}
+	}
+
+	profile, ok := profiles[options.transcode]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown transcode profile %q; available: %s", options.transcode, strings.Join(names, ", "))
+	}
+	if options.transcodeKeepOriginal {
+		profile.KeepOriginal = true
+	}
+	options.profile = &profile
+	return nil
+}
+
+// checkFFmpeg fails fast when a profile is selected but ffmpeg is missing,
+// instead of failing every track.
+func checkFFmpeg(options transcodeFlags) error {
+	if options.profile == nil {
+		return nil
+	}
+	if _, err := exec.LookPath(options.ffmpeg); err != nil {
+		return fmt.Errorf("--transcode needs ffmpeg: %w", err)
+	}
+	return nil
+}
+
+func loadTranscodeProfiles(path string) ([]ya.TranscodeProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read transcode profiles: %w", err)
+	}
+	var profiles []ya.TranscodeProfile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("parse transcode profiles %s: %w", path, err)
+	}
+	for i := range profiles {
+		profiles[i].Name = strings.TrimSpace(profiles[i].Name)
+		if err := profiles[i].Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return profiles, nil
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseDownloadWithArgs(extra ...string) (parseOutcome[downloadOptions], string) {
+	var stderr bytes.Buffer
+	args := append([]string{"--token", "abc", "--link", "https://music.yandex.ru/album/1"}, extra...)
+	parsed := parseDownloadOptions(args, &stderr)
+	return parsed, stderr.String()
+}
+
+func TestParseDownloadOptionsSelectsBuiltinTranscodeProfile(t *testing.T) {
+	parsed, stderr := parseDownloadWithArgs("--format", "flac", "--transcode", "opus", "--transcode-keep-original")
+	if !parsed.proceed {
+		t.Fatalf("expected proceed, stderr: %s", stderr)
+	}
+	profile := parsed.options.profile
+	if profile == nil || profile.Name != "opus" || profile.Extension != ".opus" || !profile.KeepOriginal {
+		t.Fatalf("unexpected profile: %#v", profile)
+	}
+	if parsed.options.ffmpeg != "ffmpeg" {
+		t.Fatalf("ffmpeg = %q", parsed.options.ffmpeg)
+	}
+}
+
+func TestParseDownloadOptionsLoadsCustomTranscodeProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	data := `[{"name": "opus", "extension": ".ogg", "args": ["-c:a", "libvorbis"], "keep_original": true}]`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, stderr := parseDownloadWithArgs("--transcode", "opus", "--transcode-profiles", path)
+	if !parsed.proceed {
+		t.Fatalf("expected proceed, stderr: %s", stderr)
+	}
+	profile := parsed.options.profile
+	if profile.Extension != ".ogg" || !profile.KeepOriginal || strings.Join(profile.Args, " ") != "-c:a libvorbis" {
+		t.Fatalf("custom profile did not replace builtin: %#v", profile)
+	}
+}
+
+func TestParseDownloadOptionsRejectsInvalidTranscodeFlags(t *testing.T) {
+	badProfiles := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(badProfiles, []byte(`[{"name": "x", "extension": "ogg"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string][]string{
+		`unknown transcode profile "wav"`: {"--transcode", "wav"},
+		"require --transcode":             {"--transcode-keep-original"},
+		"extension must look like .opus":  {"--transcode", "x", "--transcode-profiles", badProfiles},
+		"--upgrade cannot be combined":    {"--upgrade", "--transcode", "opus"},
+		"read transcode profiles":         {"--transcode", "opus", "--transcode-profiles", filepath.Join(t.TempDir(), "missing.json")},
+	}
+	for want, args := range tests {
+		parsed, stderr := parseDownloadWithArgs(args...)
+		if parsed.proceed || parsed.exitCode != 2 || !strings.Contains(stderr, want) {
+			t.Fatalf("args %q: proceed = %v, exit = %d, stderr = %q, want %q", args, parsed.proceed, parsed.exitCode, stderr, want)
+		}
+	}
+}
+
+func TestCheckFFmpegReportsMissingExecutable(t *testing.T) {
+	options := transcodeFlags{transcode: "opus", ffmpeg: filepath.Join(t.TempDir(), "missing-ffmpeg")}
+	if err := resolveTranscodeFlags(&options); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFFmpeg(options); err == nil || !strings.Contains(err.Error(), "--transcode needs ffmpeg") {
+		t.Fatalf("err = %v", err)
+	}
+	if err := checkFFmpeg(transcodeFlags{}); err != nil {
+		t.Fatalf("no profile: err = %v", err)
+	}
+}
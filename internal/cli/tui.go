@@ -26,15 +26,31 @@ func runTUI(args []string, stderr io.Writer) int {
 		return 2
 	}
 
-	downloadLogger, client := newLoggedClient(options.timeoutSeconds, stderr)
+	accounts, err := utils.LoadTokenStore(utils.AccountsFileName)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	downloadLogger, client, err := newLoggedClient(options.sharedFlags, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
 	defer downloadLogger.Close()
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 	defer signal.Stop(sigCh)
 
-	downloadOptions := ya.DownloadOptions{SkipCover: options.skipCover}
-	prog := tea.NewProgram(ui.StartUi(client, downloadOptions))
+	downloadOptions := ya.DownloadOptions{
+		SkipCover:         options.skipCover,
+		ReplayGain:        options.replayGain,
+		LosslessContainer: options.container(),
+	}
+	prog := tea.NewProgram(ui.StartUi(client, downloadOptions).
+		WithHistory(options.historyStore()).
+		WithAccounts(accounts, options.account))
 
 	go func() {
 		sig := <-sigCh
@@ -0,0 +1,309 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/history"
+	"ya-music/internal/watch"
+	"ya-music/source"
+	"ya-music/utils"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+const (
+	defaultWatchInterval = time.Hour
+	minWatchInterval     = time.Minute
+)
+
+type watchOptions struct {
+	token    string
+	link     string
+	ref      *source.Ref
+	interval time.Duration
+	format   ya.AudioFormat
+	output   string
+	state    string
+	once     bool
+	accountFlags
+	losslessFlags
+	transcodeFlags
+	hookFlags
+	historyFlags
+	sharedFlags
+}
+
+func parseWatchOptions(args []string, stderr io.Writer) parseOutcome[watchOptions] {
+	options := watchOptions{
+		interval: defaultWatchInterval,
+		format:   ya.AudioFormatMP3,
+		output:   defaultOutputDir,
+	}
+	flags := flag.NewFlagSet("yamdl watch", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&options.token, "token", "", "Yandex Music authentication token (required unless --account is given)")
+	flags.StringVar(&options.link, "link", "", "Yandex Music playlist, album, or chart URL to watch (required)")
+	flags.DurationVar(&options.interval, "interval", options.interval, "time between checks, at least 1m")
+	format := string(options.format)
+	flags.StringVar(&format, "format", format, "audio format: mp3 or flac")
+	flags.StringVar(&options.output, "output", options.output, "directory for downloaded tracks")
+	flags.StringVar(&options.state, "state", "", "file that remembers seen tracks (default: hidden file in --output)")
+	flags.BoolVar(&options.once, "once", false, "check once and exit instead of polling")
+	registerAccountFlags(flags, &options.accountFlags)
+	registerLosslessFlags(flags, &options.losslessFlags)
+	registerTranscodeFlags(flags, &options.transcodeFlags)
+	registerHookFlags(flags, &options.hookFlags)
+	registerHistoryFlags(flags, &options.historyFlags)
+	registerSharedFlags(flags, &options.sharedFlags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: yamdl watch --token TOKEN --link URL [options]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return parseOutcome[watchOptions]{exitCode: 0}
+		}
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprintln(stderr, "watch does not accept positional arguments")
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	if err := applyAccount(options.accountFlags, flags, &options.token, &options.output); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	options.link = strings.TrimSpace(options.link)
+	if options.link == "" {
+		fmt.Fprintln(stderr, "--link is required")
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	ref, err := source.Parse(options.link)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	options.ref = ref
+	if options.interval < minWatchInterval {
+		fmt.Fprintln(stderr, "--interval must be at least 1m")
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	if err := validateSharedFlags(options.sharedFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	if err := validateHookFlags(&options.hookFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	options.format = ya.AudioFormat(strings.ToLower(strings.TrimSpace(format)))
+	if options.format != ya.AudioFormatMP3 && options.format != ya.AudioFormatFLAC {
+		fmt.Fprintln(stderr, "--format must be mp3 or flac")
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	if err := validateLosslessFlags(&options.losslessFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	if err := resolveTranscodeFlags(&options.transcodeFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	options.output = strings.TrimSpace(options.output)
+	if options.output == "" {
+		fmt.Fprintln(stderr, "--output must not be empty")
+		return parseOutcome[watchOptions]{exitCode: 2}
+	}
+	options.state = strings.TrimSpace(options.state)
+	if options.state == "" {
+		options.state = watch.DefaultStatePath(options.output, ref)
+	}
+	return parseOutcome[watchOptions]{options: options, proceed: true}
+}
+
+func runWatch(args []string, stdout, stderr io.Writer) int {
+	parsed := parseWatchOptions(args, stderr)
+	if !parsed.proceed {
+		return parsed.exitCode
+	}
+	options := parsed.options
+
+	if err := utils.CreateDirIfNotExists(options.output); err != nil {
+		fmt.Fprintf(stderr, "failed to create output directory: %v\n", err)
+		return 1
+	}
+	if err := checkFFmpeg(options.transcodeFlags); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	downloadLogger, client, err := newLoggedClient(options.sharedFlags, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer downloadLogger.Close()
+	client.SetToken(options.token)
+
+	interrupts := newInterruptSignals()
+	defer interrupts.stop()
+
+	downloadLogger.Info("watch started",
+		"source", utils.SanitizeURL(options.link),
+		"interval", options.interval.String(),
+		"state", options.state,
+	)
+	for {
+		interrupted, err := runWatchCycle(client, options, stdout, stderr, interrupts, downloadLogger)
+		if err != nil {
+			fmt.Fprintln(stderr, describeError(err))
+			return errorExitCode(err)
+		}
+		if interrupted {
+			return 130
+		}
+		if options.once {
+			return 0
+		}
+
+		next := time.Now().Add(options.interval)
+		fmt.Fprintf(stdout, "Next check at %s\n", next.Format(time.DateTime))
+		select {
+		case <-interrupts.first:
+			fmt.Fprintln(stdout, "Interrupted: watch stopped")
+			downloadLogger.Info("watch stopped")
+			return 130
+		case <-time.After(options.interval):
+		}
+	}
+}
+
+type watchClient interface {
+	source.ContextClient
+	DownloadTrackWithOptionsContext(context.Context, model.Track, string, ya.DownloadOptions) (string, error)
+}
+
+// runWatchCycle checks the source once and downloads tracks not seen before.
+// Resolve failures are reported and retried on the next cycle; only state file
+// errors and a rejected token stop the watcher.
+func runWatchCycle(
+	client watchClient,
+	options watchOptions,
+	stdout, stderr io.Writer,
+	interrupts interruptSignals,
+	downloadLogger *utils.DownloadLogger,
+) (bool, error) {
+	state, err := watch.LoadState(options.state, options.link)
+	if err != nil {
+		return false, err
+	}
+
+	// Each cycle has its own contexts, so nothing is left cancelled for the
+	// next one.
+	batchContext, cancelBatch := context.WithCancel(context.Background())
+	defer cancelBatch()
+	snapshot, err := source.ResolveSnapshotContext(batchContext, client, options.ref)
+	if ya.Classify(err) == ya.ErrAuthExpired {
+		return false, fmt.Errorf("check failed: %w", err)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Check failed: %s\n", describeError(err))
+		downloadLogger.Error("watch cycle failed", "source", utils.SanitizeURL(options.link), "error", err)
+		return false, nil
+	}
+
+	if state.Unchanged(snapshot) {
+		fmt.Fprintf(stdout, "No changes (revision %d)\n", snapshot.Revision)
+		downloadLogger.Info("watch cycle unchanged", "revision", snapshot.Revision)
+		state.CheckedAt = time.Now()
+		return false, watch.SaveState(options.state, state)
+	}
+
+	tracks := state.NewTracks(snapshot.Tracks)
+	if len(tracks) == 0 {
+		fmt.Fprintln(stdout, "No new tracks")
+		downloadLogger.Info("watch cycle finished", "revision", snapshot.Revision, "new_tracks", 0)
+		state.Record(snapshot, nil, true, time.Now())
+		return false, watch.SaveState(options.state, state)
+	}
+
+	fmt.Fprintf(stdout, "Found %d new tracks\n", len(tracks))
+	downloadContext, cancelDownloads := context.WithCancel(context.Background())
+	defer cancelDownloads()
+
+	var recorded []batch.Event
+	historyStore := options.historyStore()
+	defer closeHistory(historyStore, stderr, downloadLogger)
+	hooks := newBatchHooks(options.hookFlags, stderr, downloadLogger)
+	live := newTerminalProgress(stdout, len(tracks))
+	summary, interrupted := consumeDownloadEventsWithFlush(
+		stdout,
+		hooks.wrap(recordHistory(recordEvents(batch.Run(batch.Config{
+			Client:          client,
+			Tracks:          tracks,
+			OutputDir:       options.output,
+			Context:         batchContext,
+			DownloadContext: downloadContext,
+			Progress:        live != nil,
+			Options: ya.DownloadOptions{
+				SkipCover:         options.skipCover,
+				AudioFormat:       options.format,
+				ReplayGain:        options.replayGain,
+				LosslessContainer: options.container(),
+				Transcode:         options.profile,
+				FFmpegPath:        options.ffmpeg,
+			},
+		}), &recorded), history.NewRecorder(historyStore, options.link), stderr, downloadLogger), len(tracks)),
+		interrupts.first,
+		interrupts.force,
+		cancelBatch,
+		cancelDownloads,
+		interrupts.flush,
+		live,
+	)
+
+	complete := !interrupted && summary.failed == 0
+	state.Record(snapshot, recorded, complete, time.Now())
+	if err := watch.SaveState(options.state, state); err != nil {
+		return interrupted, err
+	}
+
+	fmt.Fprintf(stdout, "Check finished: %d new, %d downloaded, %d skipped, %d failed\n",
+		len(tracks),
+		summary.downloaded,
+		summary.skipped,
+		summary.failed,
+	)
+	downloadLogger.Info("watch cycle finished",
+		"revision", snapshot.Revision,
+		"new_tracks", len(tracks),
+		"downloaded", summary.downloaded,
+		"skipped", summary.skipped,
+		"failed", summary.failed,
+		"interrupted", interrupted,
+	)
+	hooks.finish(summary.hookPayload(options.link, options.output, len(tracks), interrupted))
+	return interrupted, nil
+}
+
+// recordEvents forwards events unchanged while keeping a copy of each one for
+// the watch state.
+func recordEvents(events <-chan batch.Event, recorded *[]batch.Event) <-chan batch.Event {
+	forwarded := make(chan batch.Event)
+	go func() {
+		defer close(forwarded)
+		for event := range events {
+			if event.Status != batch.StatusProgress {
+				*recorded = append(*recorded, event)
+			}
+			forwarded <- event
+		}
+	}()
+	return forwarded
+}
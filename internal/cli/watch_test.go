@@ -0,0 +1,259 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"ya-music/internal/batch"
+	"ya-music/internal/watch"
+	"ya-music/utils"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+type fakeWatchClient struct {
+	mu         sync.Mutex
+	playlist   model.Playlist
+	resolveErr error
+	downloaded []string
+	failures   map[string]error
+}
+
+func (c *fakeWatchClient) TrackInfo(string) (*model.Track, error) {
+	return nil, errors.New("unexpected track lookup")
+}
+
+func (c *fakeWatchClient) AlbumWithTracks(string) (*model.Album, error) {
+	return nil, errors.New("unexpected album lookup")
+}
+
+func (c *fakeWatchClient) UsersPlaylist(string, string) (*model.Playlist, error) {
+	if c.resolveErr != nil {
+		return nil, c.resolveErr
+	}
+	playlist := c.playlist
+	return &playlist, nil
+}
+
+func (c *fakeWatchClient) PlaylistByUUID(string) (*model.Playlist, error) {
+	return nil, errors.New("unexpected playlist lookup")
+}
+
+func (c *fakeWatchClient) Chart(string) (*model.Playlist, error) {
+	return nil, errors.New("unexpected chart lookup")
+}
+
+func (c *fakeWatchClient) TrackInfoContext(_ context.Context, id string) (*model.Track, error) {
+	return c.TrackInfo(id)
+}
+
+func (c *fakeWatchClient) AlbumWithTracksContext(_ context.Context, id string) (*model.Album, error) {
+	return c.AlbumWithTracks(id)
+}
+
+func (c *fakeWatchClient) UsersPlaylistContext(_ context.Context, id string, username string) (*model.Playlist, error) {
+	return c.UsersPlaylist(id, username)
+}
+
+func (c *fakeWatchClient) PlaylistByUUIDContext(_ context.Context, id string) (*model.Playlist, error) {
+	return c.PlaylistByUUID(id)
+}
+
+func (c *fakeWatchClient) ChartContext(_ context.Context, region string) (*model.Playlist, error) {
+	return c.Chart(region)
+}
+
+func (c *fakeWatchClient) DownloadTrackWithOptionsContext(_ context.Context, track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
+	if err := c.failures[track.ID.String()]; err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.downloaded = append(c.downloaded, track.ID.String())
+	sort.Strings(c.downloaded)
+	return track.ID.String() + ".mp3", nil
+}
+
+func watchPlaylist(revision int, ids ...string) model.Playlist {
+	playlist := model.Playlist{Revision: revision}
+	for _, id := range ids {
+		playlist.Tracks = append(playlist.Tracks, model.TrackShort{Track: model.Track{
+			ID:        model.FlexibleID(id),
+			Title:     "Track " + id,
+			Available: true,
+		}})
+	}
+	return playlist
+}
+
+func testWatchOptions(t *testing.T) watchOptions {
+	t.Helper()
+	var stderr bytes.Buffer
+	output := t.TempDir()
+	parsed := parseWatchOptions([]string{
+		"--token", "abc",
+		"--link", "https://music.yandex.ru/users/user/playlists/3",
+		"--output", output,
+		"--history-file", filepath.Join(output, "history.db"),
+		"--once",
+	}, &stderr)
+	if !parsed.proceed {
+		t.Fatalf("parse failed: %s", stderr.String())
+	}
+	return parsed.options
+}
+
+func runTestWatchCycle(t *testing.T, client *fakeWatchClient, options watchOptions) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	interrupted, err := runWatchCycle(client, options, &stdout, &stderr, interruptSignals{}, utils.NewDiscardDownloadLogger())
+	if err != nil || interrupted {
+		t.Fatalf("cycle: interrupted = %v, err = %v, stderr: %s", interrupted, err, stderr.String())
+	}
+	return stdout.String() + stderr.String()
+}
+
+func TestParseWatchOptionsDefaultsStateToOutputDirectory(t *testing.T) {
+	options := testWatchOptions(t)
+
+	if options.interval != defaultWatchInterval || options.format != ya.AudioFormatMP3 || !options.once {
+		t.Fatalf("unexpected options: %#v", options)
+	}
+	want := filepath.Join(options.output, ".yamdl-watch-playlist-user-3.json")
+	if options.state != want {
+		t.Fatalf("state = %q, want %q", options.state, want)
+	}
+}
+
+func TestParseWatchOptionsRejectsInvalidInput(t *testing.T) {
+	link := "https://music.yandex.ru/users/user/playlists/3"
+	tests := map[string][]string{
+		"--token is required":            {"--link", link},
+		"--link is required":             {"--token", "abc"},
+		"--interval must be at least 1m": {"--token", "abc", "--link", link, "--interval", "30s"},
+		"--format must be mp3 or flac":   {"--token", "abc", "--link", link, "--format", "aac"},
+		"watch does not accept":          {"--token", "abc", "--link", link, "extra"},
+	}
+
+	for want, args := range tests {
+		var stderr bytes.Buffer
+		parsed := parseWatchOptions(args, &stderr)
+		if parsed.proceed || parsed.exitCode != 2 {
+			t.Fatalf("args %q: proceed = %v, exit code = %d", args, parsed.proceed, parsed.exitCode)
+		}
+		if !strings.Contains(stderr.String(), want) {
+			t.Fatalf("args %q: stderr = %q, want %q", args, stderr.String(), want)
+		}
+	}
+}
+
+func TestRunWatchCycleDownloadsOnlyNewTracks(t *testing.T) {
+	options := testWatchOptions(t)
+	client := &fakeWatchClient{playlist: watchPlaylist(1, "1", "2")}
+
+	runTestWatchCycle(t, client, options)
+	if got := strings.Join(client.downloaded, ","); got != "1,2" {
+		t.Fatalf("first cycle downloaded %q", got)
+	}
+
+	output := runTestWatchCycle(t, client, options)
+	if len(client.downloaded) != 2 || !strings.Contains(output, "No changes (revision 1)") {
+		t.Fatalf("unchanged cycle downloaded %v, output: %s", client.downloaded, output)
+	}
+
+	client.playlist = watchPlaylist(2, "3", "1", "2")
+	output = runTestWatchCycle(t, client, options)
+	if got := strings.Join(client.downloaded, ","); got != "1,2,3" {
+		t.Fatalf("changed cycle downloaded %q", got)
+	}
+	if !strings.Contains(output, "Check finished: 1 new, 1 downloaded, 0 skipped, 0 failed") {
+		t.Fatalf("unexpected output: %s", output)
+	}
+}
+
+func TestRunWatchCycleRetriesFailedTracks(t *testing.T) {
+	options := testWatchOptions(t)
+	client := &fakeWatchClient{
+		playlist: watchPlaylist(1, "1", "2"),
+		failures: map[string]error{"2": errors.New("boom")},
+	}
+
+	runTestWatchCycle(t, client, options)
+	state, err := watch.LoadState(options.state, options.link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Revision != 0 || len(state.Seen) != 1 || state.Seen["1"] != "done" {
+		t.Fatalf("state after failure = %#v", state)
+	}
+
+	client.failures = nil
+	runTestWatchCycle(t, client, options)
+	if got := strings.Join(client.downloaded, ","); got != "1,2" {
+		t.Fatalf("retry downloaded %q", got)
+	}
+}
+
+func TestRunWatchCycleKeepsStateWhenResolveFails(t *testing.T) {
+	options := testWatchOptions(t)
+	client := &fakeWatchClient{resolveErr: errors.New("offline")}
+
+	output := runTestWatchCycle(t, client, options)
+	if !strings.Contains(output, "Check failed: offline") {
+		t.Fatalf("unexpected output: %s", output)
+	}
+	if _, err := os.Stat(options.state); !os.IsNotExist(err) {
+		t.Fatalf("state file should not exist, stat err = %v", err)
+	}
+}
+
+func TestRunWatchCycleRunsBatchHookAfterNewTracks(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	options := testWatchOptions(t)
+	marker := filepath.Join(options.output, "hook.txt")
+	options.onBatchDone = `printf '%s' "$YAMDL_DOWNLOADED" > "` + marker + `"`
+	client := &fakeWatchClient{playlist: watchPlaylist(1, "1", "2")}
+
+	runTestWatchCycle(t, client, options)
+	data, err := os.ReadFile(marker)
+	if err != nil || string(data) != "2" {
+		t.Fatalf("hook output = %q, err = %v", data, err)
+	}
+
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	runTestWatchCycle(t, client, options)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("hook ran without new tracks, stat err = %v", err)
+	}
+}
+
+func TestRunWatchCycleRemembersUnavailableTracks(t *testing.T) {
+	options := testWatchOptions(t)
+	client := &fakeWatchClient{playlist: watchPlaylist(1, "1", "2")}
+	client.playlist.Tracks[1].Track.Available = false
+
+	runTestWatchCycle(t, client, options)
+	state, err := watch.LoadState(options.state, options.link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Seen["1"] != "done" || state.Seen["2"] != batch.SkipUnavailable {
+		t.Fatalf("seen = %v", state.Seen)
+	}
+
+	client.playlist = watchPlaylist(2, "1", "2")
+	runTestWatchCycle(t, client, options)
+	if got := strings.Join(client.downloaded, ","); got != "1,2" {
+		t.Fatalf("downloaded %q after the track became available", got)
+	}
+}
@@ -0,0 +1,41 @@
+package fakeapi
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+)
+
+// MP3Fixture returns a short silent MPEG-1 Layer III stream.
+func MP3Fixture() []byte {
+	// 128 kbps, 44.1 kHz, no padding: 417 bytes per frame.
+	frame := append([]byte{0xff, 0xfb, 0x90, 0x00}, make([]byte, 413)...)
+	return bytes.Repeat(frame, 4)
+}
+
+// FLACFixture returns a FLAC stream with a STREAMINFO block and one frame
+// header, enough for the tag writers.
+func FLACFixture() []byte {
+	data := []byte("fLaC")
+	// Last metadata block, STREAMINFO, 34 bytes.
+	data = append(data, 0x80, 0x00, 0x00, 0x22)
+	streamInfo := make([]byte, 34)
+	// 4096-sample blocks, 44.1 kHz, stereo, 16 bits.
+	copy(streamInfo, []byte{0x10, 0x00, 0x10, 0x00})
+	copy(streamInfo[10:], []byte{0x0a, 0xc4, 0x42, 0xf0})
+	data = append(data, streamInfo...)
+	return append(data, 0xff, 0xf8, 0x00, 0x00)
+}
+
+// CoverFixture returns a small JPEG image that image decoders accept.
+func CoverFixture() []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 200, G: 40, B: 40, A: 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,477 @@
+// Package fakeapi serves a local imitation of the Yandex Music API for
+// offline end-to-end tests.
+//
+// The server covers the endpoints the downloader uses: account status,
+// tracks, albums, playlists, charts, MP3 download info with signed links,
+// lossless file info with AES-CTR encrypted audio, and cover art. It runs
+// over TLS because MP3 links are always https; use Transport to trust it and
+// point clients at URL with ya.Client.SetBaseURL.
+package fakeapi
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"ya-music/ya/lossless"
+	"ya-music/ya/model"
+)
+
+// LosslessKey is the hex AES key of every lossless payload.
+const LosslessKey = "00112233445566778899aabbccddeeff"
+
+// signSalt matches the salt the client signs MP3 links with.
+const signSalt = "XGRlBW9FXlekgbPrRHuSiA"
+
+// Track is a track served by the fake API.
+type Track struct {
+	model.Track
+	// MP3 is the audio behind the MP3 download link. Nil means MP3Fixture.
+	MP3 []byte
+	// Lossless is served encrypted through get-file-info. Nil means the
+	// track has no lossless version and the client falls back to MP3.
+	Lossless []byte
+	// LosslessCodec is the codec reported for Lossless; empty means flac.
+	LosslessCodec string
+	// Cover, when set, is served at the track's CoverURI.
+	Cover []byte
+	// Preview offers only a 30-second preview download option, like the API
+	// does for accounts without a subscription.
+	Preview bool
+}
+
+// Playlist is a playlist served by the fake API.
+type Playlist struct {
+	// Owner and Kind serve the playlist at /users/{Owner}/playlists/{Kind}.
+	Owner string
+	Kind  string
+	// UUID serves the playlist at /playlist/{UUID}.
+	UUID     string
+	Title    string
+	Revision int
+	TrackIDs []string
+	// PageSize splits the tracks into pages of this size when positive.
+	PageSize int
+	// OmitTrackData sends only track IDs, like the API does for large
+	// playlists.
+	OmitTrackData bool
+}
+
+// Server is a running fake API. Its methods are safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	token       string
+	account     model.Account
+	plus        model.Plus
+	permissions model.Permissions
+	tracks      map[string]Track
+	albums      map[string]model.Album
+	playlists   map[string]Playlist
+	charts      map[string][]string
+	requests    []string
+}
+
+// New starts a fake API. Close it when done.
+func New() *Server {
+	s := &Server{
+		account:   model.Account{Uid: 1, Login: "fake", ServiceAvailable: true},
+		tracks:    make(map[string]Track),
+		albums:    make(map[string]model.Album),
+		playlists: make(map[string]Playlist),
+		charts:    make(map[string][]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /account/status", s.handleAccount)
+	mux.HandleFunc("GET /tracks/{id}", s.handleTrack)
+	mux.HandleFunc("POST /tracks", s.handleTracks)
+	mux.HandleFunc("GET /albums/{id}/with-tracks", s.handleAlbum)
+	mux.HandleFunc("GET /users/{owner}/playlists/{kind}", s.handleUserPlaylist)
+	mux.HandleFunc("GET /playlist/{uuid}", s.handleUUIDPlaylist)
+	mux.HandleFunc("GET /landing3/chart", s.handleChart)
+	mux.HandleFunc("GET /landing3/chart/{region}", s.handleChart)
+	mux.HandleFunc("GET /tracks/{id}/download-info", s.handleDownloadInfo)
+	mux.HandleFunc("GET /download-info-xml/{id}", s.handleDownloadInfoXML)
+	mux.HandleFunc("GET /get-mp3/{sign}/{ts}/mp3/{id}", s.handleMP3)
+	mux.HandleFunc("GET /get-file-info", s.handleFileInfo)
+	mux.HandleFunc("GET /lossless/{id}", s.handleLossless)
+	mux.HandleFunc("GET /covers/{id}/{size}", s.handleCover)
+
+	s.Server = httptest.NewTLSServer(s.record(mux))
+	return s
+}
+
+// Transport returns a transport that trusts the server certificate.
+func (s *Server) Transport() http.RoundTripper {
+	return s.Client().Transport
+}
+
+// Host is the host:port of the server.
+func (s *Server) Host() string {
+	return s.Listener.Addr().String()
+}
+
+// RequireToken rejects requests that do not carry "OAuth token".
+func (s *Server) RequireToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = token
+}
+
+// SetAccount replaces the account returned by account status.
+func (s *Server) SetAccount(account model.Account) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account = account
+}
+
+// SetPlus sets the subscription state returned by account status.
+func (s *Server) SetPlus(hasPlus bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.plus = model.Plus{HasPlus: hasPlus}
+}
+
+// SetPermissions sets the permissions returned by account status.
+func (s *Server) SetPermissions(permissions model.Permissions) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissions = permissions
+}
+
+// AddTrack serves track. A track with Cover gets a CoverURI on the server.
+func (s *Server) AddTrack(track Track) {
+	if track.MP3 == nil {
+		track.MP3 = MP3Fixture()
+	}
+	if track.Cover != nil {
+		track.CoverURI = s.Host() + "/covers/" + track.ID.String() + "/%%"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracks[track.ID.String()] = track
+}
+
+// AddAlbum serves an album of the given tracks, which must be added first,
+// in one volume.
+func (s *Server) AddAlbum(id, title string, trackIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.albums[id] = model.Album{
+		ID:         model.FlexibleID(id),
+		Title:      title,
+		Available:  true,
+		TrackCount: len(trackIDs),
+		Volumes:    [][]model.Track{s.lookup(trackIDs)},
+	}
+}
+
+// AddPodcast serves a podcast show with the episodes trackIDs.
+func (s *Server) AddPodcast(id, title string, trackIDs ...string) {
+	s.AddAlbum(id, title, trackIDs...)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	album := s.albums[id]
+	album.Type = model.AlbumTypePodcast
+	album.MetaType = model.AlbumTypePodcast
+	s.albums[id] = album
+}
+
+// AddPlaylist serves playlist at its owner and kind, its UUID, or both.
+func (s *Server) AddPlaylist(playlist Playlist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if playlist.Owner != "" && playlist.Kind != "" {
+		s.playlists[playlist.Owner+"/"+playlist.Kind] = playlist
+	}
+	if playlist.UUID != "" {
+		s.playlists[playlist.UUID] = playlist
+	}
+}
+
+// SetChart serves the chart of region; an empty region is the default chart.
+func (s *Server) SetChart(region string, trackIDs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.charts[region] = trackIDs
+}
+
+// Requests lists the requests served so far as "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		token := s.token
+		s.mu.Unlock()
+
+		if token != "" && r.Header.Get("Authorization") != "OAuth "+token {
+			writeError(w, http.StatusUnauthorized, "session-expired", "invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// lookup returns the model tracks of ids, skipping unknown ones. s.mu must
+// be held.
+func (s *Server) lookup(ids []string) []model.Track {
+	tracks := make([]model.Track, 0, len(ids))
+	for _, id := range ids {
+		trackID, _, _ := strings.Cut(id, ":")
+		if track, ok := s.tracks[trackID]; ok {
+			tracks = append(tracks, track.Track)
+		}
+	}
+	return tracks
+}
+
+func (s *Server) track(id string) (Track, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	track, ok := s.tracks[id]
+	return track, ok
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	account, plus, permissions := s.account, s.plus, s.permissions
+	s.mu.Unlock()
+	writeResult(w, model.Status{Account: account, Plus: plus, Permissions: permissions})
+}
+
+func (s *Server) handleTrack(w http.ResponseWriter, r *http.Request) {
+	track, ok := s.track(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "not-found", "track not found")
+		return
+	}
+	writeResult(w, []model.Track{track.Track})
+}
+
+func (s *Server) handleTracks(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "validate", err.Error())
+		return
+	}
+	s.mu.Lock()
+	tracks := s.lookup(strings.Split(r.PostForm.Get("track-ids"), ","))
+	s.mu.Unlock()
+	writeResult(w, tracks)
+}
+
+func (s *Server) handleAlbum(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	album, ok := s.albums[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "not-found", "album not found")
+		return
+	}
+	writeResult(w, album)
+}
+
+func (s *Server) handleUserPlaylist(w http.ResponseWriter, r *http.Request) {
+	s.servePlaylist(w, r, r.PathValue("owner")+"/"+r.PathValue("kind"))
+}
+
+func (s *Server) handleUUIDPlaylist(w http.ResponseWriter, r *http.Request) {
+	s.servePlaylist(w, r, r.PathValue("uuid"))
+}
+
+func (s *Server) servePlaylist(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	playlist, ok := s.playlists[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not-found", "playlist not found")
+		return
+	}
+
+	ids := playlist.TrackIDs
+	result := model.Playlist{
+		Available:    true,
+		Kind:         atoi(playlist.Kind),
+		PlaylistUUID: playlist.UUID,
+		Revision:     playlist.Revision,
+		Title:        playlist.Title,
+		TrackCount:   len(ids),
+		Owner:        model.User{Login: playlist.Owner},
+	}
+	if playlist.PageSize > 0 {
+		page := atoi(r.URL.Query().Get("page"))
+		start := min(page*playlist.PageSize, len(ids))
+		end := min(start+playlist.PageSize, len(ids))
+		result.Pager = model.Pager{Total: len(ids), Page: page, PerPage: playlist.PageSize}
+		ids = ids[start:end]
+	}
+
+	result.Tracks = make([]model.TrackShort, 0, len(ids))
+	for _, id := range ids {
+		short := model.TrackShort{ID: model.FlexibleID(id)}
+		if track, ok := s.tracks[id]; ok && !playlist.OmitTrackData {
+			short.Track = track.Track
+		}
+		result.Tracks = append(result.Tracks, short)
+	}
+	writeResult(w, result)
+}
+
+func (s *Server) handleChart(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids, ok := s.charts[r.PathValue("region")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "not-found", "chart not found")
+		return
+	}
+
+	chart := model.Playlist{Available: true, Title: "Chart", TrackCount: len(ids)}
+	for _, track := range s.lookup(ids) {
+		chart.Tracks = append(chart.Tracks, model.TrackShort{ID: track.ID, Track: track})
+	}
+	writeResult(w, map[string]model.Playlist{"chart": chart})
+}
+
+func (s *Server) handleDownloadInfo(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	track, ok := s.track(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "not-found", "track not found")
+		return
+	}
+	writeResult(w, []model.DownloadInfo{{
+		Codec:           "mp3",
+		BitrateInKbps:   320,
+		DownloadInfoURL: s.URL + "/download-info-xml/" + id,
+		Preview:         track.Preview,
+	}})
+}
+
+func (s *Server) handleDownloadInfoXML(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, ok := s.track(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(model.TrackDownloadInfo{
+		Host: s.Host(),
+		Path: "/mp3/" + id,
+		Ts:   "0",
+		S:    "fake-" + id,
+	})
+}
+
+func (s *Server) handleMP3(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	track, ok := s.track(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	sum := md5.Sum([]byte(signSalt + "mp3/" + id + "fake-" + id))
+	if r.PathValue("sign") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "bad sign", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Content-Length", strconv.Itoa(len(track.MP3)))
+	_, _ = w.Write(track.MP3)
+}
+
+func (s *Server) handleFileInfo(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	id := query.Get("trackId")
+	ts, err := strconv.ParseInt(query.Get("ts"), 10, 64)
+	if err != nil || query.Get("sign") != lossless.SignRequest(ts, id) {
+		writeError(w, http.StatusForbidden, "bad-sign", "invalid sign")
+		return
+	}
+	track, ok := s.track(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "not-found", "track not found")
+		return
+	}
+
+	info := map[string]any{"quality": "nq", "codec": "aac", "bitrate": 192, "urls": []string{s.URL + "/lossless/" + id}}
+	if track.Lossless != nil {
+		codec := track.LosslessCodec
+		if codec == "" {
+			codec = "flac"
+		}
+		info = map[string]any{
+			"quality": "lossless",
+			"codec":   codec,
+			"bitrate": 1411,
+			"urls":    []string{s.URL + "/lossless/" + id},
+			"key":     LosslessKey,
+		}
+	}
+	writeResult(w, map[string]any{"downloadInfo": info})
+}
+
+func (s *Server) handleLossless(w http.ResponseWriter, r *http.Request) {
+	track, ok := s.track(r.PathValue("id"))
+	if !ok || track.Lossless == nil {
+		http.NotFound(w, r)
+		return
+	}
+	data := encrypt(track.Lossless)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
+
+func (s *Server) handleCover(w http.ResponseWriter, r *http.Request) {
+	track, ok := s.track(r.PathValue("id"))
+	if !ok || track.Cover == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	_, _ = w.Write(track.Cover)
+}
+
+// encrypt applies the AES-CTR stream the client decrypts lossless audio
+// with.
+func encrypt(data []byte) []byte {
+	key, _ := hex.DecodeString(LosslessKey)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	encrypted := make([]byte, len(data))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(encrypted, data)
+	return encrypted
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"result": result})
+}
+
+func writeError(w http.ResponseWriter, status int, name, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"name": name, "message": message}})
+}
+
+func atoi(value string) int {
+	n, _ := strconv.Atoi(value)
+	return n
+}
@@ -0,0 +1,90 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+	"ya-music/ya/lossless"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, server *Server, path string) (int, []byte) {
+	t.Helper()
+	resp, err := server.Client().Get(server.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, body
+}
+
+func TestPlaylistPagesOmitTrackDataWhenAsked(t *testing.T) {
+	server := New()
+	defer server.Close()
+	for _, id := range []string{"1", "2", "3"} {
+		server.AddTrack(Track{Track: model.Track{ID: model.FlexibleID(id), Title: "Track " + id}})
+	}
+	server.AddPlaylist(Playlist{Owner: "user", Kind: "5", TrackIDs: []string{"1", "2", "3"}, PageSize: 2, OmitTrackData: true})
+
+	status, body := get(t, server, "/users/user/playlists/5?page=1&pageSize=2")
+
+	require.Equal(t, http.StatusOK, status)
+	var response model.PlaylistResponse
+	require.NoError(t, json.Unmarshal(body, &response))
+	assert.Equal(t, model.Pager{Total: 3, Page: 1, PerPage: 2}, response.Result.Pager)
+	require.Len(t, response.Result.Tracks, 1)
+	assert.Equal(t, "3", response.Result.Tracks[0].TrackID())
+	assert.Empty(t, response.Result.Tracks[0].Track.Title)
+}
+
+func TestFileInfoServesEncryptedLosslessAudio(t *testing.T) {
+	server := New()
+	defer server.Close()
+	server.AddTrack(Track{Track: model.Track{ID: "7"}, Lossless: FLACFixture()})
+
+	fileInfoURL := lossless.BuildFileInfoURL(server.URL, "7", time.Now().Unix())
+	resp, err := server.Client().Get(fileInfoURL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	info, err := lossless.ParseDownloadInfo(body)
+	require.NoError(t, err)
+	assert.Equal(t, "flac", info.Codec)
+	require.Len(t, info.URLs, 1)
+
+	resp, err = server.Client().Get(info.URLs[0])
+	require.NoError(t, err)
+	encrypted, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	decrypted, err := lossless.DecryptData(encrypted, info.Key)
+	require.NoError(t, err)
+	assert.Equal(t, FLACFixture(), decrypted)
+}
+
+func TestFileInfoRejectsBadSign(t *testing.T) {
+	server := New()
+	defer server.Close()
+	server.AddTrack(Track{Track: model.Track{ID: "7"}, Lossless: FLACFixture()})
+
+	status, _ := get(t, server, "/get-file-info?trackId=7&ts=1&sign=wrong")
+
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestRequireTokenRejectsMissingAuthorization(t *testing.T) {
+	server := New()
+	defer server.Close()
+	server.RequireToken("secret")
+
+	status, body := get(t, server, "/account/status")
+
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Contains(t, string(body), "session-expired")
+}
@@ -0,0 +1,287 @@
+// Package feed writes an RSS 2.0 feed with iTunes tags for podcast episodes
+// downloaded by yamdl, so a podcast app can subscribe to a local folder.
+package feed
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"ya-music/ya"
+)
+
+// FileName is the feed written next to the episodes.
+const FileName = "feed.xml"
+
+// Episode is a downloaded episode file with its tags.
+type Episode struct {
+	ya.EpisodeTags
+	// Path is relative to the feed directory and uses forward slashes.
+	Path string
+	Size int64
+	// ModTime dates episodes without a release time.
+	ModTime time.Time
+}
+
+// Options describe the feed channel.
+type Options struct {
+	// BaseURL is where the feed directory is served, for example
+	// http://nas.local:8080/files/.
+	BaseURL string
+	// Title defaults to the show of the episodes.
+	Title       string
+	Description string
+}
+
+// Skipped is an MP3 file left out of the feed because its tags could not be
+// read.
+type Skipped struct {
+	Path string
+	Err  error
+}
+
+// Result summarizes a written feed.
+type Result struct {
+	Episodes int
+	Skipped  []Skipped
+}
+
+// Scan finds the podcast episodes under dir, newest first. MP3 files that are
+// not tagged as episodes are ignored, and files with unreadable tags are
+// returned as skipped so one broken file does not block the feed.
+func Scan(dir string) ([]Episode, []Skipped, error) {
+	var episodes []Episode
+	var skipped []Skipped
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(entry.Name(), ".") && path != dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".mp3") {
+			return nil
+		}
+		tags, ok, err := ya.ReadEpisodeTags(path)
+		if err != nil {
+			skipped = append(skipped, Skipped{Path: path, Err: err})
+			return nil
+		}
+		if !ok {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		episodes = append(episodes, Episode{
+			EpisodeTags: tags,
+			Path:        filepath.ToSlash(rel),
+			Size:        info.Size(),
+			ModTime:     info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("scan episodes: %w", err)
+	}
+	slices.SortStableFunc(episodes, func(a, b Episode) int {
+		if c := b.date().Compare(a.date()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	return episodes, skipped, nil
+}
+
+func (e Episode) date() time.Time {
+	if !e.Published.IsZero() {
+		return e.Published
+	}
+	return e.ModTime
+}
+
+// WriteFile scans dir and writes its feed to dir/FileName.
+func WriteFile(dir string, options Options) (Result, error) {
+	episodes, skipped, err := Scan(dir)
+	if err != nil {
+		return Result{}, err
+	}
+	if options.Title == "" && !oneShow(episodes) {
+		if abs, err := filepath.Abs(dir); err == nil {
+			options.Title = filepath.Base(abs)
+		}
+	}
+	tmp, err := os.CreateTemp(dir, ".feed-*.xml")
+	if err != nil {
+		return Result{}, fmt.Errorf("save feed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := Write(tmp, episodes, options); err != nil {
+		tmp.Close()
+		return Result{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Result{}, fmt.Errorf("save feed: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, FileName)); err != nil {
+		return Result{}, fmt.Errorf("save feed: %w", err)
+	}
+	return Result{Episodes: len(episodes), Skipped: skipped}, nil
+}
+
+func oneShow(episodes []Episode) bool {
+	for _, episode := range episodes {
+		if episode.Show != episodes[0].Show {
+			return false
+		}
+	}
+	return true
+}
+
+type rss struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	ITunes  string   `xml:"xmlns:itunes,attr"`
+	Channel channel  `xml:"channel"`
+}
+
+type channel struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Author      string `xml:"itunes:author,omitempty"`
+	Items       []item `xml:"item"`
+}
+
+type item struct {
+	Title       string    `xml:"title"`
+	Description string    `xml:"description,omitempty"`
+	PubDate     string    `xml:"pubDate"`
+	Enclosure   enclosure `xml:"enclosure"`
+	GUID        guid      `xml:"guid"`
+	Author      string    `xml:"itunes:author,omitempty"`
+	Duration    string    `xml:"itunes:duration,omitempty"`
+}
+
+type enclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type guid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// Write writes the feed of episodes, in the given order, to w.
+func Write(w io.Writer, episodes []Episode, options Options) error {
+	base, err := parseBaseURL(options.BaseURL)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+		base.RawPath = ""
+	}
+
+	feed := rss{
+		Version: "2.0",
+		ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+		Channel: channel{
+			Title:       options.Title,
+			Link:        base.String(),
+			Description: options.Description,
+		},
+	}
+	if len(episodes) > 0 {
+		if feed.Channel.Title == "" {
+			feed.Channel.Title = episodes[0].Show
+		}
+		feed.Channel.Author = episodes[0].Author
+	}
+	if feed.Channel.Title == "" {
+		feed.Channel.Title = "Podcasts"
+	}
+	if feed.Channel.Description == "" {
+		feed.Channel.Description = "Episodes of " + feed.Channel.Title + " downloaded with yamdl"
+	}
+	for _, episode := range episodes {
+		feed.Channel.Items = append(feed.Channel.Items, newItem(base, episode))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("write feed: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(feed); err != nil {
+		return fmt.Errorf("write feed: %w", err)
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return fmt.Errorf("write feed: %w", err)
+	}
+	return nil
+}
+
+// ValidateBaseURL checks that raw can be used as Options.BaseURL.
+func ValidateBaseURL(raw string) error {
+	_, err := parseBaseURL(raw)
+	return err
+}
+
+func parseBaseURL(raw string) (*url.URL, error) {
+	base, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, errors.New("feed base URL must be an http or https URL")
+	}
+	return base, nil
+}
+
+func newItem(base *url.URL, episode Episode) item {
+	title := episode.Title
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(episode.Path), filepath.Ext(episode.Path))
+	}
+	id := episode.Path
+	if episode.TrackID != "" {
+		id = "yandex-music-track-" + episode.TrackID
+	}
+	return item{
+		Title:       title,
+		Description: episode.Description,
+		PubDate:     episode.date().Format(time.RFC1123Z),
+		Enclosure: enclosure{
+			URL:    base.JoinPath(strings.Split(episode.Path, "/")...).String(),
+			Length: episode.Size,
+			Type:   "audio/mpeg",
+		},
+		GUID:     guid{Value: id},
+		Author:   episode.Author,
+		Duration: formatDuration(episode.Duration),
+	}
+}
+
+// formatDuration writes HH:MM:SS as podcast apps expect; "" when unknown.
+func formatDuration(duration time.Duration) string {
+	if duration <= 0 {
+		return ""
+	}
+	seconds := int(duration.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
@@ -0,0 +1,109 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ya-music/ya"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeEpisode(t *testing.T, path, id, title, released string, podcast bool) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("audio payload"), 0o644))
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tag.Close()
+	tag.SetVersion(4)
+	tag.SetTitle(title)
+	tag.SetAlbum("Show")
+	tag.SetArtist("Host")
+	if podcast {
+		tag.AddFrame("PCST", id3v2.UnknownFrame{Body: []byte{0, 0, 0, 1}})
+	}
+	tag.AddTextFrame("TDRL", id3v2.EncodingUTF8, released)
+	tag.AddTextFrame("TLEN", id3v2.EncodingUTF8, "3725000")
+	tag.AddCommentFrame(id3v2.CommentFrame{Encoding: id3v2.EncodingUTF8, Language: "eng", Text: title + " notes"})
+	tag.AddUFIDFrame(id3v2.UFIDFrame{OwnerIdentifier: "music.yandex.ru", Identifier: []byte(id)})
+	require.NoError(t, tag.Save())
+}
+
+func TestWriteFileListsEpisodesNewestFirst(t *testing.T) {
+	dir := t.TempDir()
+	writeEpisode(t, filepath.Join(dir, "Show - 2024-01-01 - First.mp3"), "1", "First", "2024-01-01T06:00:00", true)
+	writeEpisode(t, filepath.Join(dir, "season 2", "Show - 2024-02-01 - Second.mp3"), "2", "Second", "2024-02-01T06:00:00", true)
+	writeEpisode(t, filepath.Join(dir, "Artist - Song.mp3"), "3", "Song", "2024-03-01T06:00:00", false)
+
+	result, err := WriteFile(dir, Options{BaseURL: "http://nas.local:8080/files"})
+	require.NoError(t, err)
+	assert.Equal(t, Result{Episodes: 2}, result)
+
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	require.NoError(t, err)
+	var feed rss
+	require.NoError(t, xml.Unmarshal(data, &feed))
+	assert.Equal(t, "Show", feed.Channel.Title)
+	assert.Equal(t, "http://nas.local:8080/files/", feed.Channel.Link)
+	require.Len(t, feed.Channel.Items, 2)
+	second := feed.Channel.Items[0]
+	assert.Equal(t, "Second", second.Title)
+	assert.Equal(t, "Second notes", second.Description)
+	assert.Equal(t, "Thu, 01 Feb 2024 06:00:00 +0000", second.PubDate)
+	assert.Equal(t, enclosure{
+		URL:    "http://nas.local:8080/files/season%202/Show%20-%202024-02-01%20-%20Second.mp3",
+		Length: second.Enclosure.Length,
+		Type:   "audio/mpeg",
+	}, second.Enclosure)
+	assert.Positive(t, second.Enclosure.Length)
+	assert.Equal(t, "yandex-music-track-2", second.GUID.Value)
+	assert.Equal(t, "First", feed.Channel.Items[1].Title)
+	assert.Contains(t, string(data), `xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"`)
+	// encoding/xml does not read back prefixed names, so check iTunes tags as text.
+	assert.Contains(t, string(data), "<itunes:duration>01:02:05</itunes:duration>")
+	assert.Contains(t, string(data), "<itunes:author>Host</itunes:author>")
+}
+
+func TestWriteFileSkipsUnreadableTags(t *testing.T) {
+	dir := t.TempDir()
+	writeEpisode(t, filepath.Join(dir, "Show - 2024-01-01 - First.mp3"), "1", "First", "2024-01-01T06:00:00", true)
+	broken := filepath.Join(dir, "Broken.mp3")
+	// A TIT2 frame larger than the tag it is in.
+	require.NoError(t, os.WriteFile(broken, []byte("ID3\x04\x00\x00\x00\x00\x00\x20TIT2\x00\x00\x7f\x7f\x00\x00\x03abc"), 0o644))
+
+	result, err := WriteFile(dir, Options{BaseURL: "http://nas.local:8080/files"})
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Episodes)
+	require.Len(t, result.Skipped, 1)
+	assert.Equal(t, broken, result.Skipped[0].Path)
+	assert.Error(t, result.Skipped[0].Err)
+	assert.FileExists(t, filepath.Join(dir, FileName))
+}
+
+func TestWriteRejectsMissingBaseURL(t *testing.T) {
+	err := Write(&bytes.Buffer{}, nil, Options{})
+
+	assert.ErrorContains(t, err, "base URL")
+}
+
+func TestWriteDatesEpisodesWithoutReleaseTimeByModTime(t *testing.T) {
+	modTime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	var out bytes.Buffer
+
+	require.NoError(t, Write(&out, []Episode{{
+		EpisodeTags: ya.EpisodeTags{Title: "Untitled"},
+		Path:        "a.mp3",
+		ModTime:     modTime,
+	}}, Options{BaseURL: "https://example.com/podcast/", Title: "Mine"}))
+
+	assert.Contains(t, out.String(), "<pubDate>Mon, 06 May 2024 07:08:09 +0000</pubDate>")
+	assert.Contains(t, out.String(), "<title>Mine</title>")
+	assert.Contains(t, out.String(), `<guid isPermaLink="false">a.mp3</guid>`)
+}
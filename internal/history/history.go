@@ -0,0 +1,366 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"ya-music/ya/model"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultPath is the history database used when none is configured. It lives
+// next to the download log in the working directory.
+const DefaultPath = "dl_history.db"
+
+type Status string
+
+const (
+	StatusDone    Status = "done"
+	StatusSkipped Status = "skipped"
+	StatusError   Status = "error"
+)
+
+// Record describes the outcome of one track download.
+type Record struct {
+	Time    time.Time `json:"time"`
+	TrackID string    `json:"track_id"`
+	Title   string    `json:"title"`
+	Artists string    `json:"artists,omitempty"`
+	Album   string    `json:"album,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Status  Status    `json:"status"`
+	Reason  string    `json:"reason,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Format  string    `json:"format,omitempty"`
+	// Bitrate is the average bitrate in kbit/s derived from the file size and
+	// the track length.
+	Bitrate int    `json:"bitrate_kbps,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Path    string `json:"path,omitempty"`
+	// DurationMs is the time spent downloading the track.
+	DurationMs int64 `json:"duration_ms,omitempty"`
+}
+
+// NewRecord describes track with the format, size, and bitrate of the file at
+// path, if it exists.
+func NewRecord(track model.Track, status Status, path string, now time.Time) Record {
+	record := Record{
+		Time:    now,
+		TrackID: track.ID.String(),
+		Title:   track.FullTitle(),
+		Artists: track.ArtistsString(),
+		Status:  status,
+		Path:    path,
+	}
+	if len(track.Albums) > 0 {
+		record.Album = track.Albums[0].Title
+	}
+	if path == "" {
+		return record
+	}
+	record.Format = strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		record.Size = info.Size()
+		if track.DurationMs > 0 {
+			record.Bitrate = int(record.Size * 8 / int64(track.DurationMs))
+		}
+	}
+	return record
+}
+
+// Store keeps records in a bbolt database: records are keyed by insertion
+// sequence, with indexes by track ID and by time. A nil Store discards records.
+//
+// The first Append opens the database and keeps it, and its file lock, until
+// Close, so a run writes all its records through one handle. Reads without an
+// open handle open the database read-only for the call.
+type Store struct {
+	path string
+	mu   sync.Mutex
+	db   *bolt.DB
+}
+
+var (
+	recordsBucket = []byte("records")
+	trackBucket   = []byte("by_track")
+	timeBucket    = []byte("by_time")
+)
+
+// lockTimeout bounds the wait for another process holding the database.
+const lockTimeout = 5 * time.Second
+
+func Open(path string) *Store {
+	if strings.TrimSpace(path) == "" {
+		path = DefaultPath
+	}
+	return &Store{path: path}
+}
+
+func (s *Store) Path() string {
+	if s == nil {
+		return ""
+	}
+	return s.path
+}
+
+// Close releases the database opened by Append. The next Append opens it
+// again.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	if err != nil {
+		return fmt.Errorf("close history: %w", err)
+	}
+	return nil
+}
+
+// Append stores records and their index entries in one transaction, creating
+// the database if needed.
+func (s *Store) Append(records ...Record) error {
+	if s == nil || len(records) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.db == nil {
+		db, err := bolt.Open(s.path, 0o644, &bolt.Options{Timeout: lockTimeout})
+		if err != nil {
+			return fmt.Errorf("open history: %w", err)
+		}
+		s.db = db
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		buckets := make([]*bolt.Bucket, 0, 3)
+		for _, name := range [][]byte{recordsBucket, trackBucket, timeBucket} {
+			bucket, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			buckets = append(buckets, bucket)
+		}
+		recordsB, trackB, timeB := buckets[0], buckets[1], buckets[2]
+		for _, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return fmt.Errorf("encode history record: %w", err)
+			}
+			seq, err := recordsB.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := sequenceKey(seq)
+			if err := recordsB.Put(key, data); err != nil {
+				return err
+			}
+			if err := trackB.Put(trackKey(record.TrackID, key), nil); err != nil {
+				return err
+			}
+			if err := timeB.Put(timeKey(record.Time, key), nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("write history: %w", err)
+	}
+	return nil
+}
+
+// Load reads all records in the order they were written. A missing database
+// is an empty history.
+func (s *Store) Load() ([]Record, error) {
+	var records []Record
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, data []byte) error {
+			record, err := decodeRecord(key, data)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Query returns the records matched by filter in the order they were written.
+// Since and Until are answered from the time index.
+func (s *Store) Query(filter Filter) ([]Record, error) {
+	if filter.Since.IsZero() && filter.Until.IsZero() {
+		records, err := s.Load()
+		return Query(records, filter), err
+	}
+	var records []Record
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(timeBucket)
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		var key []byte
+		if filter.Since.IsZero() {
+			key, _ = cursor.First()
+		} else {
+			key, _ = cursor.Seek(timeKey(filter.Since, nil))
+		}
+		var until []byte
+		if !filter.Until.IsZero() {
+			until = timeKey(filter.Until, nil)
+		}
+		var keys [][]byte
+		for ; key != nil; key, _ = cursor.Next() {
+			if until != nil && bytes.Compare(key, until) >= 0 {
+				break
+			}
+			keys = append(keys, key[len(key)-sequenceLength:])
+		}
+		var err error
+		records, err = recordsAt(tx, keys)
+		return err
+	})
+	return Query(records, filter), err
+}
+
+// Downloaded returns the latest successful record of each of trackIDs that
+// has one, read through the track index.
+func (s *Store) Downloaded(trackIDs []string) (map[string]Record, error) {
+	var records []Record
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(trackBucket)
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		var keys [][]byte
+		for _, id := range trackIDs {
+			if id == "" {
+				continue
+			}
+			prefix := trackKey(id, nil)
+			for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+				keys = append(keys, key[len(prefix):])
+			}
+		}
+		var err error
+		records, err = recordsAt(tx, keys)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Downloaded(records), nil
+}
+
+// recordsAt fetches records by sequence key in the order they were written.
+func recordsAt(tx *bolt.Tx, keys [][]byte) ([]Record, error) {
+	bucket := tx.Bucket(recordsBucket)
+	if bucket == nil || len(keys) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(keys, bytes.Compare)
+	keys = slices.CompactFunc(keys, bytes.Equal)
+	records := make([]Record, 0, len(keys))
+	for _, key := range keys {
+		data := bucket.Get(key)
+		if data == nil {
+			return nil, fmt.Errorf("index points to missing record %d", binary.BigEndian.Uint64(key))
+		}
+		record, err := decodeRecord(key, data)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// view runs fn in a read-only transaction without creating the database.
+func (s *Store) view(fn func(*bolt.Tx) error) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db := s.db
+	if db == nil {
+		if _, err := os.Stat(s.path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		var err error
+		db, err = bolt.Open(s.path, 0o644, &bolt.Options{Timeout: lockTimeout, ReadOnly: true})
+		if err != nil {
+			return fmt.Errorf("open history %s: %w", s.path, err)
+		}
+		defer db.Close()
+	}
+	if err := db.View(fn); err != nil {
+		return fmt.Errorf("read history %s: %w", s.path, err)
+	}
+	return nil
+}
+
+func decodeRecord(key, data []byte) (Record, error) {
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return Record{}, fmt.Errorf("parse record %d: %w", binary.BigEndian.Uint64(key), err)
+	}
+	return record, nil
+}
+
+const sequenceLength = 8
+
+func sequenceKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// trackKey is the track ID, a zero byte so one ID is never a prefix of
+// another, and the record sequence.
+func trackKey(trackID string, seq []byte) []byte {
+	key := append([]byte(trackID), 0)
+	return append(key, seq...)
+}
+
+// timeKey orders records by time: seconds with the sign bit flipped so earlier
+// times sort first, nanoseconds, then the record sequence.
+func timeKey(t time.Time, seq []byte) []byte {
+	key := binary.BigEndian.AppendUint64(nil, uint64(t.Unix())^(1<<63))
+	key = binary.BigEndian.AppendUint32(key, uint32(t.Nanosecond()))
+	return append(key, seq...)
+}
+
+// Downloaded returns the latest successful record of every track ID.
+func Downloaded(records []Record) map[string]Record {
+	downloaded := make(map[string]Record)
+	for _, record := range records {
+		if record.Status != StatusDone || record.TrackID == "" {
+			continue
+		}
+		if previous, ok := downloaded[record.TrackID]; ok && previous.Time.After(record.Time) {
+			continue
+		}
+		downloaded[record.TrackID] = record
+	}
+	return downloaded
+}
@@ -0,0 +1,241 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTrack(id, title, artist string) model.Track {
+	return model.Track{
+		ID:         model.FlexibleID(id),
+		Title:      title,
+		Artists:    []model.Artist{{Name: artist}},
+		Albums:     []model.Album{{Title: "Album"}},
+		DurationMs: 1000,
+		Available:  true,
+	}
+}
+
+func TestStoreAppendsAndLoadsRecords(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), "history.db"))
+	first := Record{Time: time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), TrackID: "1", Status: StatusDone}
+	second := Record{Time: time.Date(2026, 10, 2, 10, 0, 0, 0, time.UTC), TrackID: "2", Status: StatusError, Error: "boom"}
+
+	require.NoError(t, store.Append(first))
+	require.NoError(t, store.Append(second))
+	records, err := store.Load()
+
+	require.NoError(t, err)
+	assert.Equal(t, []Record{first, second}, records)
+}
+
+func TestStoreKeepsDatabaseOpenUntilClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	store := Open(path)
+	first := Record{Time: time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC), TrackID: "1", Status: StatusDone}
+	second := Record{Time: time.Date(2026, 10, 2, 10, 0, 0, 0, time.UTC), TrackID: "2", Status: StatusDone}
+
+	require.NoError(t, store.Append(first))
+	require.NotNil(t, store.db)
+	db := store.db
+	require.NoError(t, store.Append(second))
+	assert.Same(t, db, store.db)
+
+	require.NoError(t, store.Close())
+	assert.Nil(t, store.db)
+	require.NoError(t, store.Close())
+	records, err := Open(path).Load()
+	require.NoError(t, err)
+	assert.Equal(t, []Record{first, second}, records)
+
+	require.NoError(t, store.Append(first))
+	t.Cleanup(func() { _ = store.Close() })
+	records, err = store.Load()
+	require.NoError(t, err)
+	assert.Len(t, records, 3)
+}
+
+func TestStoreLoadToleratesMissingDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+
+	records, err := Open(path).Load()
+
+	require.NoError(t, err)
+	assert.Empty(t, records)
+	assert.NoFileExists(t, path)
+}
+
+func TestStoreLoadRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	require.NoError(t, os.WriteFile(path, []byte("{\"track_id\":\"1\"}\n"), 0o644))
+
+	_, err := Open(path).Load()
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "open history")
+}
+
+func TestStoreQueryUsesTimeIndex(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), "history.db"))
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 12, 0, 0, 0, time.UTC) }
+	// Written out of time order to check that results keep insertion order.
+	require.NoError(t, store.Append(
+		Record{Time: day(3), TrackID: "3", Status: StatusDone},
+		Record{Time: day(1), TrackID: "1", Status: StatusDone},
+		Record{Time: day(2), TrackID: "2", Status: StatusError},
+		Record{TrackID: "0", Status: StatusDone},
+	))
+
+	ids := func(filter Filter) []string {
+		records, err := store.Query(filter)
+		require.NoError(t, err)
+		var out []string
+		for _, record := range records {
+			out = append(out, record.TrackID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"3", "1", "2", "0"}, ids(Filter{}))
+	assert.Equal(t, []string{"3", "2"}, ids(Filter{Since: day(2)}))
+	assert.Equal(t, []string{"1", "0"}, ids(Filter{Until: day(2)}))
+	assert.Equal(t, []string{"2"}, ids(Filter{Since: day(2), Until: day(3)}))
+	assert.Equal(t, []string{"3"}, ids(Filter{Since: day(2), Status: StatusDone}))
+}
+
+func TestStoreDownloadedUsesTrackIndex(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), "history.db"))
+	older := Record{Time: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), TrackID: "1", Status: StatusDone, Format: "mp3"}
+	newer := Record{Time: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), TrackID: "1", Status: StatusDone, Format: "flac"}
+	require.NoError(t, store.Append(older, Record{TrackID: "10", Status: StatusDone}))
+	require.NoError(t, store.Append(newer, Record{TrackID: "2", Status: StatusError}))
+
+	downloaded, err := store.Downloaded([]string{"1", "2", "3"})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Record{"1": newer}, downloaded)
+}
+
+func TestNewRecordMeasuresFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Artist - Song.FLAC")
+	require.NoError(t, os.WriteFile(path, make([]byte, 40000), 0o644))
+	now := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+
+	record := NewRecord(testTrack("7", "Song", "Artist"), StatusDone, path, now)
+
+	assert.Equal(t, Record{
+		Time:    now,
+		TrackID: "7",
+		Title:   "Song",
+		Artists: "Artist",
+		Album:   "Album",
+		Status:  StatusDone,
+		Format:  "flac",
+		Bitrate: 320,
+		Size:    40000,
+		Path:    path,
+	}, record)
+}
+
+func TestRecorderStoresTerminalEvents(t *testing.T) {
+	store := Open(filepath.Join(t.TempDir(), "history.db"))
+	recorder := NewRecorder(store, "https://music.yandex.ru/album/1")
+	clock := time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC)
+	recorder.now = func() time.Time {
+		clock = clock.Add(1500 * time.Millisecond)
+		return clock
+	}
+
+	for _, event := range []batch.Event{
+		{Index: 1, Track: testTrack("1", "One", "A"), Status: batch.StatusDownloading},
+		{Index: 1, Track: testTrack("1", "One", "A"), Status: batch.StatusDone, Format: batch.ContainerMP3},
+		{Index: 2, Track: testTrack("2", "Two", "B"), Status: batch.StatusSkipped, Reason: batch.SkipUnavailable},
+		{Index: 3, Track: testTrack("3", "Three", "C"), Status: batch.StatusError, Reason: "boom"},
+	} {
+		require.NoError(t, recorder.Observe(event))
+	}
+
+	records, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, StatusDone, records[0].Status)
+	assert.Equal(t, "mp3", records[0].Format)
+	assert.Equal(t, int64(1500), records[0].DurationMs)
+	assert.Equal(t, "https://music.yandex.ru/album/1", records[0].Source)
+	assert.Equal(t, StatusSkipped, records[1].Status)
+	assert.Equal(t, batch.SkipUnavailable, records[1].Reason)
+	assert.Equal(t, StatusError, records[2].Status)
+	assert.Equal(t, "boom", records[2].Error)
+	assert.Zero(t, records[2].DurationMs)
+}
+
+func TestQueryFiltersRecords(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 10, d, 12, 0, 0, 0, time.UTC) }
+	records := []Record{
+		{Time: day(1), TrackID: "1", Artists: "Alpha", Source: "https://music.yandex.ru/album/1", Status: StatusDone},
+		{Time: day(2), TrackID: "2", Artists: "Beta", Source: "https://music.yandex.ru/album/2", Status: StatusError},
+		{Time: day(3), TrackID: "3", Artists: "alpha, Gamma", Source: "https://music.yandex.ru/album/2", Status: StatusDone},
+	}
+
+	ids := func(filter Filter) []string {
+		var out []string
+		for _, record := range Query(records, filter) {
+			out = append(out, record.TrackID)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"1", "2", "3"}, ids(Filter{}))
+	assert.Equal(t, []string{"2", "3"}, ids(Filter{Since: day(2)}))
+	assert.Equal(t, []string{"1"}, ids(Filter{Until: day(2)}))
+	assert.Equal(t, []string{"2"}, ids(Filter{Status: StatusError}))
+	assert.Equal(t, []string{"1", "3"}, ids(Filter{Artist: "ALPHA"}))
+	assert.Equal(t, []string{"3"}, ids(Filter{Artist: "alpha", Source: "album/2"}))
+}
+
+func TestDownloadedKeepsLatestSuccess(t *testing.T) {
+	older := Record{Time: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), TrackID: "1", Status: StatusDone, Format: "mp3"}
+	newer := Record{Time: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC), TrackID: "1", Status: StatusDone, Format: "flac"}
+	failed := Record{Time: time.Date(2026, 10, 3, 0, 0, 0, 0, time.UTC), TrackID: "2", Status: StatusError}
+
+	downloaded := Downloaded([]Record{newer, older, failed})
+
+	assert.Equal(t, map[string]Record{"1": newer}, downloaded)
+}
+
+func TestExportWritesCSVAndJSON(t *testing.T) {
+	records := []Record{{
+		Time:    time.Date(2026, 10, 1, 10, 0, 0, 0, time.UTC),
+		TrackID: "1",
+		Title:   "Song, Live",
+		Status:  StatusDone,
+		Size:    2048,
+	}}
+
+	var csvOut bytes.Buffer
+	require.NoError(t, WriteCSV(&csvOut, records))
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "time,track_id,title,"))
+	assert.Equal(t, `2026-10-01T10:00:00Z,1,"Song, Live",,,,done,,,,,2048,,`, lines[1])
+
+	var jsonOut bytes.Buffer
+	require.NoError(t, WriteJSON(&jsonOut, records))
+	var decoded []Record
+	require.NoError(t, json.Unmarshal(jsonOut.Bytes(), &decoded))
+	assert.Equal(t, records, decoded)
+
+	jsonOut.Reset()
+	require.NoError(t, WriteJSON(&jsonOut, nil))
+	assert.Equal(t, "[]\n", jsonOut.String())
+}
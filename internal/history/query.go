@@ -0,0 +1,112 @@
+package history
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Filter selects records. Zero fields match everything; Artist and Source
+// match case-insensitive substrings.
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Status Status
+	Artist string
+	Source string
+}
+
+func (f Filter) Match(record Record) bool {
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !record.Time.Before(f.Until) {
+		return false
+	}
+	if f.Status != "" && record.Status != f.Status {
+		return false
+	}
+	if !containsFold(record.Artists, f.Artist) || !containsFold(record.Source, f.Source) {
+		return false
+	}
+	return true
+}
+
+func containsFold(value, substring string) bool {
+	substring = strings.TrimSpace(substring)
+	return substring == "" || strings.Contains(strings.ToLower(value), strings.ToLower(substring))
+}
+
+// Query returns the records matched by filter, keeping their order.
+func Query(records []Record, filter Filter) []Record {
+	var matched []Record
+	for _, record := range records {
+		if filter.Match(record) {
+			matched = append(matched, record)
+		}
+	}
+	return matched
+}
+
+var csvHeader = []string{
+	"time", "track_id", "title", "artists", "album", "source", "status", "reason",
+	"error", "format", "bitrate_kbps", "size", "path", "duration_ms",
+}
+
+// WriteCSV writes records with a header row.
+func WriteCSV(w io.Writer, records []Record) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return fmt.Errorf("write history csv: %w", err)
+	}
+	for _, record := range records {
+		row := []string{
+			record.Time.Format(time.RFC3339),
+			record.TrackID,
+			record.Title,
+			record.Artists,
+			record.Album,
+			record.Source,
+			string(record.Status),
+			record.Reason,
+			record.Error,
+			record.Format,
+			formatOptionalInt(int64(record.Bitrate)),
+			formatOptionalInt(record.Size),
+			record.Path,
+			formatOptionalInt(record.DurationMs),
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("write history csv: %w", err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("write history csv: %w", err)
+	}
+	return nil
+}
+
+func formatOptionalInt(value int64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+// WriteJSON writes records as an indented JSON array.
+func WriteJSON(w io.Writer, records []Record) error {
+	if records == nil {
+		records = []Record{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(records); err != nil {
+		return fmt.Errorf("write history json: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package history
+
+import (
+	"time"
+	"ya-music/internal/batch"
+)
+
+// Recorder turns batch events of one source into history records. It is not
+// safe for concurrent use; feed it from the goroutine that consumes events.
+type Recorder struct {
+	store   *Store
+	source  string
+	started map[int]time.Time
+	now     func() time.Time
+}
+
+func NewRecorder(store *Store, source string) *Recorder {
+	return &Recorder{
+		store:   store,
+		source:  source,
+		started: make(map[int]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Observe records terminal events and remembers when downloads started.
+func (r *Recorder) Observe(event batch.Event) error {
+	if r == nil || r.store == nil {
+		return nil
+	}
+	now := r.now()
+	if !event.Terminal() {
+		if event.Status == batch.StatusDownloading {
+			r.started[event.Index] = now
+		}
+		return nil
+	}
+
+	record := NewRecord(event.Track, StatusDone, event.Path, now)
+	record.Source = r.source
+	if event.Format != "" {
+		record.Format = string(event.Format)
+	}
+	switch event.Status {
+	case batch.StatusSkipped:
+		record.Status = StatusSkipped
+		record.Reason = event.Reason
+	case batch.StatusError:
+		record.Status = StatusError
+		record.Error = event.Reason
+	}
+	if started, ok := r.started[event.Index]; ok {
+		record.DurationMs = now.Sub(started).Milliseconds()
+		delete(r.started, event.Index)
+	}
+	return r.store.Append(record)
+}
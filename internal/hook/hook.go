@@ -0,0 +1,75 @@
+// Package hook runs user-supplied shell commands after downloads.
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds a single hook run unless the caller overrides it.
+const DefaultTimeout = 30 * time.Second
+
+// waitDelay stops Run from waiting on output pipes held open by background
+// processes the hook started.
+const waitDelay = time.Second
+
+// Run executes command through the platform shell with env appended to the
+// current environment. Output goes to stdout and stderr.
+func Run(ctx context.Context, command string, env []string, stdout, stderr io.Writer) error {
+	return run(ctx, command, env, nil, stdout, stderr)
+}
+
+// RunPayload executes command with payload encoded as JSON on stdin and its
+// common fields in the environment. A positive timeout kills the command
+// when it runs longer.
+func RunPayload(ctx context.Context, command string, timeout time.Duration, payload Payload, stdout, stderr io.Writer) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode hook payload: %w", err)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err = run(ctx, command, payload.Env(), bytes.NewReader(data), stdout, stderr)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("hook %q timed out after %s", strings.TrimSpace(command), timeout)
+	}
+	return err
+}
+
+func run(ctx context.Context, command string, env []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil
+	}
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = waitDelay
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook %q failed: %w", command, err)
+	}
+	return nil
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,80 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPassesEnvironmentAndOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+
+	var stdout, stderr bytes.Buffer
+	err := Run(context.Background(), `echo "$YAMDL_TEST_VALUE"; echo oops >&2`, []string{"YAMDL_TEST_VALUE=hello"}, &stdout, &stderr)
+
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", stdout.String())
+	assert.Equal(t, "oops\n", stderr.String())
+}
+
+func TestRunReportsFailureAndIgnoresEmptyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, Run(context.Background(), "  ", nil, &out, &out))
+	assert.Error(t, Run(context.Background(), "exit 3", nil, &out, &out))
+}
+
+func TestRunPayloadWritesJSONToStdinAndSetsEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+
+	payload := NewTrackPayload(batch.Event{
+		Index:  2,
+		Track:  model.Track{ID: "7", Title: "Song", Artists: []model.Artist{{Name: "A"}, {Name: "B"}}, Albums: []model.Album{{ID: "9", Title: "Record", Year: 2020}}},
+		Status: batch.StatusDone,
+		Format: batch.ContainerFLAC,
+		Path:   "/music/A - Song.flac",
+	})
+
+	var stdout, stderr bytes.Buffer
+	err := RunPayload(context.Background(), `cat; echo; echo "$YAMDL_TRACK_ID|$YAMDL_TRACK_ARTISTS|$YAMDL_PATH|$YAMDL_CONTAINER"`, time.Minute, payload, &stdout, &stderr)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 2)
+	var decoded TrackPayload
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &decoded))
+	assert.Equal(t, payload, decoded)
+	assert.Equal(t, EventTrackDone, decoded.Event)
+	assert.Equal(t, "Record", decoded.Track.Album)
+	assert.Equal(t, "7|A, B|/music/A - Song.flac|flac", lines[1])
+}
+
+func TestRunPayloadStopsAtTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+
+	var out bytes.Buffer
+	started := time.Now()
+	err := RunPayload(context.Background(), "sleep 5", 50*time.Millisecond, BatchPayload{Event: EventBatchDone}, &out, &out)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out after 50ms")
+	assert.Less(t, time.Since(started), 4*time.Second)
+}
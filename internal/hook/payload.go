@@ -0,0 +1,119 @@
+package hook
+
+import (
+	"strconv"
+	"strings"
+	"ya-music/internal/batch"
+	"ya-music/ya/model"
+)
+
+const (
+	EventTrackDone = "track_done"
+	EventBatchDone = "batch_done"
+)
+
+// Payload is the JSON document a hook receives on stdin.
+type Payload interface {
+	Env() []string
+}
+
+// TrackPayload describes one finished, skipped, or failed track.
+type TrackPayload struct {
+	Event     string    `json:"event"`
+	Index     int       `json:"index"`
+	Status    string    `json:"status"`
+	Reason    string    `json:"reason,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Track     TrackInfo `json:"track"`
+}
+
+// TrackInfo is the subset of track metadata passed to hooks.
+type TrackInfo struct {
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Version    string   `json:"version,omitempty"`
+	Artists    []string `json:"artists"`
+	Album      string   `json:"album,omitempty"`
+	AlbumID    string   `json:"album_id,omitempty"`
+	Year       int      `json:"year,omitempty"`
+	ISRC       string   `json:"isrc,omitempty"`
+	DurationMs int      `json:"duration_ms,omitempty"`
+}
+
+// BatchPayload summarizes a whole batch after its last track.
+type BatchPayload struct {
+	Event       string         `json:"event"`
+	Source      string         `json:"source"`
+	Output      string         `json:"output"`
+	Total       int            `json:"total"`
+	Downloaded  int            `json:"downloaded"`
+	Skipped     int            `json:"skipped"`
+	Failed      int            `json:"failed"`
+	Interrupted bool           `json:"interrupted"`
+	Tracks      []TrackPayload `json:"tracks"`
+}
+
+// NewTrackPayload converts a terminal batch event into a hook payload.
+func NewTrackPayload(event batch.Event) TrackPayload {
+	return TrackPayload{
+		Event:     EventTrackDone,
+		Index:     event.Index,
+		Status:    string(event.Status),
+		Reason:    event.Reason,
+		Container: string(event.Format),
+		Path:      event.Path,
+		Track:     newTrackInfo(event.Track),
+	}
+}
+
+func newTrackInfo(track model.Track) TrackInfo {
+	info := TrackInfo{
+		ID:         track.ID.String(),
+		Title:      track.Title,
+		Version:    track.Version,
+		Artists:    make([]string, 0, len(track.Artists)),
+		ISRC:       track.ISRC,
+		DurationMs: track.DurationMs,
+	}
+	for _, artist := range track.Artists {
+		info.Artists = append(info.Artists, artist.Name)
+	}
+	if len(track.Albums) > 0 {
+		album := track.Albums[0]
+		info.Album = album.Title
+		info.AlbumID = album.ID.String()
+		info.Year = album.Year
+	}
+	return info
+}
+
+// Env exposes the most used fields so simple hooks can skip JSON parsing.
+func (p TrackPayload) Env() []string {
+	return []string{
+		"YAMDL_EVENT=" + p.Event,
+		"YAMDL_INDEX=" + strconv.Itoa(p.Index),
+		"YAMDL_STATUS=" + p.Status,
+		"YAMDL_REASON=" + p.Reason,
+		"YAMDL_CONTAINER=" + p.Container,
+		"YAMDL_PATH=" + p.Path,
+		"YAMDL_TRACK_ID=" + p.Track.ID,
+		"YAMDL_TRACK_TITLE=" + p.Track.Title,
+		"YAMDL_TRACK_ARTISTS=" + strings.Join(p.Track.Artists, ", "),
+		"YAMDL_ALBUM=" + p.Track.Album,
+	}
+}
+
+// Env exposes the batch counters.
+func (p BatchPayload) Env() []string {
+	return []string{
+		"YAMDL_EVENT=" + p.Event,
+		"YAMDL_SOURCE=" + p.Source,
+		"YAMDL_OUTPUT=" + p.Output,
+		"YAMDL_TOTAL=" + strconv.Itoa(p.Total),
+		"YAMDL_DOWNLOADED=" + strconv.Itoa(p.Downloaded),
+		"YAMDL_SKIPPED=" + strconv.Itoa(p.Skipped),
+		"YAMDL_FAILED=" + strconv.Itoa(p.Failed),
+		"YAMDL_INTERRUPTED=" + strconv.FormatBool(p.Interrupted),
+	}
+}
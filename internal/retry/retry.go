@@ -0,0 +1,182 @@
+package retry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"ya-music/internal/batch"
+)
+
+const (
+	// DefaultFilename is the retry list kept in the output directory.
+	DefaultFilename = ".yamdl-failed.json"
+	listVersion     = 1
+)
+
+// DefaultPath returns the retry list of outputDir.
+func DefaultPath(outputDir string) string {
+	return filepath.Join(outputDir, DefaultFilename)
+}
+
+// Entry is a track whose last download attempt failed.
+type Entry struct {
+	TrackID  string    `json:"track_id"`
+	Title    string    `json:"title,omitempty"`
+	Source   string    `json:"source,omitempty"`
+	Stage    string    `json:"stage,omitempty"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// Options are the download options of the batch that last recorded failures,
+// so a retry can use them again.
+type Options struct {
+	Format            string `json:"format,omitempty"`
+	LosslessContainer string `json:"lossless_container,omitempty"`
+	Transcode         string `json:"transcode,omitempty"`
+	SkipCover         bool   `json:"skip_cover,omitempty"`
+	ReplayGain        bool   `json:"replaygain,omitempty"`
+	Upgrade           bool   `json:"upgrade,omitempty"`
+	UpgradeArchive    string `json:"upgrade_archive,omitempty"`
+}
+
+// List is the content of a retry file.
+type List struct {
+	Version int     `json:"version"`
+	Options Options `json:"options"`
+	Entries []Entry `json:"entries"`
+}
+
+// Load reads the retry list at path. A missing file is an empty list.
+func Load(path string) (List, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return List{Version: listVersion}, nil
+	}
+	if err != nil {
+		return List{}, fmt.Errorf("read retry list: %w", err)
+	}
+	var list List
+	if err := json.Unmarshal(data, &list); err != nil {
+		return List{}, fmt.Errorf("parse retry list %s: %w", path, err)
+	}
+	if list.Version != listVersion {
+		return List{}, fmt.Errorf("unsupported retry list version %d", list.Version)
+	}
+	return list, nil
+}
+
+// Save atomically writes list to path, or removes the file when no failures
+// remain.
+func Save(path string, list List) error {
+	if len(list.Entries) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove retry list: %w", err)
+		}
+		return nil
+	}
+	list.Version = listVersion
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode retry list: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create retry list temp file: %w", err)
+	}
+	tempName := temp.Name()
+	defer func() {
+		_ = os.Remove(tempName)
+	}()
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("write retry list: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("close retry list: %w", err)
+	}
+	if err := os.Rename(tempName, path); err != nil {
+		return fmt.Errorf("publish retry list: %w", err)
+	}
+	return nil
+}
+
+// Fail adds entry, replacing an earlier failure of the same track. An entry
+// without a source keeps the source of the earlier failure.
+func (l *List) Fail(entry Entry) {
+	for _, previous := range l.Entries {
+		if previous.TrackID == entry.TrackID && entry.Source == "" {
+			entry.Source = previous.Source
+		}
+	}
+	l.Clear(entry.TrackID)
+	l.Entries = append(l.Entries, entry)
+}
+
+// Clear removes the failure of trackID, if any.
+func (l *List) Clear(trackID string) {
+	kept := l.Entries[:0]
+	for _, entry := range l.Entries {
+		if entry.TrackID != trackID {
+			kept = append(kept, entry)
+		}
+	}
+	l.Entries = kept
+}
+
+// Apply records failed tracks of a batch and clears tracks that are now on
+// disk. Other skipped tracks keep their entries. options replace the stored
+// options when the batch failed at least one track.
+func (l *List) Apply(source string, options Options, events []batch.Event, now time.Time) {
+	failed := false
+	for _, event := range events {
+		id := event.Track.ID.String()
+		if id == "" {
+			continue
+		}
+		switch {
+		case event.Status == batch.StatusError:
+			failed = true
+			l.Fail(Entry{
+				TrackID:  id,
+				Title:    event.Track.DisplayLabel(),
+				Source:   source,
+				Stage:    event.Stage,
+				Error:    event.Reason,
+				FailedAt: now,
+			})
+		case event.Status == batch.StatusDone,
+			event.Status == batch.StatusSkipped && event.Reason == batch.SkipAlreadyExists:
+			l.Clear(id)
+		}
+	}
+	if failed {
+		l.Options = options
+	}
+}
+
+// TrackIDs returns the IDs of all failed tracks in the order they failed.
+func (l List) TrackIDs() []string {
+	ids := make([]string, 0, len(l.Entries))
+	for _, entry := range l.Entries {
+		ids = append(ids, entry.TrackID)
+	}
+	return ids
+}
+
+// Source returns the source link shared by all entries, or "" when the
+// failures come from different links.
+func (l List) Source() string {
+	source := ""
+	for i, entry := range l.Entries {
+		if i > 0 && entry.Source != source {
+			return ""
+		}
+		source = entry.Source
+	}
+	return source
+}
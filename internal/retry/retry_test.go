@@ -0,0 +1,93 @@
+package retry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func track(id string) model.Track {
+	return model.Track{ID: model.FlexibleID(id), Title: "Song " + id, Available: true}
+}
+
+func TestApplyRecordsFailuresAndClearsRecoveredTracks(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	list := List{Entries: []Entry{
+		{TrackID: "1", Error: "old"},
+		{TrackID: "2", Error: "old"},
+		{TrackID: "3", Error: "old"},
+	}}
+	options := Options{Format: "flac", SkipCover: true}
+
+	list.Apply("https://music.yandex.ru/album/1", options, []batch.Event{
+		{Track: track("1"), Status: batch.StatusDownloading},
+		{Track: track("1"), Status: batch.StatusDone},
+		{Track: track("2"), Status: batch.StatusSkipped, Reason: batch.SkipAlreadyExists},
+		{Track: track("3"), Status: batch.StatusSkipped, Reason: batch.SkipUnavailable},
+		{Track: track("4"), Status: batch.StatusError, Reason: "boom", Stage: "download_link"},
+	}, now)
+
+	assert.Equal(t, []string{"3", "4"}, list.TrackIDs())
+	assert.Equal(t, Entry{
+		TrackID:  "4",
+		Title:    "Song 4",
+		Source:   "https://music.yandex.ru/album/1",
+		Stage:    "download_link",
+		Error:    "boom",
+		FailedAt: now,
+	}, list.Entries[1])
+	assert.Equal(t, options, list.Options)
+}
+
+func TestApplyKeepsOptionsWithoutNewFailures(t *testing.T) {
+	list := List{Options: Options{Format: "flac"}, Entries: []Entry{{TrackID: "1"}}}
+
+	list.Apply("", Options{Format: "mp3"}, []batch.Event{{Track: track("2"), Status: batch.StatusDone}}, time.Now())
+
+	assert.Equal(t, "flac", list.Options.Format)
+}
+
+func TestSaveAndLoadRoundTripAndRemoveEmptyList(t *testing.T) {
+	path := DefaultPath(t.TempDir())
+
+	empty, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Entries)
+
+	list := List{Options: Options{Format: "mp3"}, Entries: []Entry{{TrackID: "1", Error: "boom"}}}
+	require.NoError(t, Save(path, list))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, listVersion, loaded.Version)
+	assert.Equal(t, list.Entries, loaded.Entries)
+	assert.Equal(t, list.Options, loaded.Options)
+
+	require.NoError(t, Save(path, List{}))
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "failed.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":9,"entries":[]}`), 0o644))
+
+	_, err := Load(path)
+
+	assert.ErrorContains(t, err, "unsupported retry list version 9")
+}
+
+func TestFailKeepsEarlierSourceWhenRetryHasNone(t *testing.T) {
+	list := List{Entries: []Entry{{TrackID: "1", Source: "https://music.yandex.ru/album/1", Error: "old"}}}
+
+	list.Fail(Entry{TrackID: "1", Error: "new"})
+
+	require.Len(t, list.Entries, 1)
+	assert.Equal(t, "https://music.yandex.ru/album/1", list.Entries[0].Source)
+	assert.Equal(t, "new", list.Entries[0].Error)
+}
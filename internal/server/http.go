@@ -0,0 +1,248 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const maxSubmitBodyBytes = 64 << 10
+
+// NewHandler exposes manager over a JSON API guarded by apiKey:
+//
+//	POST   /api/jobs             queue {"link": "..."} (JSON or form body)
+//	GET    /api/jobs             list jobs
+//	GET    /api/jobs/{id}        job with per-track progress
+//	POST   /api/jobs/{id}/cancel cancel a queued or running job
+//	DELETE /api/jobs/{id}        same as cancel
+//	GET    /api/events           server-sent events; ?job=ID filters one job
+//
+// The key is accepted as a Bearer token, an X-API-Key header, or an api_key
+// query parameter for clients such as EventSource that cannot set headers.
+func NewHandler(manager *Manager, apiKey string) http.Handler {
+	h := &handler{manager: manager}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/jobs", h.submit)
+	mux.HandleFunc("GET /api/jobs", h.list)
+	mux.HandleFunc("GET /api/jobs/{id}", h.get)
+	mux.HandleFunc("POST /api/jobs/{id}/cancel", h.cancel)
+	mux.HandleFunc("DELETE /api/jobs/{id}", h.cancel)
+	mux.HandleFunc("GET /api/events", h.events)
+	return withCORS(requireAPIKey(apiKey, mux))
+}
+
+// FilesPrefix is where WithFiles serves the download directory.
+const FilesPrefix = "/files/"
+
+// WithFiles serves the files under dir at FilesPrefix without the API key, so
+// podcast apps on the LAN can fetch a feed and its episodes. Directory
+// listings and hidden files such as retry lists are not served; everything
+// else goes to api.
+func WithFiles(api http.Handler, dir string) http.Handler {
+	files := http.StripPrefix(FilesPrefix, http.FileServer(http.Dir(dir)))
+	mux := http.NewServeMux()
+	mux.Handle("GET "+FilesPrefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/") || strings.Contains(r.URL.Path, "/.") {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	mux.Handle("/", api)
+	return mux
+}
+
+type handler struct {
+	manager *Manager
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type submitRequest struct {
+	Link string `json:"link"`
+}
+
+func requireAPIKey(apiKey string, next http.Handler) http.Handler {
+	expected := []byte(apiKey)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(requestAPIKey(r)), expected) != 1 {
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid or missing API key"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+// withCORS lets browser bookmarklets on other origins call the API; requests
+// still need the API key.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *handler) submit(w http.ResponseWriter, r *http.Request) {
+	link, err := readSubmitLink(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	job, err := h.manager.Submit(link)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func readSubmitLink(r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxSubmitBodyBytes)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data" {
+		if err := r.ParseForm(); err != nil {
+			return "", fmt.Errorf("invalid form body: %w", err)
+		}
+		return requiredLink(r.PostForm.Get("link"))
+	}
+
+	var request submitRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("link is required")
+		}
+		return "", fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return requiredLink(request.Link)
+}
+
+func requiredLink(link string) (string, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return "", errors.New("link is required")
+	}
+	return link, nil
+}
+
+func (h *handler) list(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Jobs []Job `json:"jobs"`
+	}{Jobs: h.manager.Jobs()})
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.manager.Job(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *handler) cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := h.manager.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+	case errors.Is(err, ErrJobFinished):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+	default:
+		writeJSON(w, http.StatusAccepted, job)
+	}
+}
+
+// events streams updates as server-sent events. Each stream starts with the
+// current state of the selected jobs so clients never miss earlier progress.
+func (h *handler) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "streaming unsupported"})
+		return
+	}
+	jobFilter := r.URL.Query().Get("job")
+	if jobFilter != "" {
+		if _, err := h.manager.Job(jobFilter); err != nil {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	updates, stop := h.manager.Subscribe()
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	for _, job := range h.manager.Jobs() {
+		if jobFilter != "" && job.ID != jobFilter {
+			continue
+		}
+		if err := writeEvent(w, Update{Type: UpdateJob, JobID: job.ID, Job: &job}); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case update, ok := <-updates:
+			if !ok {
+				return
+			}
+			if jobFilter != "" && update.JobID != jobFilter {
+				continue
+			}
+			if err := writeEvent(w, update); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, update Update) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", update.Type, data)
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
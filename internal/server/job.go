@@ -0,0 +1,70 @@
+// Package server runs yamdl as a long-lived daemon that queues downloads
+// submitted over a local HTTP API.
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobResolving JobStatus = "resolving"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+func (s JobStatus) finished() bool {
+	return s == JobDone || s == JobFailed || s == JobCancelled
+}
+
+// TrackQueued marks a resolved track that batch.Run has not reported yet.
+const TrackQueued = "queued"
+
+type Job struct {
+	ID        string     `json:"id"`
+	Link      string     `json:"link"`
+	Status    JobStatus  `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Summary   JobSummary `json:"summary"`
+	Tracks    []JobTrack `json:"tracks,omitempty"`
+}
+
+type JobSummary struct {
+	Total      int `json:"total"`
+	Downloaded int `json:"downloaded"`
+	Skipped    int `json:"skipped"`
+	Failed     int `json:"failed"`
+}
+
+type JobTrack struct {
+	Index  int    `json:"index"`
+	ID     string `json:"id"`
+	Label  string `json:"label"`
+	Status string `json:"status"`
+	Format string `json:"format,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// clone returns a copy that shares no track state with j.
+func (j *Job) clone(withTracks bool) Job {
+	copied := *j
+	copied.Tracks = nil
+	if withTracks {
+		copied.Tracks = append([]JobTrack(nil), j.Tracks...)
+	}
+	return copied
+}
+
+func newJobID() string {
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,459 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/internal/history"
+	"ya-music/source"
+	"ya-music/utils"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+	ErrInvalidLink = errors.New("invalid link")
+)
+
+// Client resolves sources and downloads tracks for queued jobs.
+type Client interface {
+	source.ContextClient
+	DownloadTrackWithOptionsContext(context.Context, model.Track, string, ya.DownloadOptions) (string, error)
+}
+
+type Config struct {
+	Client      Client
+	Store       *Store
+	OutputDir   string
+	Options     ya.DownloadOptions
+	Concurrency int
+	Logger      *utils.DownloadLogger
+	// History records finished tracks when set.
+	History *history.Store
+}
+
+type UpdateType string
+
+const (
+	UpdateJob   UpdateType = "job"
+	UpdateTrack UpdateType = "track"
+)
+
+// Update is a change notification streamed to event subscribers. Job updates
+// carry the job without its track list; track updates carry one track.
+type Update struct {
+	Type  UpdateType `json:"type"`
+	JobID string     `json:"job_id"`
+	Job   *Job       `json:"job,omitempty"`
+	Track *JobTrack  `json:"track,omitempty"`
+}
+
+// Manager owns the job queue and runs jobs one at a time.
+type Manager struct {
+	config Config
+
+	mu            sync.Mutex
+	jobs          []*Job
+	byID          map[string]*Job
+	running       string
+	cancelRunning context.CancelFunc
+	// cancelDownloads aborts the downloads in flight of the running job. The
+	// Run context does not, so shutdown lets them finish.
+	cancelDownloads context.CancelFunc
+	cancelRequested bool
+
+	persistMu sync.Mutex
+	wake      chan struct{}
+
+	subscribersMu sync.Mutex
+	subscribers   map[chan Update]struct{}
+
+	now func() time.Time
+}
+
+// NewManager restores jobs loaded from the store. Jobs that were resolving or
+// running when the daemon stopped are queued again from the start; files that
+// already finished are reported as already existing on the next run.
+func NewManager(config Config, restored []Job) *Manager {
+	m := &Manager{
+		config:      config,
+		byID:        make(map[string]*Job, len(restored)),
+		wake:        make(chan struct{}, 1),
+		subscribers: make(map[chan Update]struct{}),
+		now:         time.Now,
+	}
+	for _, job := range restored {
+		job := job
+		if !job.Status.finished() {
+			resetJob(&job)
+		}
+		m.jobs = append(m.jobs, &job)
+		m.byID[job.ID] = &job
+	}
+	m.signal()
+	return m
+}
+
+func resetJob(job *Job) {
+	job.Status = JobQueued
+	job.Error = ""
+	job.Summary = JobSummary{}
+	job.Tracks = nil
+}
+
+func (m *Manager) logger() *utils.DownloadLogger {
+	if m.config.Logger == nil {
+		return utils.NewDiscardDownloadLogger()
+	}
+	return m.config.Logger
+}
+
+func (m *Manager) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Submit validates link and appends a new queued job.
+func (m *Manager) Submit(link string) (Job, error) {
+	link = strings.TrimSpace(link)
+	if _, err := source.Parse(link); err != nil {
+		return Job{}, fmt.Errorf("%w: %v", ErrInvalidLink, err)
+	}
+
+	now := m.now()
+	job := &Job{
+		ID:        newJobID(),
+		Link:      link,
+		Status:    JobQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	m.mu.Lock()
+	m.jobs = append(m.jobs, job)
+	m.byID[job.ID] = job
+	snapshot := job.clone(false)
+	m.mu.Unlock()
+
+	m.persist()
+	m.publish(Update{Type: UpdateJob, JobID: job.ID, Job: &snapshot})
+	m.logger().Info("job queued", "job_id", job.ID, "source", utils.SanitizeURL(link))
+	m.signal()
+	return snapshot, nil
+}
+
+// Jobs lists every known job in submission order, without track details.
+func (m *Manager) Jobs() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job.clone(false))
+	}
+	return jobs
+}
+
+// Job returns one job including per-track progress.
+func (m *Manager) Job(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.byID[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job.clone(true), nil
+}
+
+// Cancel drops a queued job or stops a running one. Active downloads of a
+// running job are aborted; tracks that already finished stay on disk.
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	job, ok := m.byID[id]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	if job.Status.finished() {
+		snapshot := job.clone(false)
+		m.mu.Unlock()
+		return snapshot, ErrJobFinished
+	}
+
+	if m.running == id {
+		m.cancelRequested = true
+		cancel, cancelDownloads := m.cancelRunning, m.cancelDownloads
+		snapshot := job.clone(false)
+		m.mu.Unlock()
+
+		cancel()
+		cancelDownloads()
+		m.logger().Info("job cancel requested", "job_id", id)
+		return snapshot, nil
+	}
+
+	job.Status = JobCancelled
+	job.UpdatedAt = m.now()
+	snapshot := job.clone(false)
+	m.mu.Unlock()
+
+	m.persist()
+	m.publish(Update{Type: UpdateJob, JobID: id, Job: &snapshot})
+	m.logger().Info("job cancelled", "job_id", id)
+	return snapshot, nil
+}
+
+// AbortDownloads cancels the downloads in flight of the running job, for a
+// forced shutdown. The job is queued again when Run has been stopped.
+func (m *Manager) AbortDownloads() {
+	m.mu.Lock()
+	cancelDownloads := m.cancelDownloads
+	m.mu.Unlock()
+	if cancelDownloads != nil {
+		cancelDownloads()
+	}
+}
+
+// Subscribe streams job and track updates until the returned stop function is
+// called. Updates are dropped for subscribers that do not keep up.
+func (m *Manager) Subscribe() (<-chan Update, func()) {
+	ch := make(chan Update, 64)
+	m.subscribersMu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.subscribersMu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			m.subscribersMu.Lock()
+			delete(m.subscribers, ch)
+			m.subscribersMu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func (m *Manager) publish(update Update) {
+	m.subscribersMu.Lock()
+	defer m.subscribersMu.Unlock()
+	for ch := range m.subscribers {
+		select {
+		case ch <- update:
+		default:
+		}
+	}
+}
+
+func (m *Manager) persist() {
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+
+	m.mu.Lock()
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job.clone(true))
+	}
+	m.mu.Unlock()
+
+	if err := m.config.Store.Save(jobs); err != nil {
+		m.logger().Error("job store save failed", "error", err)
+	}
+}
+
+// Run processes queued jobs until ctx is cancelled. Cancelling ctx stops
+// scheduling tracks but lets started downloads finish; see AbortDownloads. A
+// job interrupted by shutdown is queued again so it resumes after the next
+// start.
+func (m *Manager) Run(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		id, ok := m.nextQueued()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-m.wake:
+			}
+			continue
+		}
+		m.runJob(ctx, id)
+	}
+}
+
+func (m *Manager) nextQueued() (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.Status == JobQueued {
+			return job.ID, true
+		}
+	}
+	return "", false
+}
+
+func (m *Manager) updateJob(id string, persist bool, apply func(job *Job)) {
+	m.mu.Lock()
+	job := m.byID[id]
+	apply(job)
+	job.UpdatedAt = m.now()
+	snapshot := job.clone(false)
+	m.mu.Unlock()
+
+	if persist {
+		m.persist()
+	}
+	m.publish(Update{Type: UpdateJob, JobID: id, Job: &snapshot})
+}
+
+func (m *Manager) runJob(ctx context.Context, id string) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	downloadCtx, cancelDownloads := context.WithCancel(context.Background())
+	defer cancelDownloads()
+
+	m.mu.Lock()
+	link := m.byID[id].Link
+	m.running = id
+	m.cancelRunning = cancel
+	m.cancelDownloads = cancelDownloads
+	m.cancelRequested = false
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.running = ""
+		m.cancelRunning = nil
+		m.cancelDownloads = nil
+		m.mu.Unlock()
+	}()
+
+	m.logger().Info("job started", "job_id", id, "source", utils.SanitizeURL(link))
+	m.updateJob(id, true, func(job *Job) {
+		job.Status = JobResolving
+	})
+
+	tracks, err := source.ResolveContext(jobCtx, m.config.Client, link)
+	if jobCtx.Err() != nil {
+		m.finishJob(ctx, id, nil)
+		return
+	}
+	if err == nil && len(tracks) == 0 {
+		err = errors.New("no tracks found")
+	}
+	if err != nil {
+		m.finishJob(ctx, id, fmt.Errorf("failed to resolve source: %w", err))
+		return
+	}
+
+	m.updateJob(id, true, func(job *Job) {
+		job.Status = JobRunning
+		job.Summary = JobSummary{Total: len(tracks)}
+		job.Tracks = make([]JobTrack, len(tracks))
+		for i, track := range tracks {
+			job.Tracks[i] = JobTrack{
+				Index:  i + 1,
+				ID:     track.ID.String(),
+				Label:  track.DisplayLabel(),
+				Status: TrackQueued,
+			}
+		}
+	})
+
+	events := batch.Run(batch.Config{
+		Client:          m.config.Client,
+		Tracks:          tracks,
+		OutputDir:       m.config.OutputDir,
+		Options:         m.config.Options,
+		Concurrency:     m.config.Concurrency,
+		Context:         jobCtx,
+		DownloadContext: downloadCtx,
+	})
+	recorder := history.NewRecorder(m.config.History, link)
+	for event := range events {
+		if err := recorder.Observe(event); err != nil {
+			m.logger().Error("history write failed", "stage", "history", "job_id", id, "error", err)
+		}
+		m.applyEvent(id, event)
+	}
+	// Release the database between jobs so `yamdl history` can read it.
+	if err := m.config.History.Close(); err != nil {
+		m.logger().Error("history close failed", "stage", "history", "job_id", id, "error", err)
+	}
+
+	m.finishJob(ctx, id, nil)
+}
+
+func (m *Manager) applyEvent(id string, event batch.Event) {
+	terminal := event.Terminal()
+
+	m.mu.Lock()
+	job := m.byID[id]
+	if event.Index < 1 || event.Index > len(job.Tracks) {
+		m.mu.Unlock()
+		return
+	}
+	track := &job.Tracks[event.Index-1]
+	track.Status = string(event.Status)
+	track.Format = string(event.Format)
+	track.Reason = event.Reason
+	switch event.Status {
+	case batch.StatusDone:
+		job.Summary.Downloaded++
+	case batch.StatusSkipped:
+		job.Summary.Skipped++
+	case batch.StatusError:
+		job.Summary.Failed++
+	}
+	job.UpdatedAt = m.now()
+	trackSnapshot := *track
+	jobSnapshot := job.clone(false)
+	m.mu.Unlock()
+
+	if terminal {
+		m.persist()
+	}
+	m.publish(Update{Type: UpdateTrack, JobID: id, Track: &trackSnapshot})
+	if terminal {
+		m.publish(Update{Type: UpdateJob, JobID: id, Job: &jobSnapshot})
+	}
+}
+
+func (m *Manager) finishJob(ctx context.Context, id string, jobErr error) {
+	m.mu.Lock()
+	cancelRequested := m.cancelRequested
+	m.mu.Unlock()
+
+	m.updateJob(id, true, func(job *Job) {
+		switch {
+		case cancelRequested:
+			job.Status = JobCancelled
+		case ctx.Err() != nil:
+			resetJob(job)
+		case jobErr != nil:
+			job.Status = JobFailed
+			job.Error = jobErr.Error()
+		default:
+			job.Status = JobDone
+		}
+	})
+
+	snapshot, _ := m.Job(id)
+	m.logger().Info("job finished",
+		"job_id", id,
+		"status", snapshot.Status,
+		"downloaded", snapshot.Summary.Downloaded,
+		"skipped", snapshot.Summary.Skipped,
+		"failed", snapshot.Summary.Failed,
+		"error", snapshot.Error,
+	)
+}
@@ -0,0 +1,433 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"ya-music/internal/history"
+	"ya-music/ya"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAPIKey = "secret"
+
+type fakeClient struct {
+	mu        sync.Mutex
+	albums    map[string]*model.Album
+	block     chan struct{}
+	started   chan string
+	downloads []string
+	// cancels counts downloads whose context was cancelled when they ended.
+	cancels int
+}
+
+func (c *fakeClient) TrackInfoContext(_ context.Context, id string) (*model.Track, error) {
+	return &model.Track{ID: model.FlexibleID(id), Title: "Track " + id, Available: true}, nil
+}
+
+func (c *fakeClient) AlbumWithTracksContext(_ context.Context, id string) (*model.Album, error) {
+	album, ok := c.albums[id]
+	if !ok {
+		return nil, errors.New("album not found")
+	}
+	return album, nil
+}
+
+func (c *fakeClient) UsersPlaylistContext(context.Context, string, string) (*model.Playlist, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeClient) PlaylistByUUIDContext(context.Context, string) (*model.Playlist, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeClient) ChartContext(context.Context, string) (*model.Playlist, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeClient) DownloadTrackWithOptionsContext(ctx context.Context, track model.Track, _ string, _ ya.DownloadOptions) (string, error) {
+	if c.started != nil {
+		c.started <- track.ID.String()
+	}
+	if c.block != nil {
+		<-c.block
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ctx.Err() != nil {
+		c.cancels++
+	}
+	c.downloads = append(c.downloads, track.ID.String())
+	return track.ID.String() + ".mp3", nil
+}
+
+func testAlbum(ids ...string) *model.Album {
+	var tracks []model.Track
+	for _, id := range ids {
+		tracks = append(tracks, model.Track{ID: model.FlexibleID(id), Title: "Track " + id, Available: true})
+	}
+	tracks = append(tracks, model.Track{ID: "locked", Title: "Locked"})
+	return &model.Album{ID: "1", Volumes: [][]model.Track{tracks}}
+}
+
+func newTestManager(t *testing.T, client *fakeClient, restored []Job) (*Manager, *Store) {
+	t.Helper()
+	store, _, err := OpenStore(filepath.Join(t.TempDir(), "jobs.json"))
+	require.NoError(t, err)
+	return NewManager(Config{Client: client, Store: store, Concurrency: 1}, restored), store
+}
+
+func startManager(t *testing.T, manager *Manager) context.CancelFunc {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		manager.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return cancel
+}
+
+func waitForStatus(t *testing.T, manager *Manager, id string, want JobStatus) Job {
+	t.Helper()
+	var job Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = manager.Job(id)
+		return err == nil && job.Status == want
+	}, 2*time.Second, 5*time.Millisecond, "job %s never reached %s", id, want)
+	return job
+}
+
+func TestManagerRunsJobAndRecordsTrackProgress(t *testing.T) {
+	client := &fakeClient{albums: map[string]*model.Album{"1": testAlbum("10", "11")}}
+	manager, store := newTestManager(t, client, nil)
+	startManager(t, manager)
+
+	submitted, err := manager.Submit(" https://music.yandex.ru/album/1 ")
+	require.NoError(t, err)
+	assert.Equal(t, JobQueued, submitted.Status)
+
+	job := waitForStatus(t, manager, submitted.ID, JobDone)
+	assert.Equal(t, JobSummary{Total: 3, Downloaded: 2, Skipped: 1}, job.Summary)
+	require.Len(t, job.Tracks, 3)
+	assert.Equal(t, "done", job.Tracks[0].Status)
+	assert.Equal(t, "skipped", job.Tracks[2].Status)
+	assert.Equal(t, "unavailable", job.Tracks[2].Reason)
+
+	// The finished status is saved right after it becomes visible in memory.
+	var saved []Job
+	require.Eventually(t, func() bool {
+		_, saved, err = OpenStore(store.path)
+		return err == nil && len(saved) == 1 && saved[0].Status == JobDone
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.Len(t, saved[0].Tracks, 3)
+}
+
+func TestManagerRecordsHistory(t *testing.T) {
+	client := &fakeClient{albums: map[string]*model.Album{"1": testAlbum("10")}}
+	store, _, err := OpenStore(filepath.Join(t.TempDir(), "jobs.json"))
+	require.NoError(t, err)
+	records := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	manager := NewManager(Config{Client: client, Store: store, Concurrency: 1, History: records}, nil)
+	startManager(t, manager)
+
+	submitted, err := manager.Submit("https://music.yandex.ru/album/1")
+	require.NoError(t, err)
+	waitForStatus(t, manager, submitted.ID, JobDone)
+
+	recorded, err := records.Load()
+	require.NoError(t, err)
+	require.Len(t, recorded, 2)
+	byID := map[string]history.Record{}
+	for _, record := range recorded {
+		byID[record.TrackID] = record
+	}
+	assert.Equal(t, history.StatusDone, byID["10"].Status)
+	assert.Equal(t, "https://music.yandex.ru/album/1", byID["10"].Source)
+	assert.Equal(t, history.StatusSkipped, byID["locked"].Status)
+}
+
+func TestManagerMarksUnresolvableJobFailed(t *testing.T) {
+	manager, _ := newTestManager(t, &fakeClient{}, nil)
+	startManager(t, manager)
+
+	submitted, err := manager.Submit("https://music.yandex.ru/album/404")
+	require.NoError(t, err)
+
+	job := waitForStatus(t, manager, submitted.ID, JobFailed)
+	assert.Contains(t, job.Error, "album not found")
+}
+
+func TestManagerRejectsInvalidLink(t *testing.T) {
+	manager, _ := newTestManager(t, &fakeClient{}, nil)
+
+	_, err := manager.Submit("https://example.com/not-music")
+
+	assert.ErrorIs(t, err, ErrInvalidLink)
+	assert.Empty(t, manager.Jobs())
+}
+
+func TestManagerCancelsRunningJob(t *testing.T) {
+	client := &fakeClient{
+		albums:  map[string]*model.Album{"1": testAlbum("10", "11")},
+		block:   make(chan struct{}),
+		started: make(chan string, 4),
+	}
+	manager, _ := newTestManager(t, client, nil)
+	startManager(t, manager)
+
+	submitted, err := manager.Submit("https://music.yandex.ru/album/1")
+	require.NoError(t, err)
+	<-client.started
+
+	_, err = manager.Cancel(submitted.ID)
+	require.NoError(t, err)
+	close(client.block)
+
+	job := waitForStatus(t, manager, submitted.ID, JobCancelled)
+	assert.Equal(t, 1, job.Summary.Downloaded)
+	assert.Equal(t, 1, client.cancels)
+
+	_, err = manager.Cancel(submitted.ID)
+	assert.ErrorIs(t, err, ErrJobFinished)
+	_, err = manager.Cancel("missing")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestManagerShutdownLetsRunningDownloadsFinish(t *testing.T) {
+	client := &fakeClient{
+		albums:  map[string]*model.Album{"1": testAlbum("10", "11")},
+		block:   make(chan struct{}),
+		started: make(chan string, 4),
+	}
+	manager, _ := newTestManager(t, client, nil)
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		manager.Run(ctx)
+	}()
+
+	submitted, err := manager.Submit("https://music.yandex.ru/album/1")
+	require.NoError(t, err)
+	<-client.started
+	stop()
+	close(client.block)
+	<-done
+
+	client.mu.Lock()
+	assert.Equal(t, []string{"10"}, client.downloads)
+	assert.Zero(t, client.cancels)
+	client.mu.Unlock()
+	job, err := manager.Job(submitted.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobQueued, job.Status)
+}
+
+func TestManagerAbortDownloadsCancelsRunningDownloads(t *testing.T) {
+	client := &fakeClient{
+		albums:  map[string]*model.Album{"1": testAlbum("10")},
+		block:   make(chan struct{}),
+		started: make(chan string, 4),
+	}
+	manager, _ := newTestManager(t, client, nil)
+	stop := startManager(t, manager)
+
+	_, err := manager.Submit("https://music.yandex.ru/album/1")
+	require.NoError(t, err)
+	<-client.started
+	stop()
+	manager.AbortDownloads()
+	close(client.block)
+
+	require.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.cancels == 1
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestManagerRequeuesUnfinishedJobsOnRestart(t *testing.T) {
+	restored := []Job{
+		{ID: "a", Link: "https://music.yandex.ru/album/1", Status: JobRunning, Tracks: []JobTrack{{Index: 1}}},
+		{ID: "b", Link: "https://music.yandex.ru/album/1", Status: JobDone},
+		{ID: "c", Link: "https://music.yandex.ru/album/1", Status: JobQueued},
+	}
+	client := &fakeClient{albums: map[string]*model.Album{"1": testAlbum("10")}}
+	manager, _ := newTestManager(t, client, restored)
+
+	job, err := manager.Job("a")
+	require.NoError(t, err)
+	assert.Equal(t, JobQueued, job.Status)
+	assert.Empty(t, job.Tracks)
+
+	startManager(t, manager)
+	waitForStatus(t, manager, "a", JobDone)
+	waitForStatus(t, manager, "c", JobDone)
+	finished, err := manager.Job("b")
+	require.NoError(t, err)
+	assert.Equal(t, JobDone, finished.Status)
+	assert.Empty(t, finished.Tracks)
+}
+
+func TestStoreRejectsUnknownVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	store, jobs, err := OpenStore(path)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	require.NoError(t, store.Save([]Job{{ID: "a", Status: JobQueued}}))
+
+	_, jobs, err = OpenStore(path)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+
+	require.NoError(t, writeFile(path, `{"version": 99, "jobs": []}`))
+	_, _, err = OpenStore(path)
+	assert.Error(t, err)
+}
+
+func TestHandlerRequiresAPIKey(t *testing.T) {
+	manager, _ := newTestManager(t, &fakeClient{}, nil)
+	server := httptest.NewServer(NewHandler(manager, testAPIKey))
+	t.Cleanup(server.Close)
+
+	for _, setKey := range []func(*http.Request){
+		func(*http.Request) {},
+		func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") },
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/jobs", nil)
+		require.NoError(t, err)
+		setKey(req)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	}
+
+	for _, setKey := range []func(*http.Request){
+		func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+testAPIKey) },
+		func(r *http.Request) { r.Header.Set("X-API-Key", testAPIKey) },
+		func(r *http.Request) { r.URL.RawQuery = "api_key=" + testAPIKey },
+	} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/jobs", nil)
+		require.NoError(t, err)
+		setKey(req)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestWithFilesServesFilesWithoutAPIKey(t *testing.T) {
+	manager, _ := newTestManager(t, &fakeClient{}, nil)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "feed.xml"), []byte("<rss/>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".yamdl-failed.json"), []byte("{}"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "Show"), 0o755))
+	server := httptest.NewServer(WithFiles(NewHandler(manager, testAPIKey), dir))
+	t.Cleanup(server.Close)
+
+	get := func(path string) (int, string) {
+		res, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	status, body := get("/files/feed.xml")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "<rss/>", body)
+	for _, path := range []string{"/files/", "/files/Show/", "/files/.yamdl-failed.json"} {
+		status, _ := get(path)
+		assert.Equal(t, http.StatusNotFound, status, path)
+	}
+	status, _ = get("/api/jobs")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestHandlerSubmitsJobsAndStreamsEvents(t *testing.T) {
+	client := &fakeClient{albums: map[string]*model.Album{"1": testAlbum("10")}}
+	manager, _ := newTestManager(t, client, nil)
+	server := httptest.NewServer(NewHandler(manager, testAPIKey))
+	t.Cleanup(server.Close)
+
+	eventsReq, err := http.NewRequest(http.MethodGet, server.URL+"/api/events?api_key="+testAPIKey, nil)
+	require.NoError(t, err)
+	eventsRes, err := http.DefaultClient.Do(eventsReq)
+	require.NoError(t, err)
+	t.Cleanup(func() { eventsRes.Body.Close() })
+	assert.Equal(t, "text/event-stream", eventsRes.Header.Get("Content-Type"))
+
+	form := url.Values{"link": {"https://music.yandex.ru/album/1"}}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/jobs", strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-API-Key", testAPIKey)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusAccepted, res.StatusCode)
+
+	startManager(t, manager)
+
+	scanner := bufio.NewScanner(eventsRes.Body)
+	var sawTrackDone, sawJobDone bool
+	for scanner.Scan() && !(sawTrackDone && sawJobDone) {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		sawTrackDone = sawTrackDone || (strings.Contains(line, `"type":"track"`) && strings.Contains(line, `"status":"done"`))
+		sawJobDone = sawJobDone || (strings.Contains(line, `"type":"job"`) && strings.Contains(line, `"status":"done"`))
+	}
+	assert.True(t, sawTrackDone)
+	assert.True(t, sawJobDone)
+}
+
+func TestHandlerReportsBadRequestsAndMissingJobs(t *testing.T) {
+	manager, _ := newTestManager(t, &fakeClient{}, nil)
+	server := httptest.NewServer(NewHandler(manager, testAPIKey))
+	t.Cleanup(server.Close)
+
+	do := func(method, path, body string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+testAPIKey)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/jobs", `{}`))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/jobs", `{"link": "https://example.com"}`))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/api/jobs/missing", ""))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/jobs/missing/cancel", ""))
+	assert.Equal(t, http.StatusAccepted, do(http.MethodPost, "/api/jobs", `{"link": "https://music.yandex.ru/album/1"}`))
+}
+
+func writeFile(path, content string) error {
+	return os.WriteFile(path, []byte(content), 0644)
+}
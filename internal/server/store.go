@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const storeVersion = 1
+
+// Store persists the job queue as a JSON file so queued and interrupted jobs
+// survive a daemon restart.
+type Store struct {
+	path string
+	mu   sync.Mutex
+}
+
+type storeFile struct {
+	Version int   `json:"version"`
+	Jobs    []Job `json:"jobs"`
+}
+
+// OpenStore reads the jobs saved at path. A missing file is an empty queue.
+func OpenStore(path string) (*Store, []Job, error) {
+	store := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read job store: %w", err)
+	}
+
+	var state storeFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, nil, fmt.Errorf("parse job store %s: %w", path, err)
+	}
+	if state.Version != storeVersion {
+		return nil, nil, fmt.Errorf("unsupported job store version %d", state.Version)
+	}
+	return store, state.Jobs, nil
+}
+
+// Save atomically replaces the stored queue with jobs.
+func (s *Store) Save(jobs []Job) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(storeFile{Version: storeVersion, Jobs: jobs}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode job store: %w", err)
+	}
+
+	dir := filepath.Dir(s.path)
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create job store temp file: %w", err)
+	}
+	tempName := temp.Name()
+	defer func() {
+		_ = os.Remove(tempName)
+	}()
+
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("write job store: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("sync job store: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("close job store: %w", err)
+	}
+	if err := os.Rename(tempName, s.path); err != nil {
+		return fmt.Errorf("publish job store: %w", err)
+	}
+	return nil
+}
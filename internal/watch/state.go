@@ -0,0 +1,147 @@
+// Package watch keeps the per-source state used by `yamdl watch` to download
+// only tracks added since the previous check.
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/source"
+	"ya-music/utils"
+	"ya-music/ya/model"
+)
+
+// State is what a watcher remembers about one source between checks.
+type State struct {
+	Link     string `json:"link"`
+	Revision int    `json:"revision"`
+	Snapshot int    `json:"snapshot"`
+	// Seen maps the ID of every handled track to how it was handled: a
+	// batch.StatusDone status or a skip reason such as batch.SkipUnavailable.
+	Seen      map[string]string `json:"seen_tracks"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+// DefaultStatePath places the state next to the downloads as a hidden file
+// named after the source, so separate watchers never share a file.
+func DefaultStatePath(outputDir string, ref *source.Ref) string {
+	return filepath.Join(outputDir, ".yamdl-watch-"+utils.SanitizeFilename(ref.Key())+".json")
+}
+
+// LoadState reads the state at path. A missing file, or a file written for a
+// different link, starts from an empty state.
+func LoadState(path, link string) (State, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return State{Link: link}, nil
+	}
+	if err != nil {
+		return State{}, fmt.Errorf("read watch state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, fmt.Errorf("parse watch state %s: %w", path, err)
+	}
+	if state.Link != link {
+		return State{Link: link}, nil
+	}
+	return state, nil
+}
+
+// SaveState atomically writes state to path.
+func SaveState(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode watch state: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("create watch state temp file: %w", err)
+	}
+	tempName := temp.Name()
+	defer func() {
+		_ = os.Remove(tempName)
+	}()
+	if _, err := temp.Write(data); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("write watch state: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("close watch state: %w", err)
+	}
+	if err := os.Rename(tempName, path); err != nil {
+		return fmt.Errorf("publish watch state: %w", err)
+	}
+	return nil
+}
+
+// Unchanged reports whether a playlist still has the revision recorded after
+// the last complete check. Tracks and albums have no revision and are always
+// compared by track ID.
+func (s State) Unchanged(snapshot source.Snapshot) bool {
+	return snapshot.Revision != 0 &&
+		snapshot.Revision == s.Revision &&
+		snapshot.Snapshot == s.Snapshot
+}
+
+// NewTracks returns tracks whose IDs have not been recorded as handled, and
+// tracks seen as unavailable that have become available since.
+func (s State) NewTracks(tracks []model.Track) []model.Track {
+	var fresh []model.Track
+	for _, track := range tracks {
+		id := strings.TrimSpace(track.ID.String())
+		if id == "" {
+			continue
+		}
+		status, ok := s.Seen[id]
+		if ok && (status != batch.SkipUnavailable || !track.Available) {
+			continue
+		}
+		fresh = append(fresh, track)
+	}
+	return fresh
+}
+
+// Record marks downloaded, already existing, and unavailable tracks as
+// handled together with their status. Failed and unscheduled tracks stay new so
+// the next check retries them. The playlist revision is stored only when
+// complete is true, otherwise an unchanged playlist would hide the tracks that
+// still need a retry.
+func (s *State) Record(snapshot source.Snapshot, events []batch.Event, complete bool, now time.Time) {
+	for _, event := range events {
+		id := strings.TrimSpace(event.Track.ID.String())
+		status, ok := handledStatus(event)
+		if id == "" || !ok {
+			continue
+		}
+		if s.Seen == nil {
+			s.Seen = make(map[string]string)
+		}
+		s.Seen[id] = status
+	}
+	if complete {
+		s.Revision = snapshot.Revision
+		s.Snapshot = snapshot.Snapshot
+	}
+	s.CheckedAt = now
+}
+
+func handledStatus(event batch.Event) (string, bool) {
+	switch event.Status {
+	case batch.StatusDone:
+		return string(batch.StatusDone), true
+	case batch.StatusSkipped:
+		switch event.Reason {
+		case batch.SkipAlreadyExists, batch.SkipDuplicate, batch.SkipUnavailable:
+			return event.Reason, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ya-music/internal/batch"
+	"ya-music/source"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func track(id string) model.Track {
+	return model.Track{ID: model.FlexibleID(id), Available: true}
+}
+
+func TestNewTracksSkipsSeenAndUnidentifiedTracks(t *testing.T) {
+	state := State{Seen: map[string]string{"1": "done", "3": batch.SkipAlreadyExists}}
+
+	fresh := state.NewTracks([]model.Track{track("1"), track("2"), track("3"), track(""), track("4")})
+
+	require.Len(t, fresh, 2)
+	assert.Equal(t, "2", fresh[0].ID.String())
+	assert.Equal(t, "4", fresh[1].ID.String())
+}
+
+func TestNewTracksReturnsUnavailableTracksOnceAvailable(t *testing.T) {
+	state := State{Seen: map[string]string{"1": batch.SkipUnavailable, "2": batch.SkipUnavailable}}
+	stillUnavailable := track("2")
+	stillUnavailable.Available = false
+
+	fresh := state.NewTracks([]model.Track{track("1"), stillUnavailable})
+
+	require.Len(t, fresh, 1)
+	assert.Equal(t, "1", fresh[0].ID.String())
+}
+
+func TestRecordMarksHandledTracksAndRevision(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	snapshot := source.Snapshot{Revision: 5, Snapshot: 2}
+	state := State{Seen: map[string]string{"1": "done"}}
+
+	state.Record(snapshot, []batch.Event{
+		{Track: track("2"), Status: batch.StatusDownloading},
+		{Track: track("2"), Status: batch.StatusDone},
+		{Track: track("3"), Status: batch.StatusSkipped, Reason: batch.SkipAlreadyExists},
+		{Track: track("4"), Status: batch.StatusSkipped, Reason: batch.SkipUnavailable},
+		{Track: track("5"), Status: batch.StatusError, Reason: "boom"},
+	}, true, now)
+
+	assert.Equal(t, map[string]string{
+		"1": "done",
+		"2": "done",
+		"3": batch.SkipAlreadyExists,
+		"4": batch.SkipUnavailable,
+	}, state.Seen)
+	assert.Equal(t, 5, state.Revision)
+	assert.Equal(t, 2, state.Snapshot)
+	assert.Equal(t, now, state.CheckedAt)
+	assert.True(t, state.Unchanged(snapshot))
+}
+
+func TestRecordKeepsRevisionWhenIncomplete(t *testing.T) {
+	state := State{Revision: 4}
+
+	state.Record(source.Snapshot{Revision: 5}, []batch.Event{{Track: track("2"), Status: batch.StatusDone}}, false, time.Now())
+
+	assert.Equal(t, 4, state.Revision)
+	assert.Equal(t, map[string]string{"2": "done"}, state.Seen)
+	assert.False(t, state.Unchanged(source.Snapshot{Revision: 5}))
+}
+
+func TestUnchangedIgnoresSourcesWithoutRevision(t *testing.T) {
+	assert.False(t, State{}.Unchanged(source.Snapshot{}))
+}
+
+func TestStateRoundTripsAndResetsForAnotherLink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := LoadState(path, "link-a")
+	require.NoError(t, err)
+	assert.Equal(t, State{Link: "link-a"}, state)
+
+	state.Revision = 3
+	state.Seen = map[string]string{"1": batch.SkipUnavailable}
+	require.NoError(t, SaveState(path, state))
+
+	loaded, err := LoadState(path, "link-a")
+	require.NoError(t, err)
+	assert.Equal(t, 3, loaded.Revision)
+	assert.Equal(t, map[string]string{"1": batch.SkipUnavailable}, loaded.Seen)
+
+	other, err := LoadState(path, "link-b")
+	require.NoError(t, err)
+	assert.Equal(t, State{Link: "link-b"}, other)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err = LoadState(path, "link-a")
+	assert.Error(t, err)
+}
+
+func TestDefaultStatePathIsHiddenAndPerSource(t *testing.T) {
+	path := DefaultStatePath("out", &source.Ref{Kind: source.KindLegacyPlaylist, Username: "user", PlaylistID: "3"})
+
+	assert.Equal(t, filepath.Join("out", ".yamdl-watch-playlist-user-3.json"), path)
+}
@@ -0,0 +1,61 @@
+package sdk
+
+import (
+	"context"
+	"strings"
+
+	"ya-music/source"
+	"ya-music/utils"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+// Track is a Yandex Music track as returned by Resolve.
+type Track = model.Track
+
+// TranscodeProfile converts downloads with ffmpeg; see Options.Transcode.
+type TranscodeProfile = ya.TranscodeProfile
+
+// BuiltinTranscodeProfiles returns the profiles known to the yamdl command.
+func BuiltinTranscodeProfiles() []TranscodeProfile {
+	return ya.BuiltinTranscodeProfiles()
+}
+
+// Failure classes of download errors, matched with errors.Is on Event.Err.
+var (
+	ErrAlreadyExists        = ya.ErrTrackAlreadyExists
+	ErrAuthExpired          = ya.ErrAuthExpired
+	ErrSubscriptionRequired = ya.ErrSubscriptionRequired
+	ErrRegionBlocked        = ya.ErrRegionBlocked
+	ErrRateLimited          = ya.ErrRateLimited
+	ErrNotFound             = ya.ErrNotFound
+	ErrNetwork              = ya.ErrNetwork
+	ErrDiskFull             = ya.ErrDiskFull
+	ErrTagWrite             = ya.ErrTagWrite
+)
+
+// Client talks to the Yandex Music API on behalf of one account.
+type Client struct {
+	api *ya.Client
+}
+
+// NewClient returns a client authorized with token. An empty token sends
+// anonymous requests.
+func NewClient(token string) *Client {
+	api := ya.NewClient(utils.NewHttpClient())
+	if token != "" {
+		api.SetToken(token)
+	}
+	return &Client{api: api}
+}
+
+// Resolve returns the tracks of a track, album, playlist or chart link.
+func (c *Client) Resolve(ctx context.Context, link string) ([]Track, error) {
+	return source.ResolveContext(ctx, c.api, link)
+}
+
+// ValidLink reports whether link is a Yandex Music link Resolve accepts.
+func ValidLink(link string) bool {
+	_, err := source.Parse(strings.TrimSpace(link))
+	return err == nil
+}
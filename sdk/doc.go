@@ -0,0 +1,39 @@
+// Package sdk embeds the downloader in other Go programs.
+//
+// A Client resolves Yandex Music links into tracks. A Downloader downloads
+// tracks concurrently, names them with a Namer, optionally post-processes
+// them with a Tagger and hands the finished files to a Storage. Progress is
+// reported as a stream of Events:
+//
+//	client := sdk.NewClient(token)
+//	tracks, err := client.Resolve(ctx, "https://music.yandex.ru/album/123")
+//	if err != nil {
+//		return err
+//	}
+//	downloader := &sdk.Downloader{Client: client, Storage: sdk.DirStorage{Dir: "music"}}
+//	events, err := downloader.Download(ctx, tracks)
+//	if err != nil {
+//		return err
+//	}
+//	for event := range events {
+//		fmt.Println(event.Status, event.Track.DisplayLabel())
+//	}
+//
+// # Compatibility
+//
+// Within a major version of the module, exported identifiers of this
+// package are not removed or renamed and keep their meaning:
+//
+//   - Option and event structs may gain fields; zero values of new fields
+//     keep the previous behaviour. Use keyed struct literals.
+//   - Interfaces (Storage, Namer, Tagger) do not gain methods. New behaviour
+//     is added through optional interfaces checked at run time.
+//   - New Status values may be added; treat unknown ones like their
+//     Terminal result.
+//   - The error variables keep matching with errors.Is.
+//
+// Track and TranscodeProfile are aliases of the types in ya/model and ya and
+// share these guarantees for their existing fields. Other packages of the
+// module, including ya, source and utils, carry no such promise, and the
+// internal packages cannot be imported at all.
+package sdk
@@ -0,0 +1,274 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"ya-music/internal/batch"
+	"ya-music/ya"
+	"ya-music/ya/model"
+)
+
+// Format is the audio quality requested for downloads.
+type Format string
+
+const (
+	// FormatMP3 downloads the best MP3 bitrate. It is the default.
+	FormatMP3 Format = "mp3"
+	// FormatLossless downloads FLAC audio when the track has it and falls
+	// back to MP3 otherwise.
+	FormatLossless Format = "lossless"
+)
+
+// Options control how tracks are downloaded.
+type Options struct {
+	Format Format
+	// RemuxFLAC saves lossless audio delivered in MP4 as .flac files; by
+	// default it is stored as .m4a.
+	RemuxFLAC bool
+	// SkipCover leaves cover art out of the tags.
+	SkipCover bool
+	// ReplayGain writes ReplayGain track and album tags when loudness is
+	// known.
+	ReplayGain bool
+	// Transcode converts downloads with ffmpeg; only the converted file is
+	// stored and KeepOriginal is ignored.
+	Transcode *TranscodeProfile
+	// FFmpegPath overrides the ffmpeg found in PATH.
+	FFmpegPath string
+	// Concurrency is the number of tracks downloaded at once; zero means 3.
+	Concurrency int
+	// Progress enables StatusProgress events.
+	Progress bool
+}
+
+func (o Options) download() ya.DownloadOptions {
+	options := ya.DownloadOptions{
+		SkipCover:  o.SkipCover,
+		ReplayGain: o.ReplayGain,
+		FFmpegPath: o.FFmpegPath,
+	}
+	if o.Format == FormatLossless {
+		options.AudioFormat = ya.AudioFormatFLAC
+	}
+	if o.RemuxFLAC {
+		options.LosslessContainer = ya.LosslessContainerFLAC
+	}
+	if o.Transcode != nil {
+		profile := *o.Transcode
+		profile.KeepOriginal = false
+		options.Transcode = &profile
+	}
+	return options
+}
+
+// Status is the stage of a track in an Event.
+type Status string
+
+const (
+	StatusDownloading Status = "downloading"
+	// StatusProgress events report the bytes received so far; see
+	// Options.Progress.
+	StatusProgress Status = "progress"
+	StatusDone     Status = "done"
+	StatusSkipped  Status = "skipped"
+	StatusError    Status = "error"
+)
+
+// Event reports a change of one track. Every track ends with exactly one
+// terminal event.
+type Event struct {
+	// Index is the 1-based position of Track in the downloaded list.
+	Index  int
+	Track  Track
+	Status Status
+	// Name is the stored file of done events and the existing file of
+	// tracks skipped because of it.
+	Name string
+	// Format is the container of Name, such as "mp3", "flac" or "m4a".
+	Format string
+	// Reason explains skipped and error events.
+	Reason string
+	// Err is the failure of error events; see the Err variables.
+	Err error
+	// Bytes and TotalBytes are set on progress events. TotalBytes is -1
+	// when the size is unknown.
+	Bytes      int64
+	TotalBytes int64
+}
+
+// Terminal reports whether e is the final event of its track.
+func (e Event) Terminal() bool {
+	return e.Status != StatusDownloading && e.Status != StatusProgress
+}
+
+// Downloader downloads tracks into a Storage. Client and Storage are
+// required; the other fields are optional.
+type Downloader struct {
+	Client  *Client
+	Storage Storage
+	// Namer defaults to DefaultNamer.
+	Namer Namer
+	// Tagger runs on every downloaded file before it is stored.
+	Tagger  Tagger
+	Options Options
+	// StagingDir holds files while they are downloaded and tagged. Empty
+	// means the system temporary directory.
+	StagingDir string
+
+	fetcher trackFetcher
+}
+
+type trackFetcher interface {
+	DownloadTrackWithOptionsContext(context.Context, model.Track, string, ya.DownloadOptions) (string, error)
+}
+
+// Download starts downloading tracks and returns their events. The channel
+// is closed when every track has finished. Cancelling ctx aborts the
+// downloads in flight with error events; tracks that have not started yet
+// get no events.
+func (d *Downloader) Download(ctx context.Context, tracks []Track) (<-chan Event, error) {
+	fetcher := d.fetcher
+	if fetcher == nil {
+		if d.Client == nil {
+			return nil, errors.New("sdk: Downloader.Client is required")
+		}
+		fetcher = d.Client.api
+	}
+	if d.Storage == nil {
+		return nil, errors.New("sdk: Downloader.Storage is required")
+	}
+	if d.Options.Transcode != nil {
+		if err := d.Options.Transcode.Validate(); err != nil {
+			return nil, fmt.Errorf("sdk: %w", err)
+		}
+	}
+
+	namer := d.Namer
+	if namer == nil {
+		namer = DefaultNamer
+	}
+	batchEvents := batch.Run(batch.Config{
+		Client: storingFetcher{
+			fetcher: fetcher,
+			storage: d.Storage,
+			namer:   namer,
+			tagger:  d.Tagger,
+			staging: d.StagingDir,
+		},
+		Tracks:          tracks,
+		Options:         d.Options.download(),
+		Concurrency:     d.Options.Concurrency,
+		Context:         ctx,
+		DownloadContext: ctx,
+		Progress:        d.Options.Progress,
+	})
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		for event := range batchEvents {
+			events <- Event{
+				Index:      event.Index,
+				Track:      event.Track,
+				Status:     Status(event.Status),
+				Name:       event.Path,
+				Format:     string(event.Format),
+				Reason:     event.Reason,
+				Err:        event.Err,
+				Bytes:      event.Bytes,
+				TotalBytes: event.TotalBytes,
+			}
+		}
+	}()
+	return events, nil
+}
+
+// storingFetcher downloads each track into its own staging directory and
+// moves the result into storage. The returned name is the storage name.
+type storingFetcher struct {
+	fetcher trackFetcher
+	storage Storage
+	namer   Namer
+	tagger  Tagger
+	staging string
+}
+
+func (f storingFetcher) DownloadTrackWithOptionsContext(ctx context.Context, track model.Track, _ string, options ya.DownloadOptions) (string, error) {
+	base := path.Clean(strings.TrimSpace(f.namer.Name(track, options.FilenameSuffix)))
+	if base == "." || base == "/" {
+		return "", fmt.Errorf("namer returned an empty name for track %s", track.ID.String())
+	}
+
+	for _, extension := range candidateExtensions(options) {
+		if name, err := f.existing(ctx, base+extension); name != "" || err != nil {
+			return name, err
+		}
+	}
+
+	stagingDir, err := os.MkdirTemp(f.staging, ".yamdl-sdk-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	filename, err := f.fetcher.DownloadTrackWithOptionsContext(ctx, track, stagingDir, options)
+	if err != nil {
+		return "", err
+	}
+	if f.tagger != nil {
+		if err := f.tagger.Tag(ctx, filename, track); err != nil {
+			return "", fmt.Errorf("%w: %w", ya.ErrTagWrite, err)
+		}
+	}
+
+	name := base + strings.ToLower(filepath.Ext(filename))
+	if existing, err := f.existing(ctx, name); existing != "" || err != nil {
+		return existing, err
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to open downloaded file: %w", err)
+	}
+	defer file.Close()
+	if err := f.storage.Put(ctx, name, file); err != nil {
+		return "", fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	return name, nil
+}
+
+// existing returns name with ya.ErrTrackAlreadyExists when storage has it.
+func (f storingFetcher) existing(ctx context.Context, name string) (string, error) {
+	exists, err := f.storage.Exists(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect storage: %w", err)
+	}
+	if exists {
+		return name, fmt.Errorf("%w: %s", ya.ErrTrackAlreadyExists, name)
+	}
+	return "", nil
+}
+
+// candidateExtensions lists the extensions a download with options can be
+// stored with, so existing files are found before downloading.
+func candidateExtensions(options ya.DownloadOptions) []string {
+	var extensions []string
+	if options.Transcode != nil {
+		extensions = append(extensions, strings.ToLower(strings.TrimSpace(options.Transcode.Extension)))
+	}
+	switch {
+	case options.FormatOrDefault() == ya.AudioFormatMP3:
+		extensions = append(extensions, ".mp3")
+	case options.LosslessContainer == ya.LosslessContainerFLAC:
+		extensions = append(extensions, ".flac")
+	default:
+		extensions = append(extensions, ".flac", ".m4a")
+	}
+	return extensions
+}
@@ -0,0 +1,194 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"ya-music/ya"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeFetcher struct {
+	mu        sync.Mutex
+	extension string
+	err       error
+	fetched   []string
+	options   []ya.DownloadOptions
+}
+
+func (f *fakeFetcher) DownloadTrackWithOptionsContext(_ context.Context, track model.Track, outputDir string, options ya.DownloadOptions) (string, error) {
+	f.mu.Lock()
+	f.fetched = append(f.fetched, track.ID.String())
+	f.options = append(f.options, options)
+	f.mu.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	filename := filepath.Join(outputDir, ya.TrackFilenameKey(track)+f.extension)
+	return filename, os.WriteFile(filename, []byte("audio "+track.ID.String()), 0600)
+}
+
+type memoryStorage struct {
+	mu    sync.Mutex
+	files map[string]string
+}
+
+func (s *memoryStorage) Exists(_ context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.files[name]
+	return ok, nil
+}
+
+func (s *memoryStorage) Put(_ context.Context, name string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = string(data)
+	return nil
+}
+
+func collect(t *testing.T, downloader *Downloader, tracks []Track) []Event {
+	t.Helper()
+	events, err := downloader.Download(context.Background(), tracks)
+	require.NoError(t, err)
+	var collected []Event
+	for event := range events {
+		collected = append(collected, event)
+	}
+	return collected
+}
+
+func terminal(events []Event) map[int]Event {
+	byIndex := make(map[int]Event)
+	for _, event := range events {
+		if event.Terminal() {
+			byIndex[event.Index] = event
+		}
+	}
+	return byIndex
+}
+
+func TestDownloadStoresFilesUnderNamerNames(t *testing.T) {
+	storage := &memoryStorage{files: map[string]string{}}
+	fetcher := &fakeFetcher{extension: ".flac"}
+	tagged := make(chan string, 1)
+	downloader := &Downloader{
+		Storage: storage,
+		Namer: NamerFunc(func(track Track, _ string) string {
+			return "Artist/" + track.Title
+		}),
+		Tagger: TaggerFunc(func(_ context.Context, path string, track Track) error {
+			data, err := os.ReadFile(path)
+			tagged <- string(data)
+			return err
+		}),
+		Options:    Options{Format: FormatLossless, RemuxFLAC: true},
+		StagingDir: t.TempDir(),
+		fetcher:    fetcher,
+	}
+
+	events := collect(t, downloader, []Track{{ID: "1", Title: "Song", Available: true}})
+
+	done := terminal(events)[1]
+	assert.Equal(t, StatusDone, done.Status)
+	assert.Equal(t, "Artist/Song.flac", done.Name)
+	assert.Equal(t, "flac", done.Format)
+	assert.Equal(t, map[string]string{"Artist/Song.flac": "audio 1"}, storage.files)
+	assert.Equal(t, "audio 1", <-tagged)
+	require.Len(t, fetcher.options, 1)
+	assert.Equal(t, ya.AudioFormatFLAC, fetcher.options[0].AudioFormat)
+	assert.Equal(t, ya.LosslessContainerFLAC, fetcher.options[0].LosslessContainer)
+}
+
+func TestDownloadSkipsTracksAlreadyInStorage(t *testing.T) {
+	storage := &memoryStorage{files: map[string]string{"Artist - Old.m4a": "old"}}
+	fetcher := &fakeFetcher{extension: ".flac"}
+	downloader := &Downloader{
+		Storage:    storage,
+		Options:    Options{Format: FormatLossless},
+		StagingDir: t.TempDir(),
+		fetcher:    fetcher,
+	}
+
+	events := collect(t, downloader, []Track{
+		{ID: "1", Title: "Old", Artists: []model.Artist{{Name: "Artist"}}, Available: true},
+		{ID: "2", Title: "New", Artists: []model.Artist{{Name: "Artist"}}, Available: true},
+	})
+
+	byIndex := terminal(events)
+	assert.Equal(t, StatusSkipped, byIndex[1].Status)
+	assert.Equal(t, "Artist - Old.m4a", byIndex[1].Name)
+	assert.Equal(t, StatusDone, byIndex[2].Status)
+	assert.Equal(t, []string{"2"}, fetcher.fetched)
+	assert.Equal(t, "old", storage.files["Artist - Old.m4a"])
+}
+
+func TestDownloadReportsFetchAndTaggerFailures(t *testing.T) {
+	storage := &memoryStorage{files: map[string]string{}}
+	failing := &Downloader{
+		Storage:    storage,
+		StagingDir: t.TempDir(),
+		fetcher:    &fakeFetcher{err: ya.ErrSubscriptionRequired},
+	}
+	events := collect(t, failing, []Track{{ID: "1", Available: true}})
+	assert.ErrorIs(t, terminal(events)[1].Err, ErrSubscriptionRequired)
+
+	tagging := &Downloader{
+		Storage: storage,
+		Tagger: TaggerFunc(func(context.Context, string, Track) error {
+			return errors.New("bad frame")
+		}),
+		StagingDir: t.TempDir(),
+		fetcher:    &fakeFetcher{extension: ".mp3"},
+	}
+	events = collect(t, tagging, []Track{{ID: "2", Title: "Song", Available: true}})
+	failed := terminal(events)[1]
+	assert.Equal(t, StatusError, failed.Status)
+	assert.ErrorIs(t, failed.Err, ErrTagWrite)
+	assert.Empty(t, storage.files)
+}
+
+func TestDownloadRemovesStagingDirectories(t *testing.T) {
+	staging := t.TempDir()
+	downloader := &Downloader{
+		Storage:    &memoryStorage{files: map[string]string{}},
+		StagingDir: staging,
+		fetcher:    &fakeFetcher{extension: ".mp3"},
+	}
+
+	collect(t, downloader, []Track{{ID: "1", Title: "Song", Available: true}})
+
+	entries, err := os.ReadDir(staging)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestDownloadRequiresClientAndStorage(t *testing.T) {
+	_, err := (&Downloader{Storage: DirStorage{Dir: t.TempDir()}}).Download(context.Background(), nil)
+	assert.ErrorContains(t, err, "Client is required")
+
+	_, err = (&Downloader{Client: NewClient("")}).Download(context.Background(), nil)
+	assert.ErrorContains(t, err, "Storage is required")
+}
+
+func TestCandidateExtensionsFollowFormatAndTranscode(t *testing.T) {
+	assert.Equal(t, []string{".mp3"}, candidateExtensions(Options{}.download()))
+	assert.Equal(t, []string{".flac", ".m4a"}, candidateExtensions(Options{Format: FormatLossless}.download()))
+	assert.Equal(t, []string{".opus", ".flac"}, candidateExtensions(Options{
+		Format:    FormatLossless,
+		RemuxFLAC: true,
+		Transcode: &TranscodeProfile{Name: "opus", Extension: ".OPUS"},
+	}.download()))
+}
@@ -0,0 +1,53 @@
+package sdk_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"ya-music/sdk"
+)
+
+func ExampleDownloader() {
+	ctx := context.Background()
+	client := sdk.NewClient(os.Getenv("YANDEX_MUSIC_TOKEN"))
+
+	tracks, err := client.Resolve(ctx, "https://music.yandex.ru/album/3461493")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	downloader := &sdk.Downloader{
+		Client:  client,
+		Storage: sdk.DirStorage{Dir: "music"},
+		Options: sdk.Options{Format: sdk.FormatLossless, Concurrency: 4},
+	}
+	events, err := downloader.Download(ctx, tracks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for event := range events {
+		switch event.Status {
+		case sdk.StatusDone:
+			fmt.Println("saved", event.Name)
+		case sdk.StatusError:
+			fmt.Println("failed", event.Track.DisplayLabel(), event.Err)
+		}
+	}
+}
+
+func ExampleNamerFunc() {
+	// Store tracks as "Album/Artist - Title".
+	namer := sdk.NamerFunc(func(track sdk.Track, suffix string) string {
+		album := "Singles"
+		if len(track.Albums) > 0 {
+			album = track.Albums[0].Title
+		}
+		return path.Join(album, sdk.DefaultNamer.Name(track, suffix))
+	})
+
+	fmt.Println(namer.Name(sdk.Track{Title: "Song"}, ""))
+	// Output: Singles/Song
+}
@@ -0,0 +1,121 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"ya-music/ya"
+)
+
+// Storage keeps finished audio files. Names are slash-separated relative
+// paths that end with the file extension, such as "Artist - Title.flac".
+type Storage interface {
+	// Exists reports whether a file is already stored under name. Tracks
+	// whose file exists are skipped, never overwritten.
+	Exists(ctx context.Context, name string) (bool, error)
+	// Put stores the content of r under name. A failed Put must not leave a
+	// partial file under name.
+	Put(ctx context.Context, name string, r io.Reader) error
+}
+
+// DirStorage stores files below a local directory, creating subdirectories
+// as needed.
+type DirStorage struct {
+	Dir string
+}
+
+func (s DirStorage) path(name string) (string, error) {
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("storage name %q is outside the directory", name)
+	}
+	return filepath.Join(s.Dir, local), nil
+}
+
+func (s DirStorage) Exists(_ context.Context, name string) (bool, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put writes r to a temporary file next to the target and renames it into
+// place.
+func (s DirStorage) Put(_ context.Context, name string, r io.Reader) (err error) {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+".put-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	if _, err := io.Copy(file, r); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("failed to publish %s: %w", name, err)
+	}
+	return nil
+}
+
+// Namer chooses the stored name of a track without its extension. suffix
+// is non-empty when several tracks of one download share a display name;
+// the default appends it to keep their files apart.
+type Namer interface {
+	Name(track Track, suffix string) string
+}
+
+// NamerFunc adapts a function to Namer.
+type NamerFunc func(track Track, suffix string) string
+
+func (f NamerFunc) Name(track Track, suffix string) string {
+	return f(track, suffix)
+}
+
+// DefaultNamer names files "Artist - Title" like the yamdl command.
+var DefaultNamer Namer = NamerFunc(func(track Track, suffix string) string {
+	name := ya.TrackFilenameKey(track)
+	if suffix != "" {
+		name += " " + suffix
+	}
+	return name
+})
+
+// Tagger post-processes a downloaded file before it is stored, for example
+// to add custom tags. The built-in tags, cover art and ReplayGain values are
+// already written when it runs.
+type Tagger interface {
+	Tag(ctx context.Context, path string, track Track) error
+}
+
+// TaggerFunc adapts a function to Tagger.
+type TaggerFunc func(ctx context.Context, path string, track Track) error
+
+func (f TaggerFunc) Tag(ctx context.Context, path string, track Track) error {
+	return f(ctx, path, track)
+}
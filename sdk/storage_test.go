@@ -0,0 +1,66 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirStoragePutCreatesDirectoriesAndReportsExistence(t *testing.T) {
+	dir := t.TempDir()
+	storage := DirStorage{Dir: dir}
+	ctx := context.Background()
+
+	exists, err := storage.Exists(ctx, "Artist/Song.mp3")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	require.NoError(t, storage.Put(ctx, "Artist/Song.mp3", strings.NewReader("audio")))
+
+	data, err := os.ReadFile(filepath.Join(dir, "Artist", "Song.mp3"))
+	require.NoError(t, err)
+	assert.Equal(t, "audio", string(data))
+	exists, err = storage.Exists(ctx, "Artist/Song.mp3")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestDirStorageRejectsNamesOutsideTheDirectory(t *testing.T) {
+	storage := DirStorage{Dir: t.TempDir()}
+
+	assert.Error(t, storage.Put(context.Background(), "../escape.mp3", strings.NewReader("audio")))
+	_, err := storage.Exists(context.Background(), "/etc/passwd")
+	assert.Error(t, err)
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestDirStoragePutLeavesNoFileWhenReadFails(t *testing.T) {
+	dir := t.TempDir()
+
+	err := DirStorage{Dir: dir}.Put(context.Background(), "Song.mp3", failingReader{})
+
+	require.Error(t, err)
+	entries, readErr := os.ReadDir(dir)
+	require.NoError(t, readErr)
+	assert.Empty(t, entries)
+}
+
+func TestDefaultNamerMatchesCommandFilenames(t *testing.T) {
+	track := Track{ID: "7", Title: "Song", Artists: []model.Artist{{Name: "Artist"}}}
+
+	assert.Equal(t, "Artist - Song", DefaultNamer.Name(track, ""))
+	assert.Equal(t, "Artist - Song [7]", DefaultNamer.Name(track, "[7]"))
+}
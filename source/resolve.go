@@ -1,7 +1,9 @@
 package source
 
 import (
+	"context"
 	"fmt"
+	"slices"
 	"strings"
 
 	"ya-music/ya/model"
@@ -15,6 +17,15 @@ type Client interface {
 	Chart(region string) (*model.Playlist, error)
 }
 
+// ContextClient is a Client whose lookups take a context, such as *ya.Client.
+type ContextClient interface {
+	TrackInfoContext(ctx context.Context, id string) (*model.Track, error)
+	AlbumWithTracksContext(ctx context.Context, id string) (*model.Album, error)
+	UsersPlaylistContext(ctx context.Context, id string, username string) (*model.Playlist, error)
+	PlaylistByUUIDContext(ctx context.Context, id string) (*model.Playlist, error)
+	ChartContext(ctx context.Context, region string) (*model.Playlist, error)
+}
+
 func Resolve(client Client, input string) ([]model.Track, error) {
 	ref, err := Parse(strings.TrimSpace(input))
 	if err != nil {
@@ -23,36 +34,40 @@ func Resolve(client Client, input string) ([]model.Track, error) {
 	return ResolveRef(client, ref)
 }
 
+// ResolveContext resolves input like Resolve, stopping its requests when ctx
+// is done.
+func ResolveContext(ctx context.Context, client ContextClient, input string) ([]model.Track, error) {
+	return Resolve(boundClient{ctx: ctx, client: client}, input)
+}
+
 func ResolveRef(client Client, ref *Ref) ([]model.Track, error) {
 	return resolveRef(client, ref)
 }
 
-func resolvePlaylist(load func() (*model.Playlist, error)) ([]model.Track, error) {
-	playlist, err := load()
-	if err != nil {
-		return nil, err
-	}
-	return playlist.TracksList(), nil
+// Snapshot is a resolved source together with the playlist version it was
+// read at. Revision and Snapshot stay zero for tracks and albums.
+type Snapshot struct {
+	Tracks   []model.Track
+	Revision int
+	Snapshot int
 }
 
-func resolveRef(client Client, ref *Ref) ([]model.Track, error) {
+// ResolveSnapshot resolves ref like ResolveRef and also reports the playlist
+// revision so callers can detect unchanged playlists.
+func ResolveSnapshot(client Client, ref *Ref) (Snapshot, error) {
 	switch ref.Kind {
 	case KindTrack:
 		track, err := client.TrackInfo(ref.TrackID)
 		if err != nil {
-			return nil, err
+			return Snapshot{}, err
 		}
-		return []model.Track{*track}, nil
+		return Snapshot{Tracks: []model.Track{*track}}, nil
 	case KindAlbum:
 		album, err := client.AlbumWithTracks(ref.AlbumID)
 		if err != nil {
-			return nil, err
+			return Snapshot{}, err
 		}
-		var tracks []model.Track
-		for _, volume := range album.Volumes {
-			tracks = append(tracks, volume...)
-		}
-		return tracks, nil
+		return Snapshot{Tracks: albumTracks(album)}, nil
 	case KindLegacyPlaylist:
 		return resolvePlaylist(func() (*model.Playlist, error) {
 			return client.UsersPlaylist(ref.PlaylistID, ref.Username)
@@ -66,6 +81,94 @@ func resolveRef(client Client, ref *Ref) ([]model.Track, error) {
 			return client.Chart(ref.Region)
 		})
 	default:
-		return nil, fmt.Errorf("unsupported URL type")
+		return Snapshot{}, fmt.Errorf("unsupported URL type")
+	}
+}
+
+// ResolveSnapshotContext resolves ref like ResolveSnapshot, stopping its
+// requests when ctx is done.
+func ResolveSnapshotContext(ctx context.Context, client ContextClient, ref *Ref) (Snapshot, error) {
+	return ResolveSnapshot(boundClient{ctx: ctx, client: client}, ref)
+}
+
+func resolvePlaylist(load func() (*model.Playlist, error)) (Snapshot, error) {
+	playlist, err := load()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{
+		Tracks:   playlist.TracksList(),
+		Revision: playlist.Revision,
+		Snapshot: playlist.Snapshot,
+	}, nil
+}
+
+func resolveRef(client Client, ref *Ref) ([]model.Track, error) {
+	snapshot, err := ResolveSnapshot(client, ref)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.Tracks, nil
+}
+
+// boundClient adapts a ContextClient to Client with a fixed context.
+type boundClient struct {
+	ctx    context.Context
+	client ContextClient
+}
+
+func (b boundClient) TrackInfo(id string) (*model.Track, error) {
+	return b.client.TrackInfoContext(b.ctx, id)
+}
+
+func (b boundClient) AlbumWithTracks(id string) (*model.Album, error) {
+	return b.client.AlbumWithTracksContext(b.ctx, id)
+}
+
+func (b boundClient) UsersPlaylist(id string, username string) (*model.Playlist, error) {
+	return b.client.UsersPlaylistContext(b.ctx, id, username)
+}
+
+func (b boundClient) PlaylistByUUID(id string) (*model.Playlist, error) {
+	return b.client.PlaylistByUUIDContext(b.ctx, id)
+}
+
+func (b boundClient) Chart(region string) (*model.Playlist, error) {
+	return b.client.ChartContext(b.ctx, region)
+}
+
+// albumTracks flattens the volumes of album. Podcast episodes are sorted by
+// publication date, oldest first; episodes without a date go last.
+func albumTracks(album *model.Album) []model.Track {
+	var tracks []model.Track
+	for _, volume := range album.Volumes {
+		tracks = append(tracks, volume...)
+	}
+	if !album.IsPodcast() && !album.IsAudiobook() {
+		return tracks
+	}
+	// Episode naming and tagging read the album type from the track.
+	for i := range tracks {
+		if len(tracks[i].Albums) > 0 && tracks[i].Albums[0].Type == "" && tracks[i].Albums[0].MetaType == "" {
+			tracks[i].Albums[0].Type = album.Type
+			tracks[i].Albums[0].MetaType = album.MetaType
+		}
+	}
+	if album.IsPodcast() {
+		slices.SortStableFunc(tracks, func(a, b model.Track) int {
+			aTime, aOK := a.Published()
+			bTime, bOK := b.Published()
+			switch {
+			case aOK && bOK:
+				return aTime.Compare(bTime)
+			case aOK:
+				return -1
+			case bOK:
+				return 1
+			default:
+				return 0
+			}
+		})
 	}
+	return tracks
 }
@@ -1,6 +1,7 @@
 package source
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -61,6 +62,33 @@ func TestResolveAlbumFlattensVolumes(t *testing.T) {
 	assert.Equal(t, "2", tracks[1].ID.String())
 }
 
+func TestResolvePodcastSortsEpisodesChronologically(t *testing.T) {
+	episode := func(id, pubDate string) model.Track {
+		return model.Track{ID: model.FlexibleID(id), PubDate: pubDate, Albums: []model.Album{{ID: "123"}}}
+	}
+	client := fakeSourceClient{
+		album: &model.Album{
+			ID:   "123",
+			Type: model.AlbumTypePodcast,
+			Volumes: [][]model.Track{{
+				episode("3", "2024-03-01T06:00:00+03:00"),
+				episode("x", ""),
+				episode("1", "2024-01-01T06:00:00+03:00"),
+				episode("2", "2024-02-01T06:00:00+03:00"),
+			}},
+		},
+	}
+
+	tracks, err := Resolve(client, "https://music.yandex.ru/album/123")
+	require.NoError(t, err)
+	var ids []string
+	for _, track := range tracks {
+		ids = append(ids, track.ID.String())
+		assert.True(t, track.IsPodcastEpisode())
+	}
+	assert.Equal(t, []string{"1", "2", "3", "x"}, ids)
+}
+
 func TestResolveLegacyPlaylistExtractsTracks(t *testing.T) {
 	client := fakeSourceClient{
 		legacyPlaylist: &model.Playlist{
@@ -108,24 +136,28 @@ func TestResolveChartExtractsTracks(t *testing.T) {
 }
 
 func TestResolvePlaylistLoadsTracks(t *testing.T) {
-	tracks, err := resolvePlaylist(func() (*model.Playlist, error) {
+	snapshot, err := resolvePlaylist(func() (*model.Playlist, error) {
 		return &model.Playlist{
+			Revision: 7,
+			Snapshot: 3,
 			Tracks: []model.TrackShort{
 				{Track: model.Track{ID: model.FlexibleID("40"), Title: "Loaded"}},
 			},
 		}, nil
 	})
 	require.NoError(t, err)
-	require.Len(t, tracks, 1)
-	assert.Equal(t, "40", tracks[0].ID.String())
+	require.Len(t, snapshot.Tracks, 1)
+	assert.Equal(t, "40", snapshot.Tracks[0].ID.String())
+	assert.Equal(t, 7, snapshot.Revision)
+	assert.Equal(t, 3, snapshot.Snapshot)
 }
 
 func TestResolvePlaylistPropagatesLoadError(t *testing.T) {
 	wantErr := errors.New("load failed")
-	tracks, err := resolvePlaylist(func() (*model.Playlist, error) {
+	snapshot, err := resolvePlaylist(func() (*model.Playlist, error) {
 		return nil, wantErr
 	})
-	assert.Nil(t, tracks)
+	assert.Nil(t, snapshot.Tracks)
 	assert.ErrorIs(t, err, wantErr)
 }
 
@@ -158,3 +190,70 @@ func TestResolvePropagatesClientErrors(t *testing.T) {
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "access denied")
 }
+
+func TestResolveSnapshotReportsRevisionOnlyForPlaylists(t *testing.T) {
+	client := fakeSourceClient{
+		album: &model.Album{Volumes: [][]model.Track{{{ID: model.FlexibleID("1")}}}},
+		legacyPlaylist: &model.Playlist{
+			Revision: 12,
+			Snapshot: 4,
+			Tracks:   []model.TrackShort{{Track: model.Track{ID: model.FlexibleID("2")}}},
+		},
+	}
+
+	album, err := ResolveSnapshot(client, &Ref{Kind: KindAlbum, AlbumID: "1"})
+	require.NoError(t, err)
+	assert.Len(t, album.Tracks, 1)
+	assert.Zero(t, album.Revision)
+
+	playlist, err := ResolveSnapshot(client, &Ref{Kind: KindLegacyPlaylist, PlaylistID: "9", Username: "user"})
+	require.NoError(t, err)
+	assert.Len(t, playlist.Tracks, 1)
+	assert.Equal(t, 12, playlist.Revision)
+	assert.Equal(t, 4, playlist.Snapshot)
+}
+
+type contextSourceClient struct {
+	fakeSourceClient
+	gotCtx context.Context
+}
+
+func (f *contextSourceClient) TrackInfoContext(ctx context.Context, id string) (*model.Track, error) {
+	f.gotCtx = ctx
+	return f.TrackInfo(id)
+}
+
+func (f *contextSourceClient) AlbumWithTracksContext(ctx context.Context, id string) (*model.Album, error) {
+	f.gotCtx = ctx
+	return f.AlbumWithTracks(id)
+}
+
+func (f *contextSourceClient) UsersPlaylistContext(ctx context.Context, id string, username string) (*model.Playlist, error) {
+	f.gotCtx = ctx
+	return f.UsersPlaylist(id, username)
+}
+
+func (f *contextSourceClient) PlaylistByUUIDContext(ctx context.Context, id string) (*model.Playlist, error) {
+	f.gotCtx = ctx
+	return f.PlaylistByUUID(id)
+}
+
+func (f *contextSourceClient) ChartContext(ctx context.Context, region string) (*model.Playlist, error) {
+	f.gotCtx = ctx
+	return f.Chart(region)
+}
+
+func TestResolveContextPassesContextToClient(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+	client := &contextSourceClient{fakeSourceClient: fakeSourceClient{
+		track: &model.Track{ID: model.FlexibleID("7"), Title: "Song"},
+	}}
+
+	tracks, err := ResolveContext(ctx, client, "https://music.yandex.ru/album/1/track/7")
+
+	require.NoError(t, err)
+	require.Len(t, tracks, 1)
+	assert.Equal(t, "7", tracks[0].ID.String())
+	assert.Equal(t, "request", client.gotCtx.Value(key{}))
+}
@@ -37,6 +37,24 @@ type Ref struct {
 	Region       string
 }
 
+// Key returns a stable, filename-safe identifier for the referenced source.
+func (r *Ref) Key() string {
+	switch r.Kind {
+	case KindTrack:
+		return "track-" + r.TrackID
+	case KindAlbum:
+		return "album-" + r.AlbumID
+	case KindLegacyPlaylist:
+		return "playlist-" + r.Username + "-" + r.PlaylistID
+	case KindPlaylistUUID:
+		return "playlist-" + r.PlaylistUUID
+	case KindChart:
+		return "chart-" + r.Region
+	default:
+		return "unknown"
+	}
+}
+
 func Parse(input string) (*Ref, error) {
 	ref := parseRef(input)
 	if ref == nil {
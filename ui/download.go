@@ -1,10 +1,15 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
+	"ya-music/internal/history"
+	"ya-music/internal/retry"
 	"ya-music/utils"
 	"ya-music/ya"
 	"ya-music/ya/model"
@@ -22,7 +27,7 @@ import (
 
 // Global constants.
 const (
-	outputDir                = "./downloads" // Root directory for downloads.
+	defaultOutputDir         = "./downloads" // Root directory for downloads.
 	maxConcurrentDownloads   = 3             // Maximum number of concurrent downloads.
 	defaultTrackListHeight   = 18
 	minTrackListHeight       = 6
@@ -59,6 +64,7 @@ const (
 	viewFormatFLAC
 	viewBackButton
 	viewDownloadButton
+	viewRetryButton
 	viewQuitButton
 )
 
@@ -66,6 +72,7 @@ var actionFocusOrder = []focusable{
 	viewFormatMP3,
 	viewFormatFLAC,
 	viewDownloadButton,
+	viewRetryButton,
 	viewBackButton,
 	viewQuitButton,
 }
@@ -119,6 +126,10 @@ var downloadKeys = downloadKeyMap{
 		key.WithKeys("D"),
 		key.WithHelp("D", "download all"),
 	),
+	Retry: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "retry failed"),
+	),
 	Back: key.NewBinding(
 		key.WithKeys("b"),
 		key.WithHelp("b", "back"),
@@ -146,6 +157,7 @@ type downloadKeyMap struct {
 	FormatMP3  key.Binding
 	FormatFLAC key.Binding
 	Download   key.Binding
+	Retry      key.Binding
 	Back       key.Binding
 	Quit       key.Binding
 	Help       key.Binding
@@ -165,6 +177,17 @@ type DownloadModel struct {
 	// External dependencies.
 	client          *ya.Client
 	downloadOptions ya.DownloadOptions
+	history         *history.Store
+	// outputDir receives the downloads; an account may change it.
+	outputDir string
+	// retryPath is the retry list updated after each session.
+	retryPath string
+	// warning describes what the account cannot download.
+	warning string
+
+	// Source link of the current tracks and their earlier downloads by track ID.
+	source   string
+	previous map[string]history.Record
 
 	// UI components.
 	spinner   spinner.Model
@@ -182,10 +205,16 @@ type DownloadModel struct {
 	downloadableCount     int
 	sessionCompletedCount int
 	errorCount            int
+	// sessionBytes is the audio size of the sessionSizedCount tracks
+	// downloaded in this session, used to estimate the time left.
+	sessionBytes      int64
+	sessionSizedCount int
 
 	// UI state.
 	isDownloading     bool
 	shutdownRequested bool
+	// cancelSession stops the running download session.
+	cancelSession     context.CancelFunc
 	quitAfterCancel   bool
 	focusedView       focusable
 	lastActionFocus   focusable
@@ -227,6 +256,8 @@ func NewDownloadModel(client *ya.Client, options ...ya.DownloadOptions) Download
 	return DownloadModel{
 		client:            client,
 		downloadOptions:   downloadOptionsOrDefault(options),
+		outputDir:         defaultOutputDir,
+		retryPath:         retry.DefaultPath(defaultOutputDir),
 		spinner:           sp,
 		progress:          p,
 		trackList:         l,
@@ -253,6 +284,12 @@ func newDownloadHelp() help.Model {
 	return h
 }
 
+// setOutputDir downloads to dir and keeps the retry list there.
+func (m *DownloadModel) setOutputDir(dir string) {
+	m.outputDir = dir
+	m.retryPath = retry.DefaultPath(dir)
+}
+
 func downloadOptionsOrDefault(options []ya.DownloadOptions) ya.DownloadOptions {
 	if len(options) == 0 {
 		return ya.DownloadOptions{}
@@ -267,6 +304,8 @@ func (m DownloadModel) Init() tea.Cmd {
 func (m *DownloadModel) Reset() {
 	m.tracksProgress = nil
 	m.sessionEvents = nil
+	m.source = ""
+	m.previous = nil
 	m.tracksTotalCount = 0
 	m.downloadedCount = 0
 	m.downloadableCount = 0
@@ -303,6 +342,7 @@ func (m *DownloadModel) AddTracks(tracks []model.Track) {
 
 	findDuplicates(m.tracksProgress)
 	sortTracksByTitle(m.tracksProgress)
+	m.loadPreviousDownloads()
 
 	m.updateTrackList()
 	m.tracksTotalCount = len(m.tracksProgress)
@@ -313,6 +353,34 @@ func (m *DownloadModel) AddTracks(tracks []model.Track) {
 	}
 }
 
+// loadPreviousDownloads reads the history so tracks downloaded in earlier runs
+// can be marked. A broken history only loses the hints.
+func (m *DownloadModel) loadPreviousDownloads() {
+	if m.history == nil {
+		return
+	}
+	var ids []string
+	for _, tp := range m.tracksProgress {
+		if tp.track != nil {
+			ids = append(ids, tp.track.ID.String())
+		}
+	}
+	previous, err := m.history.Downloaded(ids)
+	if err != nil {
+		downloadLogger(m.client).Error("history unavailable", "stage", "history", "error", err)
+		return
+	}
+	m.previous = previous
+}
+
+func (m *DownloadModel) previousDownload(tp *TrackProgress) (history.Record, bool) {
+	if tp.status != TrackStatusReady || tp.track == nil {
+		return history.Record{}, false
+	}
+	record, ok := m.previous[tp.track.ID.String()]
+	return record, ok
+}
+
 func (m *DownloadModel) Update(msg tea.Msg) (DownloadModel, tea.Cmd) {
 	var cmds []tea.Cmd
 	var cmd tea.Cmd
@@ -329,6 +397,10 @@ func (m *DownloadModel) Update(msg tea.Msg) (DownloadModel, tea.Cmd) {
 			m.focusedView = viewDownloadButton
 			m.resizeToWindow()
 			return m.activateFocusedControl()
+		case key.Matches(keyMsg, downloadKeys.Retry) && m.controlEnabled(viewRetryButton):
+			m.focusedView = viewRetryButton
+			m.resizeToWindow()
+			return m.activateFocusedControl()
 		case key.Matches(keyMsg, downloadKeys.Back):
 			m.focusedView = viewBackButton
 			m.resizeToWindow()
@@ -365,6 +437,10 @@ func (m *DownloadModel) Update(msg tea.Msg) (DownloadModel, tea.Cmd) {
 			m.focusedView = viewDownloadButton
 			*m, cmd = m.activateFocusedControl()
 
+		case key.Matches(msg, downloadKeys.Retry) && m.focusedView != viewList && m.controlEnabled(viewRetryButton):
+			m.focusedView = viewRetryButton
+			*m, cmd = m.activateFocusedControl()
+
 		case key.Matches(msg, downloadKeys.Back) && m.focusedView != viewList && !m.isDownloading:
 			m.focusedView = viewBackButton
 			*m, cmd = m.activateFocusedControl()
@@ -427,6 +503,10 @@ func (m *DownloadModel) Update(msg tea.Msg) (DownloadModel, tea.Cmd) {
 			if msg.completed {
 				m.downloadedCount++
 				m.sessionCompletedCount++
+				if msg.progress.status == TrackStatusDownloaded && msg.progress.received > 0 {
+					m.sessionBytes += msg.progress.received
+					m.sessionSizedCount++
+				}
 			}
 			m.errorCount = countStatus(m.tracksProgress, TrackStatusError)
 			m.updateTrackList()
@@ -435,14 +515,16 @@ func (m *DownloadModel) Update(msg tea.Msg) (DownloadModel, tea.Cmd) {
 
 	case DownloadEndMsg:
 		m.isDownloading = false
+		if m.cancelSession != nil {
+			m.cancelSession()
+			m.cancelSession = nil
+		}
 		if m.shutdownRequested {
 			m.normalizeCanceledTracks()
 			m.shutdownRequested = false
-			if m.client != nil {
-				m.client.ResetCancel()
-			}
 		}
 		m.sessionEvents = nil
+		m.updateRetryList()
 		m.resizeToWindow()
 		if m.quitAfterCancel {
 			m.quitAfterCancel = false
@@ -516,7 +598,14 @@ func (m DownloadModel) fixedDownloadHeight() int {
 }
 
 func (m DownloadModel) headerBlock() string {
-	header := renderHeader(m.downloadedCount, m.tracksTotalCount, m.downloadableCount, m.errorCount)
+	var extra []string
+	if rate, eta, ok := m.throughput(); ok && m.isDownloading {
+		extra = renderThroughput(rate, eta)
+	}
+	header := renderHeader(m.downloadedCount, m.tracksTotalCount, m.downloadableCount, m.errorCount, extra...)
+	if m.warning != "" {
+		header += "\n" + redForeground.Render("Warning: "+m.warning)
+	}
 	return marginLeftStyle.Render(header) + "\n" + marginLeftStyle.Render(m.selectedTrackInfo)
 }
 
@@ -555,18 +644,23 @@ func (m *DownloadModel) cycleFocus() {
 	m.focusNext()
 }
 
-func (m DownloadModel) startDownloadSession() tea.Cmd {
-	progress := make([]TrackProgress, 0, len(m.tracksProgress))
-	for _, item := range m.tracksProgress {
+func (m *DownloadModel) startDownloadSession(items []*TrackProgress) tea.Cmd {
+	progress := make([]TrackProgress, 0, len(items))
+	for _, item := range items {
 		progress = append(progress, *item)
 	}
 	client := m.client
 	logger := downloadLogger(client)
 	options := m.downloadOptions
+	store, source, outputDir := m.history, m.source, m.outputDir
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancelSession = cancel
 
 	return func() tea.Msg {
 		session := NewDownloadSession(client, logger, options, outputDir)
-		return downloadSessionStartedMsg{events: session.Run(progress)}
+		session.history = store
+		session.source = source
+		return downloadSessionStartedMsg{events: session.Run(ctx, progress)}
 	}
 }
 
@@ -587,50 +681,160 @@ func (m *DownloadModel) resetState() {
 		}
 		tp.status = TrackStatusReady
 		tp.format = ""
+		tp.clearBytes()
 	}
 
 	m.downloadedCount = completedTrackCount(m.tracksProgress)
 	m.errorCount = countStatus(m.tracksProgress, TrackStatusError)
 	m.downloadableCount = countStatus(m.tracksProgress, TrackStatusReady)
 	m.sessionCompletedCount = 0
+	m.sessionBytes = 0
+	m.sessionSizedCount = 0
 	m.tracksTotalCount = len(m.tracksProgress)
 
 	m.updateTrackList()
 }
 
+// requeueFailed marks failed tracks ready again and returns them so only they
+// are downloaded.
+func (m *DownloadModel) requeueFailed() []*TrackProgress {
+	var failed []*TrackProgress
+	for _, tp := range m.tracksProgress {
+		if tp.status != TrackStatusError {
+			continue
+		}
+		tp.status = TrackStatusReady
+		tp.errMsg = ""
+		tp.err = nil
+		tp.stage = ""
+		tp.filename = ""
+		tp.format = ""
+		tp.clearBytes()
+		failed = append(failed, tp)
+	}
+
+	m.downloadedCount = completedTrackCount(m.tracksProgress)
+	m.errorCount = 0
+	m.downloadableCount = len(failed)
+	m.sessionCompletedCount = 0
+	m.sessionBytes = 0
+	m.sessionSizedCount = 0
+	m.updateTrackList()
+	return failed
+}
+
+// updateRetryList records failed tracks in the retry list and clears tracks
+// that are on disk now. Failures are only logged.
+func (m *DownloadModel) updateRetryList() {
+	if m.retryPath == "" {
+		return
+	}
+	list, err := retry.Load(m.retryPath)
+	if err != nil {
+		downloadLogger(m.client).Error("retry list unavailable", "stage", "retry", "error", err)
+		return
+	}
+	now := time.Now()
+	failed := false
+	for _, tp := range m.tracksProgress {
+		if tp.track == nil {
+			continue
+		}
+		switch tp.status {
+		case TrackStatusError:
+			failed = true
+			list.Fail(retry.Entry{
+				TrackID:  tp.track.ID.String(),
+				Title:    tp.track.DisplayLabel(),
+				Source:   m.source,
+				Stage:    tp.stage,
+				Error:    tp.errMsg,
+				FailedAt: now,
+			})
+		case TrackStatusDownloaded, TrackStatusAlreadyExists:
+			list.Clear(tp.track.ID.String())
+		}
+	}
+	if failed {
+		list.Options = retry.Options{
+			Format:            string(m.downloadOptions.FormatOrDefault()),
+			LosslessContainer: string(m.downloadOptions.LosslessContainer),
+			SkipCover:         m.downloadOptions.SkipCover,
+			ReplayGain:        m.downloadOptions.ReplayGain,
+		}
+		if m.downloadOptions.Transcode != nil {
+			list.Options.Transcode = m.downloadOptions.Transcode.Name
+		}
+	}
+	if err := retry.Save(m.retryPath, list); err != nil {
+		downloadLogger(m.client).Error("retry list write failed", "stage", "retry", "error", err)
+	}
+}
+
 func (m *DownloadModel) updateTrackList() {
 	items := make([]list.Item, 0, len(m.tracksProgress))
 	for _, tp := range m.tracksProgress {
 		if m.hideDuplicates && tp.status == TrackStatusDuplicate {
 			continue
 		}
+		_, downloadedBefore := m.previousDownload(tp)
 		items = append(items, TrackListItem{
-			uid:    tp.uid,
-			track:  tp.track,
-			status: tp.status,
-			format: tp.format,
+			uid:              tp.uid,
+			track:            tp.track,
+			status:           tp.status,
+			format:           tp.format,
+			errKind:          ya.ErrorKind(tp.err),
+			downloadedBefore: downloadedBefore,
+			received:         tp.received,
+			size:             tp.size,
 		})
 	}
 	m.trackList.SetItems(items)
 }
 
+// trackInfoLimit is the longest track info line, in bytes.
+const trackInfoLimit = 70
+
+// withErrorHint appends hint to the error message, shortening the message
+// rather than the hint when the line gets too long.
+func withErrorHint(errMsg, hint string) string {
+	if errMsg == "" {
+		return strings.ToUpper(hint[:1]) + hint[1:]
+	}
+	suffix := " (" + hint + ")"
+	if room := trackInfoLimit - 3 - len(suffix); len(errMsg)+len(suffix) > trackInfoLimit && room > 0 {
+		errMsg = strings.TrimSpace(errMsg[:room]) + "..."
+	}
+	return errMsg + suffix
+}
+
 func (m *DownloadModel) getTrackInfo(uid string) string {
 	var info string
 	for _, tp := range m.tracksProgress {
 		if tp.uid == uid {
 			info = fmt.Sprintf("%s - %s", tp.track.FullTitle(), tp.track.ArtistsString())
+			if record, ok := m.previousDownload(tp); ok {
+				info = fmt.Sprintf("Downloaded before (%s, %s): %s",
+					record.Time.Local().Format(time.DateOnly),
+					strings.ToUpper(record.Format),
+					record.Path,
+				)
+			}
 			if tp.filename != "" {
 				info = fmt.Sprintf("Downloaded: %s", tp.filename)
 			}
 			if tp.errMsg != "" {
 				info = tp.errMsg
 			}
+			if hint := ya.ErrorHint(tp.err); hint != "" {
+				info = withErrorHint(info, hint)
+			}
 			break
 		}
 	}
 
-	if len(info) > 70 {
-		info = info[:67] + "..."
+	if len(info) > trackInfoLimit {
+		info = info[:trackInfoLimit-3] + "..."
 	}
 	return strings.TrimSpace(info)
 }
@@ -644,13 +848,56 @@ func (m DownloadModel) sessionProgress() float64 {
 		return 0
 	}
 
-	percent := float64(m.sessionCompletedCount) / float64(m.downloadableCount)
+	completed := float64(m.sessionCompletedCount)
+	for _, tp := range m.tracksProgress {
+		if tp.status == TrackStatusDownloading && tp.size > 0 {
+			completed += min(float64(tp.received)/float64(tp.size), 1)
+		}
+	}
+	percent := completed / float64(m.downloadableCount)
 	if percent > 1 {
 		return 1
 	}
 	return percent
 }
 
+// throughput returns the combined speed of the downloading tracks in bytes
+// per second and the estimated time left, or ok false when nothing is
+// downloading. eta is negative when it cannot be estimated yet.
+func (m DownloadModel) throughput() (rate float64, eta time.Duration, ok bool) {
+	var remaining int64
+	active := 0
+	known := true
+	for _, tp := range m.tracksProgress {
+		if tp.status != TrackStatusDownloading {
+			continue
+		}
+		active++
+		rate += tp.rate
+		if tp.size < 0 || tp.received == 0 {
+			known = false
+			continue
+		}
+		remaining += tp.size - tp.received
+	}
+	if rate <= 0 {
+		return 0, 0, false
+	}
+
+	queued := m.downloadableCount - m.sessionCompletedCount - active
+	if queued > 0 {
+		if m.sessionSizedCount == 0 {
+			known = false
+		} else {
+			remaining += int64(queued) * (m.sessionBytes / int64(m.sessionSizedCount))
+		}
+	}
+	if !known {
+		return rate, -1, true
+	}
+	return rate, time.Duration(float64(remaining) / rate * float64(time.Second)), true
+}
+
 func countStatus(tracks []*TrackProgress, status TrackStatus) int {
 	count := 0
 	for _, tp := range tracks {
@@ -666,13 +913,31 @@ func completedTrackCount(tracks []*TrackProgress) int {
 		countStatus(tracks, TrackStatusAlreadyExists)
 }
 
-func renderHeader(completed, total, downloadable, errors int) string {
-	return strings.Join([]string{
+func renderHeader(completed, total, downloadable, errors int, extra ...string) string {
+	return strings.Join(append([]string{
 		renderCounter("Total tracks", total),
 		renderCounter("To download", downloadable),
 		renderCounter("Completed", completed),
 		renderCounter("Errors", errors),
-	}, "  ") + "\n"
+	}, extra...), "  ") + "\n"
+}
+
+// renderThroughput renders the speed and time left of a running download.
+func renderThroughput(rate float64, eta time.Duration) []string {
+	parts := []string{dimGrayForeground.Render("Speed:") + " " + formatRate(rate)}
+	if eta >= 0 {
+		parts = append(parts, dimGrayForeground.Render("ETA:")+" "+formatETA(eta))
+	}
+	return parts
+}
+
+func formatRate(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.1f MB/s", bytesPerSecond/(1<<20))
+}
+
+func formatETA(eta time.Duration) string {
+	seconds := int(eta.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
 }
 
 func renderCounter(label string, value int) string {
@@ -705,8 +970,18 @@ func (m *DownloadModel) activateFocusedControl() (DownloadModel, tea.Cmd) {
 		m.focusedView = viewList
 		m.resizeToWindow()
 
-		utils.CreateDirIfNotExists(outputDir)
-		return *m, m.startDownloadSession()
+		utils.CreateDirIfNotExists(m.outputDir)
+		return *m, m.startDownloadSession(m.tracksProgress)
+
+	case viewRetryButton:
+		if !m.controlEnabled(viewRetryButton) {
+			return *m, nil
+		}
+		failed := m.requeueFailed()
+		m.isDownloading = true
+		m.focusedView = viewList
+		m.resizeToWindow()
+		return *m, m.startDownloadSession(failed)
 
 	case viewQuitButton:
 		return m.quitOrCancel("quit_button")
@@ -844,7 +1119,7 @@ func verticalTargetsBelow(control focusable) []focusable {
 	switch control {
 	case viewFormatMP3, viewFormatFLAC:
 		return []focusable{viewDownloadButton, viewBackButton, viewQuitButton}
-	case viewDownloadButton, viewBackButton:
+	case viewDownloadButton, viewRetryButton, viewBackButton:
 		return []focusable{viewQuitButton}
 	default:
 		return nil
@@ -853,7 +1128,7 @@ func verticalTargetsBelow(control focusable) []focusable {
 
 func verticalTargetsAbove(control focusable) []focusable {
 	switch control {
-	case viewDownloadButton:
+	case viewDownloadButton, viewRetryButton:
 		return []focusable{viewFormatMP3, viewFormatFLAC}
 	case viewBackButton, viewQuitButton:
 		return []focusable{viewFormatFLAC, viewFormatMP3}
@@ -884,6 +1159,8 @@ func (m DownloadModel) controlEnabled(control focusable) bool {
 	switch control {
 	case viewFormatMP3, viewFormatFLAC, viewBackButton, viewDownloadButton:
 		return !m.isDownloading
+	case viewRetryButton:
+		return !m.isDownloading && m.errorCount > 0
 	case viewQuitButton:
 		return true
 	default:
@@ -905,6 +1182,7 @@ func renderActionBar(m DownloadModel) string {
 	actionRow := lipgloss.JoinHorizontal(lipgloss.Center,
 		renderCommandLabel("ACTIONS"),
 		renderActionControl(m, viewDownloadButton, "Download all", "D"),
+		renderActionControl(m, viewRetryButton, "Retry failed", "R"),
 		renderActionControl(m, viewBackButton, "Back", "b"),
 		renderActionControl(m, viewQuitButton, quitControlLabel(m), "q"),
 	)
@@ -1028,6 +1306,8 @@ func (m DownloadModel) downloadHelpKeyMap() downloadHelpKeyMap {
 	formatFLAC.SetEnabled(!m.isDownloading)
 	download := downloadKeys.Download
 	download.SetEnabled(!m.isDownloading)
+	retryFailed := downloadKeys.Retry
+	retryFailed.SetEnabled(m.controlEnabled(viewRetryButton))
 	back := downloadKeys.Back
 	back.SetEnabled(!m.isDownloading)
 	activate := downloadKeys.Activate
@@ -1077,6 +1357,7 @@ func (m DownloadModel) downloadHelpKeyMap() downloadHelpKeyMap {
 			},
 			{
 				download,
+				retryFailed,
 				back,
 				downloadKeys.Quit,
 				downloadKeys.Help,
@@ -1171,8 +1452,8 @@ func (m *DownloadModel) requestShutdown(reason string, quitAfterCancel bool) {
 		"is_downloading", m.isDownloading,
 	)
 
-	if m.client != nil {
-		m.client.Cancel()
+	if m.cancelSession != nil {
+		m.cancelSession()
 	}
 }
 
@@ -1182,9 +1463,10 @@ func (m *DownloadModel) normalizeCanceledTracks() {
 			continue
 		}
 
-		if tp.status == TrackStatusDownloading || isCanceledError(tp.errMsg) {
+		if tp.status == TrackStatusDownloading || errors.Is(tp.err, context.Canceled) {
 			tp.status = TrackStatusReady
 			tp.errMsg = ""
+			tp.err = nil
 			tp.filename = ""
 			tp.format = ""
 		}
@@ -1197,14 +1479,3 @@ func (m *DownloadModel) normalizeCanceledTracks() {
 	m.tracksTotalCount = len(m.tracksProgress)
 	m.updateTrackList()
 }
-
-func isCanceledError(errMsg string) bool {
-	errMsg = strings.ToLower(strings.TrimSpace(errMsg))
-	if errMsg == "" {
-		return false
-	}
-
-	return strings.Contains(errMsg, "context canceled") ||
-		strings.Contains(errMsg, "operation was canceled") ||
-		strings.Contains(errMsg, "request canceled")
-}
@@ -1,11 +1,14 @@
 package ui
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"runtime/debug"
 	"sync"
+	"time"
+	"ya-music/internal/history"
 	"ya-music/utils"
 	"ya-music/ya"
 	"ya-music/ya/model"
@@ -13,18 +16,39 @@ import (
 
 // TrackProgress represents the download progress and state of a track.
 type TrackProgress struct {
-	uid      string
-	track    *model.Track
-	status   TrackStatus
-	errMsg   string
+	uid    string
+	track  *model.Track
+	status TrackStatus
+	errMsg string
+	// err is the failure of errored tracks; ya.Classify tells its class.
+	err error
+	// stage is the download stage that failed, as recorded in retry lists.
+	stage    string
 	filename string
 	format   string
+	// received and size are the audio bytes of a downloading track; size is
+	// -1 when unknown. rate is the average speed in bytes per second.
+	received int64
+	size     int64
+	rate     float64
 }
 
+func (tp *TrackProgress) clearBytes() {
+	tp.received = 0
+	tp.size = 0
+	tp.rate = 0
+}
+
+// byteProgressInterval is the minimum time between two byte progress events
+// of a track.
+const byteProgressInterval = 250 * time.Millisecond
+
 type downloadTrackClient interface {
-	DownloadTrackWithOptions(model.Track, string, ya.DownloadOptions) (string, error)
+	DownloadTrackWithOptionsContext(context.Context, model.Track, string, ya.DownloadOptions) (string, error)
 }
 
+// DownloadSessionEvent reports a track snapshot. Events of a downloading
+// track that are not Completed carry its received bytes and rate.
 type DownloadSessionEvent struct {
 	Progress  TrackProgress
 	Completed bool
@@ -36,6 +60,9 @@ type DownloadSession struct {
 	options     ya.DownloadOptions
 	outputDir   string
 	concurrency int
+	// history records finished tracks of source when set.
+	history *history.Store
+	source  string
 }
 
 func NewDownloadSession(
@@ -57,7 +84,9 @@ func NewDownloadSession(
 	}
 }
 
-func (s *DownloadSession) Run(progress []TrackProgress) <-chan DownloadSessionEvent {
+// Run downloads the ready tracks of progress. Cancelling ctx stops the
+// downloads of this session only.
+func (s *DownloadSession) Run(ctx context.Context, progress []TrackProgress) <-chan DownloadSessionEvent {
 	events := make(chan DownloadSessionEvent)
 	work := append([]TrackProgress(nil), progress...)
 
@@ -69,6 +98,11 @@ func (s *DownloadSession) Run(progress []TrackProgress) <-chan DownloadSessionEv
 			"format", s.options.FormatOrDefault(),
 		)
 
+		var albumLoudness map[string]model.R128
+		if s.options.ReplayGain {
+			albumLoudness = albumLoudnessForProgress(work)
+		}
+
 		var wg sync.WaitGroup
 		sem := make(chan struct{}, s.concurrency)
 		for _, item := range work {
@@ -80,36 +114,60 @@ func (s *DownloadSession) Run(progress []TrackProgress) <-chan DownloadSessionEv
 				continue
 			}
 
+			options := s.options
+			if albumLoudness != nil {
+				options.AlbumLoudness = ya.AlbumLoudnessFor(albumLoudness, *item.track)
+			}
+
 			item := item
 			wg.Add(1)
-			go s.runTrack(item, &wg, sem, events)
+			go s.runTrack(ctx, item, options, &wg, sem, events)
 		}
 
 		wg.Wait()
+		if err := s.history.Close(); err != nil {
+			s.logger.Error("history close failed", "stage", "history", "error", err)
+		}
 		s.logger.Info("download session finished")
 	}()
 
 	return events
 }
 
+func albumLoudnessForProgress(progress []TrackProgress) map[string]model.R128 {
+	tracks := make([]model.Track, 0, len(progress))
+	for _, item := range progress {
+		if item.track != nil {
+			tracks = append(tracks, *item.track)
+		}
+	}
+	return ya.AlbumLoudness(tracks)
+}
+
 func (s *DownloadSession) runTrack(
+	ctx context.Context,
 	item TrackProgress,
+	options ya.DownloadOptions,
 	wg *sync.WaitGroup,
 	sem chan struct{},
 	events chan<- DownloadSessionEvent,
 ) {
 	defer wg.Done()
 	trackCtx := utils.NewTrackLogContext(*item.track)
+	var started time.Time
 
 	defer func() {
 		if r := recover(); r != nil {
 			item.status = TrackStatusError
 			item.errMsg = fmt.Sprintf("panic: %v", r)
+			item.err = errors.New(item.errMsg)
+			item.stage = "download_track"
 			s.logger.LogTrack(slog.LevelError, trackCtx, "panic recovered",
 				"stage", "download_track",
 				"error", fmt.Sprintf("%v", r),
 				"stack", string(debug.Stack()),
 			)
+			s.recordHistory(item, started)
 			events <- DownloadSessionEvent{Progress: item, Completed: true}
 		}
 	}()
@@ -118,15 +176,19 @@ func (s *DownloadSession) runTrack(
 	defer func() { <-sem }()
 
 	item.status = TrackStatusDownloading
+	started = time.Now()
 	s.logger.LogTrack(slog.LevelInfo, trackCtx, "worker started",
 		"stage", "download_track",
 	)
 	events <- DownloadSessionEvent{Progress: item}
+	options.Progress = reportBytes(&item, events)
 
-	filePath, err := s.client.DownloadTrackWithOptions(*item.track, s.outputDir, s.options)
+	filePath, err := s.client.DownloadTrackWithOptionsContext(ctx, *item.track, s.outputDir, options)
 	if err != nil {
 		item.status = TrackStatusError
 		item.errMsg = err.Error()
+		item.err = err
+		item.stage = ya.FailureStage(err)
 		item.filename = filePath
 
 		if errors.Is(err, ya.ErrTrackAlreadyExists) {
@@ -138,6 +200,7 @@ func (s *DownloadSession) runTrack(
 				"filename", filePath,
 				"reason", "already_exists",
 			)
+			s.recordHistory(item, started)
 			events <- DownloadSessionEvent{Progress: item, Completed: true}
 			return
 		}
@@ -153,6 +216,8 @@ func (s *DownloadSession) runTrack(
 		item.filename = filePath
 		item.format = downloadFormatFromFilename(filePath)
 		item.errMsg = ""
+		item.err = nil
+		item.stage = ""
 
 		s.logger.LogTrack(slog.LevelInfo, trackCtx, "worker finished",
 			"stage", "download_track",
@@ -161,5 +226,61 @@ func (s *DownloadSession) runTrack(
 		)
 	}
 
+	s.recordHistory(item, started)
 	events <- DownloadSessionEvent{Progress: item, Completed: true}
 }
+
+// reportBytes sends snapshots of item as its audio downloads, at most one per
+// byteProgressInterval apart from the last one.
+func reportBytes(item *TrackProgress, events chan<- DownloadSessionEvent) utils.ProgressFunc {
+	var first, last time.Time
+	return func(received, size int64) {
+		now := time.Now()
+		if first.IsZero() || received == 0 {
+			first = now
+		}
+		if received != size && now.Sub(last) < byteProgressInterval {
+			return
+		}
+		last = now
+		item.received = received
+		item.size = size
+		if elapsed := now.Sub(first).Seconds(); elapsed > 0 {
+			item.rate = float64(received) / elapsed
+		}
+		events <- DownloadSessionEvent{Progress: *item}
+	}
+}
+
+// recordHistory appends the finished track to the history. Failures are only
+// logged so the download result is still shown.
+func (s *DownloadSession) recordHistory(item TrackProgress, started time.Time) {
+	if s.history == nil {
+		return
+	}
+	status := history.StatusDone
+	switch item.status {
+	case TrackStatusAlreadyExists:
+		status = history.StatusSkipped
+	case TrackStatusError:
+		status = history.StatusError
+	}
+	now := time.Now()
+	record := history.NewRecord(*item.track, status, item.filename, now)
+	record.Source = s.source
+	switch status {
+	case history.StatusSkipped:
+		record.Reason = "already exists"
+	case history.StatusError:
+		record.Error = item.errMsg
+	}
+	if !started.IsZero() {
+		record.DurationMs = now.Sub(started).Milliseconds()
+	}
+	if err := s.history.Append(record); err != nil {
+		s.logger.LogTrack(slog.LevelError, utils.NewTrackLogContext(*item.track), "history write failed",
+			"stage", "history",
+			"error", err,
+		)
+	}
+}
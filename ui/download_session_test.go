@@ -3,9 +3,12 @@ package ui
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"path/filepath"
 	"testing"
 	"time"
+	"ya-music/internal/history"
 	"ya-music/utils"
 	"ya-music/ya"
 	"ya-music/ya/model"
@@ -19,7 +22,8 @@ type fakeDownloadClient struct {
 	err      error
 }
 
-func (f *fakeDownloadClient) DownloadTrackWithOptions(
+func (f *fakeDownloadClient) DownloadTrackWithOptionsContext(
+	context.Context,
 	model.Track,
 	string,
 	ya.DownloadOptions,
@@ -39,7 +43,7 @@ func TestDownloadSessionEmitsSnapshotsWithoutMutatingInput(t *testing.T) {
 	)
 
 	var events []DownloadSessionEvent
-	for event := range session.Run(input) {
+	for event := range session.Run(context.Background(), input) {
 		events = append(events, event)
 	}
 
@@ -59,7 +63,7 @@ func TestDownloadSessionTurnsClientErrorIntoCompletedErrorEvent(t *testing.T) {
 	)
 
 	var final DownloadSessionEvent
-	for event := range session.Run([]TrackProgress{{
+	for event := range session.Run(context.Background(), []TrackProgress{{
 		uid: "track-1", track: &model.Track{ID: model.FlexibleID("1"), Title: "Song"}, status: TrackStatusReady,
 	}}) {
 		if event.Completed {
@@ -71,13 +75,47 @@ func TestDownloadSessionTurnsClientErrorIntoCompletedErrorEvent(t *testing.T) {
 	assert.Contains(t, final.Progress.errMsg, "context canceled")
 }
 
+type progressDownloadClient struct{}
+
+func (progressDownloadClient) DownloadTrackWithOptionsContext(
+	_ context.Context,
+	_ model.Track,
+	_ string,
+	options ya.DownloadOptions,
+) (string, error) {
+	options.Progress(0, 10)
+	options.Progress(5, 10)
+	options.Progress(10, 10)
+	return "song.flac", nil
+}
+
+func TestDownloadSessionReportsReceivedBytes(t *testing.T) {
+	session := NewDownloadSession(progressDownloadClient{}, utils.NewDiscardDownloadLogger(), ya.DownloadOptions{}, t.TempDir())
+
+	var events []DownloadSessionEvent
+	for event := range session.Run(context.Background(), []TrackProgress{{
+		uid: "track-1", track: &model.Track{ID: model.FlexibleID("1"), Title: "Song"}, status: TrackStatusReady,
+	}}) {
+		events = append(events, event)
+	}
+
+	require.Len(t, events, 4)
+	assert.Equal(t, int64(0), events[1].Progress.received)
+	assert.Equal(t, int64(10), events[2].Progress.received)
+	assert.Equal(t, int64(10), events[2].Progress.size)
+	assert.False(t, events[2].Completed)
+	assert.Equal(t, TrackStatusDownloaded, events[3].Progress.status)
+	assert.Equal(t, int64(10), events[3].Progress.received)
+}
+
 type blockingDownloadClient struct {
 	started chan struct{}
 	release chan struct{}
 	path    string
 }
 
-func (c *blockingDownloadClient) DownloadTrackWithOptions(
+func (c *blockingDownloadClient) DownloadTrackWithOptionsContext(
+	context.Context,
 	model.Track,
 	string,
 	ya.DownloadOptions,
@@ -92,7 +130,7 @@ func TestDownloadSessionClosesOnlyAfterWorkersFinish(t *testing.T) {
 	release := make(chan struct{})
 	client := &blockingDownloadClient{started: started, release: release, path: "song.mp3"}
 	session := NewDownloadSession(client, utils.NewDiscardDownloadLogger(), ya.DownloadOptions{}, t.TempDir())
-	events := session.Run([]TrackProgress{{
+	events := session.Run(context.Background(), []TrackProgress{{
 		uid: "track-1", track: &model.Track{ID: model.FlexibleID("1"), Title: "Song"}, status: TrackStatusReady,
 	}})
 
@@ -122,6 +160,44 @@ func TestDownloadSessionClosesOnlyAfterWorkersFinish(t *testing.T) {
 	}
 }
 
+type contextDownloadClient struct {
+	started chan struct{}
+}
+
+func (c *contextDownloadClient) DownloadTrackWithOptionsContext(
+	ctx context.Context,
+	_ model.Track,
+	_ string,
+	_ ya.DownloadOptions,
+) (string, error) {
+	close(c.started)
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestDownloadSessionStopsWhenItsContextIsCancelled(t *testing.T) {
+	client := &contextDownloadClient{started: make(chan struct{})}
+	session := NewDownloadSession(client, utils.NewDiscardDownloadLogger(), ya.DownloadOptions{}, t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := session.Run(ctx, []TrackProgress{{
+		uid: "track-1", track: &model.Track{ID: model.FlexibleID("1"), Title: "Song"}, status: TrackStatusReady,
+	}})
+
+	<-events // Downloading
+	<-client.started
+	cancel()
+	var final DownloadSessionEvent
+	for event := range events {
+		if event.Completed {
+			final = event
+		}
+	}
+
+	assert.Equal(t, TrackStatusError, final.Progress.status)
+	assert.ErrorIs(t, final.Progress.err, context.Canceled)
+}
+
 func TestDownloadSessionLogsSkippedTracks(t *testing.T) {
 	var logs bytes.Buffer
 	session := NewDownloadSession(
@@ -131,7 +207,7 @@ func TestDownloadSessionLogsSkippedTracks(t *testing.T) {
 		t.TempDir(),
 	)
 
-	for range session.Run([]TrackProgress{
+	for range session.Run(context.Background(), []TrackProgress{
 		{uid: "duplicate", track: &model.Track{ID: model.FlexibleID("1"), Title: "Duplicate"}, status: TrackStatusDuplicate},
 		{uid: "unavailable", track: &model.Track{ID: model.FlexibleID("2"), Title: "Unavailable"}, status: TrackStatusNotAvailable},
 	}) {
@@ -144,7 +220,8 @@ func TestDownloadSessionLogsSkippedTracks(t *testing.T) {
 
 type panicDownloadClient struct{}
 
-func (panicDownloadClient) DownloadTrackWithOptions(
+func (panicDownloadClient) DownloadTrackWithOptionsContext(
+	context.Context,
 	model.Track,
 	string,
 	ya.DownloadOptions,
@@ -161,7 +238,7 @@ func TestDownloadSessionConvertsWorkerPanicToCompletedErrorEvent(t *testing.T) {
 	)
 
 	var events []DownloadSessionEvent
-	for event := range session.Run([]TrackProgress{{
+	for event := range session.Run(context.Background(), []TrackProgress{{
 		uid: "track-1", track: &model.Track{ID: model.FlexibleID("1"), Title: "Song"}, status: TrackStatusReady,
 	}}) {
 		events = append(events, event)
@@ -172,3 +249,28 @@ func TestDownloadSessionConvertsWorkerPanicToCompletedErrorEvent(t *testing.T) {
 	assert.True(t, events[1].Completed)
 	assert.Contains(t, events[1].Progress.errMsg, "download failure")
 }
+
+func TestDownloadSessionRecordsHistory(t *testing.T) {
+	store := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	session := NewDownloadSession(
+		&fakeDownloadClient{err: errors.New("boom")},
+		utils.NewDownloadLoggerForWriter(io.Discard),
+		ya.DownloadOptions{},
+		t.TempDir(),
+	)
+	session.history = store
+	session.source = "https://music.yandex.ru/album/1"
+
+	for range session.Run(context.Background(), []TrackProgress{{
+		uid: "track-1", track: &model.Track{ID: model.FlexibleID("1"), Title: "Song"}, status: TrackStatusReady,
+	}}) {
+	}
+
+	records, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "1", records[0].TrackID)
+	assert.Equal(t, history.StatusError, records[0].Status)
+	assert.Equal(t, "boom", records[0].Error)
+	assert.Equal(t, "https://music.yandex.ru/album/1", records[0].Source)
+}
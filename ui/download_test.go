@@ -2,9 +2,15 @@ package ui
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"ya-music/internal/history"
+	"ya-music/internal/retry"
 	"ya-music/utils"
 	"ya-music/ya"
 	"ya-music/ya/model"
@@ -15,6 +21,7 @@ import (
 	"github.com/charmbracelet/x/ansi"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func keyText(text string) tea.KeyPressMsg {
@@ -556,6 +563,45 @@ func TestResetState(t *testing.T) {
 	assert.Equal(t, 0, m.sessionCompletedCount)
 }
 
+func TestSessionProgressCountsPartialDownloads(t *testing.T) {
+	m := NewDownloadModel(nil)
+	m.tracksProgress = []*TrackProgress{
+		{uid: "a", status: TrackStatusReady},
+		{uid: "b", status: TrackStatusReady},
+	}
+	m.resetState()
+
+	updated, _ := m.Update(DownloadProgressUpdateMsg{
+		progress: TrackProgress{uid: "a", status: TrackStatusDownloading, received: 50, size: 100, rate: 10},
+	})
+
+	assert.InDelta(t, 0.25, updated.sessionProgress(), 0.0001)
+	rate, eta, ok := updated.throughput()
+	assert.True(t, ok)
+	assert.InDelta(t, 10.0, rate, 0.0001)
+	assert.Equal(t, time.Duration(-1), eta, "queued track size is unknown")
+
+	updated, _ = updated.Update(DownloadProgressUpdateMsg{
+		progress:  TrackProgress{uid: "a", status: TrackStatusDownloaded, received: 100, size: 100},
+		completed: true,
+	})
+	updated, _ = updated.Update(DownloadProgressUpdateMsg{
+		progress: TrackProgress{uid: "b", status: TrackStatusDownloading, received: 20, size: 100, rate: 20},
+	})
+
+	_, eta, ok = updated.throughput()
+	assert.True(t, ok)
+	assert.Equal(t, 4*time.Second, eta)
+}
+
+func TestRenderThroughput(t *testing.T) {
+	header := renderHeader(0, 1, 1, 0, renderThroughput(3<<20, 75*time.Second)...)
+
+	assert.Contains(t, header, "3.0 MB/s")
+	assert.Contains(t, header, "1:15")
+	assert.NotContains(t, strings.Join(renderThroughput(1<<20, -1), " "), "ETA")
+}
+
 func TestSessionProgressExcludesPriorDownloads(t *testing.T) {
 	m := NewDownloadModel(nil)
 	for i := 0; i < 5; i++ {
@@ -616,7 +662,7 @@ func TestStartDownloadSessionRequeuesCompletedTracksAfterReset(t *testing.T) {
 	}
 
 	eventCount := 0
-	for event := range session.Run(progress) {
+	for event := range session.Run(context.Background(), progress) {
 		eventCount++
 		updated, _ := m.Update(DownloadProgressUpdateMsg{
 			progress:  event.Progress,
@@ -658,7 +704,7 @@ func TestResetStateRequeuesAllDownloadedTracksForNewSession(t *testing.T) {
 	}
 
 	eventCount := 0
-	for range session.Run(progress) {
+	for range session.Run(context.Background(), progress) {
 		eventCount++
 	}
 
@@ -845,8 +891,8 @@ func TestDownloadSessionLogsSkippedReasons(t *testing.T) {
 		},
 	}
 
-	session := NewDownloadSession(client, logger, ya.DownloadOptions{}, outputDir)
-	for range session.Run(progressList) {
+	session := NewDownloadSession(client, logger, ya.DownloadOptions{}, defaultOutputDir)
+	for range session.Run(context.Background(), progressList) {
 	}
 
 	assert.Contains(t, logs.String(), "download session started")
@@ -901,7 +947,7 @@ func TestDownloadEndRestoresCanceledTracksToReady(t *testing.T) {
 	m.tracksProgress = []*TrackProgress{
 		{status: TrackStatusDownloaded, filename: "done.mp3"},
 		{status: TrackStatusAlreadyExists, filename: "exists.mp3"},
-		{status: TrackStatusError, errMsg: "context canceled"},
+		{status: TrackStatusError, errMsg: "context canceled", err: fmt.Errorf("failed to send request: %w", context.Canceled)},
 		{status: TrackStatusDownloading},
 	}
 
@@ -932,3 +978,102 @@ func TestDownloadEndQuitsAfterShutdownRequest(t *testing.T) {
 		assert.IsType(t, tea.QuitMsg{}, cmd())
 	}
 }
+
+func TestAddTracksMarksPreviouslyDownloadedTracks(t *testing.T) {
+	store := history.Open(filepath.Join(t.TempDir(), "history.db"))
+	require.NoError(t, store.Append(history.Record{
+		Time:    time.Date(2026, 10, 1, 12, 0, 0, 0, time.Local),
+		TrackID: "1",
+		Status:  history.StatusDone,
+		Format:  "flac",
+		Path:    "downloads/A.flac",
+	}))
+	m := NewDownloadModel(nil)
+	m.history = store
+
+	m.AddTracks([]model.Track{
+		{ID: model.FlexibleID("1"), Title: "A", Available: true},
+		{ID: model.FlexibleID("2"), Title: "B", Available: true},
+	})
+
+	items := m.trackList.Items()
+	require.Len(t, items, 2)
+	assert.Equal(t, "Ready (before)", items[0].(TrackListItem).statusLabel())
+	assert.Equal(t, "Ready", items[1].(TrackListItem).statusLabel())
+	assert.Equal(t, "Downloaded before (2026-10-01, FLAC): downloads/A.flac", m.getTrackInfo(items[0].(TrackListItem).uid))
+}
+
+func TestRetryFailedRequeuesOnlyFailedTracks(t *testing.T) {
+	m := NewDownloadModel(nil)
+	m.tracksProgress = []*TrackProgress{
+		{uid: "done", track: &model.Track{ID: model.FlexibleID("1")}, status: TrackStatusDownloaded, filename: "a.mp3"},
+		{uid: "failed", track: &model.Track{ID: model.FlexibleID("2")}, status: TrackStatusError, errMsg: "boom", stage: "download_link"},
+	}
+	m.errorCount = 1
+	assert.True(t, m.controlEnabled(viewRetryButton))
+
+	updated, cmd := m.Update(keyText("R"))
+
+	assert.NotNil(t, cmd)
+	assert.True(t, updated.isDownloading)
+	assert.False(t, updated.controlEnabled(viewRetryButton))
+	assert.Equal(t, TrackStatusDownloaded, updated.tracksProgress[0].status)
+	assert.Equal(t, TrackStatusReady, updated.tracksProgress[1].status)
+	assert.Empty(t, updated.tracksProgress[1].errMsg)
+	assert.Equal(t, 1, updated.downloadableCount)
+	assert.Equal(t, 1, updated.downloadedCount)
+	assert.Equal(t, 0, updated.errorCount)
+
+	idle := NewDownloadModel(nil)
+	_, cmd = idle.Update(keyText("R"))
+	assert.Nil(t, cmd)
+}
+
+func TestDownloadEndUpdatesRetryList(t *testing.T) {
+	m := NewDownloadModel(nil)
+	m.retryPath = retry.DefaultPath(t.TempDir())
+	m.source = "https://music.yandex.ru/album/1"
+	m.downloadOptions.AudioFormat = ya.AudioFormatFLAC
+	m.isDownloading = true
+	m.tracksProgress = []*TrackProgress{
+		{uid: "done", track: &model.Track{ID: model.FlexibleID("1")}, status: TrackStatusDownloaded},
+		{uid: "failed", track: &model.Track{ID: model.FlexibleID("2"), Title: "B"}, status: TrackStatusError, errMsg: "boom", stage: "download_link"},
+	}
+
+	m, _ = m.Update(DownloadEndMsg{})
+
+	list, err := retry.Load(m.retryPath)
+	require.NoError(t, err)
+	require.Len(t, list.Entries, 1)
+	assert.Equal(t, "2", list.Entries[0].TrackID)
+	assert.Equal(t, "download_link", list.Entries[0].Stage)
+	assert.Equal(t, m.source, list.Entries[0].Source)
+	assert.Equal(t, "flac", list.Options.Format)
+
+	m.tracksProgress[1].status = TrackStatusDownloaded
+	m, _ = m.Update(DownloadEndMsg{})
+
+	list, err = retry.Load(m.retryPath)
+	require.NoError(t, err)
+	assert.Empty(t, list.Entries)
+}
+
+func TestFailedTrackShowsErrorClassAndHint(t *testing.T) {
+	m := NewDownloadModel(nil)
+	m.tracksProgress = []*TrackProgress{{
+		uid:    "failed",
+		track:  &model.Track{ID: model.FlexibleID("1"), Title: "A"},
+		status: TrackStatusError,
+		errMsg: "write a.flac: no space left on device",
+		err:    &ya.StageError{Stage: "download_file", Kind: ya.ErrDiskFull, Err: errors.New("no space left on device")},
+	}}
+
+	m.updateTrackList()
+
+	require.Len(t, m.trackList.Items(), 1)
+	assert.Equal(t, "Disk full", m.trackList.Items()[0].(TrackListItem).statusLabel())
+	assert.Equal(t, "write a.flac: no... (free up space in the output directory and retry)", m.getTrackInfo("failed"))
+
+	m.tracksProgress[0].errMsg = "disk full"
+	assert.Equal(t, "disk full (free up space in the output directory and retry)", m.getTrackInfo("failed"))
+}
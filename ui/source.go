@@ -15,6 +15,8 @@ import (
 type (
 	SourceSubmitMsg struct {
 		Tracks []model.Track
+		// Link is the URL the tracks were resolved from.
+		Link string
 	}
 
 	URLHandleErrorMsg string
@@ -26,6 +28,9 @@ type SourceModel struct {
 	errorMsg     string
 	spinner      spinner.Model
 	isProcessing bool
+	link         string
+	// warning describes what the account cannot download.
+	warning string
 }
 
 func NewSourceModel(client *ya.Client) SourceModel {
@@ -106,6 +111,7 @@ func (m SourceModel) handleEnterKey() (SourceModel, tea.Cmd) {
 		return m, nil
 	}
 	m.isProcessing = true
+	m.link = input
 	m.urlInput.Blur()
 	return m, tea.Batch(
 		func() tea.Msg { return *ref },
@@ -114,12 +120,13 @@ func (m SourceModel) handleEnterKey() (SourceModel, tea.Cmd) {
 }
 
 func (m *SourceModel) handleURL(ref *source.Ref) tea.Cmd {
+	link := m.link
 	return func() tea.Msg {
 		tracks, err := source.ResolveRef(m.client, ref)
 		if err != nil {
 			return URLHandleErrorMsg(err.Error())
 		}
-		return SourceSubmitMsg{Tracks: tracks}
+		return SourceSubmitMsg{Tracks: tracks, Link: link}
 	}
 }
 
@@ -129,6 +136,9 @@ func (m SourceModel) View() tea.View {
 
 func (m SourceModel) render() string {
 	s := "What do you want to download?\n\n"
+	if m.warning != "" {
+		s += redForeground.Render("Warning: "+m.warning) + "\n\n"
+	}
 	s += dimGrayForeground.Render("Examples of URL:")
 	s += dimGrayForeground.Render("\n- Track: https://music.yandex.ru/album/1231231/track/12312345")
 	s += dimGrayForeground.Render("\n- Album: https://music.yandex.ru/album/1231231")
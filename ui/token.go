@@ -2,8 +2,10 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 	"ya-music/utils"
 	"ya-music/ya"
+	"ya-music/ya/model"
 
 	"charm.land/bubbles/v2/spinner"
 	"charm.land/bubbles/v2/textinput"
@@ -20,16 +22,32 @@ type TokenModel struct {
 	confirmSave     bool            // Flag to confirm token saving
 	tokenFromFile   bool            // Flag indicating token was read from file
 	displayInput    bool            // Flag to display the input field
+
+	accounts        *utils.TokenStore // Named accounts; nil uses token.txt only
+	accountName     string            // Account whose token is checked or entered
+	choosingAccount bool              // Flag to display the account picker
+	accountCursor   int               // Picker row; the last row enters another token
+	status          *model.Status     // Account status of the last valid token
 }
 
 type (
-	TokenCorrectMsg      string
-	TokenIncorrectMsg    string
-	TokenOkMsg           struct{}
+	TokenCorrectMsg   string
+	TokenIncorrectMsg string
+	// TokenOkMsg ends the token screen. OutputDir is set when the chosen
+	// account has its own download directory; Warning when the account
+	// cannot download full tracks or lossless.
+	TokenOkMsg struct {
+		OutputDir string
+		Warning   string
+	}
 	TokenReadFromFileMsg struct {
 		Token string
 		Err   error
 	}
+	tokenCheckedMsg struct {
+		token  string
+		status *model.Status
+	}
 )
 
 func NewTokenModel(client *ya.Client) TokenModel {
@@ -51,11 +69,44 @@ func NewTokenModel(client *ya.Client) TokenModel {
 	}
 }
 
+// WithAccounts offers the accounts of store. A non-empty name selects that
+// account directly; an unknown name asks for its token and saves it under
+// that name. Without a name the user picks an account, or enters another
+// token when store is empty.
+func (m TokenModel) WithAccounts(store *utils.TokenStore, name string) TokenModel {
+	m.accounts = store
+	m.accountName = strings.TrimSpace(name)
+	switch {
+	case store == nil:
+	case m.accountName != "":
+		if account, ok := store.Account(m.accountName); ok {
+			m.tokenFromFile = true
+			m.currentToken = account.Token
+			return m
+		}
+		m.isCheckingToken = false
+		m.displayInput = true
+	case len(store.Accounts) > 0:
+		m.isCheckingToken = false
+		m.choosingAccount = true
+	}
+	return m
+}
+
 func (m *TokenModel) Resize(width, height int) {
 	m.inputField.SetWidth(responsiveWidth(width, inputHorizontalChrome, minInputWidth))
 }
 
 func (m TokenModel) Init() tea.Cmd {
+	switch {
+	case m.choosingAccount, m.displayInput:
+		return nil
+	case m.accountName != "":
+		return tea.Batch(
+			m.loadingSpinner.Tick,
+			m.checkToken(m.currentToken),
+		)
+	}
 	return tea.Batch(
 		m.loadingSpinner.Tick,
 		m.readTokenFromFile(),
@@ -77,6 +128,9 @@ func (m TokenModel) Update(msg tea.Msg) (TokenModel, tea.Cmd) {
 		m, cmd = m.handleTokenIncorrectMsg(msg)
 	case TokenCorrectMsg:
 		m, cmd = m.handleTokenCorrectMsg(msg)
+	case tokenCheckedMsg:
+		m.status = msg.status
+		m, cmd = m.handleTokenCorrectMsg(TokenCorrectMsg(msg.token))
 	case TokenReadFromFileMsg:
 		m, cmd = m.handleTokenReadFromFileMsg(msg)
 	case spinner.TickMsg:
@@ -97,6 +151,8 @@ func (m TokenModel) render() string {
 	switch {
 	case m.isCheckingToken:
 		return fmt.Sprintf("%s Checking token...", m.loadingSpinner.View())
+	case m.choosingAccount:
+		return m.renderAccountPicker()
 	case m.confirmSave:
 		return m.renderSaveConfirmation()
 	case m.displayInput:
@@ -109,21 +165,71 @@ func (m TokenModel) render() string {
 func (m TokenModel) checkToken(token string) tea.Cmd {
 	return func() tea.Msg {
 		m.client.SetToken(token)
-		acc, err := m.client.AccountStatus()
-		if err != nil || acc.Uid == 0 {
+		status, err := m.client.Status()
+		if err != nil || status.Account.Uid == 0 {
 			m.client.SetToken("")
 			return TokenIncorrectMsg("Invalid token")
 		}
-		return TokenCorrectMsg(token)
+		return tokenCheckedMsg{token: token, status: status}
+	}
+}
+
+// tokenOk leaves the token screen with the output directory of the chosen
+// account.
+func (m TokenModel) tokenOk() tea.Cmd {
+	msg := TokenOkMsg{Warning: m.warning()}
+	if m.accounts != nil {
+		if account, ok := m.accounts.Account(m.accountName); ok {
+			msg.OutputDir = account.OutputDir
+		}
+	}
+	return func() tea.Msg { return msg }
+}
+
+// saveAccount stores token under the chosen account together with the
+// account status shown by the picker, then leaves the token screen.
+func (m TokenModel) saveAccount(token string) tea.Cmd {
+	store, name, status, warning := m.accounts, m.accountName, m.status, m.warning()
+	return func() tea.Msg {
+		account, _ := store.Account(name)
+		// A failed refresh of an already saved token does not block it.
+		refresh := account.Token == token
+		account.Name = name
+		account.Token = token
+		if status != nil {
+			account.DisplayName = accountDisplayName(status.Account)
+			account.HasPlus = status.Plus.HasPlus
+		}
+		store.Put(account)
+		if err := store.Save(); err != nil && !refresh {
+			return TokenIncorrectMsg("Failed to save account")
+		}
+		return TokenOkMsg{OutputDir: account.OutputDir, Warning: warning}
 	}
 }
 
+// warning describes the limits of the checked account, if any.
+func (m TokenModel) warning() string {
+	if m.status == nil {
+		return ""
+	}
+	return ya.CapabilitiesOf(m.status).Warning()
+}
+
+func accountDisplayName(account model.Account) string {
+	if account.DisplayName != "" {
+		return account.DisplayName
+	}
+	return account.Login
+}
+
 func (m TokenModel) saveTokenToFile(token string) tea.Cmd {
+	warning := m.warning()
 	return func() tea.Msg {
 		if err := utils.SaveTokenToFile(token); err != nil {
 			return TokenIncorrectMsg("Failed to save token")
 		}
-		return TokenOkMsg{}
+		return TokenOkMsg{Warning: warning}
 	}
 }
 
@@ -138,13 +244,19 @@ func (m TokenModel) readTokenFromFile() tea.Cmd {
 }
 
 func (m TokenModel) handleKeyMsg(msg tea.KeyPressMsg) (TokenModel, tea.Cmd) {
+	if m.choosingAccount {
+		return m.handleAccountPickerKey(msg)
+	}
 	if m.confirmSave {
 		switch msg.String() {
 		case "y", "Y":
+			if m.accounts != nil && m.accountName != "" {
+				return m, m.saveAccount(m.currentToken)
+			}
 			return m, m.saveTokenToFile(m.currentToken)
 		case "n", "N":
 			m.confirmSave = false
-			return m, func() tea.Msg { return TokenOkMsg{} }
+			return m, m.tokenOk()
 		}
 	} else if msg.String() == "enter" && !m.isCheckingToken {
 		m.isCheckingToken = true
@@ -168,6 +280,9 @@ func (m TokenModel) handleTokenIncorrectMsg(msg TokenIncorrectMsg) (TokenModel,
 	m.errorMessage = string(msg)
 	if m.tokenFromFile {
 		m.errorMessage = "Token from file is invalid"
+		if m.accountName != "" {
+			m.errorMessage = fmt.Sprintf("Token of account %s is invalid", m.accountName)
+		}
 	}
 	m.displayInput = true
 	return m, m.inputField.Focus()
@@ -178,8 +293,12 @@ func (m TokenModel) handleTokenCorrectMsg(msg TokenCorrectMsg) (TokenModel, tea.
 	m.isCheckingToken = false
 	m.currentToken = string(msg)
 
+	if m.tokenFromFile && m.accountName != "" && m.accounts != nil {
+		// Refresh the name and subscription the picker shows next time.
+		return m, m.saveAccount(m.currentToken)
+	}
 	if m.tokenFromFile || m.currentToken == "" {
-		return m, func() tea.Msg { return TokenOkMsg{} }
+		return m, m.tokenOk()
 	}
 
 	m.confirmSave = true
@@ -210,8 +329,70 @@ func (m TokenModel) handleSpinnerTickMsg(msg spinner.TickMsg) (TokenModel, tea.C
 	return m, nil
 }
 
+func (m TokenModel) handleAccountPickerKey(msg tea.KeyPressMsg) (TokenModel, tea.Cmd) {
+	accounts := m.accounts.Accounts
+	switch msg.String() {
+	case "up", "k":
+		if m.accountCursor > 0 {
+			m.accountCursor--
+		}
+	case "down", "j":
+		if m.accountCursor < len(accounts) {
+			m.accountCursor++
+		}
+	case "enter":
+		m.choosingAccount = false
+		m.isCheckingToken = true
+		if m.accountCursor == len(accounts) {
+			return m, tea.Batch(
+				m.loadingSpinner.Tick,
+				m.readTokenFromFile(),
+			)
+		}
+		account := accounts[m.accountCursor]
+		m.accountName = account.Name
+		m.currentToken = account.Token
+		m.tokenFromFile = true
+		return m, tea.Batch(
+			m.loadingSpinner.Tick,
+			m.checkToken(account.Token),
+		)
+	}
+	return m, nil
+}
+
+func (m TokenModel) renderAccountPicker() string {
+	var b strings.Builder
+	b.WriteString("Choose an account:\n\n")
+	for i, account := range m.accounts.Accounts {
+		line := boldStyle.Render(account.Name)
+		if account.DisplayName != "" {
+			line += "  " + account.DisplayName
+		}
+		if account.HasPlus {
+			line += "  " + greenForeground.Render("Plus")
+		} else {
+			line += "  " + dimGrayForeground.Render("no subscription")
+		}
+		b.WriteString(pickerRow(line, i == m.accountCursor))
+	}
+	b.WriteString(pickerRow("Enter another token", m.accountCursor == len(m.accounts.Accounts)))
+	b.WriteString("\n" + dimGrayForeground.Render("↑/↓ to move, enter to select"))
+	return b.String()
+}
+
+func pickerRow(text string, selected bool) string {
+	if selected {
+		return boldRedStyle.Render("> ") + text + "\n"
+	}
+	return "  " + text + "\n"
+}
+
 func (m TokenModel) renderSaveConfirmation() string {
 	fileName := boldStyle.Render(utils.TokenFileName)
+	if m.accounts != nil && m.accountName != "" {
+		fileName = fmt.Sprintf("%s as account %s", boldStyle.Render(utils.AccountsFileName), boldStyle.Render(m.accountName))
+	}
 	yesOption := boldRedStyle.Render("Y")
 	noOption := boldRedStyle.Render("N")
 
@@ -1,9 +1,16 @@
 package ui
 
 import (
+	"path/filepath"
 	"testing"
+	"ya-music/internal/fakeapi"
+	"ya-music/utils"
+	"ya-music/ya"
+	"ya-music/ya/model"
 
+	tea "charm.land/bubbletea/v2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTokenResizeExpandsInputToWindowWidth(t *testing.T) {
@@ -21,3 +28,114 @@ func TestTokenResizeKeepsMinimumInputWidth(t *testing.T) {
 
 	assert.Equal(t, minInputWidth, m.inputField.Width())
 }
+
+func newAccountTestModel(t *testing.T, accounts ...utils.StoredAccount) (TokenModel, *utils.TokenStore, string) {
+	t.Helper()
+	server := fakeapi.New()
+	t.Cleanup(server.Close)
+	server.RequireToken("boris-token")
+	server.SetAccount(model.Account{Uid: 2, Login: "boris", DisplayName: "Boris"})
+	server.SetPlus(true)
+	httpClient := utils.NewHttpClient()
+	httpClient.SetTransport(server.Transport())
+	client := ya.NewClient(httpClient)
+	client.SetBaseURL(server.URL)
+
+	path := filepath.Join(t.TempDir(), utils.AccountsFileName)
+	store, err := utils.LoadTokenStore(path)
+	require.NoError(t, err)
+	for _, account := range accounts {
+		store.Put(account)
+	}
+	return NewTokenModel(client), store, path
+}
+
+func TestAccountPickerChecksChosenAccountAndUsesItsOutputDir(t *testing.T) {
+	m, store, path := newAccountTestModel(t,
+		utils.StoredAccount{Name: "anna", Token: "anna-token", DisplayName: "Anna"},
+		utils.StoredAccount{Name: "boris", Token: "boris-token", OutputDir: "music/boris"},
+	)
+	m = m.WithAccounts(store, "")
+
+	assert.Nil(t, m.Init())
+	view := m.render()
+	assert.Contains(t, view, "anna")
+	assert.Contains(t, view, "Anna")
+	assert.Contains(t, view, "no subscription")
+	assert.Contains(t, view, "Enter another token")
+
+	m, _ = m.Update(keyCode(tea.KeyDown))
+	m, _ = m.Update(keyCode(tea.KeyEnter))
+	require.True(t, m.isCheckingToken)
+	require.Equal(t, "boris", m.accountName)
+
+	m, cmd := m.Update(m.checkToken(m.currentToken)())
+	require.NotNil(t, cmd)
+	assert.Equal(t, TokenOkMsg{OutputDir: "music/boris"}, cmd())
+
+	saved, err := utils.LoadTokenStore(path)
+	require.NoError(t, err)
+	account, ok := saved.Account("boris")
+	require.True(t, ok)
+	assert.Equal(t, "Boris", account.DisplayName)
+	assert.True(t, account.HasPlus)
+}
+
+func TestUnknownAccountAsksForTokenAndSavesIt(t *testing.T) {
+	m, store, path := newAccountTestModel(t)
+	m = m.WithAccounts(store, "boris")
+
+	assert.Nil(t, m.Init())
+	assert.True(t, m.displayInput)
+
+	m.inputField.SetValue("boris-token")
+	m, _ = m.Update(keyCode(tea.KeyEnter))
+	m, _ = m.Update(m.checkToken("boris-token")())
+	require.True(t, m.confirmSave)
+	assert.Contains(t, m.render(), utils.AccountsFileName)
+
+	m, cmd := m.Update(keyText("y"))
+	require.NotNil(t, cmd)
+	assert.Equal(t, TokenOkMsg{}, cmd())
+	saved, err := utils.LoadTokenStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, []utils.StoredAccount{{Name: "boris", Token: "boris-token", DisplayName: "Boris", HasPlus: true}}, saved.Accounts)
+}
+
+func TestInvalidAccountTokenNamesTheAccount(t *testing.T) {
+	m, store, _ := newAccountTestModel(t, utils.StoredAccount{Name: "anna", Token: "expired"})
+	m = m.WithAccounts(store, "anna")
+
+	m, _ = m.Update(m.checkToken(m.currentToken)())
+
+	assert.True(t, m.displayInput)
+	assert.Contains(t, m.render(), "Token of account anna is invalid")
+}
+
+func TestTokenOkMsgSetsDownloadOutputDir(t *testing.T) {
+	m := StartUi(nil)
+
+	updated, _ := m.Update(TokenOkMsg{OutputDir: "music/anna"})
+
+	assert.Equal(t, "music/anna", updated.(Model).downloadModel.outputDir)
+	assert.Equal(t, filepath.Join("music/anna", ".yamdl-failed.json"), updated.(Model).downloadModel.retryPath)
+}
+
+func TestTokenOkWarnsWithoutSubscription(t *testing.T) {
+	m := NewTokenModel(nil)
+	m.status = &model.Status{Account: model.Account{Uid: 1}}
+
+	msg := m.tokenOk()()
+
+	assert.Equal(t, TokenOkMsg{Warning: "no active subscription: lossless unavailable, previews only"}, msg)
+}
+
+func TestTokenOkMsgShowsWarningOnSourceAndDownloadScreens(t *testing.T) {
+	m := StartUi(nil)
+
+	updated, _ := m.Update(TokenOkMsg{Warning: "no active subscription: lossless unavailable, previews only"})
+
+	updatedModel := updated.(Model)
+	assert.Contains(t, updatedModel.sourceModel.render(), "Warning: no active subscription")
+	assert.Contains(t, updatedModel.downloadModel.headerBlock(), "Warning: no active subscription")
+}
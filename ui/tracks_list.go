@@ -67,6 +67,19 @@ func (t TrackStatus) String() string {
 	}
 }
 
+// errorKindLabels replace "Error" in the status column when the cause of a
+// failure is known.
+var errorKindLabels = map[string]string{
+	"auth_expired":          "Auth expired",
+	"subscription_required": "No subscription",
+	"region_blocked":        "Region blocked",
+	"rate_limited":          "Rate limited",
+	"not_found":             "Not found",
+	"network":               "Network error",
+	"disk_full":             "Disk full",
+	"tag_write":             "Tag error",
+}
+
 type ListSelectedItemMsg string
 
 type TrackListItem struct {
@@ -74,6 +87,13 @@ type TrackListItem struct {
 	track  *model.Track
 	status TrackStatus
 	format string
+	// errKind is the ya.ErrorKind of failed tracks.
+	errKind string
+	// downloadedBefore marks ready tracks found in the download history.
+	downloadedBefore bool
+	// received and size are the audio bytes of a downloading track.
+	received int64
+	size     int64
 }
 
 func (t TrackListItem) FilterValue() string {
@@ -248,6 +268,17 @@ func truncateToWidth(s string, width int) string {
 }
 
 func (t TrackListItem) statusLabel() string {
+	if t.status == TrackStatusReady && t.downloadedBefore {
+		return "Ready (before)"
+	}
+	if t.status == TrackStatusDownloading && t.received > 0 {
+		return miniProgress(t.received, t.size)
+	}
+	if t.status == TrackStatusError {
+		if label, ok := errorKindLabels[t.errKind]; ok {
+			return label
+		}
+	}
 	if t.status != TrackStatusDownloaded {
 		return t.status.String()
 	}
@@ -258,6 +289,21 @@ func (t TrackListItem) statusLabel() string {
 	return t.status.String() + " " + format
 }
 
+// miniProgressWidth is the number of cells of a row's progress bar.
+const miniProgressWidth = 8
+
+// miniProgress renders a row progress bar with the percentage, or the bytes
+// received when the size is unknown.
+func miniProgress(received, size int64) string {
+	if size <= 0 {
+		return fmt.Sprintf("↓ %.1f MB", float64(received)/(1<<20))
+	}
+	fraction := min(float64(received)/float64(size), 1)
+	filled := int(fraction * miniProgressWidth)
+	return strings.Repeat("█", filled) + strings.Repeat("░", miniProgressWidth-filled) +
+		fmt.Sprintf(" %3d%%", int(fraction*100))
+}
+
 func formatTrackNumber(index int, totalItems int) string {
 	width := len(strconv.Itoa(totalItems))
 	if width <= 2 {
@@ -124,6 +124,21 @@ func TestTrackListItemDownloadedStatusDefaultsToMP3(t *testing.T) {
 	assert.Equal(t, "✅ MP3", item.statusLabel())
 }
 
+func TestTrackListItemErrorStatusNamesKnownCause(t *testing.T) {
+	assert.Equal(t, "Auth expired", TrackListItem{status: TrackStatusError, errKind: "auth_expired"}.statusLabel())
+	assert.Equal(t, "Disk full", TrackListItem{status: TrackStatusError, errKind: "disk_full"}.statusLabel())
+	assert.Equal(t, "Error", TrackListItem{status: TrackStatusError}.statusLabel())
+	for kind, label := range errorKindLabels {
+		assert.LessOrEqual(t, len(label), trackStatusColumnWidth, kind)
+	}
+}
+
+func TestTrackListItemDownloadingStatusShowsByteProgress(t *testing.T) {
+	assert.Equal(t, "███░░░░░  40%", TrackListItem{status: TrackStatusDownloading, received: 40, size: 100}.statusLabel())
+	assert.Equal(t, "↓ 2.0 MB", TrackListItem{status: TrackStatusDownloading, received: 2 << 20, size: -1}.statusLabel())
+	assert.Equal(t, "Downloading...", TrackListItem{status: TrackStatusDownloading}.statusLabel())
+}
+
 func TestTrackListItemRenderHandlesWideTitleCharacters(t *testing.T) {
 	items := []list.Item{
 		TrackListItem{
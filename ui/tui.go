@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 
+	"ya-music/internal/history"
 	"ya-music/utils"
 	"ya-music/ya"
 
@@ -75,12 +76,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, m.sourceModel.Reset()
 
 	case TokenOkMsg:
+		if msg.OutputDir != "" {
+			m.downloadModel.setOutputDir(msg.OutputDir)
+		}
+		m.sourceModel.warning = msg.Warning
+		m.downloadModel.warning = msg.Warning
 		m.initState = UiStateSelectSource
 		m.resizeToWindow()
 		cmds = append(cmds, m.sourceModel.Init())
 
 	case SourceSubmitMsg:
 		m.initState = UiStateDownloading
+		m.downloadModel.source = msg.Link
 		m.downloadModel.AddTracks(msg.Tracks)
 		m.resizeToWindow()
 
@@ -136,6 +143,20 @@ func StartUi(client *ya.Client, options ...ya.DownloadOptions) Model {
 	}
 }
 
+// WithHistory records finished downloads in store and marks tracks it already
+// lists as downloaded.
+func (m Model) WithHistory(store *history.Store) Model {
+	m.downloadModel.history = store
+	return m
+}
+
+// WithAccounts lets the token screen pick one of the named accounts in store.
+// See TokenModel.WithAccounts.
+func (m Model) WithAccounts(store *utils.TokenStore, name string) Model {
+	m.tokenModel = m.tokenModel.WithAccounts(store, name)
+	return m
+}
+
 func (m *Model) resizeToWindow() {
 	if m.windowWidth <= 0 || m.windowHeight <= 0 {
 		return
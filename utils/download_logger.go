@@ -34,6 +34,9 @@ type RequestLogContext struct {
 	Track     TrackLogContext
 	Stage     string
 	Operation string
+	// Progress, when set, is called as the response body of a download is
+	// read.
+	Progress ProgressFunc
 }
 
 type synchronizedWriter struct {
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -93,6 +94,22 @@ func (c *HttpClient) ResetCancel() {
 	c.mu.Unlock()
 }
 
+// Context is cancelled by Cancel, so work outside HTTP requests, such as
+// external encoders, stops together with downloads.
+func (c *HttpClient) Context() context.Context {
+	return c.baseContext()
+}
+
+// StatusError reports a download answered with an unexpected HTTP status.
+type StatusError struct {
+	Op         string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: status code %d", e.Op, e.StatusCode)
+}
+
 func (c *HttpClient) SetToken(token string) {
 	c.headers["Authorization"] = fmt.Sprintf("OAuth %s", token)
 }
@@ -114,11 +131,23 @@ func (c *HttpClient) Get(url string) ([]byte, error) {
 }
 
 func (c *HttpClient) GetWithContext(reqCtx RequestLogContext, url string) ([]byte, error) {
-	return c.sendRequest(reqCtx, http.MethodGet, url, nil)
+	return c.GetContext(c.baseContext(), reqCtx, url)
+}
+
+// GetContext is GetWithContext bound to ctx instead of the client-wide
+// Cancel.
+func (c *HttpClient) GetContext(ctx context.Context, reqCtx RequestLogContext, url string) ([]byte, error) {
+	return c.sendRequest(ctx, reqCtx, http.MethodGet, url, nil)
 }
 
 func (c *HttpClient) GetWithContextAndHeaders(reqCtx RequestLogContext, url string, headers map[string]string) ([]byte, error) {
-	return c.sendRequestWithHeaders(reqCtx, http.MethodGet, url, nil, headers)
+	return c.GetWithHeadersContext(c.baseContext(), reqCtx, url, headers)
+}
+
+// GetWithHeadersContext is GetWithContextAndHeaders bound to ctx instead of
+// the client-wide Cancel.
+func (c *HttpClient) GetWithHeadersContext(ctx context.Context, reqCtx RequestLogContext, url string, headers map[string]string) ([]byte, error) {
+	return c.sendRequestWithHeaders(ctx, reqCtx, http.MethodGet, url, nil, headers)
 }
 
 func (c *HttpClient) Post(url string, data []byte) ([]byte, error) {
@@ -126,15 +155,28 @@ func (c *HttpClient) Post(url string, data []byte) ([]byte, error) {
 }
 
 func (c *HttpClient) PostWithContext(reqCtx RequestLogContext, url string, data []byte) ([]byte, error) {
-	return c.sendRequest(reqCtx, http.MethodPost, url, data)
+	return c.PostContext(c.baseContext(), reqCtx, url, data)
+}
+
+// PostContext is PostWithContext bound to ctx instead of the client-wide
+// Cancel.
+func (c *HttpClient) PostContext(ctx context.Context, reqCtx RequestLogContext, url string, data []byte) ([]byte, error) {
+	return c.sendRequest(ctx, reqCtx, http.MethodPost, url, data)
+}
+
+// PostFormContext posts form as application/x-www-form-urlencoded until ctx
+// is done.
+func (c *HttpClient) PostFormContext(ctx context.Context, reqCtx RequestLogContext, url string, form neturl.Values) ([]byte, error) {
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	return c.sendRequestWithHeaders(ctx, reqCtx, http.MethodPost, url, []byte(form.Encode()), headers)
 }
 
-func (c *HttpClient) sendRequest(reqCtx RequestLogContext, method, url string, data []byte) ([]byte, error) {
-	return c.sendRequestWithHeaders(reqCtx, method, url, data, nil)
+func (c *HttpClient) sendRequest(ctx context.Context, reqCtx RequestLogContext, method, url string, data []byte) ([]byte, error) {
+	return c.sendRequestWithHeaders(ctx, reqCtx, method, url, data, nil)
 }
 
-func (c *HttpClient) sendRequestWithHeaders(reqCtx RequestLogContext, method, url string, data []byte, extraHeaders map[string]string) ([]byte, error) {
-	ctx, cancel := withOptionalTimeout(c.baseContext(), c.requestTimeout)
+func (c *HttpClient) sendRequestWithHeaders(ctx context.Context, reqCtx RequestLogContext, method, url string, data []byte, extraHeaders map[string]string) ([]byte, error) {
+	ctx, cancel := withOptionalTimeout(ctx, c.requestTimeout)
 	defer cancel()
 
 	req, err := c.createRequest(ctx, method, url, data, extraHeaders)
@@ -216,7 +258,13 @@ func (c *HttpClient) DownloadFile(url, filepath string) error {
 }
 
 func (c *HttpClient) DownloadBytesWithContext(reqCtx RequestLogContext, url string) ([]byte, error) {
-	ctx, cancel := withOptionalTimeout(c.baseContext(), c.downloadTimeout)
+	return c.DownloadBytesContext(c.baseContext(), reqCtx, url)
+}
+
+// DownloadBytesContext is DownloadBytesWithContext bound to ctx instead of
+// the client-wide Cancel.
+func (c *HttpClient) DownloadBytesContext(ctx context.Context, reqCtx RequestLogContext, url string) ([]byte, error) {
+	ctx, cancel := withOptionalTimeout(ctx, c.downloadTimeout)
 	defer cancel()
 
 	req, err := c.createDownloadRequest(ctx, url)
@@ -242,7 +290,11 @@ func (c *HttpClient) DownloadBytesWithContext(reqCtx RequestLogContext, url stri
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	var reader io.Reader = resp.Body
+	if resp.StatusCode == http.StatusOK {
+		reader = newProgressReader(resp.Body, resp.ContentLength, reqCtx.Progress)
+	}
+	body, err := io.ReadAll(reader)
 	if err != nil {
 		c.logRequest(slog.LevelError, reqCtx, "download response read failed", http.MethodGet, url,
 			"status_code", resp.StatusCode,
@@ -259,7 +311,7 @@ func (c *HttpClient) DownloadBytesWithContext(reqCtx RequestLogContext, url stri
 			"response_bytes", len(body),
 			"response_preview", responsePreview(resp.Header.Get("Content-Type"), body),
 		)
-		return nil, fmt.Errorf("failed to download bytes: status code %d", resp.StatusCode)
+		return nil, &StatusError{Op: "failed to download bytes", StatusCode: resp.StatusCode}
 	}
 
 	c.logRequest(slog.LevelInfo, reqCtx, "download request finished", http.MethodGet, url,
@@ -272,10 +324,22 @@ func (c *HttpClient) DownloadBytesWithContext(reqCtx RequestLogContext, url stri
 }
 
 func (c *HttpClient) DownloadToWriterWithContext(reqCtx RequestLogContext, url string, writer io.Writer) (int64, error) {
-	return c.downloadResponseToWriter(reqCtx, url, writer, "")
+	return c.DownloadToWriterContext(c.baseContext(), reqCtx, url, writer)
+}
+
+// DownloadToWriterContext is DownloadToWriterWithContext bound to ctx instead
+// of the client-wide Cancel.
+func (c *HttpClient) DownloadToWriterContext(ctx context.Context, reqCtx RequestLogContext, url string, writer io.Writer) (int64, error) {
+	return c.downloadResponseToWriter(ctx, reqCtx, url, writer, "")
 }
 
 func (c *HttpClient) DownloadFileWithContext(reqCtx RequestLogContext, url, filepath string) error {
+	return c.DownloadFileContext(c.baseContext(), reqCtx, url, filepath)
+}
+
+// DownloadFileContext is DownloadFileWithContext bound to ctx instead of the
+// client-wide Cancel.
+func (c *HttpClient) DownloadFileContext(ctx context.Context, reqCtx RequestLogContext, url, filepath string) error {
 	out, err := c.createTempDownloadFile(filepath)
 	if err != nil {
 		return fmt.Errorf("error creating file: %w", err)
@@ -291,7 +355,7 @@ func (c *HttpClient) DownloadFileWithContext(reqCtx RequestLogContext, url, file
 		}
 	}()
 
-	written, err := c.downloadResponseToWriter(reqCtx, url, out, filepath)
+	written, err := c.downloadResponseToWriter(ctx, reqCtx, url, out, filepath)
 	if err != nil {
 		return err
 	}
@@ -318,8 +382,8 @@ func (c *HttpClient) DownloadFileWithContext(reqCtx RequestLogContext, url, file
 	return nil
 }
 
-func (c *HttpClient) downloadResponseToWriter(reqCtx RequestLogContext, url string, writer io.Writer, destination string) (int64, error) {
-	ctx, cancel := withOptionalTimeout(c.baseContext(), c.downloadTimeout)
+func (c *HttpClient) downloadResponseToWriter(ctx context.Context, reqCtx RequestLogContext, url string, writer io.Writer, destination string) (int64, error) {
+	ctx, cancel := withOptionalTimeout(ctx, c.downloadTimeout)
 	defer cancel()
 
 	req, err := c.createDownloadRequest(ctx, url)
@@ -365,11 +429,12 @@ func (c *HttpClient) downloadResponseToWriter(reqCtx RequestLogContext, url stri
 			badArgs = append([]any{"destination", destination}, badArgs...)
 		}
 		c.logRequest(slog.LevelError, reqCtx, "download request finished with bad status", http.MethodGet, url, badArgs...)
-		return 0, fmt.Errorf("failed to download file: status code %d", resp.StatusCode)
+		return 0, &StatusError{Op: "failed to download file", StatusCode: resp.StatusCode}
 	}
 
 	buf := make([]byte, DefaultBufferSize)
-	written, err := io.CopyBuffer(writer, resp.Body, buf)
+	reader := newProgressReader(resp.Body, resp.ContentLength, reqCtx.Progress)
+	written, err := io.CopyBuffer(writer, reader, buf)
 	if err != nil {
 		copyArgs := []any{
 			"status_code", resp.StatusCode,
@@ -2,8 +2,10 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
@@ -171,6 +173,22 @@ func TestPost(t *testing.T) {
 	assert.Equal(t, `{"result": "success"}`, string(resp))
 }
 
+func TestPostFormContextSendsURLEncodedBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "1,2", r.PostForm.Get("track-ids"))
+		w.Write([]byte(`{"result": []}`))
+	}))
+	defer server.Close()
+
+	client := NewHttpClient()
+	resp, err := client.PostFormContext(context.Background(), RequestLogContext{}, server.URL, url.Values{"track-ids": {"1,2"}})
+
+	require.NoError(t, err)
+	assert.Equal(t, `{"result": []}`, string(resp))
+}
+
 type trackingWriter struct {
 	bytes.Buffer
 	closed bool
@@ -203,6 +221,71 @@ func TestDownloadToWriterWithContextWritesBytesWithoutClosingWriter(t *testing.T
 	assert.False(t, writer.closed)
 }
 
+func TestDownloadToWriterWithContextReportsProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		w.Write([]byte("audio-data"))
+	}))
+	defer server.Close()
+
+	client := NewHttpClient()
+	var lastWritten, lastTotal int64
+	calls := 0
+
+	_, err := client.DownloadToWriterWithContext(
+		RequestLogContext{Progress: func(written, total int64) {
+			calls++
+			lastWritten, lastTotal = written, total
+		}},
+		server.URL,
+		&trackingWriter{},
+	)
+
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, calls, 2)
+	assert.Equal(t, int64(10), lastWritten)
+	assert.Equal(t, int64(10), lastTotal)
+}
+
+func TestDownloadBytesWithContextReportsProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("flac"))
+	}))
+	defer server.Close()
+
+	client := NewHttpClient()
+	var lastWritten int64
+
+	body, err := client.DownloadBytesWithContext(
+		RequestLogContext{Progress: func(written, total int64) { lastWritten = written }},
+		server.URL,
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("flac"), body)
+	assert.Equal(t, int64(4), lastWritten)
+}
+
+func TestDownloadToWriterContextUsesOnlyTheGivenContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("audio-data"))
+	}))
+	defer server.Close()
+
+	client := NewHttpClient()
+	client.Cancel()
+	writer := &trackingWriter{}
+
+	written, err := client.DownloadToWriterContext(context.Background(), RequestLogContext{}, server.URL, writer)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len("audio-data")), written)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.DownloadToWriterContext(ctx, RequestLogContext{}, server.URL, &trackingWriter{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestDownloadToWriterWithContextRejectsBadStatus(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusServiceUnavailable)
@@ -295,7 +378,11 @@ func TestDownloadFileError(t *testing.T) {
 	defer os.Remove(tempFile)
 
 	err := client.DownloadFile(server.URL, tempFile)
-	assert.Error(t, err)
+	var statusErr *StatusError
+	if assert.ErrorAs(t, err, &statusErr) {
+		assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+	}
+	assert.EqualError(t, err, "failed to download file: status code 404")
 }
 
 func TestDownloadFileWithContextLogsBadStatus(t *testing.T) {
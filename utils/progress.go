@@ -0,0 +1,32 @@
+package utils
+
+import "io"
+
+// ProgressFunc receives the bytes written so far and the expected total,
+// which is -1 when the server does not report a length.
+type ProgressFunc func(written, total int64)
+
+// progressReader reports the bytes read from r to progress.
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func newProgressReader(r io.Reader, total int64, progress ProgressFunc) io.Reader {
+	if progress == nil {
+		return r
+	}
+	progress(0, total)
+	return &progressReader{r: r, total: total, progress: progress}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.progress(p.read, p.total)
+	}
+	return n, err
+}
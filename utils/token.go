@@ -1,11 +1,21 @@
 package utils
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
 	"strings"
 )
 
-const TokenFileName = "token.txt"
+const (
+	TokenFileName = "token.txt"
+	// AccountsFileName holds named accounts; TokenFileName stays the
+	// unnamed default token.
+	AccountsFileName = "accounts.json"
+)
 
 func SaveTokenToFile(token string) error {
 	return os.WriteFile(TokenFileName, []byte(token), 0600)
@@ -18,3 +28,95 @@ func ReadTokenFromFile() (string, error) {
 	}
 	return strings.TrimSpace(string(content)), nil
 }
+
+// StoredAccount is a named token with its per-account defaults.
+type StoredAccount struct {
+	Name      string `json:"name"`
+	Token     string `json:"token"`
+	OutputDir string `json:"output_dir,omitempty"`
+	// DisplayName and HasPlus are remembered from the last successful token
+	// check so accounts can be listed without a request per account.
+	DisplayName string `json:"display_name,omitempty"`
+	HasPlus     bool   `json:"has_plus,omitempty"`
+}
+
+// TokenStore is the list of named accounts saved in an accounts file.
+type TokenStore struct {
+	path     string
+	Accounts []StoredAccount `json:"accounts"`
+}
+
+// LoadTokenStore reads the accounts file at path. A missing file is an empty
+// store.
+func LoadTokenStore(path string) (*TokenStore, error) {
+	store := &TokenStore{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read accounts: %w", err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("parse accounts %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Account returns the account called name.
+func (s *TokenStore) Account(name string) (StoredAccount, bool) {
+	index := s.index(name)
+	if index < 0 {
+		return StoredAccount{}, false
+	}
+	return s.Accounts[index], true
+}
+
+// Put adds account or replaces the one with the same name.
+func (s *TokenStore) Put(account StoredAccount) {
+	if index := s.index(account.Name); index >= 0 {
+		s.Accounts[index] = account
+		return
+	}
+	s.Accounts = append(s.Accounts, account)
+}
+
+// Remove deletes the account called name and reports whether it existed.
+func (s *TokenStore) Remove(name string) bool {
+	index := s.index(name)
+	if index < 0 {
+		return false
+	}
+	s.Accounts = slices.Delete(s.Accounts, index, index+1)
+	return true
+}
+
+// Save writes the store back to its file, readable only by the owner.
+func (s *TokenStore) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode accounts: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".accounts-*.json")
+	if err != nil {
+		return fmt.Errorf("save accounts: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save accounts: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save accounts: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("save accounts: %w", err)
+	}
+	return nil
+}
+
+func (s *TokenStore) index(name string) int {
+	return slices.IndexFunc(s.Accounts, func(account StoredAccount) bool {
+		return account.Name == name
+	})
+}
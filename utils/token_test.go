@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), AccountsFileName)
+	store, err := LoadTokenStore(path)
+	require.NoError(t, err)
+	assert.Empty(t, store.Accounts)
+
+	store.Put(StoredAccount{Name: "anna", Token: "a1", OutputDir: "./anna"})
+	store.Put(StoredAccount{Name: "boris", Token: "b1"})
+	store.Put(StoredAccount{Name: "anna", Token: "a2", DisplayName: "Anna", HasPlus: true})
+	require.NoError(t, store.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	loaded, err := LoadTokenStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, []StoredAccount{
+		{Name: "anna", Token: "a2", DisplayName: "Anna", HasPlus: true},
+		{Name: "boris", Token: "b1"},
+	}, loaded.Accounts)
+
+	assert.True(t, loaded.Remove("anna"))
+	assert.False(t, loaded.Remove("anna"))
+	_, ok := loaded.Account("anna")
+	assert.False(t, ok)
+	account, ok := loaded.Account("boris")
+	assert.True(t, ok)
+	assert.Equal(t, "b1", account.Token)
+}
+
+func TestLoadTokenStoreRejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), AccountsFileName)
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+	_, err := LoadTokenStore(path)
+
+	assert.ErrorContains(t, err, "parse accounts")
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// TransportOptions configure how an HttpClient connects. API, download and
+// cover requests share the transport.
+type TransportOptions struct {
+	// Proxy is an http, https or socks5 proxy URL, optionally with
+	// user:password. Empty uses HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+	Proxy string
+	// CABundle is a PEM file of root certificates trusted in addition to the
+	// system ones.
+	CABundle string
+}
+
+// ParseProxyURL validates a proxy URL of TransportOptions. Errors never
+// repeat the URL, which may hold a password.
+func ParseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		// *url.Error repeats the URL; keep only its cause.
+		return nil, fmt.Errorf("invalid proxy URL: %w", errors.Unwrap(err))
+	}
+	switch strings.ToLower(proxyURL.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errors.New("invalid proxy URL: scheme must be http, https or socks5")
+	}
+	if proxyURL.Host == "" {
+		return nil, errors.New("invalid proxy URL: missing host")
+	}
+	return proxyURL, nil
+}
+
+// NewTransport returns a transport configured by options.
+func NewTransport(options TransportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if strings.TrimSpace(options.Proxy) != "" {
+		proxyURL, err := ParseProxyURL(options.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if strings.TrimSpace(options.CABundle) != "" {
+		pool, err := loadCABundle(options.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return transport, nil
+}
+
+func loadCABundle(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("CA bundle contains no PEM certificates")
+	}
+	return pool, nil
+}
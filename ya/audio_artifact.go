@@ -1,18 +1,21 @@
 package ya
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"ya-music/utils"
+	"ya-music/ya/loudness"
 	"ya-music/ya/model"
 )
 
 type artifactMetadata struct {
-	Track     model.Track
-	CoverPath string
+	Track      model.Track
+	CoverPath  string
+	ReplayGain *replayGain
 }
 
 type artifactTagger interface {
@@ -21,6 +24,8 @@ type artifactTagger interface {
 
 type artifactWriteFunc func(path string) error
 
+type loudnessAnalyzer func(path string) (loudness.Result, error)
+
 type metadataFailurePolicy uint8
 
 const (
@@ -37,6 +42,7 @@ type artifactSpec struct {
 	FailurePolicy      metadataFailurePolicy
 	MetadataSuccessMsg string
 	MetadataSkipMsg    string
+	LoudnessAnalyzer   loudnessAnalyzer
 }
 
 type artifactPublishResult struct {
@@ -45,6 +51,7 @@ type artifactPublishResult struct {
 }
 
 func (c *Client) publishAudioArtifact(
+	ctx context.Context,
 	track model.Track,
 	destination string,
 	options DownloadOptions,
@@ -92,16 +99,18 @@ func (c *Client) publishAudioArtifact(
 			"temp_filename", tempFilename,
 			"format", spec.Format,
 		)
-		return artifactPublishResult{}, err
+		return artifactPublishResult{}, withStage(spec.DownloadStage, err)
 	}
 
-	coverCh := c.startCoverDownload(track, destination, options)
+	gain := c.resolveReplayGain(trackCtx, track, tempFilename, options, spec)
+
+	coverCh := c.startCoverDownload(ctx, track, destination, options)
 	cover := c.waitCoverDownload(trackCtx, coverCh)
 	if cover.filename != "" {
 		defer c.removeCoverFile(trackCtx, cover.filename)
 	}
 
-	metadata := artifactMetadata{Track: track, CoverPath: cover.filename}
+	metadata := artifactMetadata{Track: track, CoverPath: cover.filename, ReplayGain: gain}
 	if err := spec.Tagger.Write(tempFilename, metadata); err != nil {
 		if spec.FailurePolicy == metadataRequired {
 			c.logTrackFailure(trackCtx, spec.MetadataStage, err,
@@ -110,7 +119,7 @@ func (c *Client) publishAudioArtifact(
 				"cover_filename", cover.filename,
 			)
 			return artifactPublishResult{Filename: destination, CoverFilename: cover.filename},
-				fmt.Errorf("failed to write %s tags: %w", spec.Format, err)
+				withStage(spec.MetadataStage, fmt.Errorf("failed to write %s tags: %w", spec.Format, err))
 		}
 
 		c.logTrack(slog.LevelWarn, trackCtx, spec.MetadataSkipMsg,
@@ -127,13 +136,35 @@ func (c *Client) publishAudioArtifact(
 		)
 	}
 
+	published := destination
+	if options.Transcode.appliesTo(spec.Format) {
+		transcoded, err := c.transcodeArtifact(ctx, trackCtx, tempFilename, destination, options, metadata)
+		switch {
+		case err != nil && (!options.Transcode.KeepOriginal || ctx.Err() != nil):
+			return artifactPublishResult{Filename: destination, CoverFilename: cover.filename},
+				fmt.Errorf("%w (%s): %w", errTranscodeFailed, options.Transcode.Name, err)
+		case err != nil:
+			// The original was requested anyway, so it is still worth publishing.
+			c.logTrack(slog.LevelWarn, trackCtx, "transcode failed, keeping original",
+				"stage", "transcode",
+				"profile", options.Transcode.Name,
+				"filename", destination,
+				"error", err,
+			)
+		case transcoded == destination || !options.Transcode.KeepOriginal:
+			return artifactPublishResult{Filename: transcoded, CoverFilename: cover.filename}, nil
+		default:
+			published = transcoded
+		}
+	}
+
 	if err := os.Rename(tempFilename, destination); err != nil {
 		c.logTrackFailure(trackCtx, spec.DownloadStage, err,
 			"filename", destination,
 			"temp_filename", tempFilename,
 			"format", spec.Format,
 		)
-		return artifactPublishResult{}, fmt.Errorf("failed to publish %s file: %w", spec.Format, err)
+		return artifactPublishResult{}, withStage(spec.DownloadStage, fmt.Errorf("failed to publish %s file: %w", spec.Format, err))
 	}
 	cleanupTemp = false
 
@@ -142,19 +173,19 @@ func (c *Client) publishAudioArtifact(
 		"filename", destination,
 		"cover_filename", cover.filename,
 	)
-	return artifactPublishResult{Filename: destination, CoverFilename: cover.filename}, nil
+	return artifactPublishResult{Filename: published, CoverFilename: cover.filename}, nil
 }
 
 type mp3ArtifactTagger struct{}
 
 func (mp3ArtifactTagger) Write(path string, metadata artifactMetadata) error {
-	return writeID3Tags(path, metadata.Track, metadata.CoverPath)
+	return writeID3Tags(path, metadata.Track, metadata.CoverPath, metadata.ReplayGain)
 }
 
 type flacArtifactTagger struct{}
 
 func (flacArtifactTagger) Write(path string, metadata artifactMetadata) error {
-	return writeFLACTags(path, metadata.Track, metadata.CoverPath)
+	return writeFLACTags(path, metadata.Track, metadata.CoverPath, metadata.ReplayGain)
 }
 
 type m4aArtifactTagger struct {
@@ -168,6 +199,7 @@ func (t m4aArtifactTagger) Write(path string, metadata artifactMetadata) error {
 	}
 	coverMIME, coverData, _ := readM4ACoverData(metadata.CoverPath)
 	tags := m4aTagInputForTrack(metadata.Track, album, coverMIME, coverData)
+	tags.ReplayGain = metadata.ReplayGain.fields()
 	return t.client.m4aTags().Write(path, tags)
 }
 
@@ -199,6 +231,7 @@ func flacArtifactSpec() artifactSpec {
 		Tagger:             flacArtifactTagger{},
 		FailurePolicy:      metadataRequired,
 		MetadataSuccessMsg: "FLAC metadata written",
+		LoudnessAnalyzer:   loudness.AnalyzeFLACFile,
 	}
 }
 
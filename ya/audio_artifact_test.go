@@ -1,6 +1,7 @@
 package ya
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/http/httptest"
@@ -90,6 +91,7 @@ func TestPublishAudioArtifactPublishesAfterRequiredTags(t *testing.T) {
 	client := NewClient(utils.NewHttpClient())
 
 	result, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{},
@@ -134,6 +136,7 @@ func TestPublishAudioArtifactRemovesTempWhenRequiredTagsFail(t *testing.T) {
 	client := NewClient(utils.NewHttpClient())
 
 	result, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{},
@@ -167,6 +170,7 @@ func TestPublishAudioArtifactPublishesRawAudioWhenBestEffortTagsFail(t *testing.
 	client := NewClient(utils.NewHttpClient())
 
 	result, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{SkipCover: true},
@@ -210,6 +214,7 @@ func TestPublishAudioArtifactCleansCoverWhenAudioWriteFails(t *testing.T) {
 	client := NewClient(utils.NewHttpClient())
 
 	result, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{},
@@ -250,6 +255,7 @@ func TestPublishAudioArtifactTagsTempFileBeforeRename(t *testing.T) {
 	client := NewClient(utils.NewHttpClient())
 
 	_, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{SkipCover: true},
@@ -268,6 +274,7 @@ func TestPublishAudioArtifactRejectsInvalidDestination(t *testing.T) {
 
 	t.Run("empty destination", func(t *testing.T) {
 		result, err := client.publishAudioArtifact(
+			context.Background(),
 			track,
 			"",
 			DownloadOptions{SkipCover: true},
@@ -282,6 +289,7 @@ func TestPublishAudioArtifactRejectsInvalidDestination(t *testing.T) {
 		dir := t.TempDir()
 		destination := filepath.Join(dir, "missing", "track.mp3")
 		result, err := client.publishAudioArtifact(
+			context.Background(),
 			track,
 			destination,
 			DownloadOptions{SkipCover: true},
@@ -303,6 +311,7 @@ func TestPublishAudioArtifactRejectsNilDependencies(t *testing.T) {
 	t.Run("nil tagger", func(t *testing.T) {
 		spec := testArtifactSpec(nil, metadataRequired)
 		result, err := client.publishAudioArtifact(
+			context.Background(),
 			track,
 			destination,
 			DownloadOptions{SkipCover: true},
@@ -317,6 +326,7 @@ func TestPublishAudioArtifactRejectsNilDependencies(t *testing.T) {
 	t.Run("nil writer", func(t *testing.T) {
 		tagger := &recordingArtifactTagger{}
 		result, err := client.publishAudioArtifact(
+			context.Background(),
 			track,
 			destination,
 			DownloadOptions{SkipCover: true},
@@ -343,6 +353,7 @@ func TestPublishAudioArtifactCleansTempOnRenameFailure(t *testing.T) {
 	client := NewClient(utils.NewHttpClient())
 
 	result, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{SkipCover: true},
@@ -367,6 +378,7 @@ func TestPublishAudioArtifactFailsWhenCreateTempFails(t *testing.T) {
 	client := NewClient(utils.NewHttpClient())
 
 	result, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{SkipCover: true},
@@ -403,6 +415,7 @@ func TestPublishAudioArtifactContinuesWhenCoverDownloadFails(t *testing.T) {
 	client := NewClient(utils.NewHttpClient())
 
 	result, err := client.publishAudioArtifact(
+		context.Background(),
 		track,
 		destination,
 		DownloadOptions{},
@@ -468,7 +481,7 @@ func TestAudioArtifactMp3TaggerReturnsWriteID3TagsError(t *testing.T) {
 	missing := filepath.Join(t.TempDir(), "missing.mp3")
 
 	err := tagger.Write(missing, artifactMetadata{Track: model.Track{Title: "Song"}})
-	want := writeID3Tags(missing, model.Track{Title: "Song"}, "")
+	want := writeID3Tags(missing, model.Track{Title: "Song"}, "", nil)
 	require.Error(t, err)
 	assert.Equal(t, want.Error(), err.Error())
 }
@@ -510,7 +523,7 @@ func TestAudioArtifactFlacTaggerReturnsWriteFLACTagsError(t *testing.T) {
 	missing := filepath.Join(t.TempDir(), "missing.flac")
 
 	err := tagger.Write(missing, artifactMetadata{Track: model.Track{Title: "Song"}})
-	want := writeFLACTags(missing, model.Track{Title: "Song"}, "")
+	want := writeFLACTags(missing, model.Track{Title: "Song"}, "", nil)
 	require.Error(t, err)
 	assert.Equal(t, want.Error(), err.Error())
 }
@@ -0,0 +1,39 @@
+package ya
+
+import "ya-music/ya/model"
+
+// Capabilities summarise what the token can download.
+type Capabilities struct {
+	// Subscription unlocks full tracks; without it Yandex Music serves
+	// 30-second previews only.
+	Subscription bool
+	// Lossless is granted by the high-quality permission of a subscription.
+	Lossless bool
+}
+
+// CapabilitiesOf reads the capabilities from an account status. A status
+// without permissions grants lossless with the subscription.
+func CapabilitiesOf(status *model.Status) Capabilities {
+	if status == nil {
+		return Capabilities{}
+	}
+	capabilities := Capabilities{Subscription: status.HasActiveSubscription()}
+	capabilities.Lossless = capabilities.Subscription
+	if status.HasPermissions() {
+		capabilities.Lossless = capabilities.Subscription && status.Can(model.PermissionHighQuality)
+	}
+	return capabilities
+}
+
+// Warning describes what the account cannot download, or returns "" when
+// nothing is limited.
+func (c Capabilities) Warning() string {
+	switch {
+	case !c.Subscription:
+		return "no active subscription: lossless unavailable, previews only"
+	case !c.Lossless:
+		return "subscription has no high-quality permission: lossless unavailable"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,60 @@
+package ya
+
+import (
+	"testing"
+	"time"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilitiesOf(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	account := model.Account{Uid: 1, Now: now}
+
+	for _, tc := range []struct {
+		name    string
+		status  *model.Status
+		want    Capabilities
+		warning string
+	}{
+		{"no status", nil, Capabilities{}, "no active subscription: lossless unavailable, previews only"},
+		{"free", &model.Status{Account: account}, Capabilities{}, "no active subscription: lossless unavailable, previews only"},
+		{"plus", &model.Status{Account: account, Plus: model.Plus{HasPlus: true}}, Capabilities{Subscription: true, Lossless: true}, ""},
+		{"auto-renewable", &model.Status{Account: account, Subscription: model.Subscription{
+			AutoRenewable: []model.AutoRenewable{{Expires: now.Add(time.Hour)}},
+		}}, Capabilities{Subscription: true, Lossless: true}, ""},
+		{"expired", &model.Status{Account: account, Subscription: model.Subscription{
+			AutoRenewable: []model.AutoRenewable{{Expires: now.Add(-time.Hour)}, {Finished: true}},
+		}}, Capabilities{}, "no active subscription: lossless unavailable, previews only"},
+		{"high-quality permission", &model.Status{Account: account, Plus: model.Plus{HasPlus: true}, Permissions: model.Permissions{
+			Until:  now.Add(time.Hour),
+			Values: []string{"landing-play", model.PermissionHighQuality},
+		}}, Capabilities{Subscription: true, Lossless: true}, ""},
+		{"no high-quality permission", &model.Status{Account: account, Plus: model.Plus{HasPlus: true}, Permissions: model.Permissions{
+			Until:  now.Add(time.Hour),
+			Values: []string{"landing-play"},
+		}}, Capabilities{Subscription: true}, "subscription has no high-quality permission: lossless unavailable"},
+		{"expired permissions fall back to default", &model.Status{Account: account, Plus: model.Plus{HasPlus: true}, Permissions: model.Permissions{
+			Until:   now.Add(-time.Hour),
+			Values:  []string{model.PermissionHighQuality},
+			Default: []string{"landing-play"},
+		}}, Capabilities{Subscription: true}, "subscription has no high-quality permission: lossless unavailable"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			capabilities := CapabilitiesOf(tc.status)
+
+			assert.Equal(t, tc.want, capabilities)
+			assert.Equal(t, tc.warning, capabilities.Warning())
+		})
+	}
+}
+
+func TestPickBestBitratePrefersFullTracksOverPreviews(t *testing.T) {
+	best := pickBestBitrate([]model.DownloadInfo{
+		{BitrateInKbps: 320, Preview: true},
+		{BitrateInKbps: 192},
+	})
+
+	assert.Equal(t, model.DownloadInfo{BitrateInKbps: 192}, best)
+}
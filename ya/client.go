@@ -2,6 +2,7 @@ package ya
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
@@ -14,6 +15,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 	"ya-music/utils"
 	"ya-music/ya/lossless"
 	"ya-music/ya/model"
@@ -21,8 +23,9 @@ import (
 
 // Constants for API endpoints and configuration
 const (
-	baseURL  = "https://api.music.yandex.net"
-	signSalt = "XGRlBW9FXlekgbPrRHuSiA"
+	// DefaultBaseURL is the Yandex Music API used unless SetBaseURL is called.
+	DefaultBaseURL = "https://api.music.yandex.net"
+	signSalt       = "XGRlBW9FXlekgbPrRHuSiA"
 )
 
 // Audio quality constants
@@ -42,8 +45,8 @@ const (
 var ErrTrackAlreadyExists = errors.New("track file already exists")
 
 type losslessTrackDownloader interface {
-	GetDownloadInfo(reqCtx utils.RequestLogContext, trackID string, userUID int) (lossless.DownloadInfo, error)
-	DownloadAudio(reqCtx utils.RequestLogContext, info lossless.DownloadInfo) ([]byte, error)
+	GetDownloadInfoContext(ctx context.Context, reqCtx utils.RequestLogContext, trackID string, userUID int) (lossless.DownloadInfo, error)
+	DownloadAudioContext(ctx context.Context, reqCtx utils.RequestLogContext, info lossless.DownloadInfo) ([]byte, error)
 }
 
 type m4aTagger interface {
@@ -60,6 +63,7 @@ type trackDownloadFunc func(track model.Track, outputDir string, options Downloa
 
 type YaClient interface {
 	TrackInfo(id string) (*model.Track, error)
+	TracksByIDs(ids []string) ([]model.Track, error)
 	AlbumWithTracks(id string) (*model.Album, error)
 	UsersPlaylist(id string, username string) (*model.Playlist, error)
 	PlaylistByUUID(id string) (*model.Playlist, error)
@@ -79,6 +83,7 @@ type Client struct {
 	m4aTagger          m4aTagger
 	userUID            int
 	username           string
+	baseURL            string
 }
 
 func NewClient(httpClient *utils.HttpClient) *Client {
@@ -93,8 +98,28 @@ func NewClient(httpClient *utils.HttpClient) *Client {
 	}
 }
 
+// SetToken switches the client to another account. The cached user ID and
+// login belong to the previous token and are fetched again when needed.
 func (c *Client) SetToken(token string) {
 	c.httpClient.SetToken(token)
+	c.userUID = 0
+	c.username = ""
+}
+
+// SetBaseURL sends API requests, including lossless file info, to baseURL
+// instead of DefaultBaseURL, for example to a local fake server.
+func (c *Client) SetBaseURL(baseURL string) {
+	c.baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	if downloader, ok := c.losslessDownloader.(interface{ SetBaseURL(string) }); ok {
+		downloader.SetBaseURL(c.baseURL)
+	}
+}
+
+func (c *Client) apiURL() string {
+	if c == nil || c.baseURL == "" {
+		return DefaultBaseURL
+	}
+	return c.baseURL
 }
 
 func (c *Client) Logger() *utils.DownloadLogger {
@@ -128,10 +153,37 @@ func (c *Client) ResetCancel() {
 	c.httpClient.ResetCancel()
 }
 
+// cancelContext is cancelled together with in-flight requests by Cancel. The
+// methods without a context argument use it.
+func (c *Client) cancelContext() context.Context {
+	if c == nil || c.httpClient == nil {
+		return context.Background()
+	}
+
+	return c.httpClient.Context()
+}
+
 func (c *Client) AccountStatus() (*model.Account, error) {
-	endpoint := fmt.Sprintf("%s/account/status", baseURL)
+	return c.AccountStatusContext(c.cancelContext())
+}
+
+func (c *Client) AccountStatusContext(ctx context.Context) (*model.Account, error) {
+	status, err := c.StatusContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &status.Account, nil
+}
+
+// Status returns the account of the token together with its subscription.
+func (c *Client) Status() (*model.Status, error) {
+	return c.StatusContext(c.cancelContext())
+}
+
+func (c *Client) StatusContext(ctx context.Context) (*model.Status, error) {
+	endpoint := fmt.Sprintf("%s/account/status", c.apiURL())
 
-	res, err := c.httpClient.Get(endpoint)
+	res, err := c.httpClient.GetContext(ctx, utils.RequestLogContext{}, endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account status: %w", err)
 	}
@@ -146,13 +198,17 @@ func (c *Client) AccountStatus() (*model.Account, error) {
 		c.username = data.Result.Account.Login
 	}
 
-	return &data.Result.Account, nil
+	return &data.Result, nil
 }
 
 func (c *Client) TrackInfo(id string) (*model.Track, error) {
-	url := fmt.Sprintf("%s/tracks/%s", baseURL, id)
+	return c.TrackInfoContext(c.cancelContext(), id)
+}
+
+func (c *Client) TrackInfoContext(ctx context.Context, id string) (*model.Track, error) {
+	url := fmt.Sprintf("%s/tracks/%s", c.apiURL(), id)
 
-	if res, err := c.httpClient.Get(url); err != nil {
+	if res, err := c.httpClient.GetContext(ctx, utils.RequestLogContext{}, url); err != nil {
 		return nil, err
 	} else {
 		var data model.TracksResponse
@@ -170,9 +226,13 @@ func (c *Client) TrackInfo(id string) (*model.Track, error) {
 }
 
 func (c *Client) AlbumWithTracks(id string) (*model.Album, error) {
-	url := fmt.Sprintf("%s/albums/%s/with-tracks", baseURL, id)
+	return c.AlbumWithTracksContext(c.cancelContext(), id)
+}
 
-	if res, err := c.httpClient.Get(url); err != nil {
+func (c *Client) AlbumWithTracksContext(ctx context.Context, id string) (*model.Album, error) {
+	url := fmt.Sprintf("%s/albums/%s/with-tracks", c.apiURL(), id)
+
+	if res, err := c.httpClient.GetContext(ctx, utils.RequestLogContext{}, url); err != nil {
 		return nil, err
 	} else {
 		var data model.AlbumResponse
@@ -190,20 +250,32 @@ func (c *Client) AlbumWithTracks(id string) (*model.Album, error) {
 }
 
 func (c *Client) UsersPlaylist(id string, username string) (*model.Playlist, error) {
-	return c.fetchPlaylist(fmt.Sprintf("%s/users/%s/playlists/%s", baseURL, username, id))
+	return c.UsersPlaylistContext(c.cancelContext(), id, username)
+}
+
+func (c *Client) UsersPlaylistContext(ctx context.Context, id string, username string) (*model.Playlist, error) {
+	return c.fetchPlaylist(ctx, fmt.Sprintf("%s/users/%s/playlists/%s", c.apiURL(), username, id))
 }
 
 func (c *Client) PlaylistByUUID(id string) (*model.Playlist, error) {
-	return c.fetchPlaylist(fmt.Sprintf("%s/playlist/%s", baseURL, id))
+	return c.PlaylistByUUIDContext(c.cancelContext(), id)
+}
+
+func (c *Client) PlaylistByUUIDContext(ctx context.Context, id string) (*model.Playlist, error) {
+	return c.fetchPlaylist(ctx, fmt.Sprintf("%s/playlist/%s", c.apiURL(), id))
 }
 
 func (c *Client) Chart(region string) (*model.Playlist, error) {
-	url := fmt.Sprintf("%s/landing3/chart", baseURL)
+	return c.ChartContext(c.cancelContext(), region)
+}
+
+func (c *Client) ChartContext(ctx context.Context, region string) (*model.Playlist, error) {
+	url := fmt.Sprintf("%s/landing3/chart", c.apiURL())
 	if region != "" {
 		url = fmt.Sprintf("%s/%s", url, region)
 	}
 
-	res, err := c.httpClient.Get(url)
+	res, err := c.httpClient.GetContext(ctx, utils.RequestLogContext{}, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chart: %w", err)
 	}
@@ -217,22 +289,10 @@ func (c *Client) Chart(region string) (*model.Playlist, error) {
 		return nil, fmt.Errorf("chart not found")
 	}
 
-	return data.Result.Chart, nil
-}
-
-func (c *Client) fetchPlaylist(url string) (*model.Playlist, error) {
-	if res, err := c.httpClient.Get(url); err != nil {
+	if err := c.completePlaylistTracks(ctx, data.Result.Chart); err != nil {
 		return nil, err
-	} else {
-		var data model.PlaylistResponse
-
-		err = parseResponse(res, &data)
-		if err != nil {
-			return nil, err
-		}
-
-		return &data.Result, nil
 	}
+	return data.Result.Chart, nil
 }
 
 func (c *Client) UsersPlaylists(ids string) ([]model.Playlist, error) {
@@ -247,7 +307,7 @@ func (c *Client) UsersPlaylists(ids string) ([]model.Playlist, error) {
 	params := url.Values{}
 	params.Add("kinds", ids)
 
-	url := fmt.Sprintf("%s/users/%d/playlists?%s", baseURL, c.userUID, params.Encode())
+	url := fmt.Sprintf("%s/users/%d/playlists?%s", c.apiURL(), c.userUID, params.Encode())
 
 	res, err := c.httpClient.Post(url, nil)
 	if err != nil {
@@ -264,13 +324,13 @@ func (c *Client) UsersPlaylists(ids string) ([]model.Playlist, error) {
 }
 
 func (c *Client) TracksDownloadInfo(trackId string) ([]model.DownloadInfo, error) {
-	return c.tracksDownloadInfo(utils.RequestLogContext{}, trackId)
+	return c.tracksDownloadInfo(c.cancelContext(), utils.RequestLogContext{}, trackId)
 }
 
-func (c *Client) tracksDownloadInfo(reqCtx utils.RequestLogContext, trackId string) ([]model.DownloadInfo, error) {
-	url := fmt.Sprintf("%s/tracks/%s/download-info", baseURL, trackId)
+func (c *Client) tracksDownloadInfo(ctx context.Context, reqCtx utils.RequestLogContext, trackId string) ([]model.DownloadInfo, error) {
+	url := fmt.Sprintf("%s/tracks/%s/download-info", c.apiURL(), trackId)
 
-	res, err := c.httpClient.GetWithContext(reqCtx, url)
+	res, err := c.httpClient.GetContext(ctx, reqCtx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -292,11 +352,11 @@ func (c *Client) tracksDownloadInfo(reqCtx utils.RequestLogContext, trackId stri
 }
 
 func (c *Client) TrackDownloadLink(url string) (string, error) {
-	return c.trackDownloadLink(utils.RequestLogContext{}, url)
+	return c.trackDownloadLink(c.cancelContext(), utils.RequestLogContext{}, url)
 }
 
-func (c *Client) trackDownloadLink(reqCtx utils.RequestLogContext, url string) (string, error) {
-	res, err := c.httpClient.GetWithContext(reqCtx, url)
+func (c *Client) trackDownloadLink(ctx context.Context, reqCtx utils.RequestLogContext, url string) (string, error) {
+	res, err := c.httpClient.GetContext(ctx, reqCtx, url)
 	if err != nil {
 		return "", err
 	}
@@ -323,9 +383,38 @@ func (c *Client) DownloadTrack(track model.Track, outputDir string) (string, err
 }
 
 func (c *Client) DownloadTrackWithOptions(track model.Track, outputDir string, options DownloadOptions) (string, error) {
+	return c.DownloadTrackWithOptionsContext(c.cancelContext(), track, outputDir, options)
+}
+
+// DownloadTrackWithOptionsContext downloads track until ctx is done. Unlike
+// DownloadTrackWithOptions, it is not stopped by Cancel, so callers can stop
+// a single track.
+func (c *Client) DownloadTrackWithOptionsContext(ctx context.Context, track model.Track, outputDir string, options DownloadOptions) (string, error) {
+	if target, ok := transcodeTarget(track, outputDir, options); ok {
+		exists, err := utils.FileExists(target)
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect destination file: %w", err)
+		}
+		if exists {
+			c.logTrack(slog.LevelInfo, utils.NewTrackLogContext(track), "skipped",
+				"stage", "precheck",
+				"reason", "already_exists",
+				"filename", target,
+				"profile", options.Transcode.Name,
+			)
+			return target, fmt.Errorf("%w: %s", ErrTrackAlreadyExists, target)
+		}
+	}
+
+	if options.Upgrade {
+		if filename, handled, err := c.upgradeExistingMP3(ctx, track, outputDir, options); handled {
+			return filename, err
+		}
+	}
+
 	if options.FormatOrDefault() == AudioFormatFLAC {
-		filename, err := c.downloadTrackLossless(track, outputDir, options)
-		if err == nil || errors.Is(err, ErrTrackAlreadyExists) {
+		filename, err := c.downloadTrackLossless(ctx, track, outputDir, options)
+		if err == nil || errors.Is(err, ErrTrackAlreadyExists) || errors.Is(err, errTranscodeFailed) {
 			return filename, err
 		}
 
@@ -335,10 +424,10 @@ func (c *Client) DownloadTrackWithOptions(track model.Track, outputDir string, o
 		)
 	}
 
-	return c.downloadTrackMP3(track, outputDir, options)
+	return c.downloadTrackMP3(ctx, track, outputDir, options)
 }
 
-func (c *Client) downloadTrackMP3(track model.Track, outputDir string, options DownloadOptions) (string, error) {
+func (c *Client) downloadTrackMP3(ctx context.Context, track model.Track, outputDir string, options DownloadOptions) (string, error) {
 	if c.mp3Downloader != nil {
 		return c.mp3Downloader(track, outputDir, options)
 	}
@@ -357,7 +446,7 @@ func (c *Client) downloadTrackMP3(track model.Track, outputDir string, options D
 		c.logTrackFailure(trackCtx, "precheck", err,
 			"filename", filename,
 		)
-		return "", fmt.Errorf("failed to inspect destination file: %w", err)
+		return "", withStage("precheck", fmt.Errorf("failed to inspect destination file: %w", err))
 	}
 
 	if exists {
@@ -369,10 +458,10 @@ func (c *Client) downloadTrackMP3(track model.Track, outputDir string, options D
 		return filename, fmt.Errorf("%w: %s", ErrTrackAlreadyExists, filename)
 	}
 
-	info, err := c.tracksDownloadInfo(c.requestContext(trackCtx, "download_info", "fetch_download_info"), track.ID.String())
+	info, err := c.tracksDownloadInfo(ctx, c.requestContext(trackCtx, "download_info", "fetch_download_info"), track.ID.String())
 	if err != nil {
 		c.logTrackFailure(trackCtx, "download_info", err)
-		return "", fmt.Errorf("failed to get download info: %w", err)
+		return "", withStage("download_info", fmt.Errorf("failed to get download info: %w", err))
 	}
 
 	bestBitrate := pickBestBitrate(info)
@@ -381,7 +470,15 @@ func (c *Client) downloadTrackMP3(track model.Track, outputDir string, options D
 			"stage", "select_bitrate",
 			"reason", "no_download_options",
 		)
-		return "", fmt.Errorf("no download options available")
+		return "", withStage("select_bitrate", fmt.Errorf("no download options available"))
+	}
+	if bestBitrate.Preview {
+		c.logTrack(slog.LevelError, trackCtx, "failed",
+			"stage", "select_bitrate",
+			"reason", "preview_only",
+			"bitrate_kbps", bestBitrate.BitrateInKbps,
+		)
+		return "", withStage("select_bitrate", fmt.Errorf("%w: only a 30-second preview is available", ErrSubscriptionRequired))
 	}
 
 	c.logTrack(slog.LevelInfo, trackCtx, "download option selected",
@@ -391,13 +488,14 @@ func (c *Client) downloadTrackMP3(track model.Track, outputDir string, options D
 		"download_info_url", utils.SanitizeURL(bestBitrate.DownloadInfoURL),
 	)
 
-	link, err := c.trackDownloadLink(c.requestContext(trackCtx, "download_link", "fetch_direct_link"), bestBitrate.DownloadInfoURL)
+	link, err := c.trackDownloadLink(ctx, c.requestContext(trackCtx, "download_link", "fetch_direct_link"), bestBitrate.DownloadInfoURL)
 	if err != nil {
 		c.logTrackFailure(trackCtx, "download_link", err)
-		return "", fmt.Errorf("failed to get download link: %w", err)
+		return "", withStage("download_link", fmt.Errorf("failed to get download link: %w", err))
 	}
 
 	result, err := c.publishAudioArtifact(
+		ctx,
 		track,
 		filename,
 		options,
@@ -421,11 +519,9 @@ func (c *Client) downloadTrackMP3(track model.Track, outputDir string, options D
 				err = errors.Join(err, closeErr)
 			}()
 
-			written, err = c.httpClient.DownloadToWriterWithContext(
-				c.requestContext(trackCtx, "download_file", "download_mp3"),
-				link,
-				file,
-			)
+			reqCtx := c.requestContext(trackCtx, "download_file", "download_mp3")
+			reqCtx.Progress = options.Progress
+			written, err = c.httpClient.DownloadToWriterContext(ctx, reqCtx, link, file)
 			return err
 		},
 	)
@@ -435,7 +531,7 @@ func (c *Client) downloadTrackMP3(track model.Track, outputDir string, options D
 	return result.Filename, nil
 }
 
-func (c *Client) downloadTrackLossless(track model.Track, outputDir string, options DownloadOptions) (string, error) {
+func (c *Client) downloadTrackLossless(ctx context.Context, track model.Track, outputDir string, options DownloadOptions) (string, error) {
 	trackCtx := utils.NewTrackLogContext(track)
 	c.logTrack(slog.LevelInfo, trackCtx, "download started",
 		"stage", "start",
@@ -444,19 +540,19 @@ func (c *Client) downloadTrackLossless(track model.Track, outputDir string, opti
 	)
 
 	if c.userUID == 0 {
-		if _, err := c.AccountStatus(); err != nil {
+		if _, err := c.AccountStatusContext(ctx); err != nil {
 			c.logTrackFailure(trackCtx, "account_status", err)
-			return "", fmt.Errorf("failed to verify account status: %w", err)
+			return "", withStage("account_status", fmt.Errorf("failed to verify account status: %w", err))
 		}
 	}
 
-	info, err := c.losslessDownloader.GetDownloadInfo(c.requestContext(trackCtx, "lossless_info", "fetch_lossless_download_info"), track.ID.String(), c.userUID)
+	info, err := c.losslessDownloader.GetDownloadInfoContext(ctx, c.requestContext(trackCtx, "lossless_info", "fetch_lossless_download_info"), track.ID.String(), c.userUID)
 	if err != nil {
 		c.logTrackFailure(trackCtx, "lossless_info", err)
-		return "", fmt.Errorf("failed to get lossless download info: %w", err)
+		return "", withStage("lossless_info", fmt.Errorf("failed to get lossless download info: %w", err))
 	}
 
-	filename := buildTrackFilenameWithExtension(track, outputDir, losslessExtensionForCodec(info.Codec), options.FilenameSuffix)
+	filename := buildTrackFilenameWithExtension(track, outputDir, losslessExtensionForCodec(info.Codec, options.LosslessContainer), options.FilenameSuffix)
 	c.logTrack(slog.LevelInfo, trackCtx, "lossless target resolved",
 		"stage", "resolve_lossless_target",
 		"filename", filename,
@@ -468,7 +564,7 @@ func (c *Client) downloadTrackLossless(track model.Track, outputDir string, opti
 		c.logTrackFailure(trackCtx, "precheck", err,
 			"filename", filename,
 		)
-		return "", fmt.Errorf("failed to inspect destination file: %w", err)
+		return "", withStage("precheck", fmt.Errorf("failed to inspect destination file: %w", err))
 	}
 	if exists {
 		c.logTrack(slog.LevelInfo, trackCtx, "skipped",
@@ -487,12 +583,14 @@ func (c *Client) downloadTrackLossless(track model.Track, outputDir string, opti
 		"quality", info.Quality,
 	)
 
-	data, err := c.losslessDownloader.DownloadAudio(c.requestContext(trackCtx, "lossless_download", "download_lossless_audio"), info)
+	reqCtx := c.requestContext(trackCtx, "lossless_download", "download_lossless_audio")
+	reqCtx.Progress = options.Progress
+	data, err := c.losslessDownloader.DownloadAudioContext(ctx, reqCtx, info)
 	if err != nil {
 		c.logTrackFailure(trackCtx, "lossless_download", err,
 			"codec", info.Codec,
 		)
-		return "", fmt.Errorf("failed to download lossless audio: %w", err)
+		return "", withStage("lossless_download", fmt.Errorf("failed to download lossless audio: %w", err))
 	}
 
 	var spec artifactSpec
@@ -503,20 +601,52 @@ func (c *Client) downloadTrackLossless(track model.Track, outputDir string, opti
 			c.logTrackFailure(trackCtx, "lossless_download", err,
 				"codec", info.Codec,
 			)
-			return "", err
+			return "", withStage("lossless_download", err)
 		}
 		spec = flacArtifactSpec()
 	case "flac-mp4":
-		spec = c.m4aArtifactSpec()
+		if options.LosslessContainer != LosslessContainerFLAC {
+			spec = c.m4aArtifactSpec()
+			break
+		}
+		remuxed, err := remuxFLACFromMP4(data)
+		if err != nil {
+			// The lossless stream is already downloaded; keep it as .m4a
+			// rather than falling back to MP3.
+			c.logTrack(slog.LevelWarn, trackCtx, "remux failed, keeping m4a",
+				"stage", "lossless_remux",
+				"codec", info.Codec,
+				"error", err,
+			)
+			filename = buildTrackFilenameWithExtension(track, outputDir, ".m4a", options.FilenameSuffix)
+			if exists, err := utils.FileExists(filename); err != nil {
+				c.logTrackFailure(trackCtx, "precheck", err,
+					"filename", filename,
+				)
+				return "", withStage("precheck", fmt.Errorf("failed to inspect destination file: %w", err))
+			} else if exists {
+				return filename, fmt.Errorf("%w: %s", ErrTrackAlreadyExists, filename)
+			}
+			spec = c.m4aArtifactSpec()
+			break
+		}
+		c.logTrack(slog.LevelInfo, trackCtx, "remuxed flac-mp4 to FLAC",
+			"stage", "lossless_remux",
+			"mp4_bytes", len(data),
+			"flac_bytes", len(remuxed),
+		)
+		data = remuxed
+		spec = flacArtifactSpec()
 	default:
 		err := fmt.Errorf("%w: codec %q", lossless.ErrNoFLACDownloadInfo, info.Codec)
 		c.logTrackFailure(trackCtx, "lossless_download", err,
 			"codec", info.Codec,
 		)
-		return "", err
+		return "", withStage("lossless_download", err)
 	}
 
 	result, err := c.publishAudioArtifact(
+		ctx,
 		track,
 		filename,
 		options,
@@ -567,6 +697,9 @@ func TrackFilenameKey(track model.Track) string {
 }
 
 func trackFilenameBase(track model.Track) string {
+	if name := episodeFilenameBase(track); name != "" {
+		return name
+	}
 	artist := strings.TrimSpace(track.ArtistsString())
 	title := strings.TrimSpace(track.FullTitle())
 
@@ -582,6 +715,31 @@ func trackFilenameBase(track model.Track) string {
 	}
 }
 
+// episodeFilenameBase names podcast episodes "Show - 2024-03-01 - 012 -
+// Title" and audiobook chapters "Book - 003 - Title" so files list in order.
+// It returns "" for music.
+func episodeFilenameBase(track model.Track) string {
+	podcast := track.IsPodcastEpisode()
+	if !podcast && !track.IsAudiobookChapter() {
+		return ""
+	}
+	title := strings.TrimSpace(track.FullTitle())
+	if title == "" {
+		return ""
+	}
+	var parts []string
+	if album := firstAlbum(track); album != nil && strings.TrimSpace(album.Title) != "" {
+		parts = append(parts, strings.TrimSpace(album.Title))
+	}
+	if published, ok := track.Published(); ok && podcast {
+		parts = append(parts, published.UTC().Format(time.DateOnly))
+	}
+	if album := firstAlbum(track); album != nil && album.TrackPosition.Index > 0 {
+		parts = append(parts, fmt.Sprintf("%03d", album.TrackPosition.Index))
+	}
+	return strings.Join(append(parts, title), " - ")
+}
+
 func parseResponse(responseBody []byte, response interface{}) error {
 	err := json.Unmarshal(responseBody, &response)
 	if err != nil {
@@ -606,16 +764,23 @@ func pickBestBitrate(info []model.DownloadInfo) model.DownloadInfo {
 		return model.DownloadInfo{}
 	}
 
+	// Full tracks always win over 30-second previews, whatever the bitrate.
 	sort.Slice(info, func(i, j int) bool {
+		if info[i].Preview != info[j].Preview {
+			return !info[i].Preview
+		}
 		return info[i].BitrateInKbps > info[j].BitrateInKbps
 	})
 
 	return info[0]
 }
 
-func losslessExtensionForCodec(codec string) string {
+func losslessExtensionForCodec(codec string, container LosslessContainer) string {
 	switch strings.ToLower(strings.TrimSpace(codec)) {
 	case "flac-mp4":
+		if container == LosslessContainerFLAC {
+			return ".flac"
+		}
 		return ".m4a"
 	default:
 		return ".flac"
@@ -2,6 +2,7 @@ package ya
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
@@ -35,7 +36,7 @@ type fakeLosslessDownloader struct {
 	userID        int
 }
 
-func (f *fakeLosslessDownloader) GetDownloadInfo(_ utils.RequestLogContext, _ string, userUID int) (lossless.DownloadInfo, error) {
+func (f *fakeLosslessDownloader) GetDownloadInfoContext(_ context.Context, _ utils.RequestLogContext, _ string, userUID int) (lossless.DownloadInfo, error) {
 	f.infoCalls++
 	f.userID = userUID
 	if f.infoErr != nil {
@@ -44,7 +45,7 @@ func (f *fakeLosslessDownloader) GetDownloadInfo(_ utils.RequestLogContext, _ st
 	return f.info, nil
 }
 
-func (f *fakeLosslessDownloader) DownloadAudio(_ utils.RequestLogContext, info lossless.DownloadInfo) ([]byte, error) {
+func (f *fakeLosslessDownloader) DownloadAudioContext(_ context.Context, _ utils.RequestLogContext, info lossless.DownloadInfo) ([]byte, error) {
 	f.downloadCalls++
 	f.info = info
 	if f.downloadErr != nil {
@@ -423,7 +424,7 @@ func TestDownloadTrackWithOptionsRejectsInvalidFLACMagic(t *testing.T) {
 	}
 
 	destination := buildTrackFilenameWithExtension(track, outputDir, ".flac", "")
-	filename, err := client.downloadTrackLossless(track, outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
+	filename, err := client.downloadTrackLossless(context.Background(), track, outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "lossless response is not a flac stream")
@@ -449,7 +450,7 @@ func TestDownloadTrackWithOptionsRejectsUnknownLosslessCodec(t *testing.T) {
 	}
 
 	destination := buildTrackFilenameWithExtension(track, outputDir, ".flac", "")
-	filename, err := client.downloadTrackLossless(track, outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
+	filename, err := client.downloadTrackLossless(context.Background(), track, outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
 
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, lossless.ErrNoFLACDownloadInfo)
@@ -476,7 +477,7 @@ func TestDownloadTrackWithOptionsReturnsFLACTagErrorWithoutDestination(t *testin
 	}
 
 	destination := buildTrackFilenameWithExtension(track, outputDir, ".flac", "")
-	filename, err := client.downloadTrackLossless(track, outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
+	filename, err := client.downloadTrackLossless(context.Background(), track, outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
 
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "failed to write flac tags")
@@ -707,6 +708,39 @@ func TestDownloadTrackMP3ReturnsTaggerErrorWithoutPartialDestination(t *testing.
 	assertNoArtifactTempFiles(t, outputDir)
 }
 
+func TestDownloadTrackWithOptionsContextStopsWhenContextIsCancelled(t *testing.T) {
+	outputDir := t.TempDir()
+	track := model.Track{ID: model.FlexibleID("42"), Title: "Song", Available: true}
+	ts := newMP3TestServer(t, mp3TestServerConfig{trackID: "42"})
+	client := newMP3TestClient(t, ts)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := client.DownloadTrackWithOptionsContext(ctx, track, outputDir, DownloadOptions{SkipCover: true})
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "download_info", FailureStage(err))
+	assert.Empty(t, ts.requests)
+}
+
+func TestContextMethodsIgnoreClientCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":[{"id":"7","title":"Song"}]}`))
+	}))
+	defer server.Close()
+	httpClient := utils.NewHttpClient()
+	httpClient.SetTransport(&hostRewriteTransport{targetHost: server.Listener.Addr().String()})
+	client := NewClient(httpClient)
+	client.Cancel()
+
+	_, err := client.TrackInfo("7")
+	require.ErrorIs(t, err, context.Canceled)
+
+	track, err := client.TrackInfoContext(context.Background(), "7")
+	require.NoError(t, err)
+	assert.Equal(t, "Song", track.Title)
+}
+
 func TestBuildTrackFilenameUsesCanonicalArtistTrackPattern(t *testing.T) {
 	outputDir := t.TempDir()
 	track := model.Track{
@@ -749,6 +783,48 @@ func TestTrackFilenameBaseFallsBackWhenArtistIsMissing(t *testing.T) {
 	assert.Equal(t, "Track Name", trackFilenameBase(track))
 }
 
+func TestTrackFilenameBaseNamesEpisodesByDateAndNumber(t *testing.T) {
+	episode := model.Track{
+		ID:      model.FlexibleID("1"),
+		Title:   "Pilot",
+		Artists: []model.Artist{{Name: "Host"}},
+		PubDate: "2024-03-01T06:00:00+03:00",
+		Albums: []model.Album{{
+			Title:         "Show",
+			Type:          model.AlbumTypePodcast,
+			TrackPosition: model.TrackPosition{Index: 12},
+		}},
+	}
+	chapter := model.Track{
+		ID:      model.FlexibleID("2"),
+		Title:   "Chapter One",
+		PubDate: "2024-03-01T06:00:00+03:00",
+		Albums: []model.Album{{
+			Title:         "Book",
+			MetaType:      model.AlbumTypeAudiobook,
+			TrackPosition: model.TrackPosition{Index: 3},
+		}},
+	}
+
+	assert.Equal(t, "Show - 2024-03-01 - 012 - Pilot", trackFilenameBase(episode))
+	assert.Equal(t, "Book - 003 - Chapter One", trackFilenameBase(chapter))
+}
+
+func TestTrackFilenameBaseDatesEpisodesInUTC(t *testing.T) {
+	episode := model.Track{
+		ID:      model.FlexibleID("1"),
+		Title:   "Late",
+		PubDate: "2024-03-01T22:30:00-05:00",
+		Albums: []model.Album{{
+			Title:         "Show",
+			Type:          model.AlbumTypePodcast,
+			TrackPosition: model.TrackPosition{Index: 13},
+		}},
+	}
+
+	assert.Equal(t, "Show - 2024-03-02 - 013 - Late", trackFilenameBase(episode))
+}
+
 func copyFixture(t *testing.T, name string) string {
 	t.Helper()
 
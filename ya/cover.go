@@ -1,6 +1,7 @@
 package ya
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -17,7 +18,7 @@ type coverDownloadResult struct {
 	err      error
 }
 
-func (c *Client) startCoverDownload(track model.Track, audioFilename string, options DownloadOptions) <-chan coverDownloadResult {
+func (c *Client) startCoverDownload(ctx context.Context, track model.Track, audioFilename string, options DownloadOptions) <-chan coverDownloadResult {
 	ch := make(chan coverDownloadResult, 1)
 	trackCtx := utils.NewTrackLogContext(track)
 
@@ -59,7 +60,8 @@ func (c *Client) startCoverDownload(track model.Track, audioFilename string, opt
 			)
 		}
 
-		err := c.httpClient.DownloadFileWithContext(
+		err := c.httpClient.DownloadFileContext(
+			ctx,
 			c.requestContext(trackCtx, "download_cover", "download_cover"),
 			coverURL,
 			coverPath,
@@ -1,6 +1,7 @@
 package ya
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -56,7 +57,7 @@ func TestDownloadCoverFailureIsReturnedForCallerToIgnore(t *testing.T) {
 		CoverURI: server.URL + "/%%",
 	}
 
-	ch := client.startCoverDownload(track, filepath.Join(t.TempDir(), "track.mp3"), DownloadOptions{})
+	ch := client.startCoverDownload(context.Background(), track, filepath.Join(t.TempDir(), "track.mp3"), DownloadOptions{})
 	result := <-ch
 
 	assert.Empty(t, result.filename)
@@ -81,7 +82,7 @@ func TestDownloadCoverReplacesStaleCoverFile(t *testing.T) {
 		CoverURI: server.URL + "/%%",
 	}
 
-	ch := client.startCoverDownload(track, audioPath, DownloadOptions{})
+	ch := client.startCoverDownload(context.Background(), track, audioPath, DownloadOptions{})
 	result := <-ch
 
 	require.NoError(t, result.err)
@@ -99,7 +100,7 @@ func TestDownloadCoverSkipReturnsNoError(t *testing.T) {
 		CoverURI: "https://example.test/%%",
 	}
 
-	ch := client.startCoverDownload(track, filepath.Join(t.TempDir(), "track.mp3"), DownloadOptions{SkipCover: true})
+	ch := client.startCoverDownload(context.Background(), track, filepath.Join(t.TempDir(), "track.mp3"), DownloadOptions{SkipCover: true})
 	result := <-ch
 
 	assert.Empty(t, result.filename)
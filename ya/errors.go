@@ -0,0 +1,150 @@
+package ya
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"ya-music/utils"
+	"ya-music/ya/model"
+)
+
+// Failure classes of Client errors. Classify maps any error to one of them;
+// errors returned by DownloadTrackWithOptions also match them with errors.Is.
+var (
+	ErrAuthExpired          = errors.New("authorization expired")
+	ErrSubscriptionRequired = errors.New("subscription required")
+	ErrRegionBlocked        = errors.New("not available in this region")
+	ErrRateLimited          = errors.New("rate limited")
+	ErrNotFound             = errors.New("not found")
+	ErrNetwork              = errors.New("network error")
+	ErrDiskFull             = errors.New("disk full")
+	ErrTagWrite             = errors.New("tag write failed")
+)
+
+var errorKinds = []struct {
+	err  error
+	name string
+	hint string
+}{
+	{ErrAuthExpired, "auth_expired", "the token is invalid or expired; get a new token and try again"},
+	{ErrSubscriptionRequired, "subscription_required", "this track needs an active Yandex Music Plus subscription"},
+	{ErrRegionBlocked, "region_blocked", "this track is not available in your account's region"},
+	{ErrRateLimited, "rate_limited", "Yandex Music is limiting requests; wait a few minutes and retry"},
+	{ErrNotFound, "not_found", "the track or link no longer exists"},
+	{ErrNetwork, "network", "check your internet connection and retry"},
+	{ErrDiskFull, "disk_full", "free up space in the output directory and retry"},
+	{ErrTagWrite, "tag_write", "tags could not be written; check that the output directory is writable"},
+}
+
+// Classify returns the sentinel error that describes err, or nil when the
+// cause is unknown. Cancellation is not classified.
+func Classify(err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return nil
+	}
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind.err) {
+			return kind.err
+		}
+	}
+
+	var apiErr *model.ErrorResponse
+	if errors.As(err, &apiErr) {
+		return classifyAPIError(apiErr)
+	}
+	var statusErr *utils.StatusError
+	if errors.As(err, &statusErr) {
+		return classifyStatus(statusErr.StatusCode)
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return ErrDiskFull
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrNetwork
+	}
+	return nil
+}
+
+// classifyAPIError maps error names of the Yandex Music API.
+func classifyAPIError(apiErr *model.ErrorResponse) error {
+	text := strings.ToLower(strings.Join([]string{
+		apiErr.APIError.Name,
+		apiErr.APIError.Message,
+		apiErr.ResultError.Name,
+		apiErr.ResultError.Message,
+	}, " "))
+	switch {
+	case strings.Contains(text, "session-expired"),
+		strings.Contains(text, "unauthorized"),
+		strings.Contains(text, "invalid-oauth-token"),
+		strings.Contains(text, "invalid_token"):
+		return ErrAuthExpired
+	case strings.Contains(text, "region"), strings.Contains(text, "geo"):
+		return ErrRegionBlocked
+	case strings.Contains(text, "not-allowed"),
+		strings.Contains(text, "no-rights"),
+		strings.Contains(text, "subscription"),
+		strings.Contains(text, "payment-required"):
+		return ErrSubscriptionRequired
+	case strings.Contains(text, "too-many-requests"),
+		strings.Contains(text, "rate-limit"),
+		strings.Contains(text, "captcha"):
+		return ErrRateLimited
+	case strings.Contains(text, "not-found"):
+		return ErrNotFound
+	default:
+		return nil
+	}
+}
+
+func classifyStatus(code int) error {
+	switch {
+	case code == http.StatusUnauthorized:
+		return ErrAuthExpired
+	case code == http.StatusPaymentRequired:
+		return ErrSubscriptionRequired
+	case code == http.StatusUnavailableForLegalReasons:
+		return ErrRegionBlocked
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code == http.StatusNotFound, code == http.StatusGone:
+		return ErrNotFound
+	case code >= http.StatusInternalServerError:
+		return ErrNetwork
+	default:
+		return nil
+	}
+}
+
+// ErrorKind returns a stable name for the class of err, such as
+// "auth_expired", or "" when the cause is unknown.
+func ErrorKind(err error) string {
+	kind := Classify(err)
+	for _, known := range errorKinds {
+		if known.err == kind {
+			return known.name
+		}
+	}
+	return ""
+}
+
+// ErrorHint suggests what the user can do about err, or "" when the cause is
+// unknown.
+func ErrorHint(err error) string {
+	kind := Classify(err)
+	for _, known := range errorKinds {
+		if known.err == kind {
+			return known.hint
+		}
+	}
+	return ""
+}
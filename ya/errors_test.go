@@ -0,0 +1,69 @@
+package ya
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"ya-music/utils"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func apiError(name, message string) *model.ErrorResponse {
+	var response model.ErrorResponse
+	response.APIError.Name = name
+	response.APIError.Message = message
+	return &response
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{apiError("session-expired", "Your OAuth token expired"), ErrAuthExpired},
+		{fmt.Errorf("failed to get account status: %w", apiError("unauthorized", "")), ErrAuthExpired},
+		{apiError("track-download-info-error", "not-allowed"), ErrSubscriptionRequired},
+		{apiError("not-available-in-region", ""), ErrRegionBlocked},
+		{apiError("too-many-requests", ""), ErrRateLimited},
+		{apiError("playlist-not-found", ""), ErrNotFound},
+		{apiError("validate", "bad id"), nil},
+		{&utils.StatusError{Op: "failed to download file", StatusCode: http.StatusNotFound}, ErrNotFound},
+		{&utils.StatusError{Op: "failed to download file", StatusCode: http.StatusTooManyRequests}, ErrRateLimited},
+		{&utils.StatusError{Op: "failed to download file", StatusCode: http.StatusBadGateway}, ErrNetwork},
+		{&utils.StatusError{Op: "failed to download file", StatusCode: http.StatusForbidden}, nil},
+		{fmt.Errorf("error writing to file: %w", &os.PathError{Op: "write", Path: "a", Err: syscall.ENOSPC}), ErrDiskFull},
+		{fmt.Errorf("failed to send request: %w", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}), ErrNetwork},
+		{fmt.Errorf("failed to send request: %w", context.DeadlineExceeded), ErrNetwork},
+		{fmt.Errorf("failed to send request: %w", context.Canceled), nil},
+		{errors.New("boom"), nil},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, Classify(test.err), "%v", test.err)
+	}
+}
+
+func TestWithStageClassifiesFailures(t *testing.T) {
+	err := withStage("download_info", apiError("session-expired", "expired"))
+
+	assert.ErrorIs(t, err, ErrAuthExpired)
+	assert.NotErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, "expired", err.Error())
+	assert.Equal(t, "auth_expired", ErrorKind(err))
+	assert.Contains(t, ErrorHint(err), "get a new token")
+
+	tagErr := withStage("flac_tags", errors.New("metaflac failed"))
+	assert.ErrorIs(t, tagErr, ErrTagWrite)
+	assert.Equal(t, "tag_write", ErrorKind(fmt.Errorf("publish: %w", tagErr)))
+
+	unknown := withStage("download_link", errors.New("boom"))
+	assert.Empty(t, ErrorKind(unknown))
+	assert.Empty(t, ErrorHint(unknown))
+}
@@ -0,0 +1,150 @@
+package ya
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"ya-music/internal/fakeapi"
+	"ya-music/source"
+	"ya-music/utils"
+	"ya-music/ya/model"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/go-flac/flacvorbis"
+	"github.com/go-flac/go-flac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeAPIClient(t *testing.T) (*fakeapi.Server, *Client) {
+	t.Helper()
+
+	server := fakeapi.New()
+	t.Cleanup(server.Close)
+	server.RequireToken("token")
+	server.AddTrack(fakeapi.Track{
+		Track: model.Track{
+			ID:        "1",
+			Title:     "First",
+			Available: true,
+			Artists:   []model.Artist{{Name: "Artist"}},
+			Albums:    []model.Album{{ID: "10", Title: "Album", TrackPosition: model.TrackPosition{Volume: 1, Index: 1}}},
+		},
+		Lossless: fakeapi.FLACFixture(),
+		Cover:    fakeapi.CoverFixture(),
+	})
+	server.AddTrack(fakeapi.Track{
+		Track: model.Track{
+			ID:        "2",
+			Title:     "Second",
+			Available: true,
+			Artists:   []model.Artist{{Name: "Artist"}},
+			Albums:    []model.Album{{ID: "10", Title: "Album", TrackPosition: model.TrackPosition{Volume: 1, Index: 2}}},
+		},
+	})
+	server.AddAlbum("10", "Album", "1", "2")
+
+	httpClient := utils.NewHttpClient()
+	httpClient.SetTransport(server.Transport())
+	client := NewClient(httpClient)
+	client.SetToken("token")
+	client.SetBaseURL(server.URL)
+	return server, client
+}
+
+func TestFakeAPIAlbumDownloadsTaggedMP3AndFLAC(t *testing.T) {
+	server, client := newFakeAPIClient(t)
+	outputDir := t.TempDir()
+
+	tracks, err := source.Resolve(client, "https://music.yandex.ru/album/10")
+	require.NoError(t, err)
+	require.Len(t, tracks, 2)
+
+	flacPath, err := client.DownloadTrackWithOptions(tracks[0], outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - First.flac"), flacPath)
+	file, err := flac.ParseFile(flacPath)
+	require.NoError(t, err)
+	var comments *flacvorbis.MetaDataBlockVorbisComment
+	var hasPicture bool
+	for _, block := range file.Meta {
+		switch block.Type {
+		case flac.VorbisComment:
+			comments, err = flacvorbis.ParseFromMetaDataBlock(*block)
+			require.NoError(t, err)
+		case flac.Picture:
+			hasPicture = true
+		}
+	}
+	require.NotNil(t, comments)
+	assertFLACComment(t, comments, "TITLE", "First")
+	assertFLACComment(t, comments, "ALBUM", "Album")
+	assert.True(t, hasPicture)
+
+	// The second track has no lossless version and falls back to MP3.
+	mp3Path, err := client.DownloadTrackWithOptions(tracks[1], outputDir, DownloadOptions{AudioFormat: AudioFormatFLAC})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Second.mp3"), mp3Path)
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tag.Close()
+	assert.Equal(t, "Second", tag.Title())
+	assert.Equal(t, "Album", tag.Album())
+
+	assert.Contains(t, server.Requests(), "GET /get-file-info")
+	assert.True(t, slices.ContainsFunc(server.Requests(), func(request string) bool {
+		return strings.HasPrefix(request, "GET /get-mp3/") && strings.HasSuffix(request, "/mp3/2")
+	}))
+	assertNoArtifactTempFiles(t, outputDir)
+}
+
+func TestFakeAPIRejectsWrongToken(t *testing.T) {
+	_, client := newFakeAPIClient(t)
+	client.SetToken("expired")
+
+	_, err := client.TrackInfo("1")
+
+	assert.ErrorIs(t, Classify(err), ErrAuthExpired)
+}
+
+func TestSetTokenForgetsCachedAccount(t *testing.T) {
+	server, client := newFakeAPIClient(t)
+	server.SetPlus(true)
+
+	status, err := client.Status()
+	require.NoError(t, err)
+	assert.True(t, status.Plus.HasPlus)
+	assert.Equal(t, 1, client.userUID)
+	assert.Equal(t, "fake", client.username)
+
+	client.SetToken("token")
+
+	assert.Zero(t, client.userUID)
+	assert.Empty(t, client.username)
+}
+
+func TestFakeAPIRefusesToSavePreviewAsFullTrack(t *testing.T) {
+	server, client := newFakeAPIClient(t)
+	server.AddTrack(fakeapi.Track{
+		Track: model.Track{
+			ID:        "3",
+			Title:     "Preview",
+			Available: true,
+			Artists:   []model.Artist{{Name: "Artist"}},
+		},
+		Preview: true,
+	})
+	outputDir := t.TempDir()
+	track, err := client.TrackInfo("3")
+	require.NoError(t, err)
+
+	_, err = client.DownloadTrack(*track, outputDir)
+
+	assert.ErrorIs(t, err, ErrSubscriptionRequired)
+	assert.ErrorContains(t, err, "30-second preview")
+	assert.False(t, slices.ContainsFunc(server.Requests(), func(request string) bool {
+		return strings.HasPrefix(request, "GET /get-mp3/")
+	}))
+	assert.NoFileExists(t, filepath.Join(outputDir, "Artist - Preview.mp3"))
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 	"ya-music/ya/model"
 
 	"github.com/go-flac/flacpicture"
@@ -13,7 +14,7 @@ import (
 	flac "github.com/go-flac/go-flac"
 )
 
-func writeFLACTags(filename string, track model.Track, coverPath string) error {
+func writeFLACTags(filename string, track model.Track, coverPath string, gain *replayGain) error {
 	file, err := flac.ParseFile(filename)
 	if err != nil {
 		return err
@@ -36,12 +37,27 @@ func writeFLACTags(filename string, track model.Track, coverPath string) error {
 	}
 
 	addFLACComment(comments, "DATE", trackYear(track))
+	if published, ok := track.Published(); ok {
+		addFLACComment(comments, "RELEASEDATE", published.UTC().Format(time.DateOnly))
+	}
+	addFLACComment(comments, "DESCRIPTION", track.ShortDescription)
+	if track.IsPodcastEpisode() {
+		addFLACComment(comments, "PODCAST", "1")
+	}
 	if trackID := strings.TrimSpace(track.ID.String()); trackID != "" {
 		addFLACComment(comments, "YANDEX_TRACK_ID", trackID)
 	}
 	if trackURL := yandexTrackURL(track); trackURL != "" {
 		addFLACComment(comments, "COMMENT", trackURL)
 	}
+	for _, identifier := range trackIdentifiers(track) {
+		for _, value := range identifier.Values {
+			addFLACComment(comments, identifier.Key, value)
+		}
+	}
+	for _, field := range gain.fields() {
+		addFLACComment(comments, field.Key, field.Value)
+	}
 
 	vorbisBlock := comments.Marshal()
 	metadata := make([]*flac.MetaDataBlock, 0, len(file.Meta)+2)
@@ -0,0 +1,582 @@
+package ya
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// FLAC metadata block header flags and types (RFC 9639, section 8.1).
+const (
+	flacLastMetadataBlock = 0x80
+	flacBlockTypeMask     = 0x7f
+	flacStreamInfoType    = 0
+	flacStreamInfoLength  = 34
+)
+
+// MP4 track fragment flags (ISO/IEC 14496-12, sections 8.8.7 and 8.8.8).
+const (
+	tfhdBaseDataOffset          = 0x000001
+	tfhdSampleDescription       = 0x000002
+	tfhdDefaultDuration         = 0x000008
+	tfhdDefaultSampleSize       = 0x000010
+	tfhdDefaultSampleFlags      = 0x000020
+	trunDataOffset              = 0x000001
+	trunFirstSampleFlags        = 0x000004
+	trunSampleDuration          = 0x000100
+	trunSampleSize              = 0x000200
+	trunSampleFlags             = 0x000400
+	trunSampleCompositionOffset = 0x000800
+)
+
+var errFLACMP4Remux = errors.New("flac-mp4 remux")
+
+type mp4FLACTrack struct {
+	id       uint32
+	metadata []byte
+	stbl     []byte
+	// defaultSampleSize comes from mvex/trex and applies to fragments.
+	defaultSampleSize uint32
+}
+
+type mp4SampleRange struct {
+	offset int64
+	size   int64
+}
+
+// remuxFLACFromMP4 converts FLAC-in-MP4 audio into a native FLAC stream. The
+// dfLa box supplies the FLAC metadata blocks, and the sample tables (or movie
+// fragments) locate the FLAC frames, which are copied unchanged.
+func remuxFLACFromMP4(data []byte) ([]byte, error) {
+	moov, ok, err := findMP4ChildAtom(data, "moov")
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse top-level atoms: %v", errFLACMP4Remux, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: MP4 file has no moov atom", errFLACMP4Remux)
+	}
+	track, err := findMP4FLACTrack(mp4AtomBody(data, moov))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errFLACMP4Remux, err)
+	}
+
+	samples, err := mp4SampleTableRanges(track.stbl, len(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errFLACMP4Remux, err)
+	}
+	if len(samples) == 0 {
+		samples, err = mp4FragmentRanges(data, track)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errFLACMP4Remux, err)
+		}
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%w: FLAC track has no samples", errFLACMP4Remux)
+	}
+
+	var audioSize int64
+	for _, sample := range samples {
+		if sample.offset < 0 || sample.size <= 0 || sample.offset > int64(len(data))-sample.size {
+			return nil, fmt.Errorf("%w: sample at offset %d is outside the file", errFLACMP4Remux, sample.offset)
+		}
+		audioSize += sample.size
+	}
+
+	stream := make([]byte, 0, 4+len(track.metadata)+int(audioSize))
+	stream = append(stream, "fLaC"...)
+	stream = append(stream, track.metadata...)
+	for _, sample := range samples {
+		stream = append(stream, data[sample.offset:sample.offset+sample.size]...)
+	}
+	first := stream[4+len(track.metadata):]
+	if len(first) < 2 || first[0] != 0xff || first[1]&0xfe != 0xf8 {
+		return nil, fmt.Errorf("%w: first sample is not a FLAC frame", errFLACMP4Remux)
+	}
+	return stream, nil
+}
+
+func mp4AtomBody(data []byte, atom m4aAtomLocation) []byte {
+	return data[atom.offset+atom.headerSize : atom.end]
+}
+
+// findMP4Path descends through nested container atoms, for example
+// mdia/minf/stbl.
+func findMP4Path(body []byte, path ...string) ([]byte, bool, error) {
+	for _, name := range path {
+		atom, ok, err := findMP4ChildAtom(body, name)
+		if err != nil || !ok {
+			return nil, ok, err
+		}
+		body = mp4AtomBody(body, atom)
+	}
+	return body, true, nil
+}
+
+func findMP4FLACTrack(moovBody []byte) (mp4FLACTrack, error) {
+	trexSizes, err := mp4TrexDefaultSizes(moovBody)
+	if err != nil {
+		return mp4FLACTrack{}, err
+	}
+
+	for offset := 0; offset < len(moovBody); {
+		atom, err := parseM4AAtom(moovBody, offset)
+		if err != nil {
+			return mp4FLACTrack{}, fmt.Errorf("parse moov: %w", err)
+		}
+		offset = atom.end
+		if atom.typ != "trak" {
+			continue
+		}
+
+		trak := mp4AtomBody(moovBody, atom)
+		stbl, ok, err := findMP4Path(trak, "mdia", "minf", "stbl")
+		if err != nil {
+			return mp4FLACTrack{}, fmt.Errorf("parse trak: %w", err)
+		}
+		if !ok {
+			continue
+		}
+		metadata, ok, err := mp4FLACMetadata(stbl)
+		if err != nil {
+			return mp4FLACTrack{}, err
+		}
+		if !ok {
+			continue
+		}
+		id, err := mp4TrackID(trak)
+		if err != nil {
+			return mp4FLACTrack{}, err
+		}
+		return mp4FLACTrack{id: id, metadata: metadata, stbl: stbl, defaultSampleSize: trexSizes[id]}, nil
+	}
+	return mp4FLACTrack{}, errors.New("MP4 file has no FLAC audio track")
+}
+
+func mp4TrackID(trak []byte) (uint32, error) {
+	tkhd, ok, err := findMP4ChildAtom(trak, "tkhd")
+	if err != nil {
+		return 0, fmt.Errorf("parse trak: %w", err)
+	}
+	if !ok {
+		return 0, errors.New("trak has no tkhd atom")
+	}
+	body := mp4AtomBody(trak, tkhd)
+	idOffset := 12
+	if len(body) > 0 && body[0] == 1 {
+		idOffset = 20
+	}
+	if len(body) < idOffset+4 {
+		return 0, errors.New("tkhd atom is too short")
+	}
+	return binary.BigEndian.Uint32(body[idOffset:]), nil
+}
+
+func mp4TrexDefaultSizes(moovBody []byte) (map[uint32]uint32, error) {
+	sizes := make(map[uint32]uint32)
+	mvex, ok, err := findMP4ChildAtom(moovBody, "mvex")
+	if err != nil || !ok {
+		return sizes, err
+	}
+	body := mp4AtomBody(moovBody, mvex)
+	for offset := 0; offset < len(body); {
+		atom, err := parseM4AAtom(body, offset)
+		if err != nil {
+			return nil, fmt.Errorf("parse mvex: %w", err)
+		}
+		offset = atom.end
+		if atom.typ != "trex" {
+			continue
+		}
+		trex := mp4AtomBody(body, atom)
+		if len(trex) < 24 {
+			return nil, errors.New("trex atom is too short")
+		}
+		sizes[binary.BigEndian.Uint32(trex[4:])] = binary.BigEndian.Uint32(trex[16:])
+	}
+	return sizes, nil
+}
+
+// mp4FLACMetadata returns the FLAC metadata blocks stored in the dfLa box of
+// an fLaC sample entry, with the last-block flag set only on the final block.
+func mp4FLACMetadata(stbl []byte) ([]byte, bool, error) {
+	stsd, ok, err := findMP4ChildAtom(stbl, "stsd")
+	if err != nil {
+		return nil, false, fmt.Errorf("parse stbl: %w", err)
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	body := mp4AtomBody(stbl, stsd)
+	if len(body) < 8 {
+		return nil, false, errors.New("stsd atom is too short")
+	}
+	entry, err := parseM4AAtom(body, 8)
+	if err != nil {
+		return nil, false, fmt.Errorf("parse stsd: %w", err)
+	}
+	if entry.typ != "fLaC" {
+		return nil, false, nil
+	}
+
+	// An audio sample entry has 28 bytes of fixed fields before its boxes.
+	entryBody := mp4AtomBody(body, entry)
+	if len(entryBody) < 28 {
+		return nil, false, errors.New("fLaC sample entry is too short")
+	}
+	dfLa, ok, err := findMP4ChildAtom(entryBody[28:], "dfLa")
+	if err != nil {
+		return nil, false, fmt.Errorf("parse fLaC sample entry: %w", err)
+	}
+	if !ok {
+		return nil, false, errors.New("fLaC sample entry has no dfLa box")
+	}
+	dfLaBody := mp4AtomBody(entryBody[28:], dfLa)
+	if len(dfLaBody) < 4 {
+		return nil, false, errors.New("dfLa box is too short")
+	}
+
+	metadata := append([]byte{}, dfLaBody[4:]...)
+	for offset, index := 0, 0; offset < len(metadata); index++ {
+		if len(metadata)-offset < 4 {
+			return nil, false, errors.New("truncated FLAC metadata block header")
+		}
+		blockType := metadata[offset] & flacBlockTypeMask
+		length := int(metadata[offset+1])<<16 | int(metadata[offset+2])<<8 | int(metadata[offset+3])
+		if index == 0 && (blockType != flacStreamInfoType || length != flacStreamInfoLength) {
+			return nil, false, errors.New("dfLa box does not start with STREAMINFO")
+		}
+		end := offset + 4 + length
+		if end > len(metadata) {
+			return nil, false, errors.New("truncated FLAC metadata block")
+		}
+		metadata[offset] = blockType
+		if end == len(metadata) {
+			metadata[offset] |= flacLastMetadataBlock
+		}
+		offset = end
+	}
+	if len(metadata) == 0 {
+		return nil, false, errors.New("dfLa box has no STREAMINFO")
+	}
+	return metadata, true, nil
+}
+
+// mp4SampleTableRanges locates samples through stsz, stsc, and stco or co64.
+// Fragmented files carry no samples here and return an empty list. dataSize
+// is the length of the whole file, which bounds the sample count.
+func mp4SampleTableRanges(stbl []byte, dataSize int) ([]mp4SampleRange, error) {
+	sizes, err := mp4SampleSizes(stbl, dataSize)
+	if err != nil || len(sizes) == 0 {
+		return nil, err
+	}
+	chunkOffsets, err := mp4ChunkOffsets(stbl)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := mp4SampleToChunk(stbl)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := make([]mp4SampleRange, 0, len(sizes))
+	sample := 0
+	for chunk := range chunkOffsets {
+		perChunk := mp4SamplesPerChunk(runs, uint32(chunk+1))
+		offset := chunkOffsets[chunk]
+		for i := uint32(0); i < perChunk && sample < len(sizes); i++ {
+			ranges = append(ranges, mp4SampleRange{offset: offset, size: sizes[sample]})
+			offset += sizes[sample]
+			sample++
+		}
+	}
+	if sample != len(sizes) {
+		return nil, fmt.Errorf("sample tables describe %d of %d samples", sample, len(sizes))
+	}
+	return ranges, nil
+}
+
+func mp4SampleSizes(stbl []byte, dataSize int) ([]int64, error) {
+	stsz, ok, err := findMP4ChildAtom(stbl, "stsz")
+	if err != nil {
+		return nil, fmt.Errorf("parse stbl: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("stbl has no stsz atom")
+	}
+	body := mp4AtomBody(stbl, stsz)
+	if len(body) < 12 {
+		return nil, errors.New("stsz atom is too short")
+	}
+	uniform := binary.BigEndian.Uint32(body[4:])
+	count := int64(binary.BigEndian.Uint32(body[8:]))
+	// Every sample takes at least one byte, or uniform bytes, of the file.
+	limit := int64(dataSize)
+	if uniform != 0 {
+		limit /= int64(uniform)
+	}
+	if count > limit {
+		return nil, fmt.Errorf("stsz atom lists %d samples, more than the file can hold", count)
+	}
+	if uniform == 0 && int64(len(body)-12) < count*4 {
+		return nil, errors.New("stsz atom is truncated")
+	}
+
+	sizes := make([]int64, count)
+	for i := range sizes {
+		if uniform != 0 {
+			sizes[i] = int64(uniform)
+			continue
+		}
+		sizes[i] = int64(binary.BigEndian.Uint32(body[12+i*4:]))
+	}
+	return sizes, nil
+}
+
+func mp4ChunkOffsets(stbl []byte) ([]int64, error) {
+	name, width := "stco", 4
+	atom, ok, err := findMP4ChildAtom(stbl, name)
+	if err == nil && !ok {
+		name, width = "co64", 8
+		atom, ok, err = findMP4ChildAtom(stbl, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse stbl: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("stbl has no stco or co64 atom")
+	}
+	body := mp4AtomBody(stbl, atom)
+	if len(body) < 8 {
+		return nil, fmt.Errorf("%s atom is too short", name)
+	}
+	count := int(binary.BigEndian.Uint32(body[4:]))
+	if len(body)-8 < count*width {
+		return nil, fmt.Errorf("%s atom is truncated", name)
+	}
+
+	offsets := make([]int64, count)
+	for i := range offsets {
+		if width == 4 {
+			offsets[i] = int64(binary.BigEndian.Uint32(body[8+i*4:]))
+			continue
+		}
+		offset := binary.BigEndian.Uint64(body[8+i*8:])
+		if offset > math.MaxInt64 {
+			return nil, errors.New("co64 offset overflows")
+		}
+		offsets[i] = int64(offset)
+	}
+	return offsets, nil
+}
+
+type mp4ChunkRun struct {
+	firstChunk      uint32
+	samplesPerChunk uint32
+}
+
+func mp4SampleToChunk(stbl []byte) ([]mp4ChunkRun, error) {
+	stsc, ok, err := findMP4ChildAtom(stbl, "stsc")
+	if err != nil {
+		return nil, fmt.Errorf("parse stbl: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("stbl has no stsc atom")
+	}
+	body := mp4AtomBody(stbl, stsc)
+	if len(body) < 8 {
+		return nil, errors.New("stsc atom is too short")
+	}
+	count := int(binary.BigEndian.Uint32(body[4:]))
+	if len(body)-8 < count*12 {
+		return nil, errors.New("stsc atom is truncated")
+	}
+
+	runs := make([]mp4ChunkRun, count)
+	for i := range runs {
+		entry := body[8+i*12:]
+		runs[i] = mp4ChunkRun{
+			firstChunk:      binary.BigEndian.Uint32(entry),
+			samplesPerChunk: binary.BigEndian.Uint32(entry[4:]),
+		}
+	}
+	return runs, nil
+}
+
+func mp4SamplesPerChunk(runs []mp4ChunkRun, chunk uint32) uint32 {
+	var perChunk uint32
+	for _, run := range runs {
+		if run.firstChunk > chunk {
+			break
+		}
+		perChunk = run.samplesPerChunk
+	}
+	return perChunk
+}
+
+// mp4FragmentRanges locates samples of track in moof/traf/trun boxes.
+func mp4FragmentRanges(data []byte, track mp4FLACTrack) ([]mp4SampleRange, error) {
+	var ranges []mp4SampleRange
+	for offset := 0; offset < len(data); {
+		moof, err := parseM4AAtom(data, offset)
+		if err != nil {
+			return nil, fmt.Errorf("parse top-level atoms: %w", err)
+		}
+		offset = moof.end
+		if moof.typ != "moof" {
+			continue
+		}
+
+		body := mp4AtomBody(data, moof)
+		for trafOffset := 0; trafOffset < len(body); {
+			traf, err := parseM4AAtom(body, trafOffset)
+			if err != nil {
+				return nil, fmt.Errorf("parse moof: %w", err)
+			}
+			trafOffset = traf.end
+			if traf.typ != "traf" {
+				continue
+			}
+			trafRanges, err := mp4TrackFragmentRanges(mp4AtomBody(body, traf), int64(moof.offset), track)
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, trafRanges...)
+		}
+	}
+	return ranges, nil
+}
+
+func mp4TrackFragmentRanges(traf []byte, moofOffset int64, track mp4FLACTrack) ([]mp4SampleRange, error) {
+	tfhd, ok, err := findMP4ChildAtom(traf, "tfhd")
+	if err != nil {
+		return nil, fmt.Errorf("parse traf: %w", err)
+	}
+	if !ok {
+		return nil, errors.New("traf has no tfhd atom")
+	}
+	header := mp4AtomBody(traf, tfhd)
+	if len(header) < 8 {
+		return nil, errors.New("tfhd atom is too short")
+	}
+	if binary.BigEndian.Uint32(header[4:]) != track.id {
+		return nil, nil
+	}
+
+	flags := binary.BigEndian.Uint32(header) & 0xffffff
+	base := moofOffset
+	defaultSize := track.defaultSampleSize
+	cursor := 8
+	read := func(width int) (uint64, error) {
+		if len(header)-cursor < width {
+			return 0, errors.New("tfhd atom is truncated")
+		}
+		var value uint64
+		if width == 8 {
+			value = binary.BigEndian.Uint64(header[cursor:])
+		} else {
+			value = uint64(binary.BigEndian.Uint32(header[cursor:]))
+		}
+		cursor += width
+		return value, nil
+	}
+	for _, field := range []struct {
+		flag  uint32
+		width int
+		apply func(uint64)
+	}{
+		{tfhdBaseDataOffset, 8, func(v uint64) { base = int64(v) }},
+		{tfhdSampleDescription, 4, nil},
+		{tfhdDefaultDuration, 4, nil},
+		{tfhdDefaultSampleSize, 4, func(v uint64) { defaultSize = uint32(v) }},
+		{tfhdDefaultSampleFlags, 4, nil},
+	} {
+		if flags&field.flag == 0 {
+			continue
+		}
+		value, err := read(field.width)
+		if err != nil {
+			return nil, err
+		}
+		if field.apply != nil {
+			field.apply(value)
+		}
+	}
+
+	var ranges []mp4SampleRange
+	dataOffset := base
+	for offset := 0; offset < len(traf); {
+		atom, err := parseM4AAtom(traf, offset)
+		if err != nil {
+			return nil, fmt.Errorf("parse traf: %w", err)
+		}
+		offset = atom.end
+		if atom.typ != "trun" {
+			continue
+		}
+		runRanges, next, err := mp4TrackRunRanges(mp4AtomBody(traf, atom), base, dataOffset, defaultSize)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, runRanges...)
+		dataOffset = next
+	}
+	return ranges, nil
+}
+
+// mp4TrackRunRanges reads one trun box. Runs without a data offset continue
+// where the previous run of the same fragment ended.
+func mp4TrackRunRanges(trun []byte, base, continueAt int64, defaultSize uint32) ([]mp4SampleRange, int64, error) {
+	if len(trun) < 8 {
+		return nil, 0, errors.New("trun atom is too short")
+	}
+	flags := binary.BigEndian.Uint32(trun) & 0xffffff
+	count := int(binary.BigEndian.Uint32(trun[4:]))
+	cursor := 8
+
+	offset := continueAt
+	if flags&trunDataOffset != 0 {
+		if len(trun)-cursor < 4 {
+			return nil, 0, errors.New("trun atom is truncated")
+		}
+		offset = base + int64(int32(binary.BigEndian.Uint32(trun[cursor:])))
+		cursor += 4
+	}
+	if flags&trunFirstSampleFlags != 0 {
+		cursor += 4
+	}
+
+	fieldsPerSample := 0
+	for _, flag := range []uint32{trunSampleDuration, trunSampleSize, trunSampleFlags, trunSampleCompositionOffset} {
+		if flags&flag != 0 {
+			fieldsPerSample++
+		}
+	}
+	if cursor > len(trun) || (len(trun)-cursor)/4 < count*fieldsPerSample {
+		return nil, 0, errors.New("trun atom is truncated")
+	}
+
+	ranges := make([]mp4SampleRange, 0, count)
+	for i := 0; i < count; i++ {
+		size := int64(defaultSize)
+		if flags&trunSampleDuration != 0 {
+			cursor += 4
+		}
+		if flags&trunSampleSize != 0 {
+			size = int64(binary.BigEndian.Uint32(trun[cursor:]))
+			cursor += 4
+		}
+		if flags&trunSampleFlags != 0 {
+			cursor += 4
+		}
+		if flags&trunSampleCompositionOffset != 0 {
+			cursor += 4
+		}
+		if size == 0 {
+			return nil, 0, errors.New("fragment sample has no size")
+		}
+		ranges = append(ranges, mp4SampleRange{offset: offset, size: size})
+		offset += size
+	}
+	return ranges, offset, nil
+}
@@ -0,0 +1,198 @@
+package ya
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"ya-music/ya/lossless"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFLACFrames = [][]byte{
+	{0xff, 0xf8, 0x01, 0x02},
+	{0xff, 0xf8, 0x03},
+	{0xff, 0xf8, 0x04, 0x05, 0x06},
+}
+
+func testMP4Atom(t *testing.T, typ string, parts ...[]byte) []byte {
+	t.Helper()
+	atom, err := buildMP4Atom(typ, bytes.Join(parts, nil))
+	require.NoError(t, err)
+	return atom
+}
+
+func u32(values ...uint32) []byte {
+	out := make([]byte, 0, 4*len(values))
+	for _, value := range values {
+		out = binary.BigEndian.AppendUint32(out, value)
+	}
+	return out
+}
+
+// testFLACMetadata returns STREAMINFO wrongly flagged as last followed by a
+// padding block without the flag, as seen in some muxers.
+func testFLACMetadata() []byte {
+	metadata := append([]byte{0x80, 0, 0, flacStreamInfoLength}, make([]byte, flacStreamInfoLength)...)
+	return append(metadata, 0x01, 0, 0, 2, 0, 0)
+}
+
+func testFLACTrak(t *testing.T, sampleTables ...[]byte) []byte {
+	tkhd := testMP4Atom(t, "tkhd", u32(0, 0, 0, 1), make([]byte, 68))
+	dfLa := testMP4Atom(t, "dfLa", u32(0), testFLACMetadata())
+	entry := testMP4Atom(t, "fLaC", make([]byte, 28), dfLa)
+	stsd := testMP4Atom(t, "stsd", u32(0, 1), entry)
+	stbl := testMP4Atom(t, "stbl", append([][]byte{stsd}, sampleTables...)...)
+	minf := testMP4Atom(t, "minf", stbl)
+	mdia := testMP4Atom(t, "mdia", minf)
+	return testMP4Atom(t, "trak", tkhd, mdia)
+}
+
+// buildTestFLACMP4 stores frames 1-2 in a first chunk and frame 3 in a second
+// chunk, separated by padding bytes the remuxer must skip.
+func buildTestFLACMP4(t *testing.T, co64 bool) []byte {
+	ftyp := testMP4Atom(t, "ftyp", []byte("isom"), u32(0))
+	gap := []byte{0, 0}
+	mdatBody := bytes.Join([][]byte{testFLACFrames[0], testFLACFrames[1], gap, testFLACFrames[2]}, nil)
+	mdat := testMP4Atom(t, "mdat", mdatBody)
+
+	first := uint32(len(ftyp) + 8)
+	second := first + uint32(len(testFLACFrames[0])+len(testFLACFrames[1])+len(gap))
+	stsz := testMP4Atom(t, "stsz", u32(0, 0, 3, 4, 3, 5))
+	stsc := testMP4Atom(t, "stsc", u32(0, 2, 1, 2, 1, 2, 1, 1))
+	offsets := testMP4Atom(t, "stco", u32(0, 2, first, second))
+	if co64 {
+		offsets = testMP4Atom(t, "co64", u32(0, 2, 0, first, 0, second))
+	}
+	moov := testMP4Atom(t, "moov", testFLACTrak(t, stsz, stsc, offsets))
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+func buildFragmentedTestFLACMP4(t *testing.T) []byte {
+	ftyp := testMP4Atom(t, "ftyp", []byte("iso6"), u32(0))
+	trex := testMP4Atom(t, "trex", u32(0, 1, 1, 0, 0, 0))
+	empty := [][]byte{
+		testMP4Atom(t, "stsz", u32(0, 0, 0)),
+		testMP4Atom(t, "stsc", u32(0, 0)),
+		testMP4Atom(t, "stco", u32(0, 0)),
+	}
+	moov := testMP4Atom(t, "moov", testFLACTrak(t, empty...), testMP4Atom(t, "mvex", trex))
+
+	var fragments []byte
+	for _, frames := range [][][]byte{testFLACFrames[:2], testFLACFrames[2:]} {
+		trunBody := u32(trunDataOffset|trunSampleSize, uint32(len(frames)), 0)
+		for _, frame := range frames {
+			trunBody = append(trunBody, u32(uint32(len(frame)))...)
+		}
+		build := func(dataOffset uint32) []byte {
+			binary.BigEndian.PutUint32(trunBody[8:], dataOffset)
+			tfhd := testMP4Atom(t, "tfhd", u32(0x020000, 1))
+			traf := testMP4Atom(t, "traf", tfhd, testMP4Atom(t, "trun", trunBody))
+			return testMP4Atom(t, "moof", testMP4Atom(t, "mfhd", u32(0, 1)), traf)
+		}
+		moof := build(0)
+		moof = build(uint32(len(moof) + 8))
+		fragments = append(fragments, moof...)
+		fragments = append(fragments, testMP4Atom(t, "mdat", frames...)...)
+	}
+	return bytes.Join([][]byte{ftyp, moov, fragments}, nil)
+}
+
+func expectedRemuxedFLAC() []byte {
+	metadata := testFLACMetadata()
+	metadata[0] = 0x00
+	metadata[4+flacStreamInfoLength] = 0x81
+	return bytes.Join([][]byte{[]byte("fLaC"), metadata, bytes.Join(testFLACFrames, nil)}, nil)
+}
+
+func TestRemuxFLACFromMP4UsesSampleTables(t *testing.T) {
+	for _, co64 := range []bool{false, true} {
+		stream, err := remuxFLACFromMP4(buildTestFLACMP4(t, co64))
+
+		require.NoError(t, err, "co64=%v", co64)
+		assert.Equal(t, expectedRemuxedFLAC(), stream, "co64=%v", co64)
+	}
+}
+
+func TestRemuxFLACFromMP4ReadsFragments(t *testing.T) {
+	stream, err := remuxFLACFromMP4(buildFragmentedTestFLACMP4(t))
+
+	require.NoError(t, err)
+	assert.Equal(t, expectedRemuxedFLAC(), stream)
+}
+
+func TestRemuxFLACFromMP4RejectsOtherAudio(t *testing.T) {
+	aac, err := os.ReadFile(filepath.Join("testdata", "m4a", "taggable-stco.m4a"))
+	require.NoError(t, err)
+
+	_, err = remuxFLACFromMP4(aac)
+	require.ErrorIs(t, err, errFLACMP4Remux)
+	assert.Contains(t, err.Error(), "no FLAC audio track")
+
+	broken := buildTestFLACMP4(t, false)
+	_, err = remuxFLACFromMP4(broken[:len(broken)-4])
+	assert.ErrorIs(t, err, errFLACMP4Remux)
+}
+
+func TestMP4SampleSizesRejectsCountsBeyondTheFile(t *testing.T) {
+	uniform := testMP4Atom(t, "stsz", u32(0, 4, 0xffffffff))
+	_, err := mp4SampleSizes(uniform, 1<<20)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "more than the file can hold")
+
+	sizes, err := mp4SampleSizes(testMP4Atom(t, "stsz", u32(0, 4, 3)), 12)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 4, 4}, sizes)
+
+	_, err = mp4SampleSizes(testMP4Atom(t, "stsz", u32(0, 0, 3, 4)), 1<<20)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "truncated")
+}
+
+func TestDownloadLosslessRemuxesFLACMP4WhenRequested(t *testing.T) {
+	outputDir := t.TempDir()
+	track := upgradeTestTrack()
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{
+		info: lossless.DownloadInfo{Quality: "lossless", Codec: "flac-mp4", Bitrate: 0},
+		data: buildTestFLACMP4(t, false),
+	})
+
+	filename, err := client.DownloadTrackWithOptions(track, outputDir, DownloadOptions{
+		SkipCover:         true,
+		AudioFormat:       AudioFormatFLAC,
+		LosslessContainer: LosslessContainerFLAC,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Song.flac"), filename)
+	id, err := ReadSourceTrackID(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "10", id)
+	data, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasSuffix(data, bytes.Join(testFLACFrames, nil)))
+}
+
+func TestDownloadLosslessKeepsM4AWhenRemuxFails(t *testing.T) {
+	outputDir := t.TempDir()
+	track := upgradeTestTrack()
+	fixtureData, err := os.ReadFile(filepath.Join("testdata", "m4a", "taggable-stco.m4a"))
+	require.NoError(t, err)
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{
+		info: lossless.DownloadInfo{Quality: "lossless", Codec: "flac-mp4", Bitrate: 0},
+		data: fixtureData,
+	})
+
+	filename, err := client.DownloadTrackWithOptions(track, outputDir, DownloadOptions{
+		SkipCover:         true,
+		AudioFormat:       AudioFormatFLAC,
+		LosslessContainer: LosslessContainerFLAC,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Song.m4a"), filename)
+	assert.Equal(t, readMP4FileTypeBox(t, filepath.Join("testdata", "m4a", "taggable-stco.m4a")), readMP4FileTypeBox(t, filename))
+}
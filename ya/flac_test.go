@@ -40,7 +40,7 @@ func TestWriteFLACTagsWritesVorbisCommentsAndCover(t *testing.T) {
 		}},
 	}
 
-	require.NoError(t, writeFLACTags(flacPath, track, coverPath))
+	require.NoError(t, writeFLACTags(flacPath, track, coverPath, nil))
 
 	file, err := flac.ParseFile(flacPath)
 	require.NoError(t, err)
@@ -82,7 +82,7 @@ func TestWriteFLACTagsIgnoresInvalidCover(t *testing.T) {
 	require.NoError(t, os.WriteFile(flacPath, minimalFLACBytes(), 0644))
 	require.NoError(t, os.WriteFile(coverPath, []byte("not an image"), 0644))
 
-	err := writeFLACTags(flacPath, model.Track{ID: model.FlexibleID("123"), Title: "Song"}, coverPath)
+	err := writeFLACTags(flacPath, model.Track{ID: model.FlexibleID("123"), Title: "Song"}, coverPath, nil)
 
 	require.NoError(t, err)
 	file, err := flac.ParseFile(flacPath)
@@ -92,6 +92,32 @@ func TestWriteFLACTagsIgnoresInvalidCover(t *testing.T) {
 	}
 }
 
+func TestWriteFLACTagsWritesReleaseDateInUTC(t *testing.T) {
+	flacPath := filepath.Join(t.TempDir(), "episode.flac")
+	require.NoError(t, os.WriteFile(flacPath, minimalFLACBytes(), 0644))
+	track := model.Track{
+		ID:      model.FlexibleID("124"),
+		Title:   "Late",
+		PubDate: "2024-03-01T22:30:00-05:00",
+		Albums:  []model.Album{{ID: "10", Title: "Show", Type: model.AlbumTypePodcast}},
+	}
+
+	require.NoError(t, writeFLACTags(flacPath, track, "", nil))
+
+	file, err := flac.ParseFile(flacPath)
+	require.NoError(t, err)
+	var comments *flacvorbis.MetaDataBlockVorbisComment
+	for _, block := range file.Meta {
+		if block.Type == flac.VorbisComment {
+			comments, err = flacvorbis.ParseFromMetaDataBlock(*block)
+			require.NoError(t, err)
+		}
+	}
+	require.NotNil(t, comments)
+	assertFLACComment(t, comments, "RELEASEDATE", "2024-03-02")
+	assertFLACComment(t, comments, "DATE", "2024")
+}
+
 func assertFLACComment(t *testing.T, comments *flacvorbis.MetaDataBlockVorbisComment, key string, want string) {
 	t.Helper()
 
@@ -13,9 +13,12 @@ import (
 const (
 	yandexTrackOwnerIdentifier        = "music.yandex.ru"
 	yandexSourceURLCommentDescription = "yandex-music-downloader:source-url"
+	podcastFrameID                    = "PCST"
+	releaseTimeFrameID                = "TDRL"
+	lengthFrameID                     = "TLEN"
 )
 
-func writeID3Tags(filename string, track model.Track, coverPath string) error {
+func writeID3Tags(filename string, track model.Track, coverPath string, gain *replayGain) error {
 	tag, err := id3v2.Open(filename, id3v2.Options{Parse: true})
 	if err != nil {
 		return err
@@ -51,6 +54,8 @@ func writeID3Tags(filename string, track model.Track, coverPath string) error {
 		tag.SetYear(year)
 	}
 
+	writeEpisodeID3Tags(tag, track)
+
 	trackID := strings.TrimSpace(track.ID.String())
 	if trackID != "" {
 		tag.DeleteFrames(tag.CommonID("Unique file identifier"))
@@ -71,6 +76,26 @@ func writeID3Tags(filename string, track model.Track, coverPath string) error {
 		})
 	}
 
+	for _, identifier := range trackIdentifiers(track) {
+		if identifier.Key == identifierISRC {
+			tag.AddTextFrame(tag.CommonID("ISRC"), id3v2.EncodingUTF8, identifier.joinedValue())
+			continue
+		}
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: identifier.Key,
+			Value:       identifier.joinedValue(),
+		})
+	}
+
+	for _, field := range gain.fields() {
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: field.Key,
+			Value:       field.Value,
+		})
+	}
+
 	if picture, ok := readCoverPicture(coverPath); ok {
 		tag.DeleteFrames(tag.CommonID("Attached picture"))
 		tag.AddAttachedPicture(picture)
@@ -79,6 +104,30 @@ func writeID3Tags(filename string, track model.Track, coverPath string) error {
 	return tag.Save()
 }
 
+// writeEpisodeID3Tags marks podcast episodes the way podcast players expect:
+// the iTunes PCST flag, the length in TLEN, the release time in TDRL, and the
+// episode description as the comment.
+func writeEpisodeID3Tags(tag *id3v2.Tag, track model.Track) {
+	if track.IsPodcastEpisode() {
+		tag.DeleteFrames(podcastFrameID)
+		tag.AddFrame(podcastFrameID, id3v2.UnknownFrame{Body: []byte{0, 0, 0, 1}})
+		if track.DurationMs > 0 {
+			tag.AddTextFrame(lengthFrameID, id3v2.EncodingUTF8, strconv.Itoa(track.DurationMs))
+		}
+	}
+	if published, ok := track.Published(); ok {
+		// ID3 timestamps carry no zone, so store UTC for readers to parse back.
+		tag.AddTextFrame(releaseTimeFrameID, id3v2.EncodingUTF8, published.UTC().Format("2006-01-02T15:04:05"))
+	}
+	if description := strings.TrimSpace(track.ShortDescription); description != "" {
+		tag.AddCommentFrame(id3v2.CommentFrame{
+			Encoding: id3v2.EncodingUTF8,
+			Language: "eng",
+			Text:     description,
+		})
+	}
+}
+
 func firstAlbum(track model.Track) *model.Album {
 	if len(track.Albums) == 0 {
 		return nil
@@ -100,6 +149,10 @@ func trackYear(track model.Track) string {
 		return strconv.Itoa(track.MetaData.Year)
 	}
 
+	if published, ok := track.Published(); ok {
+		return strconv.Itoa(published.UTC().Year())
+	}
+
 	return ""
 }
 
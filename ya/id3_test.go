@@ -51,7 +51,7 @@ func TestWriteID3TagsWritesBasicMetadataAndCover(t *testing.T) {
 		},
 	}
 
-	require.NoError(t, writeID3Tags(mp3Path, track, coverPath))
+	require.NoError(t, writeID3Tags(mp3Path, track, coverPath, nil))
 
 	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
 	require.NoError(t, err)
@@ -92,7 +92,7 @@ func TestWriteID3TagsUsesReleaseDateYearFallback(t *testing.T) {
 		MetaData: model.MetaData{Year: 2021},
 	}
 
-	require.NoError(t, writeID3Tags(mp3Path, track, ""))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
 
 	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
 	require.NoError(t, err)
@@ -102,6 +102,40 @@ func TestWriteID3TagsUsesReleaseDateYearFallback(t *testing.T) {
 	assert.Empty(t, tag.GetFrames(tag.CommonID("Attached picture")))
 }
 
+func TestWriteID3TagsWritesPodcastEpisodeFrames(t *testing.T) {
+	mp3Path := filepath.Join(t.TempDir(), "episode.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+
+	track := model.Track{
+		ID:               model.FlexibleID("123"),
+		Title:            "Pilot",
+		PubDate:          "2024-03-01T06:00:00+03:00",
+		ShortDescription: "The first episode.",
+		Albums:           []model.Album{{ID: "10", Title: "Show", Type: model.AlbumTypePodcast}},
+	}
+
+	// Tagging twice must not duplicate the podcast flag.
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tag.Close()
+
+	podcast := tag.GetFrames(podcastFrameID)
+	require.Len(t, podcast, 1)
+	assert.Equal(t, []byte{0, 0, 0, 1}, podcast[0].(id3v2.UnknownFrame).Body)
+	assert.Equal(t, "2024-03-01T03:00:00", tag.GetTextFrame(releaseTimeFrameID).Text)
+	assert.Equal(t, "2024", tag.Year())
+	var description string
+	for _, frame := range tag.GetFrames(tag.CommonID("Comments")) {
+		if comment := frame.(id3v2.CommentFrame); comment.Description == "" {
+			description = comment.Text
+		}
+	}
+	assert.Equal(t, "The first episode.", description)
+}
+
 func TestWriteID3TagsIgnoresMissingCover(t *testing.T) {
 	mp3Path := filepath.Join(t.TempDir(), "track.mp3")
 	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
@@ -111,7 +145,7 @@ func TestWriteID3TagsIgnoresMissingCover(t *testing.T) {
 		Title: "Song",
 	}
 
-	require.NoError(t, writeID3Tags(mp3Path, track, filepath.Join(t.TempDir(), "missing.jpg")))
+	require.NoError(t, writeID3Tags(mp3Path, track, filepath.Join(t.TempDir(), "missing.jpg"), nil))
 }
 
 func TestWriteID3TagsPreservesUnrelatedCommentsAndUpdatesSource(t *testing.T) {
@@ -150,7 +184,7 @@ func TestWriteID3TagsPreservesUnrelatedCommentsAndUpdatesSource(t *testing.T) {
 			ID: model.FlexibleID("456"),
 		}},
 	}
-	require.NoError(t, writeID3Tags(mp3Path, track, ""))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
 
 	comments := readID3Comments(t, mp3Path)
 	assert.Equal(t, map[string]string{
@@ -172,8 +206,8 @@ func TestWriteID3TagsSourceCommentIsIdempotent(t *testing.T) {
 		}},
 	}
 
-	require.NoError(t, writeID3Tags(mp3Path, track, ""))
-	require.NoError(t, writeID3Tags(mp3Path, track, ""))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
 
 	comments := readID3Comments(t, mp3Path)
 	require.Len(t, comments, 1)
@@ -199,7 +233,7 @@ func readID3Comments(t *testing.T, mp3Path string) map[string]string {
 }
 
 func TestWriteID3TagsReturnsErrorForMissingMP3(t *testing.T) {
-	err := writeID3Tags(filepath.Join(t.TempDir(), "missing.mp3"), model.Track{Title: "Song"}, "")
+	err := writeID3Tags(filepath.Join(t.TempDir(), "missing.mp3"), model.Track{Title: "Song"}, "", nil)
 
 	assert.Error(t, err)
 }
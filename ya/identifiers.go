@@ -0,0 +1,65 @@
+package ya
+
+import (
+	"strings"
+	"ya-music/ya/model"
+)
+
+// trackIdentifier is a single identifier tag; Key uses the upper-case
+// Vorbis/TXXX naming understood by library managers such as Picard and beets.
+type trackIdentifier struct {
+	Key    string
+	Values []string
+}
+
+const (
+	identifierISRC          = "ISRC"
+	identifierBarcode       = "BARCODE"
+	identifierYandexAlbum   = "YANDEX_ALBUM_ID"
+	identifierYandexArtists = "YANDEX_ARTIST_ID"
+)
+
+// trackIdentifiers returns the standard and source identifiers known for track.
+// The Yandex track ID is not included because each format already stores it
+// in its own dedicated field.
+func trackIdentifiers(track model.Track) []trackIdentifier {
+	var identifiers []trackIdentifier
+	add := func(key string, values ...string) {
+		var kept []string
+		seen := make(map[string]struct{}, len(values))
+		for _, value := range values {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if _, ok := seen[value]; ok {
+				continue
+			}
+			seen[value] = struct{}{}
+			kept = append(kept, value)
+		}
+		if len(kept) > 0 {
+			identifiers = append(identifiers, trackIdentifier{Key: key, Values: kept})
+		}
+	}
+
+	add(identifierISRC, strings.ToUpper(strings.TrimSpace(track.ISRC)))
+	if album := firstAlbum(track); album != nil {
+		add(identifierBarcode, album.Barcode)
+		add(identifierYandexAlbum, album.ID.String())
+	}
+
+	artistIDs := make([]string, 0, len(track.Artists))
+	for _, artist := range track.Artists {
+		artistIDs = append(artistIDs, artist.ID.String())
+	}
+	add(identifierYandexArtists, artistIDs...)
+
+	return identifiers
+}
+
+// joinedValue flattens multi-valued identifiers for formats that store a
+// single string per field.
+func (i trackIdentifier) joinedValue() string {
+	return strings.Join(i.Values, "; ")
+}
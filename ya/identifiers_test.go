@@ -0,0 +1,98 @@
+package ya
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"ya-music/ya/model"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/go-flac/flacvorbis"
+	flac "github.com/go-flac/go-flac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func identifiedTestTrack() model.Track {
+	return model.Track{
+		ID:    model.FlexibleID("123"),
+		ISRC:  " usabc2500001 ",
+		Title: "Song",
+		Artists: []model.Artist{
+			{ID: "10", Name: "Artist A"},
+			{ID: "11", Name: "Artist B"},
+			{ID: "10", Name: "Artist A"},
+			{Name: "Unknown"},
+		},
+		Albums: []model.Album{{ID: "456", Title: "Album", Barcode: "0123456789012"}},
+	}
+}
+
+func TestTrackIdentifiersCollectsStandardAndSourceIDs(t *testing.T) {
+	assert.Equal(t, []trackIdentifier{
+		{Key: identifierISRC, Values: []string{"USABC2500001"}},
+		{Key: identifierBarcode, Values: []string{"0123456789012"}},
+		{Key: identifierYandexAlbum, Values: []string{"456"}},
+		{Key: identifierYandexArtists, Values: []string{"10", "11"}},
+	}, trackIdentifiers(identifiedTestTrack()))
+
+	assert.Empty(t, trackIdentifiers(model.Track{ID: "1", Title: "Song"}))
+}
+
+func TestM4AIdentifierFieldNames(t *testing.T) {
+	assert.Equal(t, "----:com.apple.iTunes:ISRC", m4aIdentifierField(identifierISRC))
+	assert.Equal(t, "----:com.apple.iTunes:BARCODE", m4aIdentifierField(identifierBarcode))
+	assert.Equal(t, "----:com.yandex-music-downloader:album-id", m4aIdentifierField(identifierYandexAlbum))
+	assert.Equal(t, "----:com.yandex-music-downloader:artist-id", m4aIdentifierField(identifierYandexArtists))
+}
+
+func TestWriteID3TagsWritesISRCAndSourceIdentifiers(t *testing.T) {
+	mp3Path := filepath.Join(t.TempDir(), "track.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+
+	track := identifiedTestTrack()
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tag.Close()
+
+	assert.Equal(t, "USABC2500001", tag.GetTextFrame(tag.CommonID("ISRC")).Text)
+	values := map[string]string{}
+	for _, frame := range tag.GetFrames(tag.CommonID("User defined text information frame")) {
+		udtf, ok := frame.(id3v2.UserDefinedTextFrame)
+		require.True(t, ok)
+		values[udtf.Description] = udtf.Value
+	}
+	assert.Equal(t, map[string]string{
+		identifierBarcode:       "0123456789012",
+		identifierYandexAlbum:   "456",
+		identifierYandexArtists: "10; 11",
+	}, values)
+}
+
+func TestWriteFLACTagsWritesISRCAndSourceIdentifiers(t *testing.T) {
+	flacPath := filepath.Join(t.TempDir(), "track.flac")
+	require.NoError(t, os.WriteFile(flacPath, minimalFLACBytes(), 0644))
+
+	require.NoError(t, writeFLACTags(flacPath, identifiedTestTrack(), "", nil))
+
+	file, err := flac.ParseFile(flacPath)
+	require.NoError(t, err)
+	var comments *flacvorbis.MetaDataBlockVorbisComment
+	for _, block := range file.Meta {
+		if block.Type == flac.VorbisComment {
+			comments, err = flacvorbis.ParseFromMetaDataBlock(*block)
+			require.NoError(t, err)
+		}
+	}
+	require.NotNil(t, comments)
+
+	assertFLACComment(t, comments, "ISRC", "USABC2500001")
+	assertFLACComment(t, comments, "BARCODE", "0123456789012")
+	assertFLACComment(t, comments, "YANDEX_ALBUM_ID", "456")
+	artistIDs, err := comments.Get("YANDEX_ARTIST_ID")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10", "11"}, artistIDs)
+}
@@ -1,6 +1,7 @@
 package lossless
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
@@ -32,6 +33,17 @@ type HTTPClient interface {
 	DownloadBytesWithContext(reqCtx utils.RequestLogContext, url string) ([]byte, error)
 }
 
+// ContextHTTPClient is an HTTPClient whose requests can be cancelled through
+// a context, such as *utils.HttpClient. The Downloader uses these methods
+// when the client has them.
+type ContextHTTPClient interface {
+	HTTPClient
+	// Context is used by the methods that take no context.
+	Context() context.Context
+	GetWithHeadersContext(ctx context.Context, reqCtx utils.RequestLogContext, url string, headers map[string]string) ([]byte, error)
+	DownloadBytesContext(ctx context.Context, reqCtx utils.RequestLogContext, url string) ([]byte, error)
+}
+
 type Downloader struct {
 	httpClient HTTPClient
 	baseURL    string
@@ -76,13 +88,26 @@ func NewDownloader(httpClient HTTPClient) *Downloader {
 	}
 }
 
+// SetBaseURL requests file info from baseURL instead of the Yandex Music API.
+// An empty baseURL restores the default.
+func (d *Downloader) SetBaseURL(baseURL string) {
+	if strings.TrimSpace(baseURL) == "" {
+		baseURL = defaultBaseURL
+	}
+	d.baseURL = baseURL
+}
+
 func (d *Downloader) Download(reqCtx utils.RequestLogContext, trackID string, userUID int) (DownloadResult, error) {
-	info, err := d.GetDownloadInfo(reqCtx, trackID, userUID)
+	return d.DownloadContext(d.context(), reqCtx, trackID, userUID)
+}
+
+func (d *Downloader) DownloadContext(ctx context.Context, reqCtx utils.RequestLogContext, trackID string, userUID int) (DownloadResult, error) {
+	info, err := d.GetDownloadInfoContext(ctx, reqCtx, trackID, userUID)
 	if err != nil {
 		return DownloadResult{}, err
 	}
 
-	data, err := d.DownloadAudio(reqCtx, info)
+	data, err := d.DownloadAudioContext(ctx, reqCtx, info)
 	if err != nil {
 		return DownloadResult{}, err
 	}
@@ -94,12 +119,16 @@ func (d *Downloader) Download(reqCtx utils.RequestLogContext, trackID string, us
 }
 
 func (d *Downloader) GetDownloadInfo(reqCtx utils.RequestLogContext, trackID string, userUID int) (DownloadInfo, error) {
+	return d.GetDownloadInfoContext(d.context(), reqCtx, trackID, userUID)
+}
+
+func (d *Downloader) GetDownloadInfoContext(ctx context.Context, reqCtx utils.RequestLogContext, trackID string, userUID int) (DownloadInfo, error) {
 	if d == nil || d.httpClient == nil {
 		return DownloadInfo{}, fmt.Errorf("lossless downloader is not configured")
 	}
 
 	endpoint := BuildFileInfoURL(d.baseURL, trackID, d.now().Unix())
-	body, err := d.httpClient.GetWithContextAndHeaders(reqCtx, endpoint, buildFileInfoHeaders(userUID))
+	body, err := d.get(ctx, reqCtx, endpoint, buildFileInfoHeaders(userUID))
 	if err != nil {
 		return DownloadInfo{}, err
 	}
@@ -119,6 +148,10 @@ func (d *Downloader) GetDownloadInfo(reqCtx utils.RequestLogContext, trackID str
 }
 
 func (d *Downloader) DownloadAudio(reqCtx utils.RequestLogContext, info DownloadInfo) ([]byte, error) {
+	return d.DownloadAudioContext(d.context(), reqCtx, info)
+}
+
+func (d *Downloader) DownloadAudioContext(ctx context.Context, reqCtx utils.RequestLogContext, info DownloadInfo) ([]byte, error) {
 	if d == nil || d.httpClient == nil {
 		return nil, fmt.Errorf("lossless downloader is not configured")
 	}
@@ -128,7 +161,7 @@ func (d *Downloader) DownloadAudio(reqCtx utils.RequestLogContext, info Download
 
 	var errs []error
 	for _, rawURL := range info.URLs {
-		data, err := d.httpClient.DownloadBytesWithContext(reqCtx, rawURL)
+		data, err := d.download(ctx, reqCtx, rawURL)
 		if err != nil {
 			errs = append(errs, fmt.Errorf("%s: %w", utils.SanitizeURL(rawURL), err))
 			continue
@@ -147,6 +180,38 @@ func (d *Downloader) DownloadAudio(reqCtx utils.RequestLogContext, info Download
 	return nil, errors.Join(errs...)
 }
 
+func (d *Downloader) context() context.Context {
+	if d == nil {
+		return context.Background()
+	}
+	if client, ok := d.httpClient.(ContextHTTPClient); ok {
+		return client.Context()
+	}
+	return context.Background()
+}
+
+// get and download stop at ctx with a ContextHTTPClient; other clients are
+// only checked for a done ctx before the request starts.
+func (d *Downloader) get(ctx context.Context, reqCtx utils.RequestLogContext, url string, headers map[string]string) ([]byte, error) {
+	if client, ok := d.httpClient.(ContextHTTPClient); ok {
+		return client.GetWithHeadersContext(ctx, reqCtx, url, headers)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return d.httpClient.GetWithContextAndHeaders(reqCtx, url, headers)
+}
+
+func (d *Downloader) download(ctx context.Context, reqCtx utils.RequestLogContext, url string) ([]byte, error) {
+	if client, ok := d.httpClient.(ContextHTTPClient); ok {
+		return client.DownloadBytesContext(ctx, reqCtx, url)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return d.httpClient.DownloadBytesWithContext(reqCtx, url)
+}
+
 func BuildFileInfoURL(baseURL, trackID string, timestamp int64) string {
 	values := url.Values{}
 	values.Set("ts", fmt.Sprintf("%d", timestamp))
@@ -1,6 +1,7 @@
 package lossless
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/hex"
@@ -22,16 +23,19 @@ type fakeHTTPClient struct {
 	downloaded   []string
 }
 
-func (f *fakeHTTPClient) GetWithContext(_ utils.RequestLogContext, _ string) ([]byte, error) {
-	return f.getBody, nil
+func (f *fakeHTTPClient) Context() context.Context {
+	return context.Background()
 }
 
-func (f *fakeHTTPClient) GetWithContextAndHeaders(_ utils.RequestLogContext, _ string, headers map[string]string) ([]byte, error) {
+func (f *fakeHTTPClient) GetWithHeadersContext(_ context.Context, _ utils.RequestLogContext, _ string, headers map[string]string) ([]byte, error) {
 	f.gotHeaders = headers
 	return f.getBody, nil
 }
 
-func (f *fakeHTTPClient) DownloadBytesWithContext(_ utils.RequestLogContext, rawURL string) ([]byte, error) {
+func (f *fakeHTTPClient) DownloadBytesContext(ctx context.Context, _ utils.RequestLogContext, rawURL string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	f.downloaded = append(f.downloaded, rawURL)
 	if err := f.downloadErrs[rawURL]; err != nil {
 		return nil, err
@@ -39,6 +43,50 @@ func (f *fakeHTTPClient) DownloadBytesWithContext(_ utils.RequestLogContext, raw
 	return f.downloadData[rawURL], nil
 }
 
+func (f *fakeHTTPClient) GetWithContext(reqCtx utils.RequestLogContext, rawURL string) ([]byte, error) {
+	return f.GetWithContextAndHeaders(reqCtx, rawURL, nil)
+}
+
+func (f *fakeHTTPClient) GetWithContextAndHeaders(reqCtx utils.RequestLogContext, rawURL string, headers map[string]string) ([]byte, error) {
+	return f.GetWithHeadersContext(context.Background(), reqCtx, rawURL, headers)
+}
+
+func (f *fakeHTTPClient) DownloadBytesWithContext(reqCtx utils.RequestLogContext, rawURL string) ([]byte, error) {
+	return f.DownloadBytesContext(context.Background(), reqCtx, rawURL)
+}
+
+// legacyHTTPClient has only the methods without a context argument.
+type legacyHTTPClient struct {
+	fake *fakeHTTPClient
+}
+
+func (l legacyHTTPClient) GetWithContext(reqCtx utils.RequestLogContext, rawURL string) ([]byte, error) {
+	return l.fake.GetWithContext(reqCtx, rawURL)
+}
+
+func (l legacyHTTPClient) GetWithContextAndHeaders(reqCtx utils.RequestLogContext, rawURL string, headers map[string]string) ([]byte, error) {
+	return l.fake.GetWithContextAndHeaders(reqCtx, rawURL, headers)
+}
+
+func (l legacyHTTPClient) DownloadBytesWithContext(reqCtx utils.RequestLogContext, rawURL string) ([]byte, error) {
+	return l.fake.DownloadBytesWithContext(reqCtx, rawURL)
+}
+
+func TestDownloaderAcceptsClientsWithoutContextMethods(t *testing.T) {
+	fake := &fakeHTTPClient{downloadData: map[string][]byte{"https://cdn.test/a": []byte("fLaC ok")}}
+	downloader := NewDownloader(legacyHTTPClient{fake: fake})
+
+	data, err := downloader.DownloadAudio(utils.RequestLogContext{}, DownloadInfo{URLs: []string{"https://cdn.test/a"}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte("fLaC ok"), data)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = downloader.DownloadAudioContext(ctx, utils.RequestLogContext{}, DownloadInfo{URLs: []string{"https://cdn.test/b"}})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"https://cdn.test/a"}, fake.downloaded)
+}
+
 func TestBuildFileInfoURLSignsLosslessRequest(t *testing.T) {
 	rawURL := BuildFileInfoURL("https://api.music.yandex.net", "12345", 1700000000)
 	parsed, err := url.Parse(rawURL)
@@ -105,6 +153,18 @@ func TestDownloadAudioTriesNextURLAfterFailure(t *testing.T) {
 	assert.Equal(t, []string{"https://cdn.test/a", "https://cdn.test/b"}, client.downloaded)
 }
 
+func TestDownloadAudioContextStopsWhenContextIsCancelled(t *testing.T) {
+	client := &fakeHTTPClient{downloadData: map[string][]byte{"https://cdn.test/a": []byte("fLaC ok")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewDownloader(client).DownloadAudioContext(ctx, utils.RequestLogContext{}, DownloadInfo{
+		URLs: []string{"https://cdn.test/a"},
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestParseDownloadInfoSupportsResultWrapper(t *testing.T) {
 	info, err := ParseDownloadInfo([]byte(`{"result":{"download_info":{"quality":"lossless","codec":"flac","urls":["u"],"key":"k","bitrate":1411}}}`))
 
@@ -0,0 +1,563 @@
+package loudness
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var flacMarker = []byte("fLaC")
+
+// ErrNotFLAC is returned when the input does not start with a FLAC stream marker.
+var ErrNotFLAC = errors.New("not a flac stream")
+
+// StreamInfo describes the decoded PCM layout of a FLAC stream.
+type StreamInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  uint64
+}
+
+// BlockFunc receives one decoded FLAC frame as per-channel samples.
+type BlockFunc func(info StreamInfo, channels [][]int32) error
+
+// DecodeFLAC decodes a native FLAC stream and passes every audio frame to fn.
+func DecodeFLAC(r io.Reader, fn BlockFunc) (StreamInfo, error) {
+	br := &bitReader{r: bufio.NewReaderSize(r, 64*1024)}
+
+	marker := make([]byte, len(flacMarker))
+	if _, err := io.ReadFull(br.r, marker); err != nil || !bytes.Equal(marker, flacMarker) {
+		return StreamInfo{}, ErrNotFLAC
+	}
+
+	info, err := readFLACMetadata(br)
+	if err != nil {
+		return StreamInfo{}, err
+	}
+
+	for {
+		channels, err := decodeFLACFrame(br, info)
+		if errors.Is(err, io.EOF) {
+			return info, nil
+		}
+		if err != nil {
+			return info, err
+		}
+		if err := fn(info, channels); err != nil {
+			return info, err
+		}
+	}
+}
+
+func readFLACMetadata(br *bitReader) (StreamInfo, error) {
+	var info StreamInfo
+	seenStreamInfo := false
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(br.r, header); err != nil {
+			return StreamInfo{}, fmt.Errorf("read flac metadata header: %w", err)
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(br.r, body); err != nil {
+			return StreamInfo{}, fmt.Errorf("read flac metadata block: %w", err)
+		}
+		if blockType == 0 {
+			if length < 18 {
+				return StreamInfo{}, fmt.Errorf("flac streaminfo block is too short")
+			}
+			info = parseStreamInfo(body)
+			seenStreamInfo = true
+		}
+		if last {
+			break
+		}
+	}
+	if !seenStreamInfo {
+		return StreamInfo{}, fmt.Errorf("flac stream has no streaminfo block")
+	}
+	if info.SampleRate <= 0 || info.Channels <= 0 {
+		return StreamInfo{}, fmt.Errorf("flac streaminfo has invalid audio format")
+	}
+	return info, nil
+}
+
+func parseStreamInfo(body []byte) StreamInfo {
+	packed := uint64(body[10])<<56 | uint64(body[11])<<48 | uint64(body[12])<<40 | uint64(body[13])<<32 |
+		uint64(body[14])<<24 | uint64(body[15])<<16 | uint64(body[16])<<8 | uint64(body[17])
+	return StreamInfo{
+		SampleRate:    int(packed >> 44),
+		Channels:      int(packed>>41&0x7) + 1,
+		BitsPerSample: int(packed>>36&0x1f) + 1,
+		TotalSamples:  packed & 0xfffffffff,
+	}
+}
+
+const (
+	channelsIndependent = iota
+	channelsLeftSide
+	channelsSideRight
+	channelsMidSide
+)
+
+func decodeFLACFrame(br *bitReader, info StreamInfo) ([][]int32, error) {
+	sync, err := br.readBits(14)
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) && br.consumed == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if sync != 0x3ffe {
+		return nil, fmt.Errorf("flac frame sync code not found")
+	}
+	if _, err := br.readBits(2); err != nil {
+		return nil, err
+	}
+
+	blockSizeCode, err := br.readBits(4)
+	if err != nil {
+		return nil, err
+	}
+	sampleRateCode, err := br.readBits(4)
+	if err != nil {
+		return nil, err
+	}
+	channelCode, err := br.readBits(4)
+	if err != nil {
+		return nil, err
+	}
+	sampleSizeCode, err := br.readBits(3)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(1); err != nil {
+		return nil, err
+	}
+	if err := br.skipUTF8Number(); err != nil {
+		return nil, err
+	}
+
+	blockSize, err := frameBlockSize(br, blockSizeCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := skipFrameSampleRate(br, sampleRateCode); err != nil {
+		return nil, err
+	}
+	if _, err := br.readBits(8); err != nil { // CRC-8
+		return nil, err
+	}
+
+	bitsPerSample, err := frameBitsPerSample(sampleSizeCode, info.BitsPerSample)
+	if err != nil {
+		return nil, err
+	}
+
+	channelCount, assignment := int(channelCode)+1, channelsIndependent
+	switch {
+	case channelCode <= 7:
+	case channelCode == 8:
+		channelCount, assignment = 2, channelsLeftSide
+	case channelCode == 9:
+		channelCount, assignment = 2, channelsSideRight
+	case channelCode == 10:
+		channelCount, assignment = 2, channelsMidSide
+	default:
+		return nil, fmt.Errorf("flac frame uses reserved channel assignment %d", channelCode)
+	}
+
+	channels := make([][]int32, channelCount)
+	for ch := range channels {
+		bps := bitsPerSample
+		switch {
+		case assignment == channelsLeftSide && ch == 1,
+			assignment == channelsSideRight && ch == 0,
+			assignment == channelsMidSide && ch == 1:
+			bps++
+		}
+		samples, err := decodeSubframe(br, blockSize, bps)
+		if err != nil {
+			return nil, fmt.Errorf("flac subframe %d: %w", ch, err)
+		}
+		channels[ch] = samples
+	}
+
+	br.alignToByte()
+	if _, err := br.readBits(16); err != nil { // CRC-16
+		return nil, err
+	}
+	br.consumed = 0
+
+	decorrelate(channels, assignment)
+	return channels, nil
+}
+
+func frameBlockSize(br *bitReader, code uint64) (int, error) {
+	switch {
+	case code == 1:
+		return 192, nil
+	case code >= 2 && code <= 5:
+		return 576 << (code - 2), nil
+	case code == 6:
+		value, err := br.readBits(8)
+		return int(value) + 1, err
+	case code == 7:
+		value, err := br.readBits(16)
+		return int(value) + 1, err
+	case code >= 8:
+		return 256 << (code - 8), nil
+	default:
+		return 0, fmt.Errorf("flac frame uses reserved block size")
+	}
+}
+
+func skipFrameSampleRate(br *bitReader, code uint64) error {
+	switch code {
+	case 12:
+		_, err := br.readBits(8)
+		return err
+	case 13, 14:
+		_, err := br.readBits(16)
+		return err
+	case 15:
+		return fmt.Errorf("flac frame uses invalid sample rate")
+	default:
+		return nil
+	}
+}
+
+func frameBitsPerSample(code uint64, streamBits int) (int, error) {
+	switch code {
+	case 0:
+		return streamBits, nil
+	case 1:
+		return 8, nil
+	case 2:
+		return 12, nil
+	case 4:
+		return 16, nil
+	case 5:
+		return 20, nil
+	case 6:
+		return 24, nil
+	case 7:
+		return 32, nil
+	default:
+		return 0, fmt.Errorf("flac frame uses reserved sample size")
+	}
+}
+
+func decodeSubframe(br *bitReader, blockSize, bps int) ([]int32, error) {
+	header, err := br.readBits(8)
+	if err != nil {
+		return nil, err
+	}
+	if header&0x80 != 0 {
+		return nil, fmt.Errorf("invalid subframe padding")
+	}
+	kind := (header >> 1) & 0x3f
+
+	wasted := 0
+	if header&1 != 0 {
+		zeros, err := br.readUnary()
+		if err != nil {
+			return nil, err
+		}
+		wasted = int(zeros) + 1
+		bps -= wasted
+	}
+
+	samples := make([]int32, blockSize)
+	switch {
+	case kind == 0:
+		value, err := br.readSigned(bps)
+		if err != nil {
+			return nil, err
+		}
+		for i := range samples {
+			samples[i] = value
+		}
+	case kind == 1:
+		for i := range samples {
+			if samples[i], err = br.readSigned(bps); err != nil {
+				return nil, err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		if err := decodeFixed(br, samples, int(kind-8), bps); err != nil {
+			return nil, err
+		}
+	case kind >= 32:
+		if err := decodeLPC(br, samples, int(kind-31), bps); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("reserved subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return samples, nil
+}
+
+var fixedCoefficients = [][]int64{
+	{},
+	{1},
+	{2, -1},
+	{3, -3, 1},
+	{4, -6, 4, -1},
+}
+
+func decodeFixed(br *bitReader, samples []int32, order, bps int) error {
+	if order > len(samples) {
+		return fmt.Errorf("fixed predictor order exceeds block size")
+	}
+	for i := 0; i < order; i++ {
+		value, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = value
+	}
+	if err := decodeResidual(br, samples, order); err != nil {
+		return err
+	}
+	predict(samples, fixedCoefficients[order], 0)
+	return nil
+}
+
+func decodeLPC(br *bitReader, samples []int32, order, bps int) error {
+	if order > len(samples) {
+		return fmt.Errorf("lpc order exceeds block size")
+	}
+	for i := 0; i < order; i++ {
+		value, err := br.readSigned(bps)
+		if err != nil {
+			return err
+		}
+		samples[i] = value
+	}
+
+	precisionCode, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	if precisionCode == 0xf {
+		return fmt.Errorf("invalid lpc coefficient precision")
+	}
+	precision := int(precisionCode) + 1
+
+	shiftValue, err := br.readSigned(5)
+	if err != nil {
+		return err
+	}
+	if shiftValue < 0 {
+		return fmt.Errorf("negative lpc shift is not supported")
+	}
+
+	coefficients := make([]int64, order)
+	for i := range coefficients {
+		value, err := br.readSigned(precision)
+		if err != nil {
+			return err
+		}
+		coefficients[i] = int64(value)
+	}
+
+	if err := decodeResidual(br, samples, order); err != nil {
+		return err
+	}
+	predict(samples, coefficients, uint(shiftValue))
+	return nil
+}
+
+// predict restores samples in place: samples[order:] hold residuals on entry.
+func predict(samples []int32, coefficients []int64, shift uint) {
+	order := len(coefficients)
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, coefficient := range coefficients {
+			sum += coefficient * int64(samples[i-1-j])
+		}
+		samples[i] += int32(sum >> shift)
+	}
+}
+
+func decodeResidual(br *bitReader, samples []int32, order int) error {
+	method, err := br.readBits(2)
+	if err != nil {
+		return err
+	}
+	paramBits, escape := 4, uint64(0xf)
+	switch method {
+	case 0:
+	case 1:
+		paramBits, escape = 5, 0x1f
+	default:
+		return fmt.Errorf("reserved residual coding method %d", method)
+	}
+
+	partitionOrder, err := br.readBits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	partitionSize := len(samples) >> partitionOrder
+	if partitionSize<<partitionOrder != len(samples) || partitionSize < order {
+		return fmt.Errorf("invalid residual partition order %d", partitionOrder)
+	}
+
+	pos := order
+	for partition := 0; partition < partitions; partition++ {
+		count := partitionSize
+		if partition == 0 {
+			count -= order
+		}
+
+		param, err := br.readBits(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			width, err := br.readBits(5)
+			if err != nil {
+				return err
+			}
+			for i := 0; i < count; i++ {
+				value := int32(0)
+				if width > 0 {
+					if value, err = br.readSigned(int(width)); err != nil {
+						return err
+					}
+				}
+				samples[pos] = value
+				pos++
+			}
+			continue
+		}
+
+		for i := 0; i < count; i++ {
+			quotient, err := br.readUnary()
+			if err != nil {
+				return err
+			}
+			low, err := br.readBits(int(param))
+			if err != nil {
+				return err
+			}
+			folded := quotient<<param | low
+			samples[pos] = int32(folded>>1) ^ -int32(folded&1)
+			pos++
+		}
+	}
+	return nil
+}
+
+func decorrelate(channels [][]int32, assignment int) {
+	switch assignment {
+	case channelsLeftSide:
+		left, side := channels[0], channels[1]
+		for i := range side {
+			side[i] = left[i] - side[i]
+		}
+	case channelsSideRight:
+		side, right := channels[0], channels[1]
+		for i := range side {
+			side[i] += right[i]
+		}
+	case channelsMidSide:
+		mid, side := channels[0], channels[1]
+		for i := range mid {
+			m := int64(mid[i])<<1 | int64(side[i]&1)
+			s := int64(side[i])
+			mid[i] = int32((m + s) >> 1)
+			side[i] = int32((m - s) >> 1)
+		}
+	}
+}
+
+type bitReader struct {
+	r        *bufio.Reader
+	cache    uint64
+	bits     uint
+	consumed int
+}
+
+func (b *bitReader) readBits(n int) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	for b.bits < uint(n) {
+		next, err := b.r.ReadByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		b.cache = b.cache<<8 | uint64(next)
+		b.bits += 8
+		b.consumed++
+	}
+	b.bits -= uint(n)
+	value := b.cache >> b.bits & (1<<uint(n) - 1)
+	b.cache &= 1<<b.bits - 1
+	return value, nil
+}
+
+func (b *bitReader) readSigned(n int) (int32, error) {
+	value, err := b.readBits(n)
+	if err != nil {
+		return 0, err
+	}
+	shift := 64 - uint(n)
+	return int32(int64(value<<shift) >> shift), nil
+}
+
+func (b *bitReader) readUnary() (uint64, error) {
+	var count uint64
+	for {
+		bit, err := b.readBits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			return count, nil
+		}
+		count++
+	}
+}
+
+func (b *bitReader) alignToByte() {
+	b.bits -= b.bits % 8
+	b.cache &= 1<<b.bits - 1
+}
+
+func (b *bitReader) skipUTF8Number() error {
+	first, err := b.readBits(8)
+	if err != nil {
+		return err
+	}
+	extra := 0
+	for mask := uint64(0x80); mask > 0 && first&mask != 0; mask >>= 1 {
+		extra++
+	}
+	if extra == 1 || extra > 7 {
+		return fmt.Errorf("invalid flac frame number encoding")
+	}
+	if extra > 0 {
+		extra--
+	}
+	_, err = b.readBits(8 * extra)
+	return err
+}
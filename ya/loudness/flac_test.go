@@ -0,0 +1,286 @@
+package loudness
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeFLACRestoresEverySubframeTypeAndStereoMode(t *testing.T) {
+	left, right := testStereoSignal(10000)
+
+	tests := []struct {
+		name       string
+		assignment int
+		subframe   testSubframeKind
+		blockSize  int
+	}{
+		{name: "verbatim independent", assignment: channelsIndependent, subframe: subframeVerbatim, blockSize: 4096},
+		{name: "fixed left side", assignment: channelsLeftSide, subframe: subframeFixed, blockSize: 4096},
+		{name: "lpc side right", assignment: channelsSideRight, subframe: subframeLPC, blockSize: 1152},
+		{name: "lpc mid side", assignment: channelsMidSide, subframe: subframeLPC, blockSize: 4608},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := encodeTestFLAC(48000, 16, [][]int32{left, right}, tt.blockSize, tt.assignment, tt.subframe)
+
+			var gotLeft, gotRight []int32
+			info, err := DecodeFLAC(bytes.NewReader(stream), func(info StreamInfo, channels [][]int32) error {
+				require.Len(t, channels, 2)
+				gotLeft = append(gotLeft, channels[0]...)
+				gotRight = append(gotRight, channels[1]...)
+				return nil
+			})
+
+			require.NoError(t, err)
+			assert.Equal(t, StreamInfo{SampleRate: 48000, Channels: 2, BitsPerSample: 16, TotalSamples: uint64(len(left))}, info)
+			assert.Equal(t, left, gotLeft)
+			assert.Equal(t, right, gotRight)
+		})
+	}
+}
+
+func TestDecodeFLACRestoresConstantSubframes(t *testing.T) {
+	samples := make([]int32, 300)
+	for i := range samples {
+		samples[i] = -1234
+	}
+	stream := encodeTestFLAC(44100, 16, [][]int32{samples}, 256, channelsIndependent, subframeConstant)
+
+	var got []int32
+	_, err := DecodeFLAC(bytes.NewReader(stream), func(_ StreamInfo, channels [][]int32) error {
+		got = append(got, channels[0]...)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, samples, got)
+}
+
+func TestDecodeFLACRejectsNonFLACInput(t *testing.T) {
+	_, err := DecodeFLAC(bytes.NewReader([]byte("ID3\x04")), func(StreamInfo, [][]int32) error { return nil })
+
+	assert.ErrorIs(t, err, ErrNotFLAC)
+}
+
+func TestDecodeFLACReportsTruncatedFrames(t *testing.T) {
+	left, right := testStereoSignal(4096)
+	stream := encodeTestFLAC(48000, 16, [][]int32{left, right}, 4096, channelsLeftSide, subframeFixed)
+
+	_, err := DecodeFLAC(bytes.NewReader(stream[:len(stream)-100]), func(StreamInfo, [][]int32) error { return nil })
+
+	require.Error(t, err)
+}
+
+func TestAnalyzeFLACMeasuresReferenceSine(t *testing.T) {
+	const amplitudeDBFS = -23.0
+	left := sineSamples(48000, 5*48000, 1000, amplitudeDBFS, 16)
+	stream := encodeTestFLAC(48000, 16, [][]int32{left, left}, 4096, channelsMidSide, subframeLPC)
+
+	result, err := AnalyzeFLAC(bytes.NewReader(stream))
+
+	require.NoError(t, err)
+	assert.InDelta(t, -23.0, result.IntegratedLUFS, 0.1)
+	assert.InDelta(t, math.Pow(10, amplitudeDBFS/20), result.SamplePeak, 0.001)
+}
+
+type testSubframeKind int
+
+const (
+	subframeConstant testSubframeKind = iota
+	subframeVerbatim
+	subframeFixed
+	subframeLPC
+)
+
+func testStereoSignal(length int) ([]int32, []int32) {
+	left := make([]int32, length)
+	right := make([]int32, length)
+	for i := range left {
+		left[i] = int32(12000*math.Sin(float64(i)*0.031) + 3000*math.Sin(float64(i)*0.47))
+		right[i] = int32(9000*math.Cos(float64(i)*0.017) - float64(i%97)*20)
+	}
+	return left, right
+}
+
+func sineSamples(sampleRate, length int, frequency, amplitudeDBFS float64, bits int) []int32 {
+	amplitude := math.Pow(10, amplitudeDBFS/20) * float64(int64(1)<<(bits-1))
+	samples := make([]int32, length)
+	for i := range samples {
+		samples[i] = int32(math.Round(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate))))
+	}
+	return samples
+}
+
+// encodeTestFLAC writes a spec-conforming FLAC stream with a single
+// subframe type so decoder tests do not depend on an external encoder.
+func encodeTestFLAC(sampleRate, bps int, channels [][]int32, blockSize, assignment int, kind testSubframeKind) []byte {
+	total := len(channels[0])
+	w := &testBitWriter{}
+	w.bytes([]byte("fLaC"))
+	w.write(0x80, 8)
+	w.write(34, 24)
+	w.write(uint64(blockSize), 16)
+	w.write(uint64(blockSize), 16)
+	w.write(0, 24)
+	w.write(0, 24)
+	w.write(uint64(sampleRate), 20)
+	w.write(uint64(len(channels)-1), 3)
+	w.write(uint64(bps-1), 5)
+	w.write(uint64(total), 36)
+	w.bytes(make([]byte, 16))
+
+	channelCode := uint64(len(channels) - 1)
+	switch assignment {
+	case channelsLeftSide:
+		channelCode = 8
+	case channelsSideRight:
+		channelCode = 9
+	case channelsMidSide:
+		channelCode = 10
+	}
+
+	for frame, start := 0, 0; start < total; frame, start = frame+1, start+blockSize {
+		end := start + blockSize
+		if end > total {
+			end = total
+		}
+		size := end - start
+
+		w.write(0x3ffe, 14)
+		w.write(0, 2)
+		w.write(7, 4)
+		w.write(0, 4)
+		w.write(channelCode, 4)
+		w.write(4, 3)
+		w.write(0, 1)
+		w.write(uint64(frame), 8)
+		w.write(uint64(size-1), 16)
+		w.write(0, 8)
+
+		subframes, widths := splitTestChannels(channels, start, end, bps, assignment)
+		for i, samples := range subframes {
+			writeTestSubframe(w, samples, widths[i], kind)
+		}
+		w.align()
+		w.write(0, 16)
+	}
+	return w.buf
+}
+
+func splitTestChannels(channels [][]int32, start, end, bps, assignment int) ([][]int32, []int) {
+	if assignment == channelsIndependent {
+		out := make([][]int32, len(channels))
+		widths := make([]int, len(channels))
+		for i, channel := range channels {
+			out[i] = channel[start:end]
+			widths[i] = bps
+		}
+		return out, widths
+	}
+
+	left, right := channels[0][start:end], channels[1][start:end]
+	side := make([]int32, len(left))
+	mid := make([]int32, len(left))
+	for i := range left {
+		side[i] = left[i] - right[i]
+		mid[i] = (left[i] + right[i]) >> 1
+	}
+	switch assignment {
+	case channelsLeftSide:
+		return [][]int32{left, side}, []int{bps, bps + 1}
+	case channelsSideRight:
+		return [][]int32{side, right}, []int{bps + 1, bps}
+	default:
+		return [][]int32{mid, side}, []int{bps, bps + 1}
+	}
+}
+
+func writeTestSubframe(w *testBitWriter, samples []int32, bps int, kind testSubframeKind) {
+	switch kind {
+	case subframeConstant:
+		w.write(0, 8)
+		w.writeSigned(int64(samples[0]), bps)
+	case subframeVerbatim:
+		w.write(1<<1, 8)
+		for _, sample := range samples {
+			w.writeSigned(int64(sample), bps)
+		}
+	case subframeFixed:
+		w.write((8+2)<<1, 8)
+		w.writeSigned(int64(samples[0]), bps)
+		w.writeSigned(int64(samples[1]), bps)
+		residual := make([]int64, 0, len(samples))
+		for i := 2; i < len(samples); i++ {
+			residual = append(residual, int64(samples[i])-(2*int64(samples[i-1])-int64(samples[i-2])))
+		}
+		writeTestResidual(w, residual)
+	case subframeLPC:
+		// Order-2 predictor (4*s[n-1] - 2*s[n-2]) >> 1 exercises precision and shift.
+		w.write((32+1)<<1, 8)
+		w.writeSigned(int64(samples[0]), bps)
+		w.writeSigned(int64(samples[1]), bps)
+		w.write(14, 4)
+		w.writeSigned(1, 5)
+		w.writeSigned(4, 15)
+		w.writeSigned(-2, 15)
+		residual := make([]int64, 0, len(samples))
+		for i := 2; i < len(samples); i++ {
+			prediction := (4*int64(samples[i-1]) - 2*int64(samples[i-2])) >> 1
+			residual = append(residual, int64(samples[i])-prediction)
+		}
+		writeTestResidual(w, residual)
+	}
+}
+
+func writeTestResidual(w *testBitWriter, residual []int64) {
+	const riceParameter = 6
+	w.write(0, 2)
+	w.write(0, 4)
+	w.write(riceParameter, 4)
+	for _, value := range residual {
+		folded := uint64(value<<1) ^ uint64(value>>63)
+		for q := folded >> riceParameter; q > 0; q-- {
+			w.write(0, 1)
+		}
+		w.write(1, 1)
+		w.write(folded&(1<<riceParameter-1), riceParameter)
+	}
+}
+
+type testBitWriter struct {
+	buf   []byte
+	cache uint64
+	bits  uint
+}
+
+func (w *testBitWriter) write(value uint64, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		w.cache = w.cache<<1 | (value>>uint(i))&1
+		w.bits++
+		if w.bits == 8 {
+			w.buf = append(w.buf, byte(w.cache))
+			w.cache, w.bits = 0, 0
+		}
+	}
+}
+
+func (w *testBitWriter) writeSigned(value int64, bits int) {
+	w.write(uint64(value)&(1<<uint(bits)-1), bits)
+}
+
+func (w *testBitWriter) bytes(data []byte) {
+	for _, b := range data {
+		w.write(uint64(b), 8)
+	}
+}
+
+func (w *testBitWriter) align() {
+	for w.bits != 0 {
+		w.write(0, 1)
+	}
+}
@@ -0,0 +1,264 @@
+// Package loudness measures EBU R128 loudness of decoded audio for ReplayGain tagging.
+package loudness
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	absoluteGateLUFS = -70.0
+	relativeGateLU   = -10.0
+	subBlocksPerGate = 4 // 400 ms gating blocks built from 100 ms steps (75% overlap)
+)
+
+// Result is the measured loudness of a stream.
+type Result struct {
+	// IntegratedLUFS is the gated integrated loudness in LUFS.
+	IntegratedLUFS float64
+	// SamplePeak is the largest absolute sample value, where 1.0 is full scale.
+	SamplePeak float64
+}
+
+// Meter accumulates interleaved PCM and reports EBU R128 integrated loudness.
+type Meter struct {
+	channels     int
+	weights      []float64
+	filters      []kWeightingFilter
+	stepSamples  int
+	stepPosition int
+	stepEnergy   float64
+	recentEnergy []float64
+	gatingBlocks []float64
+	samplePeak   float64
+}
+
+// NewMeter creates a meter for the given sample rate and channel count.
+func NewMeter(sampleRate, channels int) (*Meter, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate %d", sampleRate)
+	}
+	if channels <= 0 {
+		return nil, fmt.Errorf("invalid channel count %d", channels)
+	}
+
+	filters := make([]kWeightingFilter, channels)
+	for i := range filters {
+		filters[i] = newKWeightingFilter(float64(sampleRate))
+	}
+
+	return &Meter{
+		channels:    channels,
+		weights:     channelWeights(channels),
+		filters:     filters,
+		stepSamples: sampleRate / 10,
+	}, nil
+}
+
+// Add feeds interleaved samples normalized to [-1, 1].
+func (m *Meter) Add(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		var energy float64
+		for ch := 0; ch < m.channels; ch++ {
+			sample := samples[i+ch]
+			if peak := math.Abs(sample); peak > m.samplePeak {
+				m.samplePeak = peak
+			}
+			filtered := m.filters[ch].process(sample)
+			energy += m.weights[ch] * filtered * filtered
+		}
+		m.addFrameEnergy(energy)
+	}
+}
+
+func (m *Meter) addFrameEnergy(energy float64) {
+	m.stepEnergy += energy
+	m.stepPosition++
+	if m.stepPosition < m.stepSamples {
+		return
+	}
+
+	m.recentEnergy = append(m.recentEnergy, m.stepEnergy)
+	if len(m.recentEnergy) > subBlocksPerGate {
+		m.recentEnergy = m.recentEnergy[1:]
+	}
+	if len(m.recentEnergy) == subBlocksPerGate {
+		var sum float64
+		for _, value := range m.recentEnergy {
+			sum += value
+		}
+		m.gatingBlocks = append(m.gatingBlocks, sum/float64(m.stepSamples*subBlocksPerGate))
+	}
+	m.stepEnergy = 0
+	m.stepPosition = 0
+}
+
+// Result returns the gated integrated loudness; silence and streams shorter
+// than one gating block report negative infinity.
+func (m *Meter) Result() Result {
+	return Result{
+		IntegratedLUFS: integratedLoudness(m.gatingBlocks),
+		SamplePeak:     m.samplePeak,
+	}
+}
+
+func integratedLoudness(blocks []float64) float64 {
+	absoluteGate := energyFromLoudness(absoluteGateLUFS)
+	var sum float64
+	var count int
+	for _, energy := range blocks {
+		if energy > absoluteGate {
+			sum += energy
+			count++
+		}
+	}
+	if count == 0 {
+		return math.Inf(-1)
+	}
+
+	relativeGate := energyFromLoudness(loudnessFromEnergy(sum/float64(count)) + relativeGateLU)
+	sum, count = 0, 0
+	for _, energy := range blocks {
+		if energy > absoluteGate && energy > relativeGate {
+			sum += energy
+			count++
+		}
+	}
+	if count == 0 {
+		return math.Inf(-1)
+	}
+	return loudnessFromEnergy(sum / float64(count))
+}
+
+func loudnessFromEnergy(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func energyFromLoudness(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+// channelWeights follows BS.1770: front channels count once, surrounds
+// count 1.41 and the LFE channel of a 5.1 layout is ignored.
+func channelWeights(channels int) []float64 {
+	weights := make([]float64, channels)
+	for i := range weights {
+		weights[i] = 1
+	}
+	if channels == 6 {
+		weights[3] = 0
+		weights[4] = 1.41
+		weights[5] = 1.41
+	}
+	return weights
+}
+
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+	z1, z2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+type kWeightingFilter struct {
+	shelf    biquad
+	highPass biquad
+}
+
+func (f *kWeightingFilter) process(x float64) float64 {
+	return f.highPass.process(f.shelf.process(x))
+}
+
+// newKWeightingFilter derives the BS.1770 pre-filter and RLB high-pass for
+// any sample rate, matching the published 48 kHz coefficients.
+func newKWeightingFilter(sampleRate float64) kWeightingFilter {
+	const (
+		shelfFrequency = 1681.974450955533
+		shelfGainDB    = 3.999843853973347
+		shelfQ         = 0.7071752369554196
+		highFrequency  = 38.13547087602444
+		highQ          = 0.5003270373238773
+	)
+
+	k := math.Tan(math.Pi * shelfFrequency / sampleRate)
+	vh := math.Pow(10, shelfGainDB/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * highFrequency / sampleRate)
+	a0 = 1 + k/highQ + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/highQ + k*k) / a0,
+	}
+
+	return kWeightingFilter{shelf: shelf, highPass: highPass}
+}
+
+// AnalyzeFLAC decodes a native FLAC stream and measures its loudness.
+func AnalyzeFLAC(r io.Reader) (Result, error) {
+	var meter *Meter
+	var interleaved []float64
+	_, err := DecodeFLAC(r, func(info StreamInfo, channels [][]int32) error {
+		if meter == nil {
+			if info.BitsPerSample <= 0 || info.BitsPerSample > 32 {
+				return fmt.Errorf("unsupported flac sample size %d", info.BitsPerSample)
+			}
+			created, err := NewMeter(info.SampleRate, len(channels))
+			if err != nil {
+				return err
+			}
+			meter = created
+		}
+		if len(channels) != meter.channels {
+			return fmt.Errorf("flac channel count changed mid-stream")
+		}
+
+		scale := 1 / float64(int64(1)<<(info.BitsPerSample-1))
+		frames := len(channels[0])
+		interleaved = interleaved[:0]
+		for i := 0; i < frames; i++ {
+			for _, channel := range channels {
+				interleaved = append(interleaved, float64(channel[i])*scale)
+			}
+		}
+		meter.Add(interleaved)
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	if meter == nil {
+		return Result{}, fmt.Errorf("flac stream has no audio frames")
+	}
+	return meter.Result(), nil
+}
+
+// AnalyzeFLACFile measures the loudness of a FLAC file on disk.
+func AnalyzeFLACFile(path string) (Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close()
+
+	return AnalyzeFLAC(file)
+}
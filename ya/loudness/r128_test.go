@@ -0,0 +1,63 @@
+package loudness
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeterMeasuresReferenceSineAtCommonSampleRates(t *testing.T) {
+	for _, sampleRate := range []int{44100, 48000, 96000} {
+		meter, err := NewMeter(sampleRate, 2)
+		require.NoError(t, err)
+
+		meter.Add(interleavedSine(sampleRate, 5*sampleRate, 1000, -23, 2))
+
+		result := meter.Result()
+		assert.InDelta(t, -23.0, result.IntegratedLUFS, 0.1, "sample rate %d", sampleRate)
+		assert.InDelta(t, math.Pow(10, -23.0/20), result.SamplePeak, 1e-6)
+	}
+}
+
+func TestMeterRelativeGateIgnoresQuietPassages(t *testing.T) {
+	meter, err := NewMeter(48000, 2)
+	require.NoError(t, err)
+
+	meter.Add(interleavedSine(48000, 10*48000, 1000, -20, 2))
+	meter.Add(interleavedSine(48000, 10*48000, 1000, -60, 2))
+
+	assert.InDelta(t, -20.0, meter.Result().IntegratedLUFS, 0.2)
+}
+
+func TestMeterReportsSilenceAsNegativeInfinity(t *testing.T) {
+	meter, err := NewMeter(48000, 1)
+	require.NoError(t, err)
+
+	meter.Add(make([]float64, 48000))
+
+	result := meter.Result()
+	assert.True(t, math.IsInf(result.IntegratedLUFS, -1))
+	assert.Zero(t, result.SamplePeak)
+}
+
+func TestNewMeterRejectsInvalidFormat(t *testing.T) {
+	_, err := NewMeter(0, 2)
+	assert.Error(t, err)
+
+	_, err = NewMeter(48000, 0)
+	assert.Error(t, err)
+}
+
+func interleavedSine(sampleRate, frames int, frequency, amplitudeDBFS float64, channels int) []float64 {
+	amplitude := math.Pow(10, amplitudeDBFS/20)
+	samples := make([]float64, 0, frames*channels)
+	for i := 0; i < frames; i++ {
+		value := amplitude * math.Sin(2*math.Pi*frequency*float64(i)/float64(sampleRate))
+		for ch := 0; ch < channels; ch++ {
+			samples = append(samples, value)
+		}
+	}
+	return samples
+}
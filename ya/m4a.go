@@ -14,6 +14,8 @@ import (
 const (
 	maxM4ATaggingFileSize = 2 << 30
 	m4aSourceURLField     = "----:com.yandex-music-downloader:source-url"
+	m4aSourceFieldPrefix  = "----:com.yandex-music-downloader:"
+	m4aITunesFieldPrefix  = "----:com.apple.iTunes:"
 )
 
 var m4aTaggingFileSizeLimit int64 = maxM4ATaggingFileSize
@@ -32,13 +34,16 @@ type m4aTagInput struct {
 	SourceURL   string
 	CoverMIME   string
 	CoverData   []byte
+	ReplayGain  []replayGainField
+	Identifiers []trackIdentifier
 }
 
 func m4aTagInputForTrack(track model.Track, album model.Album, coverMIME string, cover []byte) m4aTagInput {
 	tags := m4aTagInput{
-		Title:     strings.TrimSpace(track.FullTitle()),
-		Artist:    strings.TrimSpace(track.ArtistsString()),
-		SourceURL: yandexTrackURL(track),
+		Title:       strings.TrimSpace(track.FullTitle()),
+		Artist:      strings.TrimSpace(track.ArtistsString()),
+		SourceURL:   yandexTrackURL(track),
+		Identifiers: trackIdentifiers(track),
 	}
 
 	if albumTitle := strings.TrimSpace(album.Title); albumTitle != "" {
@@ -73,6 +78,18 @@ func m4aTagInputForTrack(track model.Track, album model.Album, coverMIME string,
 	return tags
 }
 
+// m4aIdentifierField maps an identifier to its freeform atom: ISRC and
+// BARCODE use the iTunes names Picard reads, Yandex IDs use the app namespace.
+func m4aIdentifierField(key string) string {
+	switch key {
+	case identifierISRC, identifierBarcode:
+		return m4aITunesFieldPrefix + key
+	default:
+		name := strings.TrimPrefix(key, "YANDEX_")
+		return m4aSourceFieldPrefix + strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	}
+}
+
 func readM4ACoverData(coverPath string) (string, []byte, bool) {
 	if strings.TrimSpace(coverPath) == "" {
 		return "", nil, false
@@ -144,6 +161,13 @@ func writeM4ATags(path string, tags m4aTagInput) error {
 	if value := strings.TrimSpace(tags.SourceURL); value != "" {
 		file.SetCustomValues(m4aSourceURLField, value)
 	}
+	for _, identifier := range tags.Identifiers {
+		file.SetCustomValues(m4aIdentifierField(identifier.Key), identifier.Values...)
+	}
+	for _, field := range tags.ReplayGain {
+		// Freeform ReplayGain atoms conventionally use lower-case names.
+		file.SetCustomValues(m4aITunesFieldPrefix+strings.ToLower(field.Key), field.Value)
+	}
 	if strings.TrimSpace(tags.CoverMIME) != "" && len(tags.CoverData) > 0 {
 		// Append rather than SetCoverArt: MP4 SetCoverArt removes every
 		// existing covr atom, which would discard third-party cover art.
@@ -27,9 +27,10 @@ func TestM4ATagInputForTrack(t *testing.T) {
 			name: "full album",
 			track: model.Track{
 				ID:      model.FlexibleID("123"),
+				ISRC:    "usabc2500001",
 				Title:   "Song",
 				Version: "Live",
-				Artists: []model.Artist{{Name: "Artist A"}, {Name: "Artist B"}},
+				Artists: []model.Artist{{ID: "1", Name: "Artist A"}, {ID: "2", Name: "Artist B"}},
 				Albums: []model.Album{{
 					ID:    model.FlexibleID("456"),
 					Title: "Album",
@@ -64,6 +65,11 @@ func TestM4ATagInputForTrack(t *testing.T) {
 				SourceURL:   "https://music.yandex.ru/album/456/track/123",
 				CoverMIME:   "image/png",
 				CoverData:   cover,
+				Identifiers: []trackIdentifier{
+					{Key: identifierISRC, Values: []string{"USABC2500001"}},
+					{Key: identifierYandexAlbum, Values: []string{"456"}},
+					{Key: identifierYandexArtists, Values: []string{"1", "2"}},
+				},
 			},
 		},
 		{
@@ -100,6 +106,7 @@ func TestM4ATagInputForTrack(t *testing.T) {
 				Album:       "Album",
 				AlbumArtist: "Artist",
 				SourceURL:   "https://music.yandex.ru/album/8/track/7",
+				Identifiers: []trackIdentifier{{Key: identifierYandexAlbum, Values: []string{"8"}}},
 			},
 		},
 		{
@@ -126,6 +133,7 @@ func TestM4ATagInputForTrack(t *testing.T) {
 				AlbumArtist: "Artist",
 				Year:        2020,
 				SourceURL:   "https://music.yandex.ru/album/6/track/5",
+				Identifiers: []trackIdentifier{{Key: identifierYandexAlbum, Values: []string{"6"}}},
 			},
 		},
 		{
@@ -173,6 +181,9 @@ func TestWriteM4ATagsWritesFieldsAndCover(t *testing.T) {
 	assert.Equal(t, tags.Disc, file.Disc())
 	assert.Equal(t, tags.DiscTotal, file.DiscTotal())
 	assert.Equal(t, tags.SourceURL, file.CustomValue(m4aSourceURLField))
+	for _, identifier := range tags.Identifiers {
+		assert.Equal(t, identifier.Values[0], file.CustomValue(m4aIdentifierField(identifier.Key)))
+	}
 
 	images := file.Images()
 	require.Len(t, images, 1)
@@ -285,6 +296,9 @@ func TestWriteM4ATagsPreservesCO64(t *testing.T) {
 	assert.Equal(t, tags.Title, file.Title())
 	assert.Equal(t, tags.Artist, file.Artist())
 	assert.Equal(t, tags.SourceURL, file.CustomValue(m4aSourceURLField))
+	for _, identifier := range tags.Identifiers {
+		assert.Equal(t, identifier.Values[0], file.CustomValue(m4aIdentifierField(identifier.Key)))
+	}
 
 	audio := file.AudioProperties()
 	assert.NotEmpty(t, audio.Codec)
@@ -453,6 +467,10 @@ func sampleM4ATagInput(cover []byte) m4aTagInput {
 		SourceURL:   "https://music.yandex.ru/album/456/track/123",
 		CoverMIME:   "image/png",
 		CoverData:   cover,
+		Identifiers: []trackIdentifier{
+			{Key: identifierISRC, Values: []string{"USABC2500001"}},
+			{Key: identifierYandexAlbum, Values: []string{"456"}},
+		},
 	}
 }
 
@@ -483,6 +501,9 @@ func assertM4ATags(t *testing.T, path string, tags m4aTagInput) {
 	assert.Equal(t, tags.Disc, file.Disc())
 	assert.Equal(t, tags.DiscTotal, file.DiscTotal())
 	assert.Equal(t, tags.SourceURL, file.CustomValue(m4aSourceURLField))
+	for _, identifier := range tags.Identifiers {
+		assert.Equal(t, identifier.Values[0], file.CustomValue(m4aIdentifierField(identifier.Key)))
+	}
 
 	if len(tags.CoverData) == 0 {
 		return
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"slices"
+	"time"
+)
 
 type Account struct {
 	Birthday         string    `json:"birthday,omitempty"`
@@ -16,3 +19,71 @@ type Account struct {
 	ServiceAvailable bool      `json:"serviceAvailable"`
 	Uid              int       `json:"uid,omitempty"`
 }
+
+// Plus is the Yandex Plus subscription state of an account.
+type Plus struct {
+	HasPlus bool `json:"hasPlus"`
+}
+
+// PermissionHighQuality is the permission for high-quality and lossless
+// streams.
+const PermissionHighQuality = "high-quality"
+
+// Permissions are the features the account may use until Until. Default
+// applies once Until has passed.
+type Permissions struct {
+	Until   time.Time `json:"until"`
+	Values  []string  `json:"values,omitempty"`
+	Default []string  `json:"default,omitempty"`
+}
+
+// Subscription lists the paid subscriptions of an account.
+type Subscription struct {
+	AutoRenewable      []AutoRenewable `json:"autoRenewable,omitempty"`
+	HadAnySubscription bool            `json:"hadAnySubscription"`
+	CanStartTrial      bool            `json:"canStartTrial,omitempty"`
+}
+
+type AutoRenewable struct {
+	Expires  time.Time `json:"expires"`
+	Vendor   string    `json:"vendor,omitempty"`
+	Product  string    `json:"productId,omitempty"`
+	Finished bool      `json:"finished"`
+}
+
+// HasActiveSubscription reports a Plus subscription or an auto-renewable one
+// that has not finished or expired by the server time of the status.
+func (s Status) HasActiveSubscription() bool {
+	if s.Plus.HasPlus {
+		return true
+	}
+	now := s.now()
+	for _, subscription := range s.Subscription.AutoRenewable {
+		if !subscription.Finished && (subscription.Expires.IsZero() || subscription.Expires.After(now)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the account has the named permission at the server
+// time of the status.
+func (s Status) Can(permission string) bool {
+	values := s.Permissions.Values
+	if !s.Permissions.Until.IsZero() && !s.Permissions.Until.After(s.now()) {
+		values = s.Permissions.Default
+	}
+	return slices.Contains(values, permission)
+}
+
+// HasPermissions reports whether the status lists permissions at all.
+func (s Status) HasPermissions() bool {
+	return len(s.Permissions.Values) > 0 || len(s.Permissions.Default) > 0
+}
+
+func (s Status) now() time.Time {
+	if s.Account.Now.IsZero() {
+		return time.Now()
+	}
+	return s.Account.Now
+}
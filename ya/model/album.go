@@ -1,14 +1,23 @@
 package model
 
+// Album types that hold spoken word instead of music.
+const (
+	AlbumTypePodcast   = "podcast"
+	AlbumTypeAudiobook = "audiobook"
+)
+
 type Album struct {
 	ID            FlexibleID    `json:"id"`
 	Title         string        `json:"title"`
+	Type          string        `json:"type,omitempty"`
+	MetaType      string        `json:"metaType,omitempty"`
 	TrackCount    int           `json:"trackCount,omitempty"`
 	Available     bool          `json:"available"`
 	CoverURI      string        `json:"coverUri,omitempty"`
 	Genre         string        `json:"genre,omitempty"`
 	Year          int           `json:"year,omitempty"`
 	ReleaseDate   string        `json:"releaseDate,omitempty"`
+	Barcode       string        `json:"barcode,omitempty"`
 	TrackPosition TrackPosition `json:"trackPosition,omitempty"`
 	Volumes       [][]Track     `json:"volumes,omitempty"`
 }
@@ -17,3 +26,13 @@ type TrackPosition struct {
 	Volume int `json:"volume,omitempty"`
 	Index  int `json:"index,omitempty"`
 }
+
+// IsPodcast reports a podcast show; its tracks are episodes.
+func (a Album) IsPodcast() bool {
+	return a.Type == AlbumTypePodcast || a.MetaType == AlbumTypePodcast
+}
+
+// IsAudiobook reports an audiobook; its tracks are chapters.
+func (a Album) IsAudiobook() bool {
+	return a.Type == AlbumTypeAudiobook || a.MetaType == AlbumTypeAudiobook
+}
@@ -14,6 +14,7 @@ func TestTrackDecodesTypedAlbums(t *testing.T) {
 	err := json.Unmarshal([]byte(`{
 		"id": 123,
 		"title": "Track",
+		"isrc": "USABC2500001",
 		"albums": [{
 			"id": 456,
 			"title": "Album",
@@ -21,6 +22,7 @@ func TestTrackDecodesTypedAlbums(t *testing.T) {
 			"genre": "rock",
 			"year": 2024,
 			"releaseDate": "2024-01-02",
+			"barcode": "0123456789012",
 			"trackPosition": {"volume": 1, "index": 7}
 		}]
 	}`), &track)
@@ -33,6 +35,8 @@ func TestTrackDecodesTypedAlbums(t *testing.T) {
 	assert.Equal(t, "rock", track.Albums[0].Genre)
 	assert.Equal(t, 2024, track.Albums[0].Year)
 	assert.Equal(t, "2024-01-02", track.Albums[0].ReleaseDate)
+	assert.Equal(t, "USABC2500001", track.ISRC)
+	assert.Equal(t, "0123456789012", track.Albums[0].Barcode)
 	assert.Equal(t, 1, track.Albums[0].TrackPosition.Volume)
 	assert.Equal(t, 7, track.Albums[0].TrackPosition.Index)
 }
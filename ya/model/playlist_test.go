@@ -30,3 +30,12 @@ func TestPlaylistTracksList(t *testing.T) {
 		}
 	})
 }
+
+func TestTrackShortTrackID(t *testing.T) {
+	if got := (TrackShort{ID: "uuid", Track: Track{ID: "1"}}).TrackID(); got != "1" {
+		t.Fatalf("TrackID() with track data = %q, want 1", got)
+	}
+	if got := (TrackShort{ID: "2"}).TrackID(); got != "2" {
+		t.Fatalf("TrackID() without track data = %q, want 2", got)
+	}
+}
@@ -0,0 +1,7 @@
+package model
+
+// R128 is the EBU R128 loudness the API reports for a track.
+type R128 struct {
+	Integrated float64 `json:"i"`
+	TruePeak   float64 `json:"tp"`
+}
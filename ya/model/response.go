@@ -31,5 +31,8 @@ type TracksResponse struct {
 }
 
 type Status struct {
-	Account Account `json:"account"`
+	Account      Account      `json:"account"`
+	Plus         Plus         `json:"plus"`
+	Permissions  Permissions  `json:"permissions"`
+	Subscription Subscription `json:"subscription"`
 }
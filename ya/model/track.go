@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 type Track struct {
@@ -15,9 +16,37 @@ type Track struct {
 	DurationMs        int        `json:"durationMs"`
 	Filename          string     `json:"filename"`
 	ID                FlexibleID `json:"id"`
+	ISRC              string     `json:"isrc,omitempty"`
 	MetaData          MetaData   `json:"metaData,omitempty"`
+	R128              *R128      `json:"r128,omitempty"`
 	Title             string     `json:"title"`
 	Version           string     `json:"version"`
+	// Type is "podcast-episode" for podcast episodes and empty for music.
+	Type string `json:"type,omitempty"`
+	// PubDate and ShortDescription are only set for podcast episodes.
+	PubDate          string `json:"pubDate,omitempty"`
+	ShortDescription string `json:"shortDescription,omitempty"`
+}
+
+const trackTypePodcastEpisode = "podcast-episode"
+
+// IsPodcastEpisode reports a track of a podcast.
+func (t Track) IsPodcastEpisode() bool {
+	return t.Type == trackTypePodcastEpisode || len(t.Albums) > 0 && t.Albums[0].IsPodcast()
+}
+
+// IsAudiobookChapter reports a track of an audiobook.
+func (t Track) IsAudiobookChapter() bool {
+	return len(t.Albums) > 0 && t.Albums[0].IsAudiobook()
+}
+
+// Published returns the publication time of a podcast episode.
+func (t Track) Published() (time.Time, bool) {
+	published, err := time.Parse(time.RFC3339, strings.TrimSpace(t.PubDate))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return published, true
 }
 
 func (t Track) FullTitle() string {
@@ -6,7 +6,17 @@ type TrackShort struct {
 	ID                   FlexibleID `json:"id"`
 	OriginalIndex        int        `json:"originalIndex"`
 	Timestamp            time.Time  `json:"timestamp"`
+	AlbumID              FlexibleID `json:"albumId,omitempty"`
 	Track                Track      `json:"track"`
 	Recent               bool       `json:"recent"`
 	OriginalShuffleIndex int        `json:"originalShuffleIndex"`
 }
+
+// TrackID returns the ID of the referenced track. Playlists too large for the
+// API to embed track data carry it only in ID.
+func (s TrackShort) TrackID() string {
+	if id := s.Track.ID.String(); id != "" {
+		return id
+	}
+	return s.ID.String()
+}
@@ -1,5 +1,10 @@
 package ya
 
+import (
+	"ya-music/utils"
+	"ya-music/ya/model"
+)
+
 type AudioFormat string
 
 const (
@@ -7,14 +12,40 @@ const (
 	AudioFormatFLAC AudioFormat = "flac"
 )
 
+// LosslessContainer selects how FLAC audio delivered inside MP4 is saved.
+type LosslessContainer string
+
+const (
+	LosslessContainerMP4  LosslessContainer = "mp4"
+	LosslessContainerFLAC LosslessContainer = "flac"
+)
+
 type DownloadOptions struct {
 	SkipCover      bool
 	AudioFormat    AudioFormat
 	FilenameSuffix string
+	// ReplayGain writes ReplayGain track and album tags when loudness is known.
+	ReplayGain bool
+	// AlbumLoudness is the combined loudness of the track's album, if known.
+	AlbumLoudness *model.R128
+	// Upgrade replaces an existing MP3 of the same track with a lossless file.
+	Upgrade bool
+	// UpgradeArchiveDir receives replaced MP3 files; they are deleted when empty.
+	UpgradeArchiveDir string
+	// LosslessContainer set to flac remuxes flac-mp4 downloads into native
+	// FLAC files; the default keeps them as M4A.
+	LosslessContainer LosslessContainer
+	// Transcode converts downloads with ffmpeg before they are published.
+	Transcode *TranscodeProfile
+	// FFmpegPath overrides DefaultFFmpegPath.
+	FFmpegPath string
+	// Progress, when set, receives the bytes of the audio download as they
+	// arrive. Cover art and tagging are not reported.
+	Progress utils.ProgressFunc
 }
 
 func (o DownloadOptions) FormatOrDefault() AudioFormat {
-	if o.AudioFormat == AudioFormatFLAC {
+	if o.AudioFormat == AudioFormatFLAC || o.Upgrade {
 		return AudioFormatFLAC
 	}
 	return AudioFormatMP3
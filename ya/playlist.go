@@ -0,0 +1,186 @@
+package ya
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"ya-music/utils"
+	"ya-music/ya/model"
+)
+
+// tracksBatchSize is the number of track IDs sent in one /tracks request.
+const tracksBatchSize = 250
+
+// tracksBatchConcurrency is the number of /tracks requests in flight.
+const tracksBatchConcurrency = 4
+
+func (c *Client) TracksByIDs(ids []string) ([]model.Track, error) {
+	return c.TracksByIDsContext(c.cancelContext(), ids)
+}
+
+// TracksByIDsContext loads full track data for ids, in batches sent
+// concurrently. Tracks are returned in the order of ids; IDs the API does not
+// know are left out.
+func (c *Client) TracksByIDsContext(ctx context.Context, ids []string) ([]model.Track, error) {
+	var batches [][]string
+	for start := 0; start < len(ids); start += tracksBatchSize {
+		end := min(start+tracksBatchSize, len(ids))
+		batches = append(batches, ids[start:end])
+	}
+
+	results := make([][]model.Track, len(batches))
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, tracksBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Add(1)
+		go func(i int, batch []string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = c.fetchTracks(ctx, batch)
+		}(i, batch)
+	}
+	wg.Wait()
+
+	byID := make(map[string]model.Track, len(ids))
+	for i, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		for _, track := range results[i] {
+			byID[track.ID.String()] = track
+		}
+	}
+
+	tracks := make([]model.Track, 0, len(ids))
+	for _, id := range ids {
+		trackID, _, _ := strings.Cut(id, ":")
+		if track, ok := byID[trackID]; ok {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks, nil
+}
+
+func (c *Client) fetchTracks(ctx context.Context, ids []string) ([]model.Track, error) {
+	form := url.Values{}
+	form.Set("track-ids", strings.Join(ids, ","))
+	form.Set("with-positions", "false")
+
+	res, err := c.httpClient.PostFormContext(ctx, utils.RequestLogContext{}, fmt.Sprintf("%s/tracks", c.apiURL()), form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracks: %w", err)
+	}
+
+	var data model.TracksResponse
+	if err := parseResponse(res, &data); err != nil {
+		return nil, err
+	}
+	return data.Result, nil
+}
+
+// fetchPlaylist loads every page of the playlist at url and fills in the
+// tracks the API sent without their data.
+func (c *Client) fetchPlaylist(ctx context.Context, url string) (*model.Playlist, error) {
+	playlist, err := c.fetchPlaylistPage(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	pager := playlist.Pager
+	for page := pager.Page + 1; pager.PerPage > 0 && len(playlist.Tracks) < pager.Total; page++ {
+		next, err := c.fetchPlaylistPage(ctx, playlistPageURL(url, page, pager.PerPage))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get playlist page %d: %w", page, err)
+		}
+		if len(next.Tracks) == 0 {
+			break
+		}
+		playlist.Tracks = append(playlist.Tracks, next.Tracks...)
+	}
+
+	if err := c.completePlaylistTracks(ctx, playlist); err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+func (c *Client) fetchPlaylistPage(ctx context.Context, url string) (*model.Playlist, error) {
+	res, err := c.httpClient.GetContext(ctx, utils.RequestLogContext{}, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var data model.PlaylistResponse
+	if err := parseResponse(res, &data); err != nil {
+		return nil, err
+	}
+	return &data.Result, nil
+}
+
+func playlistPageURL(rawURL string, page, perPage int) string {
+	params := url.Values{}
+	params.Set("page", strconv.Itoa(page))
+	params.Set("pageSize", strconv.Itoa(perPage))
+
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return rawURL + separator + params.Encode()
+}
+
+// completePlaylistTracks replaces playlist entries that carry only a track ID
+// with the full track. Entries the API cannot resolve stay as they are and
+// are skipped as unavailable.
+func (c *Client) completePlaylistTracks(ctx context.Context, playlist *model.Playlist) error {
+	var ids []string
+	var positions []int
+	for i, short := range playlist.Tracks {
+		if short.Track.Title != "" {
+			continue
+		}
+		id := short.TrackID()
+		if id == "" {
+			continue
+		}
+		if albumID := short.AlbumID.String(); albumID != "" {
+			id += ":" + albumID
+		}
+		ids = append(ids, id)
+		positions = append(positions, i)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tracks, err := c.TracksByIDsContext(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("failed to complete playlist tracks: %w", err)
+	}
+	byID := make(map[string]model.Track, len(tracks))
+	for _, track := range tracks {
+		byID[track.ID.String()] = track
+	}
+
+	missing := 0
+	for _, i := range positions {
+		track, ok := byID[playlist.Tracks[i].TrackID()]
+		if !ok {
+			missing++
+			continue
+		}
+		playlist.Tracks[i].Track = track
+	}
+
+	c.Logger().Info("playlist tracks completed",
+		"stage", "resolve_playlist",
+		"requested", len(ids),
+		"missing", missing,
+	)
+	return nil
+}
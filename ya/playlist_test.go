@@ -0,0 +1,115 @@
+package ya
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"ya-music/utils"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPlaylistTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	httpClient := utils.NewHttpClient()
+	httpClient.SetTransport(&hostRewriteTransport{targetHost: server.Listener.Addr().String()})
+	return NewClient(httpClient)
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, value any) {
+	t.Helper()
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(t, json.NewEncoder(w).Encode(value))
+}
+
+func TestTracksByIDsBatchesRequestsAndKeepsOrder(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	client := newPlaylistTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "/tracks", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		ids := strings.Split(r.PostForm.Get("track-ids"), ",")
+		mu.Lock()
+		batches = append(batches, len(ids))
+		mu.Unlock()
+
+		var tracks []model.Track
+		for _, id := range ids {
+			trackID, _, _ := strings.Cut(id, ":")
+			if trackID == "404" {
+				continue
+			}
+			tracks = append(tracks, model.Track{ID: model.FlexibleID(trackID), Title: "Track " + trackID})
+		}
+		writeJSON(t, w, model.TracksResponse{Result: tracks})
+	})
+
+	ids := make([]string, 0, tracksBatchSize+2)
+	for i := range tracksBatchSize + 1 {
+		ids = append(ids, fmt.Sprint(i+1))
+	}
+	ids = append(ids, "404")
+
+	tracks, err := client.TracksByIDs(ids)
+
+	require.NoError(t, err)
+	require.Len(t, tracks, tracksBatchSize+1)
+	assert.Equal(t, "1", tracks[0].ID.String())
+	assert.Equal(t, fmt.Sprint(tracksBatchSize+1), tracks[tracksBatchSize].ID.String())
+	assert.ElementsMatch(t, []int{tracksBatchSize, 2}, batches)
+}
+
+func TestUsersPlaylistFollowsPagesAndFillsMissingTracks(t *testing.T) {
+	var requested []string
+	client := newPlaylistTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/users/user/playlists/3" && r.URL.Query().Get("page") == "":
+			writeJSON(t, w, model.PlaylistResponse{Result: model.Playlist{
+				Pager: model.Pager{Total: 3, Page: 0, PerPage: 2},
+				Tracks: []model.TrackShort{
+					{Track: model.Track{ID: "1", Title: "Full", Available: true}},
+					{ID: "2", AlbumID: "20"},
+				},
+			}})
+		case r.URL.Path == "/users/user/playlists/3":
+			assert.Equal(t, "1", r.URL.Query().Get("page"))
+			assert.Equal(t, "2", r.URL.Query().Get("pageSize"))
+			writeJSON(t, w, model.PlaylistResponse{Result: model.Playlist{
+				Tracks: []model.TrackShort{{ID: "3"}},
+			}})
+		case r.URL.Path == "/tracks":
+			require.NoError(t, r.ParseForm())
+			requested = append(requested, r.PostForm.Get("track-ids"))
+			writeJSON(t, w, model.TracksResponse{Result: []model.Track{
+				{ID: "2", Title: "Second", Available: true},
+				{ID: "3", Title: "Third", Available: true},
+			}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	playlist, err := client.UsersPlaylist("3", "user")
+
+	require.NoError(t, err)
+	tracks := playlist.TracksList()
+	require.Len(t, tracks, 3)
+	assert.Equal(t, []string{"Full", "Second", "Third"}, []string{tracks[0].Title, tracks[1].Title, tracks[2].Title})
+	assert.True(t, tracks[2].Available)
+	assert.Equal(t, []string{"2:20,3"}, requested)
+}
+
+func TestPlaylistPageURLAppendsPagingParameters(t *testing.T) {
+	assert.Equal(t, "https://api.test/playlist/x?page=2&pageSize=100", playlistPageURL("https://api.test/playlist/x", 2, 100))
+	assert.Equal(t, "https://api.test/p?a=1&page=1&pageSize=50", playlistPageURL("https://api.test/p?a=1", 1, 50))
+}
@@ -0,0 +1,58 @@
+package ya
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bogem/id3v2/v2"
+)
+
+// EpisodeTags are the tags yamdl writes to a downloaded podcast episode.
+type EpisodeTags struct {
+	TrackID     string
+	Title       string
+	Show        string
+	Author      string
+	Description string
+	// Published is the release time, written and read as UTC.
+	Published time.Time
+	Duration  time.Duration
+}
+
+// ReadEpisodeTags reads the podcast tags of the MP3 file at path. ok is false
+// when the file is not marked as a podcast episode.
+func ReadEpisodeTags(path string) (tags EpisodeTags, ok bool, err error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return EpisodeTags{}, false, fmt.Errorf("read ID3 tags: %w", err)
+	}
+	defer tag.Close()
+
+	if len(tag.GetFrames(podcastFrameID)) == 0 {
+		return EpisodeTags{}, false, nil
+	}
+	tags = EpisodeTags{
+		Title:  strings.TrimSpace(tag.Title()),
+		Show:   strings.TrimSpace(tag.Album()),
+		Author: strings.TrimSpace(tag.Artist()),
+	}
+	for _, frame := range tag.GetFrames(tag.CommonID("Unique file identifier")) {
+		if ufid, ok := frame.(id3v2.UFIDFrame); ok && ufid.OwnerIdentifier == yandexTrackOwnerIdentifier {
+			tags.TrackID = strings.TrimSpace(string(ufid.Identifier))
+		}
+	}
+	for _, frame := range tag.GetFrames(tag.CommonID("Comments")) {
+		if comment, ok := frame.(id3v2.CommentFrame); ok && comment.Description == "" {
+			tags.Description = strings.TrimSpace(comment.Text)
+		}
+	}
+	if published, err := time.Parse("2006-01-02T15:04:05", strings.TrimSpace(tag.GetTextFrame(releaseTimeFrameID).Text)); err == nil {
+		tags.Published = published
+	}
+	if ms, err := strconv.Atoi(strings.TrimSpace(tag.GetTextFrame(lengthFrameID).Text)); err == nil && ms > 0 {
+		tags.Duration = time.Duration(ms) * time.Millisecond
+	}
+	return tags, true, nil
+}
@@ -0,0 +1,73 @@
+package ya
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadEpisodeTagsReadsWrittenEpisode(t *testing.T) {
+	mp3Path := filepath.Join(t.TempDir(), "episode.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+	track := model.Track{
+		ID:               model.FlexibleID("123"),
+		Title:            "Pilot",
+		Artists:          []model.Artist{{Name: "Host"}},
+		DurationMs:       90500,
+		PubDate:          "2024-03-01T06:00:00+03:00",
+		ShortDescription: "The first episode.",
+		Albums:           []model.Album{{ID: "10", Title: "Show", Type: model.AlbumTypePodcast}},
+	}
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+
+	tags, ok, err := ReadEpisodeTags(mp3Path)
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, EpisodeTags{
+		TrackID:     "123",
+		Title:       "Pilot",
+		Show:        "Show",
+		Author:      "Host",
+		Description: "The first episode.",
+		Published:   time.Date(2024, 3, 1, 3, 0, 0, 0, time.UTC),
+		Duration:    90500 * time.Millisecond,
+	}, tags)
+}
+
+func TestReadEpisodeTagsKeepsReleaseTimeAcrossZones(t *testing.T) {
+	mp3Path := filepath.Join(t.TempDir(), "episode.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+	track := model.Track{
+		ID:      model.FlexibleID("124"),
+		Title:   "Late",
+		PubDate: "2024-03-01T22:30:00-05:00",
+		Albums:  []model.Album{{ID: "10", Title: "Show", Type: model.AlbumTypePodcast}},
+	}
+	published, ok := track.Published()
+	require.True(t, ok)
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+
+	tags, ok, err := ReadEpisodeTags(mp3Path)
+
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, published.Equal(tags.Published), "published %v, read %v", published, tags.Published)
+	assert.Equal(t, time.Date(2024, 3, 2, 3, 30, 0, 0, time.UTC), tags.Published)
+}
+
+func TestReadEpisodeTagsIgnoresMusic(t *testing.T) {
+	mp3Path := filepath.Join(t.TempDir(), "song.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+	require.NoError(t, writeID3Tags(mp3Path, model.Track{ID: model.FlexibleID("1"), Title: "Song"}, "", nil))
+
+	_, ok, err := ReadEpisodeTags(mp3Path)
+
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
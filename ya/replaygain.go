@@ -0,0 +1,220 @@
+package ya
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"ya-music/utils"
+	"ya-music/ya/loudness"
+	"ya-music/ya/model"
+)
+
+// replayGainReferenceLUFS is the ReplayGain 2.0 target loudness.
+const replayGainReferenceLUFS = -18.0
+
+const (
+	replayGainSourceAPI      = "api"
+	replayGainSourceAnalysis = "analysis"
+)
+
+type replayGain struct {
+	TrackGain float64
+	TrackPeak float64
+	HasAlbum  bool
+	AlbumGain float64
+	AlbumPeak float64
+	Source    string
+}
+
+type replayGainField struct {
+	Key   string
+	Value string
+}
+
+// fields returns the tag values in the upper-case naming used by FLAC and ID3 TXXX frames.
+func (g *replayGain) fields() []replayGainField {
+	if g == nil {
+		return nil
+	}
+
+	fields := []replayGainField{
+		{Key: "REPLAYGAIN_TRACK_GAIN", Value: formatReplayGainDB(g.TrackGain)},
+		{Key: "REPLAYGAIN_TRACK_PEAK", Value: formatReplayGainPeak(g.TrackPeak)},
+	}
+	if g.HasAlbum {
+		fields = append(fields,
+			replayGainField{Key: "REPLAYGAIN_ALBUM_GAIN", Value: formatReplayGainDB(g.AlbumGain)},
+			replayGainField{Key: "REPLAYGAIN_ALBUM_PEAK", Value: formatReplayGainPeak(g.AlbumPeak)},
+		)
+	}
+	return fields
+}
+
+func formatReplayGainDB(gain float64) string {
+	return fmt.Sprintf("%+.2f dB", gain)
+}
+
+func formatReplayGainPeak(peak float64) string {
+	return fmt.Sprintf("%.6f", peak)
+}
+
+func replayGainFromR128(track model.R128, album *model.R128) *replayGain {
+	gain := &replayGain{
+		TrackGain: replayGainReferenceLUFS - track.Integrated,
+		TrackPeak: peakFromDBTP(track.TruePeak),
+		Source:    replayGainSourceAPI,
+	}
+	if album != nil {
+		gain.HasAlbum = true
+		gain.AlbumGain = replayGainReferenceLUFS - album.Integrated
+		gain.AlbumPeak = peakFromDBTP(album.TruePeak)
+	}
+	return gain
+}
+
+func replayGainFromAnalysis(result loudness.Result) (*replayGain, error) {
+	if math.IsInf(result.IntegratedLUFS, 0) || math.IsNaN(result.IntegratedLUFS) {
+		return nil, fmt.Errorf("audio is too short or silent for loudness analysis")
+	}
+	return &replayGain{
+		TrackGain: replayGainReferenceLUFS - result.IntegratedLUFS,
+		TrackPeak: result.SamplePeak,
+		Source:    replayGainSourceAnalysis,
+	}, nil
+}
+
+func peakFromDBTP(truePeak float64) float64 {
+	return math.Pow(10, truePeak/20)
+}
+
+// AlbumLoudness combines API loudness for every album whose tracks are all
+// present in tracks, keyed by album ID. Albums with a missing track or
+// loudness value are left out so album gain is never computed from a subset.
+func AlbumLoudness(tracks []model.Track) map[string]model.R128 {
+	type albumTracks struct {
+		expected int
+		seen     map[string]model.Track
+		complete bool
+	}
+
+	albums := make(map[string]*albumTracks)
+	for _, track := range tracks {
+		album := firstAlbum(track)
+		if album == nil {
+			continue
+		}
+		albumID := strings.TrimSpace(album.ID.String())
+		trackID := strings.TrimSpace(track.ID.String())
+		if albumID == "" || trackID == "" {
+			continue
+		}
+
+		group := albums[albumID]
+		if group == nil {
+			group = &albumTracks{expected: album.TrackCount, seen: make(map[string]model.Track), complete: true}
+			albums[albumID] = group
+		}
+		if track.R128 == nil {
+			group.complete = false
+		}
+		group.seen[trackID] = track
+	}
+
+	result := make(map[string]model.R128)
+	for albumID, group := range albums {
+		if !group.complete || group.expected <= 0 || len(group.seen) != group.expected {
+			continue
+		}
+		result[albumID] = combineR128(group.seen)
+	}
+	return result
+}
+
+// AlbumLoudnessFor returns the entry of albums for track's first album, or nil
+// when the album loudness is unknown.
+func AlbumLoudnessFor(albums map[string]model.R128, track model.Track) *model.R128 {
+	album := firstAlbum(track)
+	if album == nil {
+		return nil
+	}
+	loudness, ok := albums[strings.TrimSpace(album.ID.String())]
+	if !ok {
+		return nil
+	}
+	return &loudness
+}
+
+// combineR128 averages track loudness in the energy domain weighted by
+// duration, which approximates gating the album as one programme.
+func combineR128(tracks map[string]model.Track) model.R128 {
+	var energy, weight float64
+	truePeak := math.Inf(-1)
+	for _, track := range tracks {
+		duration := float64(track.DurationMs)
+		if duration <= 0 {
+			duration = 1
+		}
+		energy += duration * math.Pow(10, track.R128.Integrated/10)
+		weight += duration
+		truePeak = math.Max(truePeak, track.R128.TruePeak)
+	}
+	return model.R128{
+		Integrated: 10 * math.Log10(energy/weight),
+		TruePeak:   truePeak,
+	}
+}
+
+func (c *Client) resolveReplayGain(
+	trackCtx utils.TrackLogContext,
+	track model.Track,
+	audioPath string,
+	options DownloadOptions,
+	spec artifactSpec,
+) *replayGain {
+	if !options.ReplayGain {
+		return nil
+	}
+
+	if track.R128 != nil {
+		gain := replayGainFromR128(*track.R128, options.AlbumLoudness)
+		c.logReplayGain(trackCtx, spec, gain)
+		return gain
+	}
+
+	if spec.LoudnessAnalyzer == nil {
+		c.logTrack(slog.LevelInfo, trackCtx, "replaygain skipped",
+			"stage", "replaygain",
+			"reason", "no_loudness_data",
+			"format", spec.Format,
+		)
+		return nil
+	}
+
+	result, err := spec.LoudnessAnalyzer(audioPath)
+	var gain *replayGain
+	if err == nil {
+		gain, err = replayGainFromAnalysis(result)
+	}
+	if err != nil {
+		c.logTrack(slog.LevelWarn, trackCtx, "replaygain analysis ignored",
+			"stage", "replaygain",
+			"format", spec.Format,
+			"error", err,
+		)
+		return nil
+	}
+
+	c.logReplayGain(trackCtx, spec, gain)
+	return gain
+}
+
+func (c *Client) logReplayGain(trackCtx utils.TrackLogContext, spec artifactSpec, gain *replayGain) {
+	c.logTrack(slog.LevelInfo, trackCtx, "replaygain resolved",
+		"stage", "replaygain",
+		"format", spec.Format,
+		"source", gain.Source,
+		"track_gain", formatReplayGainDB(gain.TrackGain),
+		"album_gain_available", gain.HasAlbum,
+	)
+}
@@ -0,0 +1,215 @@
+package ya
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"ya-music/utils"
+	"ya-music/ya/loudness"
+	"ya-music/ya/model"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/go-flac/flacvorbis"
+	flac "github.com/go-flac/go-flac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayGainFromR128UsesReferenceLoudness(t *testing.T) {
+	gain := replayGainFromR128(
+		model.R128{Integrated: -9.5, TruePeak: -0.3},
+		&model.R128{Integrated: -11.25, TruePeak: 0.5},
+	)
+
+	assert.Equal(t, []replayGainField{
+		{Key: "REPLAYGAIN_TRACK_GAIN", Value: "-8.50 dB"},
+		{Key: "REPLAYGAIN_TRACK_PEAK", Value: "0.966051"},
+		{Key: "REPLAYGAIN_ALBUM_GAIN", Value: "-6.75 dB"},
+		{Key: "REPLAYGAIN_ALBUM_PEAK", Value: "1.059254"},
+	}, gain.fields())
+	assert.Equal(t, replayGainSourceAPI, gain.Source)
+}
+
+func TestReplayGainFieldsOmitAlbumWhenUnknown(t *testing.T) {
+	gain := replayGainFromR128(model.R128{Integrated: -20, TruePeak: -6}, nil)
+
+	assert.Equal(t, []replayGainField{
+		{Key: "REPLAYGAIN_TRACK_GAIN", Value: "+2.00 dB"},
+		{Key: "REPLAYGAIN_TRACK_PEAK", Value: "0.501187"},
+	}, gain.fields())
+
+	var missing *replayGain
+	assert.Nil(t, missing.fields())
+}
+
+func TestReplayGainFromAnalysisRejectsSilence(t *testing.T) {
+	_, err := replayGainFromAnalysis(loudness.Result{IntegratedLUFS: math.Inf(-1)})
+	assert.Error(t, err)
+
+	gain, err := replayGainFromAnalysis(loudness.Result{IntegratedLUFS: -14, SamplePeak: 0.9})
+	require.NoError(t, err)
+	assert.InDelta(t, -4.0, gain.TrackGain, 1e-9)
+	assert.Equal(t, 0.9, gain.TrackPeak)
+	assert.False(t, gain.HasAlbum)
+}
+
+func TestAlbumLoudnessCombinesOnlyCompleteAlbums(t *testing.T) {
+	albumTrack := func(id, albumID string, count int, r128 *model.R128) model.Track {
+		return model.Track{
+			ID:         model.FlexibleID(id),
+			DurationMs: 1000,
+			R128:       r128,
+			Albums:     []model.Album{{ID: model.FlexibleID(albumID), TrackCount: count}},
+		}
+	}
+
+	tracks := []model.Track{
+		albumTrack("1", "complete", 2, &model.R128{Integrated: -10, TruePeak: -1}),
+		albumTrack("2", "complete", 2, &model.R128{Integrated: -20, TruePeak: 0.2}),
+		albumTrack("3", "partial", 3, &model.R128{Integrated: -10, TruePeak: -1}),
+		albumTrack("4", "missing-loudness", 1, nil),
+		albumTrack("1", "complete", 2, &model.R128{Integrated: -10, TruePeak: -1}),
+	}
+
+	albums := AlbumLoudness(tracks)
+
+	require.Len(t, albums, 1)
+	combined := albums["complete"]
+	assert.InDelta(t, 10*math.Log10((math.Pow(10, -1)+math.Pow(10, -2))/2), combined.Integrated, 1e-9)
+	assert.Equal(t, 0.2, combined.TruePeak)
+}
+
+func TestPublishAudioArtifactPassesReplayGainFromAPI(t *testing.T) {
+	dir := t.TempDir()
+	destination := filepath.Join(dir, "track.mp3")
+	var got *replayGain
+	tagger := &recordingArtifactTagger{onWrite: func(_ string, metadata artifactMetadata) {
+		got = metadata.ReplayGain
+	}}
+	spec := testArtifactSpec(tagger, metadataRequired)
+	spec.LoudnessAnalyzer = func(string) (loudness.Result, error) {
+		t.Fatal("analysis must not run when the API reports loudness")
+		return loudness.Result{}, nil
+	}
+
+	track := model.Track{ID: "1", Title: "Song", R128: &model.R128{Integrated: -8, TruePeak: -1}}
+	client := NewClient(utils.NewHttpClient())
+	_, err := client.publishAudioArtifact(context.Background(), track, destination, DownloadOptions{
+		SkipCover:     true,
+		ReplayGain:    true,
+		AlbumLoudness: &model.R128{Integrated: -9, TruePeak: 0},
+	}, spec, writeAudioBytes(testAudioPayload))
+
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.InDelta(t, -10.0, got.TrackGain, 1e-9)
+	assert.True(t, got.HasAlbum)
+	assert.InDelta(t, -9.0, got.AlbumGain, 1e-9)
+}
+
+func TestPublishAudioArtifactAnalyzesAudioWithoutAPILoudness(t *testing.T) {
+	dir := t.TempDir()
+	destination := filepath.Join(dir, "track.flac")
+	var got *replayGain
+	tagger := &recordingArtifactTagger{onWrite: func(_ string, metadata artifactMetadata) {
+		got = metadata.ReplayGain
+	}}
+	var analyzedPath string
+	spec := testArtifactSpec(tagger, metadataRequired)
+	spec.LoudnessAnalyzer = func(path string) (loudness.Result, error) {
+		analyzedPath = path
+		return loudness.Result{IntegratedLUFS: -12, SamplePeak: 0.75}, nil
+	}
+
+	client := NewClient(utils.NewHttpClient())
+	_, err := client.publishAudioArtifact(context.Background(), model.Track{ID: "1", Title: "Song"}, destination,
+		DownloadOptions{SkipCover: true, ReplayGain: true}, spec, writeAudioBytes(testAudioPayload))
+
+	require.NoError(t, err)
+	assert.Contains(t, analyzedPath, ".artifact-")
+	require.NotNil(t, got)
+	assert.Equal(t, replayGainSourceAnalysis, got.Source)
+	assert.InDelta(t, -6.0, got.TrackGain, 1e-9)
+	assert.Equal(t, 0.75, got.TrackPeak)
+}
+
+func TestPublishAudioArtifactKeepsTrackWhenReplayGainAnalysisFails(t *testing.T) {
+	dir := t.TempDir()
+	destination := filepath.Join(dir, "track.flac")
+	got := &replayGain{}
+	tagger := &recordingArtifactTagger{onWrite: func(_ string, metadata artifactMetadata) {
+		got = metadata.ReplayGain
+	}}
+	spec := testArtifactSpec(tagger, metadataRequired)
+	spec.LoudnessAnalyzer = func(string) (loudness.Result, error) {
+		return loudness.Result{}, errors.New("decode failed")
+	}
+
+	client := NewClient(utils.NewHttpClient())
+	_, err := client.publishAudioArtifact(context.Background(), model.Track{ID: "1", Title: "Song"}, destination,
+		DownloadOptions{SkipCover: true, ReplayGain: true}, spec, writeAudioBytes(testAudioPayload))
+
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	assert.FileExists(t, destination)
+}
+
+func TestPublishAudioArtifactSkipsReplayGainByDefault(t *testing.T) {
+	dir := t.TempDir()
+	got := &replayGain{}
+	tagger := &recordingArtifactTagger{onWrite: func(_ string, metadata artifactMetadata) {
+		got = metadata.ReplayGain
+	}}
+
+	client := NewClient(utils.NewHttpClient())
+	track := model.Track{ID: "1", Title: "Song", R128: &model.R128{Integrated: -8}}
+	_, err := client.publishAudioArtifact(context.Background(), track, filepath.Join(dir, "track.mp3"),
+		DownloadOptions{SkipCover: true}, testArtifactSpec(tagger, metadataRequired), writeAudioBytes(testAudioPayload))
+
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestWriteReplayGainTagsForMP3AndFLAC(t *testing.T) {
+	dir := t.TempDir()
+	gain := replayGainFromR128(model.R128{Integrated: -9.5, TruePeak: -0.3}, nil)
+	track := model.Track{ID: "1", Title: "Song"}
+
+	mp3Path := filepath.Join(dir, "track.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", gain))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", gain))
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tag.Close()
+	values := map[string]string{}
+	for _, frame := range tag.GetFrames(tag.CommonID("User defined text information frame")) {
+		udtf, ok := frame.(id3v2.UserDefinedTextFrame)
+		require.True(t, ok)
+		values[udtf.Description] = udtf.Value
+	}
+	assert.Equal(t, map[string]string{
+		"REPLAYGAIN_TRACK_GAIN": "-8.50 dB",
+		"REPLAYGAIN_TRACK_PEAK": "0.966051",
+	}, values)
+
+	flacPath := filepath.Join(dir, "track.flac")
+	require.NoError(t, os.WriteFile(flacPath, minimalFLACBytes(), 0644))
+	require.NoError(t, writeFLACTags(flacPath, track, "", gain))
+
+	file, err := flac.ParseFile(flacPath)
+	require.NoError(t, err)
+	for _, block := range file.Meta {
+		if block.Type != flac.VorbisComment {
+			continue
+		}
+		comments, err := flacvorbis.ParseFromMetaDataBlock(*block)
+		require.NoError(t, err)
+		assertFLACComment(t, comments, "REPLAYGAIN_TRACK_GAIN", "-8.50 dB")
+		assertFLACComment(t, comments, "REPLAYGAIN_TRACK_PEAK", "0.966051")
+	}
+}
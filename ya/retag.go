@@ -0,0 +1,213 @@
+package ya
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"ya-music/ya/model"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/go-flac/flacvorbis"
+	flac "github.com/go-flac/go-flac"
+	"github.com/tommyo123/mtag"
+)
+
+// ErrNoSourceTrackID reports an audio file without the Yandex track ID that
+// yamdl writes while tagging.
+var ErrNoSourceTrackID = errors.New("no Yandex track ID in tags")
+
+// RetagFormat returns the audio format retag supports for path, based on its
+// extension.
+func RetagFormat(path string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return "mp3", true
+	case ".flac":
+		return "flac", true
+	case ".m4a":
+		return "m4a", true
+	default:
+		return "", false
+	}
+}
+
+// ReadSourceTrackID returns the Yandex track ID stored in the tags of an audio
+// file written by this downloader.
+func ReadSourceTrackID(path string) (string, error) {
+	format, ok := RetagFormat(path)
+	if !ok {
+		return "", fmt.Errorf("unsupported audio file: %s", filepath.Base(path))
+	}
+
+	var (
+		trackID string
+		err     error
+	)
+	switch format {
+	case "mp3":
+		trackID, err = readID3SourceTrackID(path)
+	case "flac":
+		trackID, err = readFLACSourceTrackID(path)
+	case "m4a":
+		trackID, err = readM4ASourceTrackID(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	if trackID == "" {
+		return "", ErrNoSourceTrackID
+	}
+	return trackID, nil
+}
+
+func readID3SourceTrackID(path string) (string, error) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return "", fmt.Errorf("read ID3 tags: %w", err)
+	}
+	defer tag.Close()
+
+	for _, frame := range tag.GetFrames(tag.CommonID("Unique file identifier")) {
+		ufid, ok := frame.(id3v2.UFIDFrame)
+		if ok && ufid.OwnerIdentifier == yandexTrackOwnerIdentifier {
+			if trackID := strings.TrimSpace(string(ufid.Identifier)); trackID != "" {
+				return trackID, nil
+			}
+		}
+	}
+	for _, frame := range tag.GetFrames(tag.CommonID("Comments")) {
+		comment, ok := frame.(id3v2.CommentFrame)
+		if ok && comment.Description == yandexSourceURLCommentDescription {
+			return trackIDFromSourceURL(comment.Text), nil
+		}
+	}
+	return "", nil
+}
+
+func readFLACSourceTrackID(path string) (string, error) {
+	file, err := flac.ParseFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read FLAC metadata: %w", err)
+	}
+
+	for _, block := range file.Meta {
+		if block.Type != flac.VorbisComment {
+			continue
+		}
+		comments, err := flacvorbis.ParseFromMetaDataBlock(*block)
+		if err != nil {
+			return "", fmt.Errorf("read FLAC comments: %w", err)
+		}
+		if values, err := comments.Get("YANDEX_TRACK_ID"); err == nil && len(values) > 0 {
+			if trackID := strings.TrimSpace(values[0]); trackID != "" {
+				return trackID, nil
+			}
+		}
+		if values, err := comments.Get("COMMENT"); err == nil {
+			for _, value := range values {
+				if trackID := trackIDFromSourceURL(value); trackID != "" {
+					return trackID, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
+
+func readM4ASourceTrackID(path string) (string, error) {
+	file, err := mtag.Open(path, mtag.WithReadOnly())
+	if err != nil {
+		return "", fmt.Errorf("read M4A metadata: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return trackIDFromSourceURL(file.CustomValue(m4aSourceURLField)), nil
+}
+
+// trackIDFromSourceURL extracts the track ID from a URL built by yandexTrackURL.
+func trackIDFromSourceURL(sourceURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(sourceURL))
+	if err != nil || !strings.Contains(parsed.Host, "music.yandex.") {
+		return ""
+	}
+
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	for i := len(parts) - 2; i >= 0; i-- {
+		if parts[i] == "track" {
+			return strings.TrimSpace(parts[i+1])
+		}
+	}
+	return ""
+}
+
+func (c *Client) RetagFile(path string, track model.Track, options DownloadOptions) error {
+	return c.RetagFileContext(c.cancelContext(), path, track, options)
+}
+
+// RetagFileContext rewrites the tags of an existing audio file from track
+// metadata. The file is copied, tagged, and renamed over the original so an
+// interrupted or failed retag leaves the previous file untouched.
+func (c *Client) RetagFileContext(ctx context.Context, path string, track model.Track, options DownloadOptions) error {
+	format, ok := RetagFormat(path)
+	if !ok {
+		return fmt.Errorf("unsupported audio file: %s", filepath.Base(path))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("inspect audio file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("not a regular file: %s", path)
+	}
+
+	var spec artifactSpec
+	switch format {
+	case "mp3":
+		spec = c.mp3ArtifactSpec()
+	case "flac":
+		spec = flacArtifactSpec()
+	case "m4a":
+		spec = c.m4aArtifactSpec()
+	}
+	spec.DownloadStage = "retag_copy"
+	spec.CompletionStage = "retag_complete"
+	// A retag that cannot write tags has nothing to publish.
+	spec.FailurePolicy = metadataRequired
+
+	_, err = c.publishAudioArtifact(ctx, track, path, options, spec, func(tempPath string) error {
+		return copyAudioFile(path, tempPath, info.Mode().Perm())
+	})
+	return err
+}
+
+func copyAudioFile(source, destination string, perm os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("open audio file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("open retag temp file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("copy audio file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close retag temp file: %w", err)
+	}
+	// CreateTemp files are 0600; keep the original permissions after rename.
+	if err := os.Chmod(destination, perm); err != nil {
+		return fmt.Errorf("restore file permissions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package ya
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"ya-music/utils"
+	"ya-music/ya/model"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackIDFromSourceURL(t *testing.T) {
+	tests := map[string]string{
+		"https://music.yandex.ru/album/456/track/123": "123",
+		"https://music.yandex.ru/track/99":            "99",
+		"https://music.yandex.com/track/7?utm=x":      "7",
+		"https://example.com/track/1":                 "",
+		"https://music.yandex.ru/album/456":           "",
+		"not a url":                                   "",
+	}
+	for sourceURL, want := range tests {
+		assert.Equal(t, want, trackIDFromSourceURL(sourceURL), sourceURL)
+	}
+}
+
+func TestReadSourceTrackIDFromWrittenTags(t *testing.T) {
+	dir := t.TempDir()
+	track := model.Track{ID: "123", Title: "Song", Albums: []model.Album{{ID: "456"}}}
+
+	mp3Path := filepath.Join(dir, "track.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+	trackID, err := ReadSourceTrackID(mp3Path)
+	require.NoError(t, err)
+	assert.Equal(t, "123", trackID)
+
+	flacPath := filepath.Join(dir, "track.flac")
+	require.NoError(t, os.WriteFile(flacPath, minimalFLACBytes(), 0644))
+	require.NoError(t, writeFLACTags(flacPath, track, "", nil))
+	trackID, err = ReadSourceTrackID(flacPath)
+	require.NoError(t, err)
+	assert.Equal(t, "123", trackID)
+}
+
+func TestReadSourceTrackIDFallsBackToID3SourceURL(t *testing.T) {
+	mp3Path := filepath.Join(t.TempDir(), "track.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	tag.SetVersion(4)
+	tag.AddCommentFrame(id3v2.CommentFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		Language:    "eng",
+		Description: yandexSourceURLCommentDescription,
+		Text:        "https://music.yandex.ru/album/1/track/42",
+	})
+	require.NoError(t, tag.Save())
+	require.NoError(t, tag.Close())
+
+	trackID, err := ReadSourceTrackID(mp3Path)
+	require.NoError(t, err)
+	assert.Equal(t, "42", trackID)
+}
+
+func TestReadSourceTrackIDReportsUntaggedAndUnsupportedFiles(t *testing.T) {
+	dir := t.TempDir()
+	mp3Path := filepath.Join(dir, "untagged.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+
+	_, err := ReadSourceTrackID(mp3Path)
+	assert.ErrorIs(t, err, ErrNoSourceTrackID)
+
+	_, err = ReadSourceTrackID(filepath.Join(dir, "cover.jpg"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNoSourceTrackID)
+}
+
+func TestRetagFileRewritesTagsInPlaceAndKeepsPermissions(t *testing.T) {
+	dir := t.TempDir()
+	mp3Path := filepath.Join(dir, "track.mp3")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0640))
+	require.NoError(t, writeID3Tags(mp3Path, model.Track{ID: "123", Title: "Old"}, "", nil))
+
+	client := NewClient(utils.NewHttpClient())
+	track := model.Track{ID: "123", Title: "New", Artists: []model.Artist{{Name: "Artist"}}}
+	require.NoError(t, client.RetagFile(mp3Path, track, DownloadOptions{SkipCover: true}))
+
+	tag, err := id3v2.Open(mp3Path, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tag.Close()
+	assert.Equal(t, "New", tag.Title())
+	assert.Equal(t, "Artist", tag.Artist())
+
+	info, err := os.Stat(mp3Path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	assertNoArtifactTempFiles(t, dir)
+}
+
+func TestRetagFileLeavesOriginalWhenTaggingFails(t *testing.T) {
+	dir := t.TempDir()
+	flacPath := filepath.Join(dir, "track.flac")
+	original := []byte("not a flac file")
+	require.NoError(t, os.WriteFile(flacPath, original, 0644))
+
+	client := NewClient(utils.NewHttpClient())
+	err := client.RetagFile(flacPath, model.Track{ID: "1", Title: "Song"}, DownloadOptions{SkipCover: true})
+
+	require.Error(t, err)
+	data, readErr := os.ReadFile(flacPath)
+	require.NoError(t, readErr)
+	assert.Equal(t, original, data)
+	assertNoArtifactTempFiles(t, dir)
+}
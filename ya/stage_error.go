@@ -0,0 +1,54 @@
+package ya
+
+import (
+	"errors"
+	"strings"
+)
+
+// StageError carries the download stage that failed, as logged to the
+// download log, and the class of the failure. Its message is the wrapped
+// error's message.
+type StageError struct {
+	Stage string
+	// Kind is one of the sentinel errors such as ErrAuthExpired, or nil when
+	// the cause is unknown.
+	Kind error
+	Err  error
+}
+
+func (e *StageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of e, so errors.Is(err, ErrDiskFull)
+// works for classified failures.
+func (e *StageError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// FailureStage returns the stage recorded in err, or "" when unknown.
+func FailureStage(err error) string {
+	var staged *StageError
+	if errors.As(err, &staged) {
+		return staged.Stage
+	}
+	return ""
+}
+
+// withStage tags err with stage unless an inner error already names the more
+// specific stage that failed. Failures of tagging stages that have no other
+// known cause are tag write failures.
+func withStage(stage string, err error) error {
+	if err == nil || FailureStage(err) != "" {
+		return err
+	}
+	kind := Classify(err)
+	if kind == nil && strings.HasSuffix(stage, "_tags") {
+		kind = ErrTagWrite
+	}
+	return &StageError{Stage: stage, Kind: kind, Err: err}
+}
@@ -0,0 +1,22 @@
+package ya
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithStageKeepsMessageAndInnermostStage(t *testing.T) {
+	cause := errors.New("boom")
+	inner := withStage("lossless_remux", cause)
+	outer := withStage("lossless_download", fmt.Errorf("failed: %w", inner))
+
+	assert.Equal(t, "boom", inner.Error())
+	assert.Equal(t, "failed: boom", outer.Error())
+	assert.Equal(t, "lossless_remux", FailureStage(outer))
+	assert.ErrorIs(t, outer, cause)
+	assert.Empty(t, FailureStage(cause))
+	assert.NoError(t, withStage("precheck", nil))
+}
@@ -0,0 +1,214 @@
+package ya
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"ya-music/utils"
+	"ya-music/ya/model"
+)
+
+// DefaultFFmpegPath is used when DownloadOptions.FFmpegPath is empty.
+const DefaultFFmpegPath = "ffmpeg"
+
+// errTranscodeFailed marks conversion errors, which must not fall back to an
+// MP3 download because the lossless source itself was fine.
+var errTranscodeFailed = errors.New("transcode failed")
+
+// TranscodeProfile converts a downloaded file with an external ffmpeg before
+// it is published.
+type TranscodeProfile struct {
+	Name string `json:"name"`
+	// Extension of the converted file, such as ".opus".
+	Extension string `json:"extension"`
+	// Args are ffmpeg output options placed between the input and the output
+	// file, for example ["-c:a", "libopus", "-b:a", "160k"].
+	Args []string `json:"args"`
+	// Sources lists the downloaded formats (mp3, flac, m4a) to convert; other
+	// downloads are published unchanged. Empty means flac and m4a.
+	Sources []string `json:"sources,omitempty"`
+	// KeepOriginal publishes the downloaded file next to the converted one.
+	// The original is still published when the conversion fails.
+	KeepOriginal bool `json:"keep_original,omitempty"`
+}
+
+var defaultTranscodeSources = []string{"flac", "m4a"}
+
+// BuiltinTranscodeProfiles returns the profiles available without a profile
+// file. Audio streams and tags are copied by ffmpeg; cover art and tags are
+// then written again by the regular taggers for MP3 and M4A. Opus has no
+// tagger, so it keeps only the text tags ffmpeg copied and no cover.
+func BuiltinTranscodeProfiles() []TranscodeProfile {
+	audioOnly := []string{"-map", "0:a", "-map_metadata", "0"}
+	return []TranscodeProfile{
+		{Name: "opus", Extension: ".opus", Args: append(append([]string{}, audioOnly...), "-c:a", "libopus", "-b:a", "160k")},
+		{Name: "mp3-320", Extension: ".mp3", Args: append(append([]string{}, audioOnly...), "-c:a", "libmp3lame", "-b:a", "320k")},
+		{Name: "alac", Extension: ".m4a", Args: append(append([]string{}, audioOnly...), "-c:a", "alac")},
+	}
+}
+
+// Validate reports profiles that cannot produce a file.
+func (p TranscodeProfile) Validate() error {
+	name := strings.TrimSpace(p.Name)
+	if name == "" {
+		return errors.New("transcode profile name is required")
+	}
+	extension := strings.TrimSpace(p.Extension)
+	if !strings.HasPrefix(extension, ".") || len(extension) < 2 || strings.ContainsAny(extension, `/\`) {
+		return fmt.Errorf("transcode profile %q: extension must look like .opus", name)
+	}
+	for _, source := range p.Sources {
+		switch strings.ToLower(strings.TrimSpace(source)) {
+		case "mp3", "flac", "m4a":
+		default:
+			return fmt.Errorf("transcode profile %q: unknown source format %q", name, source)
+		}
+	}
+	return nil
+}
+
+// appliesTo reports whether downloads of format are converted by p.
+func (p *TranscodeProfile) appliesTo(format string) bool {
+	if p == nil {
+		return false
+	}
+	sources := p.Sources
+	if len(sources) == 0 {
+		sources = defaultTranscodeSources
+	}
+	for _, source := range sources {
+		if strings.EqualFold(strings.TrimSpace(source), format) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *TranscodeProfile) extension() string {
+	return strings.ToLower(strings.TrimSpace(p.Extension))
+}
+
+// transcodeTarget is the published path of a converted file, so existing
+// conversions are skipped like existing downloads.
+func transcodeTarget(track model.Track, outputDir string, options DownloadOptions) (string, bool) {
+	if options.Transcode == nil {
+		return "", false
+	}
+	return buildTrackFilenameWithExtension(track, outputDir, options.Transcode.extension(), options.FilenameSuffix), true
+}
+
+// transcodeArtifact converts the staged, tagged source into the profile's
+// container next to destination and publishes it.
+func (c *Client) transcodeArtifact(
+	ctx context.Context,
+	trackCtx utils.TrackLogContext,
+	source string,
+	destination string,
+	options DownloadOptions,
+	metadata artifactMetadata,
+) (string, error) {
+	profile := options.Transcode
+	extension := profile.extension()
+	target := strings.TrimSuffix(destination, filepath.Ext(destination)) + extension
+
+	tempFile, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".transcode-*"+extension)
+	if err != nil {
+		return "", fmt.Errorf("error creating transcode temp file: %w", err)
+	}
+	tempFilename := tempFile.Name()
+	defer func() {
+		_ = os.Remove(tempFilename)
+	}()
+	if err := tempFile.Close(); err != nil {
+		return "", fmt.Errorf("error closing transcode temp file: %w", err)
+	}
+
+	c.logTrack(slog.LevelInfo, trackCtx, "transcode started",
+		"stage", "transcode",
+		"profile", profile.Name,
+		"filename", target,
+	)
+	if err := c.runFFmpeg(ctx, options.FFmpegPath, source, tempFilename, profile.Args); err != nil {
+		c.logTrackFailure(trackCtx, "transcode", err,
+			"profile", profile.Name,
+			"filename", target,
+		)
+		return "", withStage("transcode", err)
+	}
+
+	if tagger, policy := c.taggerForExtension(extension); tagger != nil {
+		if err := tagger.Write(tempFilename, metadata); err != nil {
+			if policy == metadataRequired {
+				c.logTrackFailure(trackCtx, "transcode_tags", err,
+					"profile", profile.Name,
+					"filename", target,
+				)
+				return "", withStage("transcode_tags", fmt.Errorf("failed to write %s tags after transcode: %w", strings.TrimPrefix(extension, "."), err))
+			}
+			c.logTrack(slog.LevelWarn, trackCtx, "transcode metadata skipped; keeping audio",
+				"stage", "transcode_tags",
+				"filename", target,
+				"error", err,
+			)
+		}
+	}
+
+	if err := os.Rename(tempFilename, target); err != nil {
+		c.logTrackFailure(trackCtx, "transcode", err,
+			"profile", profile.Name,
+			"filename", target,
+		)
+		return "", withStage("transcode", fmt.Errorf("failed to publish transcoded file: %w", err))
+	}
+	c.logTrack(slog.LevelInfo, trackCtx, "transcode complete",
+		"stage", "transcode",
+		"profile", profile.Name,
+		"filename", target,
+		"keep_original", profile.KeepOriginal,
+	)
+	return target, nil
+}
+
+func (c *Client) runFFmpeg(ctx context.Context, ffmpegPath, input, output string, args []string) error {
+	if strings.TrimSpace(ffmpegPath) == "" {
+		ffmpegPath = DefaultFFmpegPath
+	}
+	commandArgs := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y", "-i", input}
+	commandArgs = append(commandArgs, args...)
+	commandArgs = append(commandArgs, output)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpegPath, commandArgs...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("ffmpeg failed: %w", ctx.Err())
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("ffmpeg failed: %w: %s", err, message)
+		}
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
+
+// taggerForExtension returns the tagger that rewrites tags of a converted
+// file. Containers without a tagger keep the tags ffmpeg copied.
+func (c *Client) taggerForExtension(extension string) (artifactTagger, metadataFailurePolicy) {
+	switch extension {
+	case ".mp3":
+		return c.mp3Tags(), metadataRequired
+	case ".flac":
+		return flacArtifactTagger{}, metadataRequired
+	case ".m4a", ".mp4":
+		return m4aArtifactTagger{client: c}, metadataBestEffort
+	default:
+		return nil, metadataBestEffort
+	}
+}
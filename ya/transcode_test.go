@@ -0,0 +1,162 @@
+package ya
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"ya-music/ya/lossless"
+
+	"github.com/bogem/id3v2/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFakeFFmpeg installs a script that copies the input to the output and
+// records its arguments, or fails when fail is set.
+func writeFakeFFmpeg(t *testing.T, fail bool) (path string, argsLog string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg is a POSIX shell script")
+	}
+	dir := t.TempDir()
+	path = filepath.Join(dir, "ffmpeg")
+	argsLog = filepath.Join(dir, "args.txt")
+	script := `#!/bin/sh
+echo "$@" > "` + argsLog + `"
+`
+	if fail {
+		script += "echo 'Unknown encoder' >&2\nexit 1\n"
+	} else {
+		script += `in=""
+prev=""
+for arg in "$@"; do
+  if [ "$prev" = "-i" ]; then in="$arg"; fi
+  prev="$arg"
+  out="$arg"
+done
+cp "$in" "$out"
+`
+	}
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+	return path, argsLog
+}
+
+func transcodeTestOptions(ffmpeg string, profile TranscodeProfile) DownloadOptions {
+	return DownloadOptions{SkipCover: true, AudioFormat: AudioFormatFLAC, Transcode: &profile, FFmpegPath: ffmpeg}
+}
+
+func newFLACTranscodeClient(t *testing.T) *Client {
+	return newUpgradeTestClient(t, &fakeLosslessDownloader{
+		info: lossless.DownloadInfo{Quality: "lossless", Codec: "flac", Bitrate: 1411},
+		data: minimalFLACBytes(),
+	})
+}
+
+func TestDownloadTranscodesFLACAndDiscardsOriginal(t *testing.T) {
+	ffmpeg, argsLog := writeFakeFFmpeg(t, false)
+	outputDir := t.TempDir()
+	client := newFLACTranscodeClient(t)
+	profile := BuiltinTranscodeProfiles()[0]
+
+	filename, err := client.DownloadTrackWithOptions(upgradeTestTrack(), outputDir, transcodeTestOptions(ffmpeg, profile))
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Song.opus"), filename)
+	assert.FileExists(t, filename)
+	assert.NoFileExists(t, filepath.Join(outputDir, "Artist - Song.flac"))
+	args, err := os.ReadFile(argsLog)
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "-c:a libopus -b:a 160k")
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestDownloadTranscodeKeepsOriginalAndRetagsMP3(t *testing.T) {
+	ffmpeg, _ := writeFakeFFmpeg(t, false)
+	outputDir := t.TempDir()
+	client := newFLACTranscodeClient(t)
+	profile := BuiltinTranscodeProfiles()[1]
+	profile.KeepOriginal = true
+
+	filename, err := client.DownloadTrackWithOptions(upgradeTestTrack(), outputDir, transcodeTestOptions(ffmpeg, profile))
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Song.mp3"), filename)
+	assert.FileExists(t, filepath.Join(outputDir, "Artist - Song.flac"))
+	tag, err := id3v2.Open(filename, id3v2.Options{Parse: true})
+	require.NoError(t, err)
+	defer tag.Close()
+	assert.Equal(t, "Song", tag.Title())
+	assert.Equal(t, "Artist", tag.Artist())
+}
+
+func TestDownloadTranscodeFailureLeavesNoFiles(t *testing.T) {
+	ffmpeg, _ := writeFakeFFmpeg(t, true)
+	outputDir := t.TempDir()
+	client := newFLACTranscodeClient(t)
+
+	_, err := client.DownloadTrackWithOptions(upgradeTestTrack(), outputDir, transcodeTestOptions(ffmpeg, BuiltinTranscodeProfiles()[0]))
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unknown encoder")
+	entries, err := os.ReadDir(outputDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestDownloadTranscodeFailureKeepsRequestedOriginal(t *testing.T) {
+	ffmpeg, _ := writeFakeFFmpeg(t, true)
+	outputDir := t.TempDir()
+	client := newFLACTranscodeClient(t)
+	profile := BuiltinTranscodeProfiles()[0]
+	profile.KeepOriginal = true
+
+	filename, err := client.DownloadTrackWithOptions(upgradeTestTrack(), outputDir, transcodeTestOptions(ffmpeg, profile))
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Song.flac"), filename)
+	assert.FileExists(t, filename)
+	assert.NoFileExists(t, filepath.Join(outputDir, "Artist - Song.opus"))
+}
+
+func TestDownloadSkipsExistingTranscodedFile(t *testing.T) {
+	outputDir := t.TempDir()
+	target := filepath.Join(outputDir, "Artist - Song.opus")
+	require.NoError(t, os.WriteFile(target, []byte("opus"), 0644))
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{infoErr: errors.New("must not download")})
+
+	filename, err := client.DownloadTrackWithOptions(upgradeTestTrack(), outputDir, transcodeTestOptions("ffmpeg", BuiltinTranscodeProfiles()[0]))
+
+	assert.ErrorIs(t, err, ErrTrackAlreadyExists)
+	assert.Equal(t, target, filename)
+}
+
+func TestTranscodeProfileSourcesAndValidation(t *testing.T) {
+	profile := &TranscodeProfile{Name: "opus", Extension: ".opus"}
+	assert.True(t, profile.appliesTo("flac"))
+	assert.True(t, profile.appliesTo("m4a"))
+	assert.False(t, profile.appliesTo("mp3"))
+	assert.False(t, (*TranscodeProfile)(nil).appliesTo("flac"))
+
+	profile.Sources = []string{"MP3"}
+	assert.True(t, profile.appliesTo("mp3"))
+	assert.False(t, profile.appliesTo("flac"))
+
+	for _, profile := range BuiltinTranscodeProfiles() {
+		assert.NoError(t, profile.Validate(), profile.Name)
+	}
+	for _, invalid := range []TranscodeProfile{
+		{Extension: ".opus"},
+		{Name: "x", Extension: "opus"},
+		{Name: "x", Extension: "./a"},
+		{Name: "x", Extension: ".ogg", Sources: []string{"wav"}},
+	} {
+		err := invalid.Validate()
+		assert.Error(t, err)
+		assert.True(t, strings.Contains(err.Error(), "transcode profile"))
+	}
+}
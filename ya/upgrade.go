@@ -0,0 +1,142 @@
+package ya
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"ya-music/utils"
+	"ya-music/ya/model"
+
+	flac "github.com/go-flac/go-flac"
+	"github.com/tommyo123/mtag"
+)
+
+// upgradeExistingMP3 replaces an MP3 previously downloaded for track with a
+// lossless artifact. handled is false when there is no MP3 of the same track
+// to upgrade and the regular download flow should run instead.
+func (c *Client) upgradeExistingMP3(ctx context.Context, track model.Track, outputDir string, options DownloadOptions) (filename string, handled bool, err error) {
+	trackCtx := utils.NewTrackLogContext(track)
+	mp3Filename := buildTrackFilename(track, outputDir, options.FilenameSuffix)
+
+	exists, err := utils.FileExists(mp3Filename)
+	if err != nil {
+		c.logTrackFailure(trackCtx, "upgrade_precheck", err,
+			"filename", mp3Filename,
+		)
+		return "", true, withStage("upgrade_precheck", fmt.Errorf("failed to inspect existing MP3: %w", err))
+	}
+	if !exists {
+		return "", false, nil
+	}
+
+	trackID := strings.TrimSpace(track.ID.String())
+	existingID, err := ReadSourceTrackID(mp3Filename)
+	if err != nil || existingID != trackID {
+		// Never replace a file we cannot prove belongs to this track.
+		c.logTrack(slog.LevelInfo, trackCtx, "upgrade skipped",
+			"stage", "upgrade_precheck",
+			"reason", "track_id_mismatch",
+			"filename", mp3Filename,
+			"existing_track_id", existingID,
+		)
+		return mp3Filename, true, fmt.Errorf("%w: %s", ErrTrackAlreadyExists, mp3Filename)
+	}
+
+	c.logTrack(slog.LevelInfo, trackCtx, "upgrade started",
+		"stage", "upgrade",
+		"filename", mp3Filename,
+	)
+
+	losslessFilename, err := c.downloadTrackLossless(ctx, track, outputDir, options)
+	if err != nil && !errors.Is(err, ErrTrackAlreadyExists) {
+		c.logTrack(slog.LevelWarn, trackCtx, "upgrade skipped; keeping MP3",
+			"stage", "upgrade",
+			"filename", mp3Filename,
+			"error", err,
+		)
+		return mp3Filename, true, fmt.Errorf("%w: %s (lossless unavailable: %v)", ErrTrackAlreadyExists, mp3Filename, err)
+	}
+
+	if err := verifyLosslessArtifact(losslessFilename); err != nil {
+		c.logTrackFailure(trackCtx, "upgrade_verify", err,
+			"filename", losslessFilename,
+		)
+		return losslessFilename, true, withStage("upgrade_verify", fmt.Errorf("lossless upgrade not verified; kept %s: %w", mp3Filename, err))
+	}
+
+	if err := retireUpgradedMP3(mp3Filename, options.UpgradeArchiveDir); err != nil {
+		c.logTrackFailure(trackCtx, "upgrade_retire_mp3", err,
+			"filename", mp3Filename,
+			"archive_dir", options.UpgradeArchiveDir,
+		)
+		return losslessFilename, true, withStage("upgrade_retire_mp3", fmt.Errorf("failed to retire upgraded MP3: %w", err))
+	}
+
+	c.logTrack(slog.LevelInfo, trackCtx, "upgrade complete",
+		"stage", "upgrade",
+		"filename", losslessFilename,
+		"replaced", mp3Filename,
+		"archive_dir", options.UpgradeArchiveDir,
+	)
+	return losslessFilename, true, nil
+}
+
+// verifyLosslessArtifact checks that a published lossless file is non-empty
+// and parses as its container before the MP3 it replaces is removed.
+func verifyLosslessArtifact(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("lossless file is empty: %s", path)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		file, err := flac.ParseFile(path)
+		if err != nil {
+			return fmt.Errorf("parse FLAC: %w", err)
+		}
+		if len(file.Meta) == 0 || file.Meta[0].Type != flac.StreamInfo {
+			return fmt.Errorf("FLAC has no STREAMINFO block")
+		}
+	case ".m4a":
+		file, err := mtag.Open(path, mtag.WithReadOnly())
+		if err != nil {
+			return fmt.Errorf("open M4A: %w", err)
+		}
+		container := file.Container()
+		_ = file.Close()
+		if container != mtag.ContainerMP4 {
+			return fmt.Errorf("unsupported M4A container: %s", container)
+		}
+	default:
+		return fmt.Errorf("unexpected lossless file: %s", path)
+	}
+	return nil
+}
+
+// retireUpgradedMP3 removes path, or moves it into archiveDir when set.
+func retireUpgradedMP3(path, archiveDir string) error {
+	if strings.TrimSpace(archiveDir) == "" {
+		return os.Remove(path)
+	}
+
+	if err := utils.CreateDirIfNotExists(archiveDir); err != nil {
+		return err
+	}
+	destination := filepath.Join(archiveDir, filepath.Base(path))
+	exists, err := utils.FileExists(destination)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("archive file already exists: %s", destination)
+	}
+	return os.Rename(path, destination)
+}
@@ -0,0 +1,139 @@
+package ya
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"ya-music/ya/lossless"
+	"ya-music/ya/model"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func upgradeTestTrack() model.Track {
+	return model.Track{
+		ID:        model.FlexibleID("10"),
+		Title:     "Song",
+		Available: true,
+		Artists:   []model.Artist{{Name: "Artist"}},
+	}
+}
+
+func newUpgradeTestClient(t *testing.T, downloader *fakeLosslessDownloader) *Client {
+	t.Helper()
+	client := NewClient(nil)
+	client.userUID = 1
+	client.losslessDownloader = downloader
+	client.mp3Downloader = func(model.Track, string, DownloadOptions) (string, error) {
+		t.Fatal("upgrade must not download MP3")
+		return "", nil
+	}
+	return client
+}
+
+func writeExistingMP3(t *testing.T, outputDir string, track model.Track) string {
+	t.Helper()
+	mp3Path := buildTrackFilename(track, outputDir, "")
+	require.NoError(t, os.WriteFile(mp3Path, []byte("audio payload"), 0644))
+	require.NoError(t, writeID3Tags(mp3Path, track, "", nil))
+	return mp3Path
+}
+
+func TestUpgradeReplacesTaggedMP3WithFLAC(t *testing.T) {
+	outputDir := t.TempDir()
+	track := upgradeTestTrack()
+	mp3Path := writeExistingMP3(t, outputDir, track)
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{
+		info: lossless.DownloadInfo{Quality: "lossless", Codec: "flac", Bitrate: 1411},
+		data: minimalFLACBytes(),
+	})
+
+	filename, err := client.DownloadTrackWithOptions(track, outputDir, DownloadOptions{SkipCover: true, Upgrade: true})
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Song.flac"), filename)
+	assert.FileExists(t, filename)
+	assert.NoFileExists(t, mp3Path)
+}
+
+func TestUpgradeArchivesReplacedMP3(t *testing.T) {
+	outputDir := t.TempDir()
+	archiveDir := filepath.Join(t.TempDir(), "mp3-archive")
+	track := upgradeTestTrack()
+	mp3Path := writeExistingMP3(t, outputDir, track)
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{
+		info: lossless.DownloadInfo{Quality: "lossless", Codec: "flac", Bitrate: 1411},
+		data: minimalFLACBytes(),
+	})
+
+	_, err := client.DownloadTrackWithOptions(track, outputDir, DownloadOptions{
+		SkipCover:         true,
+		Upgrade:           true,
+		UpgradeArchiveDir: archiveDir,
+	})
+
+	require.NoError(t, err)
+	assert.NoFileExists(t, mp3Path)
+	assert.FileExists(t, filepath.Join(archiveDir, filepath.Base(mp3Path)))
+}
+
+func TestUpgradeKeepsMP3WhenLosslessIsUnavailable(t *testing.T) {
+	outputDir := t.TempDir()
+	track := upgradeTestTrack()
+	mp3Path := writeExistingMP3(t, outputDir, track)
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{infoErr: errors.New("no subscription")})
+
+	filename, err := client.DownloadTrackWithOptions(track, outputDir, DownloadOptions{SkipCover: true, Upgrade: true})
+
+	assert.ErrorIs(t, err, ErrTrackAlreadyExists)
+	assert.Equal(t, mp3Path, filename)
+	assert.FileExists(t, mp3Path)
+}
+
+func TestUpgradeLeavesMP3OfAnotherTrackUntouched(t *testing.T) {
+	outputDir := t.TempDir()
+	track := upgradeTestTrack()
+	other := track
+	other.ID = model.FlexibleID("99")
+	mp3Path := writeExistingMP3(t, outputDir, other)
+	downloader := &fakeLosslessDownloader{}
+	client := newUpgradeTestClient(t, downloader)
+
+	_, err := client.DownloadTrackWithOptions(track, outputDir, DownloadOptions{SkipCover: true, Upgrade: true})
+
+	assert.ErrorIs(t, err, ErrTrackAlreadyExists)
+	assert.FileExists(t, mp3Path)
+	assert.Zero(t, downloader.infoCalls)
+}
+
+func TestUpgradeKeepsMP3WhenExistingLosslessFileIsInvalid(t *testing.T) {
+	outputDir := t.TempDir()
+	track := upgradeTestTrack()
+	mp3Path := writeExistingMP3(t, outputDir, track)
+	flacPath := buildTrackFilenameWithExtension(track, outputDir, ".flac", "")
+	require.NoError(t, os.WriteFile(flacPath, []byte("truncated"), 0644))
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{
+		info: lossless.DownloadInfo{Quality: "lossless", Codec: "flac", Bitrate: 1411},
+	})
+
+	_, err := client.DownloadTrackWithOptions(track, outputDir, DownloadOptions{SkipCover: true, Upgrade: true})
+
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrTrackAlreadyExists)
+	assert.FileExists(t, mp3Path)
+}
+
+func TestUpgradeWithoutExistingMP3DownloadsLossless(t *testing.T) {
+	outputDir := t.TempDir()
+	client := newUpgradeTestClient(t, &fakeLosslessDownloader{
+		info: lossless.DownloadInfo{Quality: "lossless", Codec: "flac", Bitrate: 1411},
+		data: minimalFLACBytes(),
+	})
+
+	filename, err := client.DownloadTrackWithOptions(upgradeTestTrack(), outputDir, DownloadOptions{SkipCover: true, Upgrade: true})
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "Artist - Song.flac"), filename)
+}